@@ -7,6 +7,7 @@ import (
 
 type Cache interface {
 	Set(ctx context.Context, key string, value []byte, expiration time.Duration) error
+	SetNX(ctx context.Context, key string, value []byte, expiration time.Duration) (bool, error) // Only sets the key if it does not already exist
 	Get(ctx context.Context, key string) ([]byte, error)
 	Delete(ctx context.Context, keys ...string) error
 }
@@ -22,6 +22,10 @@ func (cache *RedisCache) Set(ctx context.Context, key string, value []byte, expi
 	return cache.client.Set(ctx, key, value, expiration).Err()
 }
 
+func (cache *RedisCache) SetNX(ctx context.Context, key string, value []byte, expiration time.Duration) (bool, error) {
+	return cache.client.SetNX(ctx, key, value, expiration).Result()
+}
+
 func (cache *RedisCache) Get(ctx context.Context, key string) ([]byte, error) {
 	val, err := cache.client.Get(ctx, key).Bytes()
 	if err != nil {
@@ -11,14 +11,19 @@ import (
 	"github.com/robfig/cron/v3"
 	"github.com/willtrojniak/TabAppBackend/cache"
 	"github.com/willtrojniak/TabAppBackend/db"
+	"github.com/willtrojniak/TabAppBackend/env"
 	"github.com/willtrojniak/TabAppBackend/models"
 	"github.com/willtrojniak/TabAppBackend/services"
 	"github.com/willtrojniak/TabAppBackend/services/auth"
+	"github.com/willtrojniak/TabAppBackend/services/billing"
 	"github.com/willtrojniak/TabAppBackend/services/events"
+	"github.com/willtrojniak/TabAppBackend/services/idempotency"
+	"github.com/willtrojniak/TabAppBackend/services/payments"
 	"github.com/willtrojniak/TabAppBackend/services/reports"
 	"github.com/willtrojniak/TabAppBackend/services/sessions"
 	"github.com/willtrojniak/TabAppBackend/services/shop"
 	"github.com/willtrojniak/TabAppBackend/services/user"
+	"github.com/willtrojniak/TabAppBackend/util"
 )
 
 type APIServer struct {
@@ -56,22 +61,37 @@ func (s *APIServer) Run() error {
 		log.Fatal("Failed to initialize auth handler")
 	}
 
-	shopHandler := shop.NewHandler(s.store, authHandler, sessionManager, s.events, services.HandleHttpError, slog.Default())
+	paymentProvider, err := payments.NewProvider(env.Envs.PAYMENT_PROVIDER, env.Envs.PAYMENT_WEBHOOK_SECRET)
+	if err != nil {
+		log.Fatal("Failed to initialize payment provider: ", err)
+	}
+
+	idempotencyHandler := idempotency.New(sessionStore, time.Hour*24, services.HandleHttpError, slog.Default())
+	// Verification tokens are signed with a key of their own rather than the key encrypting stored tokens
+	verificationKey := util.DeriveKey([]byte(env.Envs.ENCRYPT_SECRET), "verification-token")
+	shopHandler := shop.NewHandler(s.store, authHandler, sessionManager, idempotencyHandler, s.events, paymentProvider, verificationKey, services.HandleHttpError, slog.Default())
 	reportHandler := reports.NewReportHandler(s.store, s.events)
+	billingHandler := billing.NewBillingHandler(s.store, s.events)
 
 	router := http.NewServeMux()
 	v1 := http.NewServeMux()
+	webhooks := http.NewServeMux()
 
 	authHandler.RegisterRoutes(router)
 	userHandler.RegisterRoutes(v1)
 	shopHandler.RegisterRoutes(v1)
+	shopHandler.RegisterWebhookRoutes(webhooks)
+	if fake, ok := paymentProvider.(*payments.FakeProvider); ok {
+		fake.RegisterRoutes(router)
+	}
 
 	router.Handle("/api/v1/", http.StripPrefix("/api/v1", WithMiddleware(
 		sessionManager.RequireAuth)(v1)))
 
-	tz, _ := time.LoadLocation("America/New_York")
-	c := cron.New(cron.WithLocation(tz))
-	c.AddFunc("0 6 * * *", func() {
+	// Runs hourly, reports and scheduled journal exports are only sent to shops where it is currently the report hour.
+	// Billing periods are rolled over on every run so that bills close shortly after midnight in the shop's timezone
+	c := cron.New(cron.WithLocation(time.UTC))
+	c.AddFunc("0 * * * *", func() {
 		slog.Info("Running cron Job")
 		query := models.GetShopsQueryParams{}
 		shops, err := shopHandler.GetShops(context.Background(), &query)
@@ -82,12 +102,25 @@ func (s *APIServer) Run() error {
 		slog.Info("Shops", "count", len(shops))
 		for _, s := range shops {
 			slog.Info("Shop", "id", s.Id)
-			reportHandler.GenerateShopTabOverview(context.Background(), int(s.Id))
+			err := billingHandler.RunShopBilling(context.Background(), int(s.Id))
+			if err != nil {
+				slog.Warn("Error running shop billing", "id", s.Id, "err", err)
+			}
+			reportHandler.GenerateDailyShopTabOverview(context.Background(), int(s.Id))
+			err = reportHandler.GenerateScheduledJournalExport(context.Background(), int(s.Id))
+			if err != nil {
+				slog.Warn("Error running scheduled journal export", "id", s.Id, "err", err)
+			}
 		}
 		slog.Info("Finish cron Job")
 	})
 	c.Start()
 	defer c.Stop()
 
-	return http.ListenAndServe(s.addr, WithMiddleware(RequestLoggerMiddleware, CORSMiddleware, sessionManager.RequireCSRFToken)(router))
+	// Webhooks are called by external services without a session, so are exempt from CSRF checks
+	root := http.NewServeMux()
+	root.Handle("/webhooks/", webhooks)
+	root.Handle("/", sessionManager.RequireCSRFToken(router))
+
+	return http.ListenAndServe(s.addr, WithMiddleware(RequestLoggerMiddleware, CORSMiddleware)(root))
 }
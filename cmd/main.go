@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"log/slog"
+	_ "time/tzdata" // Shop timezones must resolve without system tzdata
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -13,6 +14,7 @@ import (
 	"github.com/willtrojniak/TabAppBackend/cmd/api"
 	"github.com/willtrojniak/TabAppBackend/db"
 	"github.com/willtrojniak/TabAppBackend/env"
+	"github.com/willtrojniak/TabAppBackend/models"
 	"github.com/willtrojniak/TabAppBackend/services/events"
 	"github.com/willtrojniak/TabAppBackend/services/notifications"
 )
@@ -24,6 +26,7 @@ var logLevels = map[string]slog.Level{
 func main() {
 
 	slog.SetLogLoggerLevel(logLevels[env.DEV])
+	models.SetTokenSecret([]byte(env.Envs.ENCRYPT_SECRET))
 
 	databaseURL := fmt.Sprintf("postgres://%v:%v@%v:%v/%v?sslmode=disable", env.Envs.POSTGRES_USER, env.Envs.POSTGRES_PASSWORD, env.Envs.POSTGRES_HOST, env.Envs.POSTGRES_PORT, env.Envs.POSTGRES_DB)
 	pgConfig, err := pgxpool.ParseConfig(databaseURL)
@@ -0,0 +1,11 @@
+ALTER TABLE tab_updates
+  ALTER COLUMN dollar_limit_per_order TYPE REAL USING (dollar_limit_per_order::NUMERIC / 100)::REAL;
+
+ALTER TABLE tabs
+  ALTER COLUMN dollar_limit_per_order TYPE REAL USING (dollar_limit_per_order::NUMERIC / 100)::REAL;
+
+ALTER TABLE item_variants
+  ALTER COLUMN price TYPE REAL USING (price::NUMERIC / 100)::REAL;
+
+ALTER TABLE items
+  ALTER COLUMN base_price TYPE REAL USING (base_price::NUMERIC / 100)::REAL;
@@ -0,0 +1,11 @@
+ALTER TABLE items
+  ALTER COLUMN base_price TYPE BIGINT USING ROUND(base_price::NUMERIC * 100)::BIGINT;
+
+ALTER TABLE item_variants
+  ALTER COLUMN price TYPE BIGINT USING ROUND(price::NUMERIC * 100)::BIGINT;
+
+ALTER TABLE tabs
+  ALTER COLUMN dollar_limit_per_order TYPE BIGINT USING ROUND(dollar_limit_per_order::NUMERIC * 100)::BIGINT;
+
+ALTER TABLE tab_updates
+  ALTER COLUMN dollar_limit_per_order TYPE BIGINT USING ROUND(dollar_limit_per_order::NUMERIC * 100)::BIGINT;
@@ -0,0 +1,38 @@
+CREATE TEMPORARY TABLE _order_variants AS
+  SELECT shop_id, tab_id, bill_id, item_id, variant_id, SUM(quantity)::INT AS quantity
+  FROM order_variants
+  GROUP BY shop_id, tab_id, bill_id, item_id, variant_id;
+
+DELETE FROM order_variants;
+
+ALTER TABLE order_variants
+  DROP CONSTRAINT order_variants_pkey,
+  DROP COLUMN order_item_id,
+  DROP COLUMN name,
+  DROP COLUMN unit_price;
+
+INSERT INTO order_variants SELECT * FROM _order_variants;
+
+ALTER TABLE order_variants
+  ADD PRIMARY KEY(shop_id, tab_id, bill_id, item_id, variant_id);
+
+CREATE TEMPORARY TABLE _order_items AS
+  SELECT shop_id, tab_id, bill_id, item_id, SUM(quantity)::INT AS quantity
+  FROM order_items
+  GROUP BY shop_id, tab_id, bill_id, item_id;
+
+DELETE FROM order_items;
+
+ALTER TABLE order_items
+  DROP CONSTRAINT order_items_pkey,
+  DROP COLUMN id,
+  DROP COLUMN name,
+  DROP COLUMN unit_price;
+
+INSERT INTO order_items SELECT * FROM _order_items;
+
+ALTER TABLE order_items
+  ADD PRIMARY KEY(shop_id, tab_id, bill_id, item_id);
+
+DROP TABLE _order_variants;
+DROP TABLE _order_items;
@@ -0,0 +1,47 @@
+-- Order lines capture the item/variant name and unit price at the time of ordering
+ALTER TABLE order_items
+  ADD COLUMN id SERIAL NOT NULL,
+  ADD COLUMN name VARCHAR(255),
+  ADD COLUMN unit_price BIGINT;
+
+-- Variants previously referenced items without an order line
+INSERT INTO order_items (shop_id, tab_id, bill_id, item_id, quantity)
+SELECT DISTINCT ov.shop_id, ov.tab_id, ov.bill_id, ov.item_id, 0
+FROM order_variants AS ov
+WHERE NOT EXISTS (
+  SELECT 1 FROM order_items AS oi
+  WHERE oi.shop_id = ov.shop_id AND oi.tab_id = ov.tab_id AND oi.bill_id = ov.bill_id AND oi.item_id = ov.item_id
+);
+
+UPDATE order_items SET (name, unit_price) = (items.name, items.base_price)
+FROM items
+WHERE items.shop_id = order_items.shop_id AND items.id = order_items.item_id;
+
+ALTER TABLE order_items
+  ALTER COLUMN name SET NOT NULL,
+  ALTER COLUMN unit_price SET NOT NULL,
+  DROP CONSTRAINT order_items_pkey,
+  ADD PRIMARY KEY(shop_id, tab_id, bill_id, id),
+  ADD UNIQUE(shop_id, tab_id, bill_id, item_id, name, unit_price);
+
+ALTER TABLE order_variants
+  ADD COLUMN order_item_id INT,
+  ADD COLUMN name VARCHAR(255),
+  ADD COLUMN unit_price BIGINT;
+
+UPDATE order_variants SET order_item_id = oi.id
+FROM order_items AS oi
+WHERE oi.shop_id = order_variants.shop_id AND oi.tab_id = order_variants.tab_id
+  AND oi.bill_id = order_variants.bill_id AND oi.item_id = order_variants.item_id;
+
+UPDATE order_variants SET (name, unit_price) = (iv.name, iv.price)
+FROM item_variants AS iv
+WHERE iv.shop_id = order_variants.shop_id AND iv.item_id = order_variants.item_id AND iv.id = order_variants.variant_id;
+
+ALTER TABLE order_variants
+  ALTER COLUMN order_item_id SET NOT NULL,
+  ALTER COLUMN name SET NOT NULL,
+  ALTER COLUMN unit_price SET NOT NULL,
+  DROP CONSTRAINT order_variants_pkey,
+  ADD PRIMARY KEY(shop_id, tab_id, bill_id, order_item_id, variant_id, name, unit_price),
+  ADD FOREIGN KEY(shop_id, tab_id, bill_id, order_item_id) REFERENCES order_items(shop_id, tab_id, bill_id, id) ON DELETE CASCADE;
@@ -0,0 +1,7 @@
+ALTER TABLE tab_updates
+  DROP COLUMN total_dollar_limit,
+  DROP COLUMN dollar_limit_per_bill;
+
+ALTER TABLE tabs
+  DROP COLUMN total_dollar_limit,
+  DROP COLUMN dollar_limit_per_bill;
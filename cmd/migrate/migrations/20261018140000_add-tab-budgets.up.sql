@@ -0,0 +1,7 @@
+ALTER TABLE tabs
+  ADD COLUMN total_dollar_limit BIGINT,
+  ADD COLUMN dollar_limit_per_bill BIGINT;
+
+ALTER TABLE tab_updates
+  ADD COLUMN total_dollar_limit BIGINT,
+  ADD COLUMN dollar_limit_per_bill BIGINT;
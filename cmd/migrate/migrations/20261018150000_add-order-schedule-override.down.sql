@@ -0,0 +1,44 @@
+-- Merge override lines back into their regular counterparts
+CREATE TEMPORARY TABLE _order_line_merges AS
+  SELECT override.shop_id, override.tab_id, override.bill_id, override.id AS override_id, regular.id AS regular_id
+  FROM order_items AS override
+  JOIN order_items AS regular ON regular.shop_id = override.shop_id AND regular.tab_id = override.tab_id
+    AND regular.bill_id = override.bill_id AND regular.item_id = override.item_id
+    AND regular.name = override.name AND regular.unit_price = override.unit_price
+  WHERE override.schedule_override AND NOT regular.schedule_override;
+
+UPDATE order_variants AS rv SET quantity = rv.quantity + ov.quantity
+FROM order_variants AS ov, _order_line_merges AS m
+WHERE ov.shop_id = m.shop_id AND ov.tab_id = m.tab_id AND ov.bill_id = m.bill_id AND ov.order_item_id = m.override_id
+  AND rv.shop_id = m.shop_id AND rv.tab_id = m.tab_id AND rv.bill_id = m.bill_id AND rv.order_item_id = m.regular_id
+  AND rv.variant_id = ov.variant_id AND rv.name = ov.name AND rv.unit_price = ov.unit_price;
+
+DELETE FROM order_variants AS ov
+USING order_variants AS rv, _order_line_merges AS m
+WHERE ov.shop_id = m.shop_id AND ov.tab_id = m.tab_id AND ov.bill_id = m.bill_id AND ov.order_item_id = m.override_id
+  AND rv.shop_id = m.shop_id AND rv.tab_id = m.tab_id AND rv.bill_id = m.bill_id AND rv.order_item_id = m.regular_id
+  AND rv.variant_id = ov.variant_id AND rv.name = ov.name AND rv.unit_price = ov.unit_price;
+
+UPDATE order_variants SET order_item_id = m.regular_id
+FROM _order_line_merges AS m
+WHERE order_variants.shop_id = m.shop_id AND order_variants.tab_id = m.tab_id
+  AND order_variants.bill_id = m.bill_id AND order_variants.order_item_id = m.override_id;
+
+UPDATE order_items SET quantity = order_items.quantity + override.quantity
+FROM _order_line_merges AS m
+JOIN order_items AS override ON override.shop_id = m.shop_id AND override.tab_id = m.tab_id
+  AND override.bill_id = m.bill_id AND override.id = m.override_id
+WHERE order_items.shop_id = m.shop_id AND order_items.tab_id = m.tab_id
+  AND order_items.bill_id = m.bill_id AND order_items.id = m.regular_id;
+
+DELETE FROM order_items
+USING _order_line_merges AS m
+WHERE order_items.shop_id = m.shop_id AND order_items.tab_id = m.tab_id
+  AND order_items.bill_id = m.bill_id AND order_items.id = m.override_id;
+
+DROP TABLE _order_line_merges;
+
+ALTER TABLE order_items
+  DROP CONSTRAINT order_items_line_key,
+  DROP COLUMN schedule_override,
+  ADD UNIQUE(shop_id, tab_id, bill_id, item_id, name, unit_price);
@@ -0,0 +1,4 @@
+ALTER TABLE order_items
+  ADD COLUMN schedule_override BOOLEAN NOT NULL DEFAULT FALSE,
+  DROP CONSTRAINT order_items_shop_id_tab_id_bill_id_item_id_name_unit_price_key,
+  ADD CONSTRAINT order_items_line_key UNIQUE(shop_id, tab_id, bill_id, item_id, name, unit_price, schedule_override);
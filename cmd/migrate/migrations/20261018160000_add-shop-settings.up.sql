@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS shop_settings (
+  shop_id INT NOT NULL,
+  timezone VARCHAR(64) NOT NULL DEFAULT 'America/New_York',
+  currency CHAR(3) NOT NULL DEFAULT 'USD',
+  contact_email VARCHAR(64) NOT NULL DEFAULT '',
+  contact_phone VARCHAR(32) NOT NULL DEFAULT '',
+  address VARCHAR(255) NOT NULL DEFAULT '',
+
+  PRIMARY KEY(shop_id),
+  FOREIGN KEY(shop_id) REFERENCES shops(id) ON DELETE CASCADE
+);
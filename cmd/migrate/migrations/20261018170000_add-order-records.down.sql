@@ -0,0 +1,39 @@
+-- Collapse the order records back into a single line per bill, item snapshot and schedule override
+CREATE TEMPORARY TABLE _order_lines AS
+  SELECT oi.shop_id, oi.tab_id, oi.bill_id, MIN(oi.id) AS id, oi.item_id, oi.name, oi.unit_price, o.schedule_override,
+    SUM(CASE WHEN o.type = 'remove' THEN -oi.quantity ELSE oi.quantity END)::INT AS quantity
+  FROM order_items AS oi
+  JOIN orders AS o ON o.shop_id = oi.shop_id AND o.tab_id = oi.tab_id AND o.bill_id = oi.bill_id AND o.id = oi.order_id
+  GROUP BY oi.shop_id, oi.tab_id, oi.bill_id, oi.item_id, oi.name, oi.unit_price, o.schedule_override;
+
+CREATE TEMPORARY TABLE _order_line_variants AS
+  SELECT l.shop_id, l.tab_id, l.bill_id, l.id AS order_item_id, ov.item_id, ov.variant_id, ov.name, ov.unit_price,
+    SUM(CASE WHEN o.type = 'remove' THEN -ov.quantity ELSE ov.quantity END)::INT AS quantity
+  FROM order_variants AS ov
+  JOIN order_items AS oi ON oi.shop_id = ov.shop_id AND oi.tab_id = ov.tab_id AND oi.bill_id = ov.bill_id AND oi.id = ov.order_item_id
+  JOIN orders AS o ON o.shop_id = oi.shop_id AND o.tab_id = oi.tab_id AND o.bill_id = oi.bill_id AND o.id = oi.order_id
+  JOIN _order_lines AS l ON l.shop_id = oi.shop_id AND l.tab_id = oi.tab_id AND l.bill_id = oi.bill_id
+    AND l.item_id = oi.item_id AND l.name = oi.name AND l.unit_price = oi.unit_price AND l.schedule_override = o.schedule_override
+  GROUP BY l.shop_id, l.tab_id, l.bill_id, l.id, ov.item_id, ov.variant_id, ov.name, ov.unit_price;
+
+DELETE FROM order_variants;
+DELETE FROM order_items;
+
+ALTER TABLE order_items
+  DROP CONSTRAINT order_items_line_key,
+  DROP COLUMN order_id,
+  ADD COLUMN schedule_override BOOLEAN NOT NULL DEFAULT FALSE,
+  ADD CONSTRAINT order_items_line_key UNIQUE(shop_id, tab_id, bill_id, item_id, name, unit_price, schedule_override);
+
+INSERT INTO order_items (shop_id, tab_id, bill_id, id, item_id, name, unit_price, schedule_override, quantity)
+SELECT shop_id, tab_id, bill_id, id, item_id, name, unit_price, schedule_override, GREATEST(quantity, 0)
+FROM _order_lines;
+
+INSERT INTO order_variants (shop_id, tab_id, bill_id, order_item_id, item_id, variant_id, name, unit_price, quantity)
+SELECT shop_id, tab_id, bill_id, order_item_id, item_id, variant_id, name, unit_price, GREATEST(quantity, 0)
+FROM _order_line_variants;
+
+DROP TABLE _order_line_variants;
+DROP TABLE _order_lines;
+DROP TABLE IF EXISTS orders;
+DROP TYPE IF EXISTS order_type;
@@ -0,0 +1,39 @@
+CREATE TYPE order_type AS ENUM ('add', 'remove');
+
+-- Each add or remove call is recorded as an immutable order, bills are derived from the order lines
+CREATE TABLE IF NOT EXISTS orders (
+  shop_id INT NOT NULL,
+  tab_id INT NOT NULL,
+  bill_id INT NOT NULL,
+  id SERIAL NOT NULL,
+  type order_type NOT NULL,
+  staff_id VARCHAR(255),
+  location_id INT, -- Not a foreign key so that order history survives location deletion
+  schedule_override BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY(shop_id, tab_id, bill_id, id),
+  FOREIGN KEY(shop_id, tab_id, bill_id) REFERENCES tab_bills(shop_id, tab_id, id),
+  FOREIGN KEY(staff_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- Existing order lines are attributed to a single unattributed order per bill
+INSERT INTO orders (shop_id, tab_id, bill_id, type, schedule_override, created_at)
+SELECT DISTINCT oi.shop_id, oi.tab_id, oi.bill_id, 'add'::order_type, oi.schedule_override, tab_bills.start_date::TIMESTAMPTZ
+FROM order_items AS oi
+JOIN tab_bills ON tab_bills.shop_id = oi.shop_id AND tab_bills.tab_id = oi.tab_id AND tab_bills.id = oi.bill_id;
+
+ALTER TABLE order_items
+  ADD COLUMN order_id INT;
+
+UPDATE order_items SET order_id = orders.id
+FROM orders
+WHERE orders.shop_id = order_items.shop_id AND orders.tab_id = order_items.tab_id
+  AND orders.bill_id = order_items.bill_id AND orders.schedule_override = order_items.schedule_override;
+
+ALTER TABLE order_items
+  ALTER COLUMN order_id SET NOT NULL,
+  DROP CONSTRAINT order_items_line_key,
+  DROP COLUMN schedule_override,
+  ADD CONSTRAINT order_items_line_key UNIQUE(shop_id, tab_id, bill_id, order_id, item_id, name, unit_price),
+  ADD FOREIGN KEY(shop_id, tab_id, bill_id, order_id) REFERENCES orders(shop_id, tab_id, bill_id, id) ON DELETE CASCADE;
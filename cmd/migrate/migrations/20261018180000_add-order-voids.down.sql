@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS order_voids;
+DROP TYPE IF EXISTS order_void_reason;
@@ -0,0 +1,18 @@
+CREATE TYPE order_void_reason AS ENUM ('entry_error', 'wrong_tab', 'customer_request', 'item_unavailable', 'other');
+
+-- Voided orders are excluded from bill totals, the original order record is left untouched
+CREATE TABLE IF NOT EXISTS order_voids (
+  shop_id INT NOT NULL,
+  tab_id INT NOT NULL,
+  bill_id INT NOT NULL,
+  order_id INT NOT NULL,
+  reason order_void_reason NOT NULL,
+  note VARCHAR(255) NOT NULL,
+  paid_bill_override BOOLEAN NOT NULL DEFAULT FALSE,
+  staff_id VARCHAR(255),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY(shop_id, tab_id, bill_id, order_id),
+  FOREIGN KEY(shop_id, tab_id, bill_id, order_id) REFERENCES orders(shop_id, tab_id, bill_id, id) ON DELETE CASCADE,
+  FOREIGN KEY(staff_id) REFERENCES users(id) ON DELETE SET NULL
+);
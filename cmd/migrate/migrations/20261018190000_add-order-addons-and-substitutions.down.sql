@@ -0,0 +1,9 @@
+DROP VIEW IF EXISTS item_substitution_prices;
+DROP TABLE IF EXISTS order_substitutions;
+DROP TABLE IF EXISTS order_addons;
+
+-- Orders which repeat an item at the same price cannot be rolled back
+ALTER TABLE order_items
+  DROP CONSTRAINT order_items_line_key,
+  DROP COLUMN line,
+  ADD CONSTRAINT order_items_line_key UNIQUE(shop_id, tab_id, bill_id, order_id, item_id, name, unit_price);
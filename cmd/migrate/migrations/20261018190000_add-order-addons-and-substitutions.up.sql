@@ -0,0 +1,68 @@
+-- Lines are numbered by their position in the order, so that an order may repeat an item with different
+-- addons and substitutions. A removal line spanning several captured prices is recorded once per price.
+ALTER TABLE order_items
+  ADD COLUMN line INT;
+
+UPDATE order_items SET line = numbered.line
+FROM (SELECT shop_id, tab_id, bill_id, id,
+        (ROW_NUMBER() OVER (PARTITION BY shop_id, tab_id, bill_id, order_id ORDER BY id) - 1)::INT AS line
+      FROM order_items) AS numbered
+WHERE numbered.shop_id = order_items.shop_id AND numbered.tab_id = order_items.tab_id
+  AND numbered.bill_id = order_items.bill_id AND numbered.id = order_items.id;
+
+ALTER TABLE order_items
+  ALTER COLUMN line SET NOT NULL,
+  DROP CONSTRAINT order_items_line_key,
+  ADD CONSTRAINT order_items_line_key UNIQUE(shop_id, tab_id, bill_id, order_id, line, name, unit_price);
+
+-- Selected addons and substitutions are priced at the addon or substitute item's base price when ordered
+CREATE TABLE IF NOT EXISTS order_addons (
+  shop_id INT NOT NULL,
+  tab_id INT NOT NULL,
+  bill_id INT NOT NULL,
+  order_item_id INT NOT NULL,
+  item_id INT NOT NULL,
+  addon_id INT NOT NULL,
+  name VARCHAR(255) NOT NULL,
+  unit_price BIGINT NOT NULL,
+  quantity INT NOT NULL DEFAULT 0,
+
+  PRIMARY KEY(shop_id, tab_id, bill_id, order_item_id, addon_id, name, unit_price),
+  FOREIGN KEY(shop_id, tab_id, bill_id, order_item_id) REFERENCES order_items(shop_id, tab_id, bill_id, id) ON DELETE CASCADE,
+  FOREIGN KEY(shop_id, addon_id) REFERENCES items(shop_id, id),
+  CHECK ( quantity >= 0 )
+);
+
+CREATE TABLE IF NOT EXISTS order_substitutions (
+  shop_id INT NOT NULL,
+  tab_id INT NOT NULL,
+  bill_id INT NOT NULL,
+  order_item_id INT NOT NULL,
+  item_id INT NOT NULL,
+  substitution_group_id INT NOT NULL,
+  substitution_id INT NOT NULL,
+  name VARCHAR(255) NOT NULL,
+  unit_price BIGINT NOT NULL,
+  quantity INT NOT NULL DEFAULT 0,
+
+  PRIMARY KEY(shop_id, tab_id, bill_id, order_item_id, substitution_group_id, substitution_id, name, unit_price),
+  FOREIGN KEY(shop_id, tab_id, bill_id, order_item_id) REFERENCES order_items(shop_id, tab_id, bill_id, id) ON DELETE CASCADE,
+  FOREIGN KEY(shop_id, substitution_id) REFERENCES items(shop_id, id),
+  CHECK ( quantity >= 0 )
+);
+
+-- A substitution is charged the difference between the substitute and the group's first option, which is
+-- included in the price of the item, and is never credited when the substitute costs less
+CREATE VIEW item_substitution_prices AS
+SELECT sgi.shop_id, sgi.substitution_group_id, sgi.item_id, items.name,
+  GREATEST(items.base_price - first_option.base_price, 0)::BIGINT AS price
+FROM item_substitution_groups_to_items AS sgi
+JOIN items ON items.shop_id = sgi.shop_id AND items.id = sgi.item_id
+JOIN LATERAL (
+  SELECT fi.base_price
+  FROM item_substitution_groups_to_items AS f
+  JOIN items AS fi ON fi.shop_id = f.shop_id AND fi.id = f.item_id
+  WHERE f.shop_id = sgi.shop_id AND f.substitution_group_id = sgi.substitution_group_id
+  ORDER BY f.index, f.item_id
+  LIMIT 1
+) AS first_option ON TRUE;
@@ -0,0 +1,3 @@
+ALTER TABLE orders
+  DROP COLUMN IF EXISTS ordered_by_email,
+  DROP COLUMN IF EXISTS ordered_by_name;
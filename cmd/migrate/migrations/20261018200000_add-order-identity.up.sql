@@ -0,0 +1,4 @@
+-- Identifies who an order was placed for, as required by the tab's verification method
+ALTER TABLE orders
+  ADD COLUMN ordered_by_name VARCHAR(64),
+  ADD COLUMN ordered_by_email VARCHAR(255);
@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS tab_vouchers (
+  shop_id INT NOT NULL,
+  tab_id INT NOT NULL,
+  id SERIAL NOT NULL,
+  code VARCHAR(16) NOT NULL,
+  max_uses INT NOT NULL DEFAULT 1 CHECK (max_uses >= 1),
+  value_cap BIGINT CHECK (value_cap >= 0), -- Null value indicates no cap on the value of each order
+  expires_at TIMESTAMPTZ, -- Null value indicates the voucher does not expire
+  created_by VARCHAR(255),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY(shop_id, tab_id, id),
+  CONSTRAINT tab_vouchers_code_key UNIQUE(shop_id, code),
+  FOREIGN KEY(shop_id, tab_id) REFERENCES tabs(shop_id, id) ON DELETE CASCADE,
+  FOREIGN KEY(created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- Each order redeems at most one voucher, redemptions of voided orders are not counted as uses
+CREATE TABLE IF NOT EXISTS voucher_redemptions (
+  shop_id INT NOT NULL,
+  tab_id INT NOT NULL,
+  bill_id INT NOT NULL,
+  order_id INT NOT NULL,
+  voucher_id INT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY(shop_id, tab_id, bill_id, order_id),
+  FOREIGN KEY(shop_id, tab_id, bill_id, order_id) REFERENCES orders(shop_id, tab_id, bill_id, id) ON DELETE CASCADE,
+  FOREIGN KEY(shop_id, tab_id, voucher_id) REFERENCES tab_vouchers(shop_id, tab_id, id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS voucher_redemptions_voucher_idx ON voucher_redemptions(shop_id, tab_id, voucher_id);
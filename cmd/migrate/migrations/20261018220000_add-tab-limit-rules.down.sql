@@ -0,0 +1,5 @@
+DROP VIEW IF EXISTS order_item_orderers;
+DROP TABLE IF EXISTS tab_limit_rules;
+DROP TYPE IF EXISTS limit_rule_period;
+DROP TYPE IF EXISTS limit_rule_scope;
+DROP TYPE IF EXISTS limit_rule_target;
@@ -0,0 +1,41 @@
+CREATE TYPE limit_rule_target AS ENUM ('item', 'category');
+CREATE TYPE limit_rule_scope AS ENUM ('person', 'tab');
+CREATE TYPE limit_rule_period AS ENUM ('day', 'bill');
+
+CREATE TABLE IF NOT EXISTS tab_limit_rules (
+  shop_id INT NOT NULL,
+  tab_id INT NOT NULL,
+  id SERIAL NOT NULL,
+  target limit_rule_target NOT NULL,
+  item_id INT,
+  category_id INT,
+  scope limit_rule_scope NOT NULL,
+  period limit_rule_period NOT NULL,
+  max_quantity INT CHECK (max_quantity >= 1), -- Null value indicates no quantity limit
+  max_amount BIGINT CHECK (max_amount >= 0), -- Null value indicates no amount limit
+
+  PRIMARY KEY(shop_id, tab_id, id),
+  FOREIGN KEY(shop_id, tab_id) REFERENCES tabs(shop_id, id) ON DELETE CASCADE,
+  FOREIGN KEY(shop_id, item_id) REFERENCES items(shop_id, id) ON DELETE CASCADE,
+  FOREIGN KEY(shop_id, category_id) REFERENCES item_categories(shop_id, id) ON DELETE CASCADE,
+  CHECK ((target = 'item' AND item_id IS NOT NULL AND category_id IS NULL) OR (target = 'category' AND category_id IS NOT NULL AND item_id IS NULL)),
+  CHECK (max_quantity IS NOT NULL OR max_amount IS NOT NULL)
+);
+
+-- The person each order line was placed for. Removals which do not identify anyone are attributed to the
+-- person of the latest non-voided addition of the same item on the bill, which is the order they reverse
+CREATE VIEW order_item_orderers AS
+SELECT oi.shop_id, oi.tab_id, oi.bill_id, oi.id AS order_item_id,
+  CASE WHEN o.ordered_by_email IS NULL AND o.ordered_by_name IS NULL THEN reversed.ordered_by_email ELSE o.ordered_by_email END AS ordered_by_email,
+  CASE WHEN o.ordered_by_email IS NULL AND o.ordered_by_name IS NULL THEN reversed.ordered_by_name ELSE o.ordered_by_name END AS ordered_by_name
+FROM order_items AS oi
+JOIN orders AS o ON o.shop_id = oi.shop_id AND o.tab_id = oi.tab_id AND o.bill_id = oi.bill_id AND o.id = oi.order_id
+LEFT JOIN LATERAL (
+  SELECT po.ordered_by_email, po.ordered_by_name
+  FROM order_items AS pi
+  JOIN orders AS po ON po.shop_id = pi.shop_id AND po.tab_id = pi.tab_id AND po.bill_id = pi.bill_id AND po.id = pi.order_id
+  WHERE pi.shop_id = oi.shop_id AND pi.tab_id = oi.tab_id AND pi.bill_id = oi.bill_id AND pi.item_id = oi.item_id AND pi.id < oi.id
+    AND po.type = 'add' AND NOT EXISTS(SELECT 1 FROM order_voids AS v WHERE v.shop_id = po.shop_id AND v.tab_id = po.tab_id AND v.bill_id = po.bill_id AND v.order_id = po.id)
+  ORDER BY pi.id DESC
+  LIMIT 1
+) AS reversed ON o.type = 'remove';
@@ -0,0 +1,4 @@
+ALTER TABLE tab_bills DROP COLUMN IF EXISTS is_closed;
+ALTER TABLE tab_updates DROP COLUMN IF EXISTS billing_term_ends, DROP COLUMN IF EXISTS billing_anchor_day, DROP COLUMN IF EXISTS billing_schedule;
+ALTER TABLE tabs DROP COLUMN IF EXISTS billing_term_ends, DROP COLUMN IF EXISTS billing_anchor_day, DROP COLUMN IF EXISTS billing_schedule;
+DROP TYPE IF EXISTS billing_schedule;
@@ -0,0 +1,17 @@
+CREATE TYPE billing_schedule AS ENUM ('interval', 'weekly', 'monthly', 'term');
+
+ALTER TABLE tabs
+  ADD COLUMN billing_schedule billing_schedule NOT NULL DEFAULT 'interval',
+  ADD COLUMN billing_anchor_day SMALLINT NOT NULL DEFAULT 0, -- Day of the week for weekly schedules, day of the month for monthly schedules
+  ADD COLUMN billing_term_ends DATE[] NOT NULL DEFAULT '{}'; -- Last days of the terms which term schedules bill separately, the final term ending with the tab
+
+ALTER TABLE tab_updates
+  ADD COLUMN billing_schedule billing_schedule NOT NULL DEFAULT 'interval',
+  ADD COLUMN billing_anchor_day SMALLINT NOT NULL DEFAULT 0,
+  ADD COLUMN billing_term_ends DATE[] NOT NULL DEFAULT '{}';
+
+ALTER TABLE tab_bills
+  ADD COLUMN is_closed BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Bills which have already ended or been paid no longer accept orders
+UPDATE tab_bills SET is_closed = TRUE WHERE is_paid OR end_date < CURRENT_DATE;
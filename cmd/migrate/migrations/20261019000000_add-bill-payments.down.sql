@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS bill_payment_reversals;
+DROP TABLE IF EXISTS bill_payments;
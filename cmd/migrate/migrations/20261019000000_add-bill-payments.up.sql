@@ -0,0 +1,62 @@
+CREATE TABLE IF NOT EXISTS bill_payments (
+  shop_id INT NOT NULL,
+  tab_id INT NOT NULL,
+  bill_id INT NOT NULL,
+  id SERIAL NOT NULL,
+  amount BIGINT NOT NULL CHECK (amount > 0),
+  method payment_method NOT NULL,
+  reference VARCHAR(64) NOT NULL DEFAULT '', -- Chartstring or receipt number the payment was made with
+  staff_id VARCHAR(255),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY(shop_id, tab_id, bill_id, id),
+  FOREIGN KEY(shop_id, tab_id, bill_id) REFERENCES tab_bills(shop_id, tab_id, id) ON DELETE CASCADE,
+  FOREIGN KEY(staff_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- Reversed payments are excluded from the amount paid, the original payment record is left untouched
+CREATE TABLE IF NOT EXISTS bill_payment_reversals (
+  shop_id INT NOT NULL,
+  tab_id INT NOT NULL,
+  bill_id INT NOT NULL,
+  payment_id INT NOT NULL,
+  note VARCHAR(255) NOT NULL,
+  staff_id VARCHAR(255),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY(shop_id, tab_id, bill_id, payment_id),
+  FOREIGN KEY(shop_id, tab_id, bill_id, payment_id) REFERENCES bill_payments(shop_id, tab_id, bill_id, id) ON DELETE CASCADE,
+  FOREIGN KEY(staff_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- Bills which were marked as paid are recorded as paid in full with the tab's payment details
+INSERT INTO bill_payments (shop_id, tab_id, bill_id, amount, method, reference)
+SELECT b.shop_id, b.tab_id, b.id, totals.total, tabs.payment_method, LEFT(tabs.payment_details, 64)
+FROM tab_bills AS b
+JOIN tabs ON tabs.shop_id = b.shop_id AND tabs.id = b.tab_id
+CROSS JOIN LATERAL (SELECT (
+  (SELECT COALESCE(SUM(CASE WHEN o.type = 'remove' THEN -1 ELSE 1 END * oi.unit_price * oi.quantity), 0)
+   FROM order_items AS oi
+   JOIN orders AS o ON o.shop_id = oi.shop_id AND o.tab_id = oi.tab_id AND o.bill_id = oi.bill_id AND o.id = oi.order_id
+   WHERE oi.shop_id = b.shop_id AND oi.tab_id = b.tab_id AND oi.bill_id = b.id
+     AND NOT EXISTS(SELECT 1 FROM order_voids AS v WHERE v.shop_id = o.shop_id AND v.tab_id = o.tab_id AND v.bill_id = o.bill_id AND v.order_id = o.id)) +
+  (SELECT COALESCE(SUM(CASE WHEN o.type = 'remove' THEN -1 ELSE 1 END * ov.unit_price * ov.quantity), 0)
+   FROM order_variants AS ov
+   JOIN order_items AS oi ON oi.shop_id = ov.shop_id AND oi.tab_id = ov.tab_id AND oi.bill_id = ov.bill_id AND oi.id = ov.order_item_id
+   JOIN orders AS o ON o.shop_id = oi.shop_id AND o.tab_id = oi.tab_id AND o.bill_id = oi.bill_id AND o.id = oi.order_id
+   WHERE ov.shop_id = b.shop_id AND ov.tab_id = b.tab_id AND ov.bill_id = b.id
+     AND NOT EXISTS(SELECT 1 FROM order_voids AS v WHERE v.shop_id = o.shop_id AND v.tab_id = o.tab_id AND v.bill_id = o.bill_id AND v.order_id = o.id)) +
+  (SELECT COALESCE(SUM(CASE WHEN o.type = 'remove' THEN -1 ELSE 1 END * oa.unit_price * oa.quantity), 0)
+   FROM order_addons AS oa
+   JOIN order_items AS oi ON oi.shop_id = oa.shop_id AND oi.tab_id = oa.tab_id AND oi.bill_id = oa.bill_id AND oi.id = oa.order_item_id
+   JOIN orders AS o ON o.shop_id = oi.shop_id AND o.tab_id = oi.tab_id AND o.bill_id = oi.bill_id AND o.id = oi.order_id
+   WHERE oa.shop_id = b.shop_id AND oa.tab_id = b.tab_id AND oa.bill_id = b.id
+     AND NOT EXISTS(SELECT 1 FROM order_voids AS v WHERE v.shop_id = o.shop_id AND v.tab_id = o.tab_id AND v.bill_id = o.bill_id AND v.order_id = o.id)) +
+  (SELECT COALESCE(SUM(CASE WHEN o.type = 'remove' THEN -1 ELSE 1 END * os.unit_price * os.quantity), 0)
+   FROM order_substitutions AS os
+   JOIN order_items AS oi ON oi.shop_id = os.shop_id AND oi.tab_id = os.tab_id AND oi.bill_id = os.bill_id AND oi.id = os.order_item_id
+   JOIN orders AS o ON o.shop_id = oi.shop_id AND o.tab_id = oi.tab_id AND o.bill_id = oi.bill_id AND o.id = oi.order_id
+   WHERE os.shop_id = b.shop_id AND os.tab_id = b.tab_id AND os.bill_id = b.id
+     AND NOT EXISTS(SELECT 1 FROM order_voids AS v WHERE v.shop_id = o.shop_id AND v.tab_id = o.tab_id AND v.bill_id = o.bill_id AND v.order_id = o.id))
+)::BIGINT AS total) AS totals
+WHERE b.is_paid AND totals.total > 0;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS tab_update_allocations;
+DROP TABLE IF EXISTS tab_allocations;
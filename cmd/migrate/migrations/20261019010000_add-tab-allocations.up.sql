@@ -0,0 +1,26 @@
+-- Splits the tab's bills across chartstrings, fixed amounts are charged first and percentages split the remainder
+CREATE TABLE IF NOT EXISTS tab_allocations (
+  shop_id INT NOT NULL,
+  tab_id INT NOT NULL,
+  id SERIAL NOT NULL,
+  chartstring VARCHAR(64) NOT NULL,
+  percent SMALLINT CHECK (percent BETWEEN 1 AND 100),
+  amount BIGINT CHECK (amount > 0),
+
+  PRIMARY KEY(shop_id, tab_id, id),
+  FOREIGN KEY(shop_id, tab_id) REFERENCES tabs(shop_id, id) ON DELETE CASCADE,
+  CHECK ((percent IS NULL) <> (amount IS NULL))
+);
+
+CREATE TABLE IF NOT EXISTS tab_update_allocations (
+  shop_id INT NOT NULL,
+  tab_id INT NOT NULL,
+  id SERIAL NOT NULL,
+  chartstring VARCHAR(64) NOT NULL,
+  percent SMALLINT CHECK (percent BETWEEN 1 AND 100),
+  amount BIGINT CHECK (amount > 0),
+
+  PRIMARY KEY(shop_id, tab_id, id),
+  FOREIGN KEY(shop_id, tab_id) REFERENCES tab_updates(shop_id, tab_id) ON DELETE CASCADE,
+  CHECK ((percent IS NULL) <> (amount IS NULL))
+);
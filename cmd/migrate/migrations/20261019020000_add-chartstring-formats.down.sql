@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS shop_chartstring_formats;
+DROP TYPE IF EXISTS chartstring_checksum;
+DROP TYPE IF EXISTS chartstring_charset;
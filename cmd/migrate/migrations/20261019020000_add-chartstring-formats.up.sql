@@ -0,0 +1,19 @@
+CREATE TYPE chartstring_charset AS ENUM ('alphanumeric', 'numeric', 'alpha');
+CREATE TYPE chartstring_checksum AS ENUM ('none', 'luhn');
+
+-- Account string formats accepted by the shop, shops without any formats accept the default format
+CREATE TABLE IF NOT EXISTS shop_chartstring_formats (
+  shop_id INT NOT NULL,
+  id SERIAL NOT NULL,
+  name VARCHAR(64) NOT NULL,
+  segments SMALLINT[] NOT NULL CHECK (cardinality(segments) > 0),
+  required_segments SMALLINT NOT NULL CHECK (required_segments BETWEEN 1 AND cardinality(segments)),
+  separators VARCHAR(8) NOT NULL DEFAULT '',
+  separator_optional BOOLEAN NOT NULL DEFAULT FALSE,
+  charset chartstring_charset NOT NULL DEFAULT 'alphanumeric',
+  checksum chartstring_checksum NOT NULL DEFAULT 'none',
+
+  PRIMARY KEY(shop_id, id),
+  UNIQUE(shop_id, name),
+  FOREIGN KEY(shop_id) REFERENCES shops(id) ON DELETE CASCADE
+);
@@ -0,0 +1,32 @@
+-- The enum is recreated with every method still in use, so that no tabs, updates or payments are lost
+DO $$
+DECLARE
+  labels TEXT;
+BEGIN
+  SELECT string_agg(quote_literal(m.method), ', ' ORDER BY m.ord, m.method) INTO labels
+  FROM (
+    SELECT u.method, MIN(u.ord) AS ord
+    FROM (
+      SELECT 'in person' AS method, 0 AS ord
+      UNION ALL SELECT 'chartstring', 1
+      UNION ALL SELECT method, 2 FROM payment_methods
+      UNION ALL SELECT payment_method, 2 FROM tabs
+      UNION ALL SELECT payment_method, 2 FROM tab_updates
+      UNION ALL SELECT method, 2 FROM bill_payments
+    ) AS u
+    GROUP BY u.method
+  ) AS m;
+
+  EXECUTE format('CREATE TYPE payment_method AS ENUM (%s)', labels);
+END $$;
+
+ALTER TABLE tabs DROP CONSTRAINT IF EXISTS tabs_shop_id_payment_method_fkey;
+ALTER TABLE tab_updates DROP CONSTRAINT IF EXISTS tab_updates_shop_id_payment_method_fkey;
+
+ALTER TABLE payment_methods ALTER COLUMN method TYPE payment_method USING method::payment_method;
+ALTER TABLE tabs ALTER COLUMN payment_method TYPE payment_method USING payment_method::payment_method;
+ALTER TABLE tab_updates ALTER COLUMN payment_method TYPE payment_method USING payment_method::payment_method;
+ALTER TABLE bill_payments ALTER COLUMN method TYPE payment_method USING method::payment_method;
+
+ALTER TABLE tabs ADD FOREIGN KEY(shop_id, payment_method) REFERENCES payment_methods(shop_id, method);
+ALTER TABLE tab_updates ADD FOREIGN KEY(shop_id, payment_method) REFERENCES payment_methods(shop_id, method);
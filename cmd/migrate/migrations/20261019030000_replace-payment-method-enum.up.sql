@@ -0,0 +1,13 @@
+-- Payment methods are validated against the registry in the application, so new methods do not require a migration
+ALTER TABLE tabs DROP CONSTRAINT IF EXISTS tabs_shop_id_payment_method_fkey;
+ALTER TABLE tab_updates DROP CONSTRAINT IF EXISTS tab_updates_shop_id_payment_method_fkey;
+
+ALTER TABLE payment_methods ALTER COLUMN method TYPE VARCHAR(32) USING method::TEXT;
+ALTER TABLE tabs ALTER COLUMN payment_method TYPE VARCHAR(32) USING payment_method::TEXT;
+ALTER TABLE tab_updates ALTER COLUMN payment_method TYPE VARCHAR(32) USING payment_method::TEXT;
+ALTER TABLE bill_payments ALTER COLUMN method TYPE VARCHAR(32) USING method::TEXT;
+
+ALTER TABLE tabs ADD FOREIGN KEY(shop_id, payment_method) REFERENCES payment_methods(shop_id, method);
+ALTER TABLE tab_updates ADD FOREIGN KEY(shop_id, payment_method) REFERENCES payment_methods(shop_id, method);
+
+DROP TYPE IF EXISTS payment_method;
@@ -0,0 +1,25 @@
+-- Online payments of a bill through a payment provider. The payment is recorded once the provider confirms it.
+CREATE TABLE IF NOT EXISTS bill_checkouts (
+  shop_id INT NOT NULL,
+  tab_id INT NOT NULL,
+  bill_id INT NOT NULL,
+  id SERIAL NOT NULL,
+  provider VARCHAR(32) NOT NULL,
+  session_id VARCHAR(255) NOT NULL,
+  checkout_url VARCHAR(2048) NOT NULL,
+  amount BIGINT NOT NULL CHECK (amount > 0),
+  user_id VARCHAR(255),
+  payment_id INT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  expires_at TIMESTAMPTZ NOT NULL, -- When the provider stops accepting payment through the session
+  completed_at TIMESTAMPTZ,
+  unapplied_amount BIGINT CHECK (unapplied_amount > 0), -- Captured after the bill was posted to the journal or in another currency, kept until refunded
+  unapplied_reference VARCHAR(64),
+  unapplied_currency CHAR(3), -- The currency the unapplied amount was captured in
+
+  PRIMARY KEY(shop_id, tab_id, bill_id, id),
+  UNIQUE(provider, session_id),
+  FOREIGN KEY(shop_id, tab_id, bill_id) REFERENCES tab_bills(shop_id, tab_id, id) ON DELETE CASCADE,
+  FOREIGN KEY(shop_id, tab_id, bill_id, payment_id) REFERENCES bill_payments(shop_id, tab_id, bill_id, id),
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE SET NULL
+);
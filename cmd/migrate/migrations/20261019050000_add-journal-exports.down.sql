@@ -0,0 +1,6 @@
+ALTER TABLE tab_bills DROP COLUMN IF EXISTS journal_export_id;
+DROP TABLE IF EXISTS journal_export_lines;
+DROP TABLE IF EXISTS journal_exports;
+DROP TABLE IF EXISTS shop_journal_columns;
+DROP TABLE IF EXISTS shop_journal_settings;
+DROP TYPE IF EXISTS journal_field;
@@ -0,0 +1,56 @@
+CREATE TYPE journal_field AS ENUM ('account', 'debit', 'credit', 'amount', 'description', 'reference', 'date', 'tab', 'bill', 'constant');
+
+-- Account credited with the shop's revenue and, if set, the day of the month the previous month's bills are exported
+CREATE TABLE IF NOT EXISTS shop_journal_settings (
+  shop_id INT NOT NULL,
+  revenue_account VARCHAR(64) NOT NULL,
+  export_day SMALLINT CHECK (export_day BETWEEN 1 AND 28),
+
+  PRIMARY KEY(shop_id),
+  FOREIGN KEY(shop_id) REFERENCES shops(id) ON DELETE CASCADE
+);
+
+-- Columns of the journal file in order, shops without any columns use the default columns
+CREATE TABLE IF NOT EXISTS shop_journal_columns (
+  shop_id INT NOT NULL,
+  position SMALLINT NOT NULL,
+  header VARCHAR(64) NOT NULL,
+  field journal_field NOT NULL,
+  value VARCHAR(64) NOT NULL DEFAULT '',
+
+  PRIMARY KEY(shop_id, position),
+  FOREIGN KEY(shop_id) REFERENCES shops(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS journal_exports (
+  shop_id INT NOT NULL,
+  id SERIAL NOT NULL,
+  start_date DATE NOT NULL,
+  end_date DATE NOT NULL CHECK (end_date >= start_date),
+  revenue_account VARCHAR(64) NOT NULL,
+  user_id VARCHAR(255), -- Null value indicates the export was scheduled or the user was deleted
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY(shop_id, id),
+  FOREIGN KEY(shop_id) REFERENCES shops(id) ON DELETE CASCADE,
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- Debits of the export, one per chartstring of each bill. The balancing credit is derived from their sum.
+CREATE TABLE IF NOT EXISTS journal_export_lines (
+  shop_id INT NOT NULL,
+  export_id INT NOT NULL,
+  id SERIAL NOT NULL,
+  tab_id INT NOT NULL,
+  bill_id INT NOT NULL,
+  chartstring VARCHAR(64) NOT NULL,
+  amount BIGINT NOT NULL CHECK (amount > 0),
+
+  PRIMARY KEY(shop_id, export_id, id),
+  FOREIGN KEY(shop_id, export_id) REFERENCES journal_exports(shop_id, id) ON DELETE CASCADE,
+  FOREIGN KEY(shop_id, tab_id, bill_id) REFERENCES tab_bills(shop_id, tab_id, id) ON DELETE CASCADE
+);
+
+-- Bills are only posted to the journal once
+ALTER TABLE tab_bills ADD COLUMN journal_export_id INT;
+ALTER TABLE tab_bills ADD FOREIGN KEY(shop_id, journal_export_id) REFERENCES journal_exports(shop_id, id);
@@ -0,0 +1,15 @@
+-- Manual charges (positive) and credits (negative) added to a bill, e.g. delivery fees or goodwill credits
+CREATE TABLE IF NOT EXISTS bill_adjustments (
+  shop_id INT NOT NULL,
+  tab_id INT NOT NULL,
+  bill_id INT NOT NULL,
+  id SERIAL NOT NULL,
+  amount BIGINT NOT NULL CHECK (amount <> 0),
+  reason VARCHAR(255) NOT NULL,
+  staff_id VARCHAR(255),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY(shop_id, tab_id, bill_id, id),
+  FOREIGN KEY(shop_id, tab_id, bill_id) REFERENCES tab_bills(shop_id, tab_id, id) ON DELETE CASCADE,
+  FOREIGN KEY(staff_id) REFERENCES users(id) ON DELETE SET NULL
+);
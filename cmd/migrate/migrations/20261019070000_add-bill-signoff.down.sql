@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS bill_comments;
+ALTER TABLE tab_bills DROP COLUMN IF EXISTS signed_off_at;
+ALTER TABLE tab_bills DROP COLUMN IF EXISTS signoff_status;
+DROP TYPE IF EXISTS bill_signoff_status;
@@ -0,0 +1,21 @@
+-- Tab owners sign off on closed bills before they are charged to the tab's payment details
+CREATE TYPE bill_signoff_status AS ENUM ('pending', 'approved', 'disputed');
+
+ALTER TABLE tab_bills
+  ADD COLUMN IF NOT EXISTS signoff_status bill_signoff_status NOT NULL DEFAULT 'pending',
+  ADD COLUMN IF NOT EXISTS signed_off_at TIMESTAMPTZ;
+
+-- Discussion of a bill between the tab owner and shop staff, opened by disputes
+CREATE TABLE IF NOT EXISTS bill_comments (
+  shop_id INT NOT NULL,
+  tab_id INT NOT NULL,
+  bill_id INT NOT NULL,
+  id SERIAL NOT NULL,
+  user_id VARCHAR(255),
+  body VARCHAR(1000) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY(shop_id, tab_id, bill_id, id),
+  FOREIGN KEY(shop_id, tab_id, bill_id) REFERENCES tab_bills(shop_id, tab_id, id) ON DELETE CASCADE,
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE SET NULL
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS order_transfer_items;
+DROP TABLE IF EXISTS order_transfers;
@@ -0,0 +1,36 @@
+-- Order lines moved between bills, possibly of different tabs. The lines are removed from the source bill and added to the
+-- target bill by a pair of orders which keep the original order's time, leaving the original order untouched.
+CREATE TABLE IF NOT EXISTS order_transfers (
+  shop_id INT NOT NULL,
+  id SERIAL NOT NULL,
+  source_tab_id INT NOT NULL,
+  source_bill_id INT NOT NULL,
+  source_order_id INT NOT NULL,
+  removal_order_id INT NOT NULL,
+  target_tab_id INT NOT NULL,
+  target_bill_id INT NOT NULL,
+  target_order_id INT NOT NULL,
+  note VARCHAR(255) NOT NULL,
+  staff_id VARCHAR(255),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY(shop_id, id),
+  FOREIGN KEY(shop_id, source_tab_id, source_bill_id, source_order_id) REFERENCES orders(shop_id, tab_id, bill_id, id) ON DELETE CASCADE,
+  FOREIGN KEY(shop_id, source_tab_id, source_bill_id, removal_order_id) REFERENCES orders(shop_id, tab_id, bill_id, id) ON DELETE CASCADE,
+  FOREIGN KEY(shop_id, target_tab_id, target_bill_id, target_order_id) REFERENCES orders(shop_id, tab_id, bill_id, id) ON DELETE CASCADE,
+  FOREIGN KEY(staff_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- Each order line may only be transferred once
+CREATE TABLE IF NOT EXISTS order_transfer_items (
+  shop_id INT NOT NULL,
+  transfer_id INT NOT NULL,
+  tab_id INT NOT NULL,
+  bill_id INT NOT NULL,
+  order_item_id INT NOT NULL,
+
+  PRIMARY KEY(shop_id, transfer_id, order_item_id),
+  UNIQUE(shop_id, tab_id, bill_id, order_item_id),
+  FOREIGN KEY(shop_id, transfer_id) REFERENCES order_transfers(shop_id, id) ON DELETE CASCADE,
+  FOREIGN KEY(shop_id, tab_id, bill_id, order_item_id) REFERENCES order_items(shop_id, tab_id, bill_id, id) ON DELETE CASCADE
+);
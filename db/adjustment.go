@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/willtrojniak/TabAppBackend/models"
+	"github.com/willtrojniak/TabAppBackend/services"
+)
+
+func (q *PgxQueries) GetBillAdjustmentById(ctx context.Context, shopId int, tabId int, billId int, adjustmentId int) (*models.BillAdjustment, error) {
+	rows, _ := q.tx.Query(ctx, `
+    SELECT a.id, a.bill_id, a.amount, a.reason, a.staff_id, users.name AS staff_name, a.created_at
+    FROM bill_adjustments AS a
+    LEFT JOIN users ON users.id = a.staff_id
+    WHERE a.shop_id = @shopId AND a.tab_id = @tabId AND a.bill_id = @billId AND a.id = @adjustmentId`,
+		pgx.NamedArgs{
+			"shopId":       shopId,
+			"tabId":        tabId,
+			"billId":       billId,
+			"adjustmentId": adjustmentId,
+		})
+
+	adjustment, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[models.BillAdjustment])
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+	err = q.setShopCurrency(ctx, shopId, adjustment)
+	if err != nil {
+		return nil, err
+	}
+	return adjustment, nil
+}
+
+// Adds a charge or credit to the bill and settles the bill against its new total.
+// Credits may not bring the bill's total below zero.
+func (q *PgxQueries) AddBillAdjustment(ctx context.Context, tab *models.Tab, billId int, staffId string, data *models.BillAdjustmentCreate, today models.Date) (int, error) {
+	return WithTxRet(ctx, q, func(q *PgxQueries) (int, error) {
+		bill, err := q.getAdjustableBill(ctx, tab, billId)
+		if err != nil {
+			return 0, err
+		}
+
+		adjustmentId, err := q.insertBillAdjustment(ctx, tab, billId, staffId, data)
+		if err != nil {
+			return 0, err
+		}
+
+		total, err := q.getTabSpent(ctx, tab.ShopId, tab.Id, &billId, nil)
+		if err != nil {
+			return 0, err
+		}
+		if total.IsNegative() {
+			return 0, services.NewValidationServiceError(errors.New("Credit exceeds the bill total"), services.ValidationErrors{
+				"amount": services.ValidationError{Value: data.Amount, Error: "gte"},
+			})
+		}
+
+		err = q.resetBillSignoff(ctx, tab.ShopId, tab.Id, billId)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = q.settleBill(ctx, tab.ShopId, tab.Id, bill, today)
+		if err != nil {
+			return 0, err
+		}
+		return adjustmentId, nil
+	})
+}
+
+// Removes an adjustment from the bill and settles the bill against its new total
+func (q *PgxQueries) RemoveBillAdjustment(ctx context.Context, tab *models.Tab, billId int, adjustmentId int, today models.Date) error {
+	return q.WithTx(ctx, func(q *PgxQueries) error {
+		bill, err := q.getAdjustableBill(ctx, tab, billId)
+		if err != nil {
+			return err
+		}
+
+		res, err := q.tx.Exec(ctx, `
+    DELETE FROM bill_adjustments
+    WHERE shop_id = @shopId AND tab_id = @tabId AND bill_id = @billId AND id = @adjustmentId`,
+			pgx.NamedArgs{
+				"shopId":       tab.ShopId,
+				"tabId":        tab.Id,
+				"billId":       billId,
+				"adjustmentId": adjustmentId,
+			})
+		if err != nil {
+			return handlePgxError(err)
+		}
+		if res.RowsAffected() == 0 {
+			return handlePgxError(pgx.ErrNoRows)
+		}
+
+		total, err := q.getTabSpent(ctx, tab.ShopId, tab.Id, &billId, nil)
+		if err != nil {
+			return err
+		}
+		if total.IsNegative() {
+			return services.NewDataConflictServiceError(errors.New("Removing the adjustment would bring the bill total below zero"))
+		}
+
+		err = q.resetBillSignoff(ctx, tab.ShopId, tab.Id, billId)
+		if err != nil {
+			return err
+		}
+
+		_, err = q.settleBill(ctx, tab.ShopId, tab.Id, bill, today)
+		return err
+	})
+}
+
+func (q *PgxQueries) insertBillAdjustment(ctx context.Context, tab *models.Tab, billId int, staffId string, data *models.BillAdjustmentCreate) (int, error) {
+	var adjustmentId int
+	err := q.tx.QueryRow(ctx, `
+    INSERT INTO bill_adjustments (shop_id, tab_id, bill_id, amount, reason, staff_id)
+    VALUES (@shopId, @tabId, @billId, @amount, @reason, @staffId)
+    RETURNING id`,
+		pgx.NamedArgs{
+			"shopId":  tab.ShopId,
+			"tabId":   tab.Id,
+			"billId":  billId,
+			"amount":  data.Amount,
+			"reason":  data.Reason,
+			"staffId": staffId,
+		}).Scan(&adjustmentId)
+	if err != nil {
+		return 0, handlePgxError(err)
+	}
+	return adjustmentId, nil
+}
+
+// Locks the bill for adjustment. Bills which have been posted to the journal may no longer be adjusted.
+func (q *PgxQueries) getAdjustableBill(ctx context.Context, tab *models.Tab, billId int) (*models.BillOverview, error) {
+	bill, err := q.getBillForUpdate(ctx, tab.ShopId, tab.Id, billId)
+	if err != nil {
+		return nil, err
+	}
+
+	var exported bool
+	err = q.tx.QueryRow(ctx, `
+    SELECT journal_export_id IS NOT NULL
+    FROM tab_bills
+    WHERE shop_id = @shopId AND tab_id = @tabId AND id = @billId`,
+		pgx.NamedArgs{
+			"shopId": tab.ShopId,
+			"tabId":  tab.Id,
+			"billId": billId,
+		}).Scan(&exported)
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+	if exported {
+		return nil, ErrBillExported
+	}
+	return bill, nil
+}
+
+// Returned when a bill is changed after it has been posted to the journal
+var ErrBillExported = services.NewDataConflictServiceError(errors.New("Bill has already been posted to the journal"))
@@ -0,0 +1,288 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/willtrojniak/TabAppBackend/models"
+	"github.com/willtrojniak/TabAppBackend/services"
+)
+
+// Creates contiguous billing periods for the tab, continuing from the end of its last bill
+// through the period following the one covering today.
+// Periods which ended before the one covering today are skipped, as no orders can be recorded against them.
+func (q *PgxQueries) EnsureBillingPeriods(ctx context.Context, tab *models.TabOverview, today models.Date) error {
+	return q.WithTx(ctx, func(q *PgxQueries) error {
+		// Serializes period generation for the tab
+		err := q.lockTab(ctx, tab.ShopId, tab.Id)
+		if err != nil {
+			return err
+		}
+
+		lastEnd, err := q.getLastBillEnd(ctx, tab.ShopId, tab.Id)
+		if err != nil {
+			return err
+		}
+
+		current := today
+		if current.Before(tab.StartDate.Date) {
+			current = tab.StartDate
+		}
+
+		next, _ := tab.BillingPeriodContaining(current)
+		if lastEnd != nil && !lastEnd.Before(next.Date) {
+			next = models.Date{Date: lastEnd.AddDays(1)}
+		}
+		horizon := tab.BillingPeriodEnd(current).AddDays(1)
+
+		for !next.After(horizon) && !next.After(tab.EndDate.Date) {
+			end := tab.BillingPeriodEnd(next)
+			_, err := q.insertBill(ctx, tab.ShopId, tab.Id, next, end)
+			if err != nil {
+				return err
+			}
+			next = models.Date{Date: end.AddDays(1)}
+		}
+
+		return nil
+	})
+}
+
+func (q *PgxQueries) getLastBillEnd(ctx context.Context, shopId int, tabId int) (*models.Date, error) {
+	var lastEnd *models.Date
+	err := q.tx.QueryRow(ctx, `
+    SELECT MAX(end_date) FROM tab_bills WHERE shop_id = @shopId AND tab_id = @tabId`,
+		pgx.NamedArgs{
+			"shopId": shopId,
+			"tabId":  tabId,
+		}).Scan(&lastEnd)
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+	return lastEnd, nil
+}
+
+func (q *PgxQueries) insertBill(ctx context.Context, shopId int, tabId int, startDate models.Date, endDate models.Date) (int, error) {
+	var billId int
+
+	row := q.tx.QueryRow(ctx, `
+    INSERT INTO tab_bills
+    (shop_id, tab_id, start_date, end_date) VALUES (@shopId, @tabId, @startDate, @endDate) RETURNING id
+    `, pgx.NamedArgs{
+		"shopId":    shopId,
+		"tabId":     tabId,
+		"startDate": startDate,
+		"endDate":   endDate,
+	})
+	err := row.Scan(&billId)
+	if err != nil {
+		return 0, handlePgxError(err)
+	}
+
+	return billId, nil
+}
+
+// Finds the bill which orders placed today are recorded against, which is the earliest open bill that has not yet ended
+func (q *PgxQueries) getTargetBill(ctx context.Context, tab *models.Tab, today models.Date) (int, error) {
+	err := q.EnsureBillingPeriods(ctx, &tab.TabOverview, today)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, _ := q.tx.Query(ctx, `
+    SELECT id, start_date, end_date, is_paid, is_closed, signoff_status, signed_off_at
+    FROM tab_bills
+    WHERE shop_id = @shopId AND tab_id = @tabId
+      AND NOT is_paid AND NOT is_closed AND end_date >= @today
+    ORDER BY start_date
+    LIMIT 1
+    `,
+		pgx.NamedArgs{
+			"shopId": tab.ShopId,
+			"tabId":  tab.Id,
+			"today":  today,
+		})
+
+	bill, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[models.BillOverview])
+	if err == nil {
+		return bill.Id, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, handlePgxError(err)
+	}
+
+	// Every bill covering today has been closed, or today is outside of the tab's dates, so the order is recorded
+	// against a new bill for the rest of the period containing today, starting after the last bill where possible
+	start, end := tab.BillingPeriodContaining(today)
+	lastEnd, err := q.getLastBillEnd(ctx, tab.ShopId, tab.Id)
+	if err != nil {
+		return 0, err
+	}
+	if lastEnd != nil && !lastEnd.Before(start.Date) {
+		start = today
+		if lastEnd.Before(today.Date) {
+			start = models.Date{Date: lastEnd.AddDays(1)}
+		}
+	}
+
+	return q.insertBill(ctx, tab.ShopId, tab.Id, start, end)
+}
+
+func (q *PgxQueries) getBillForUpdate(ctx context.Context, shopId int, tabId int, billId int) (*models.BillOverview, error) {
+	rows, _ := q.tx.Query(ctx, `
+    SELECT id, start_date, end_date, is_paid, is_closed, signoff_status, signed_off_at
+    FROM tab_bills
+    WHERE shop_id = @shopId AND tab_id = @tabId AND id = @billId
+    FOR UPDATE
+    `,
+		pgx.NamedArgs{
+			"shopId": shopId,
+			"tabId":  tabId,
+			"billId": billId,
+		})
+
+	bill, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[models.BillOverview])
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+	return bill, nil
+}
+
+// Ends the bill on the given date and moves the start of the following period up to the next day.
+// Bills ending today or earlier are closed immediately, so the following period instead starts on the cut date to take
+// the orders placed for the rest of the day. The rest of the cut period is billed on its own when no bill follows it.
+func (q *PgxQueries) cutBill(ctx context.Context, shopId int, tabId int, bill *models.BillOverview, endDate models.Date, today models.Date) error {
+	isClosed := !endDate.After(today.Date)
+	_, err := q.tx.Exec(ctx, `
+    UPDATE tab_bills
+    SET (end_date, is_closed) = (@endDate, @isClosed)
+    WHERE shop_id = @shopId AND tab_id = @tabId AND id = @billId
+    `, pgx.NamedArgs{
+		"shopId":   shopId,
+		"tabId":    tabId,
+		"billId":   bill.Id,
+		"endDate":  endDate,
+		"isClosed": isClosed,
+	})
+	if err != nil {
+		return handlePgxError(err)
+	}
+
+	nextStart := models.Date{Date: endDate.AddDays(1)}
+	if isClosed {
+		nextStart = endDate
+	}
+	result, err := q.tx.Exec(ctx, `
+    UPDATE tab_bills
+    SET start_date = @nextStart
+    WHERE shop_id = @shopId AND tab_id = @tabId AND start_date = @followingStart
+      AND NOT is_paid AND NOT is_closed
+    `, pgx.NamedArgs{
+		"shopId":         shopId,
+		"tabId":          tabId,
+		"nextStart":      nextStart,
+		"followingStart": models.Date{Date: bill.EndDate.AddDays(1)},
+	})
+	if err != nil {
+		return handlePgxError(err)
+	}
+
+	if result.RowsAffected() == 0 && !nextStart.After(bill.EndDate.Date) {
+		_, err = q.insertBill(ctx, shopId, tabId, nextStart, bill.EndDate)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ends an open bill early and starts the next billing period on the following day, or on the cut date when the bill
+// ends today. The end date may not be before today, so that orders already recorded against the bill remain within its period.
+func (q *PgxQueries) CutTabBill(ctx context.Context, tab *models.Tab, billId int, endDate models.Date, today models.Date) error {
+	return q.WithTx(ctx, func(q *PgxQueries) error {
+		bill, err := q.getBillForUpdate(ctx, tab.ShopId, tab.Id, billId)
+		if err != nil {
+			return err
+		}
+
+		if bill.IsPaid || bill.IsClosed {
+			return services.NewDataConflictServiceError(errors.New("Bill is already closed"))
+		}
+
+		if endDate.Before(today.Date) || endDate.Before(bill.StartDate.Date) || endDate.After(bill.EndDate.Date) {
+			return services.NewValidationServiceError(errors.New("Invalid bill end date"), services.ValidationErrors{
+				"end_date": services.ValidationError{Value: endDate, Error: "invalid"},
+			})
+		}
+
+		err = q.cutBill(ctx, tab.ShopId, tab.Id, bill, endDate, today)
+		if err != nil {
+			return err
+		}
+
+		// Payments already recorded may cover the bill once it has closed
+		bill.EndDate = endDate
+		bill.IsClosed = !endDate.After(today.Date)
+		_, err = q.settleBill(ctx, tab.ShopId, tab.Id, bill, today)
+		if err != nil {
+			return err
+		}
+
+		return q.EnsureBillingPeriods(ctx, &tab.TabOverview, today)
+	})
+}
+
+// Closes the shop's bills whose period ended before today, settling those already covered by their payments.
+// Returns the bills which have been paid by closing.
+func (q *PgxQueries) CloseElapsedBills(ctx context.Context, shopId int, today models.Date) ([]models.SettledBill, error) {
+	rows, _ := q.tx.Query(ctx, `
+    UPDATE tab_bills
+    SET is_closed = TRUE
+    WHERE shop_id = @shopId AND end_date < @today AND NOT is_closed
+    RETURNING tab_id, id, start_date, end_date, is_paid, is_closed, signoff_status, signed_off_at
+    `, pgx.NamedArgs{
+		"shopId": shopId,
+		"today":  today,
+	})
+	bills, err := pgx.CollectRows(rows, pgx.RowToStructByNameLax[closedBill])
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+
+	settled := make([]models.SettledBill, 0)
+	for i := range bills {
+		paid, err := q.settleBill(ctx, shopId, bills[i].TabId, &bills[i].BillOverview, today)
+		if err != nil {
+			return nil, err
+		}
+		if paid {
+			settled = append(settled, models.SettledBill{TabId: bills[i].TabId, BillId: bills[i].Id})
+		}
+	}
+	return settled, nil
+}
+
+type closedBill struct {
+	models.BillOverview
+	TabId int `db:"tab_id"`
+}
+
+// Removes upcoming bills which have no orders or payments so that they are regenerated with the tab's current schedule
+func (q *PgxQueries) resetUpcomingBills(ctx context.Context, shopId int, tabId int, today models.Date) error {
+	_, err := q.tx.Exec(ctx, `
+    DELETE FROM tab_bills AS b
+    WHERE b.shop_id = @shopId AND b.tab_id = @tabId AND b.start_date > @today
+      AND NOT b.is_paid AND NOT b.is_closed
+      AND NOT EXISTS(SELECT 1 FROM orders AS o WHERE o.shop_id = b.shop_id AND o.tab_id = b.tab_id AND o.bill_id = b.id)
+      AND NOT EXISTS(SELECT 1 FROM bill_payments AS p WHERE p.shop_id = b.shop_id AND p.tab_id = b.tab_id AND p.bill_id = b.id)
+    `, pgx.NamedArgs{
+		"shopId": shopId,
+		"tabId":  tabId,
+		"today":  today,
+	})
+	if err != nil {
+		return handlePgxError(err)
+	}
+	return nil
+}
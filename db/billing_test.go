@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/willtrojniak/TabAppBackend/models"
+)
+
+func TestEnsureBillingPeriodsSkipsElapsedPeriods(t *testing.T) {
+	f := newFixture(t)
+	today := models.DateOf(time.Now())
+	tabId := f.createTab(t, models.Date{Date: today.AddDays(-200)})
+	tab := f.getTab(t, tabId)
+
+	f.tx(t, func(q *PgxQueries) error {
+		return q.EnsureBillingPeriods(context.Background(), &tab.TabOverview, today)
+	})
+
+	bills := f.getTab(t, tabId).Bills
+	if len(bills) != 2 {
+		t.Fatalf("tab has %v bills, want the current and following periods", len(bills))
+	}
+	for _, b := range bills {
+		if b.EndDate.Before(today.Date) {
+			t.Errorf("bill %v - %v ended before %v", b.StartDate, b.EndDate, today)
+		}
+	}
+}
+
+func TestCutTabBillKeepsLaterOrdersOnTheCutDate(t *testing.T) {
+	tests := []struct {
+		name      string
+		following bool
+	}{
+		{name: "following bill moved up", following: true},
+		{name: "rest of period billed", following: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			now := time.Now()
+			today := models.DateOf(now)
+			tabId, bill := f.createBilledTab(t, 0)
+			if !tt.following {
+				f.tx(t, func(q *PgxQueries) error {
+					_, err := q.tx.Exec(context.Background(), `DELETE FROM tab_bills WHERE shop_id = $1 AND tab_id = $2 AND start_date > $3`,
+						f.shopId, tabId, bill.EndDate)
+					return err
+				})
+			}
+
+			tab := f.getTab(t, tabId)
+			f.tx(t, func(q *PgxQueries) error {
+				return q.CutTabBill(context.Background(), tab, bill.Id, today, today)
+			})
+			f.addOrder(t, tabId, now, itemOrder(f.createItem(t, "Item", 500, nil, nil), 1))
+
+			for _, b := range f.getTab(t, tabId).Bills {
+				if len(b.Items) == 0 {
+					continue
+				}
+				if b.Id == bill.Id {
+					t.Fatal("order was recorded against the closed bill")
+				}
+				if b.StartDate != today {
+					t.Errorf("order was recorded against a bill starting %v, want %v", b.StartDate, today)
+				}
+				return
+			}
+			t.Fatal("order was not recorded")
+		})
+	}
+}
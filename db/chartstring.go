@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/willtrojniak/TabAppBackend/models"
+)
+
+func (q *PgxQueries) GetChartstringFormats(ctx context.Context, shopId int) ([]models.ChartstringFormat, error) {
+	rows, err := q.tx.Query(ctx, `
+    SELECT id, name, segments, required_segments, separators, separator_optional, charset, checksum
+    FROM shop_chartstring_formats
+    WHERE shop_id = @shopId
+    ORDER BY id`,
+		pgx.NamedArgs{
+			"shopId": shopId,
+		})
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+
+	formats, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.ChartstringFormat])
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+	return formats, nil
+}
+
+// Replaces the shop's chartstring formats. Existing tabs are not revalidated.
+func (q *PgxQueries) SetChartstringFormats(ctx context.Context, shopId int, formats []models.ChartstringFormatCreate) error {
+	return q.WithTx(ctx, func(q *PgxQueries) error {
+		_, err := q.tx.Exec(ctx, `DELETE FROM shop_chartstring_formats WHERE shop_id = @shopId`,
+			pgx.NamedArgs{
+				"shopId": shopId,
+			})
+		if err != nil {
+			return handlePgxError(err)
+		}
+
+		for _, format := range formats {
+			_, err := q.tx.Exec(ctx, `
+        INSERT INTO shop_chartstring_formats (shop_id, name, segments, required_segments, separators, separator_optional, charset, checksum)
+        VALUES (@shopId, @name, @segments, @requiredSegments, @separators, @separatorOptional, @charset::chartstring_charset, @checksum::chartstring_checksum)`,
+				pgx.NamedArgs{
+					"shopId":            shopId,
+					"name":              format.Name,
+					"segments":          format.Segments,
+					"requiredSegments":  format.RequiredSegments,
+					"separators":        format.Separators,
+					"separatorOptional": format.SeparatorOptional,
+					"charset":           string(format.Charset),
+					"checksum":          string(format.Checksum),
+				})
+			if err != nil {
+				return handlePgxError(err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,160 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/willtrojniak/TabAppBackend/models"
+)
+
+func (q *PgxQueries) CreateBillCheckout(ctx context.Context, shopId int, tabId int, billId int, userId string, data *models.BillCheckoutCreate) (*models.BillCheckout, error) {
+	rows, _ := q.tx.Query(ctx, `
+    INSERT INTO bill_checkouts (shop_id, tab_id, bill_id, provider, session_id, checkout_url, amount, user_id, expires_at)
+    VALUES (@shopId, @tabId, @billId, @provider, @sessionId, @checkoutUrl, @amount, @userId, @expiresAt)
+    RETURNING id, shop_id, tab_id, bill_id, provider, session_id, checkout_url, amount, payment_id, unapplied_amount, unapplied_reference, unapplied_currency, created_at, expires_at, completed_at`,
+		pgx.NamedArgs{
+			"shopId":      shopId,
+			"tabId":       tabId,
+			"billId":      billId,
+			"provider":    data.Provider,
+			"sessionId":   data.SessionId,
+			"checkoutUrl": data.CheckoutURL,
+			"amount":      data.Amount,
+			"userId":      userId,
+			"expiresAt":   data.ExpiresAt,
+		})
+
+	checkout, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[models.BillCheckout])
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+	setUnappliedCurrency(checkout)
+	err = q.setShopCurrency(ctx, checkout.ShopId, checkout)
+	if err != nil {
+		return nil, err
+	}
+	return checkout, nil
+}
+
+// Gets the bill's latest checkout which is awaiting payment and has not expired, locking the bill until the transaction
+// completes so that only one checkout of the bill is started at a time. Returns nil if there is none.
+func (q *PgxQueries) GetPendingBillCheckout(ctx context.Context, shopId int, tabId int, billId int, now time.Time) (*models.BillCheckout, error) {
+	_, err := q.getBillForUpdate(ctx, shopId, tabId, billId)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, _ := q.tx.Query(ctx, `
+    SELECT id, shop_id, tab_id, bill_id, provider, session_id, checkout_url, amount, payment_id, unapplied_amount, unapplied_reference, unapplied_currency, created_at, expires_at, completed_at
+    FROM bill_checkouts
+    WHERE shop_id = @shopId AND tab_id = @tabId AND bill_id = @billId AND completed_at IS NULL AND expires_at > @now
+    ORDER BY created_at DESC, id DESC
+    LIMIT 1`,
+		pgx.NamedArgs{
+			"shopId": shopId,
+			"tabId":  tabId,
+			"billId": billId,
+			"now":    now,
+		})
+
+	checkouts, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[models.BillCheckout])
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+	if len(checkouts) == 0 {
+		return nil, nil
+	}
+	setUnappliedCurrency(checkouts[0])
+	err = q.setShopCurrency(ctx, shopId, checkouts[0])
+	if err != nil {
+		return nil, err
+	}
+	return checkouts[0], nil
+}
+
+// Gets the checkout created for the provider's session, locking it until the transaction completes
+func (q *PgxQueries) GetBillCheckoutForUpdate(ctx context.Context, provider string, sessionId string) (*models.BillCheckout, error) {
+	rows, _ := q.tx.Query(ctx, `
+    SELECT id, shop_id, tab_id, bill_id, provider, session_id, checkout_url, amount, payment_id, unapplied_amount, unapplied_reference, unapplied_currency, created_at, expires_at, completed_at
+    FROM bill_checkouts
+    WHERE provider = @provider AND session_id = @sessionId
+    FOR UPDATE`,
+		pgx.NamedArgs{
+			"provider":  provider,
+			"sessionId": sessionId,
+		})
+
+	checkout, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[models.BillCheckout])
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+	setUnappliedCurrency(checkout)
+	err = q.setShopCurrency(ctx, checkout.ShopId, checkout)
+	if err != nil {
+		return nil, err
+	}
+	return checkout, nil
+}
+
+// Gives the unapplied amount the currency it was captured in, which may not be the shop's
+func setUnappliedCurrency(checkout *models.BillCheckout) {
+	if checkout.UnappliedAmount != nil && checkout.UnappliedCurrency != nil {
+		checkout.UnappliedAmount.Currency = *checkout.UnappliedCurrency
+	}
+}
+
+// Records the payment confirmed by the provider against the bill and links it to the checkout.
+// Payments captured after the bill was posted to the journal cannot be applied to it, so they are kept on the checkout
+// as unapplied, to be refunded, and a nil payment id is returned.
+func (q *PgxQueries) CompleteBillCheckout(ctx context.Context, tab *models.Tab, checkout *models.BillCheckout, payerId string, data *models.BillPaymentCreate, today models.Date) (*int, error) {
+	return WithTxRet(ctx, q, func(q *PgxQueries) (*int, error) {
+		paymentId, err := q.RecordBillPayment(ctx, tab, checkout.BillId, payerId, data, today)
+		if errors.Is(err, ErrBillExported) {
+			return nil, q.CompleteBillCheckoutUnapplied(ctx, checkout, data.Amount, data.Reference)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = q.tx.Exec(ctx, `
+    UPDATE bill_checkouts
+    SET (payment_id, completed_at) = (@paymentId, NOW())
+    WHERE shop_id = @shopId AND tab_id = @tabId AND bill_id = @billId AND id = @checkoutId`,
+			pgx.NamedArgs{
+				"shopId":     checkout.ShopId,
+				"tabId":      checkout.TabId,
+				"billId":     checkout.BillId,
+				"checkoutId": checkout.Id,
+				"paymentId":  paymentId,
+			})
+		if err != nil {
+			return nil, handlePgxError(err)
+		}
+		return &paymentId, nil
+	})
+}
+
+// Completes the checkout without applying the captured payment to the bill, keeping the amount in the currency
+// it was captured in so that it can be refunded
+func (q *PgxQueries) CompleteBillCheckoutUnapplied(ctx context.Context, checkout *models.BillCheckout, amount models.Money, reference string) error {
+	amount = models.NewMoney(amount.Amount, amount.Currency)
+	_, err := q.tx.Exec(ctx, `
+    UPDATE bill_checkouts
+    SET (unapplied_amount, unapplied_reference, unapplied_currency, completed_at) = (@amount, @reference, @currency, NOW())
+    WHERE shop_id = @shopId AND tab_id = @tabId AND bill_id = @billId AND id = @checkoutId`,
+		pgx.NamedArgs{
+			"shopId":     checkout.ShopId,
+			"tabId":      checkout.TabId,
+			"billId":     checkout.BillId,
+			"checkoutId": checkout.Id,
+			"amount":     amount,
+			"reference":  reference,
+			"currency":   string(amount.Currency),
+		})
+	if err != nil {
+		return handlePgxError(err)
+	}
+	return nil
+}
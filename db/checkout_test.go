@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/willtrojniak/TabAppBackend/models"
+)
+
+func TestCompleteBillCheckout(t *testing.T) {
+	tests := []struct {
+		name          string
+		exported      bool
+		wantUnapplied bool
+	}{
+		{name: "open bill"},
+		{name: "exported bill", exported: true, wantUnapplied: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			tabId, bill := f.createBilledTab(t, 500)
+
+			var checkout *models.BillCheckout
+			f.tx(t, func(q *PgxQueries) error {
+				var err error
+				checkout, err = q.CreateBillCheckout(context.Background(), f.shopId, tabId, bill.Id, f.userId, &models.BillCheckoutCreate{
+					Provider:    "fake",
+					SessionId:   f.userId,
+					CheckoutURL: "https://example.com",
+					Amount:      models.NewMoney(500, ""),
+				})
+				return err
+			})
+			if tt.exported {
+				f.markExported(t, tabId, bill)
+			}
+
+			tab := f.getTab(t, tabId)
+			var paymentId *int
+			f.tx(t, func(q *PgxQueries) error {
+				var err error
+				paymentId, err = q.CompleteBillCheckout(context.Background(), tab, checkout, f.userId, &models.BillPaymentCreate{
+					Amount:    models.NewMoney(500, ""),
+					Method:    string(models.PaymentMethodCard),
+					Reference: "pi_test",
+				}, models.DateOf(time.Now()))
+				return err
+			})
+			if (paymentId == nil) != tt.wantUnapplied {
+				t.Fatalf("CompleteBillCheckout() payment = %v, want unapplied %v", paymentId, tt.wantUnapplied)
+			}
+
+			f.tx(t, func(q *PgxQueries) error {
+				completed, err := q.GetBillCheckoutForUpdate(context.Background(), "fake", f.userId)
+				if err != nil {
+					return err
+				}
+				if completed.CompletedAt == nil {
+					t.Error("checkout was not completed")
+				}
+				if (completed.UnappliedAmount != nil) != tt.wantUnapplied {
+					t.Errorf("checkout unapplied amount = %v, want unapplied %v", completed.UnappliedAmount, tt.wantUnapplied)
+				}
+				return nil
+			})
+		})
+	}
+}
+
+func TestCompleteBillCheckoutUnappliedKeepsCurrency(t *testing.T) {
+	f := newFixture(t)
+	tabId, bill := f.createBilledTab(t, 500)
+
+	f.tx(t, func(q *PgxQueries) error {
+		checkout, err := q.CreateBillCheckout(context.Background(), f.shopId, tabId, bill.Id, f.userId, &models.BillCheckoutCreate{
+			Provider:    "fake",
+			SessionId:   f.userId,
+			CheckoutURL: "https://example.com",
+			Amount:      models.NewMoney(500, ""),
+		})
+		if err != nil {
+			return err
+		}
+		err = q.CompleteBillCheckoutUnapplied(context.Background(), checkout, models.NewMoney(450, "EUR"), "pi_test")
+		if err != nil {
+			return err
+		}
+
+		completed, err := q.GetBillCheckoutForUpdate(context.Background(), "fake", f.userId)
+		if err != nil {
+			return err
+		}
+		if completed.PaymentId != nil || completed.UnappliedAmount == nil || *completed.UnappliedAmount != models.NewMoney(450, "EUR") {
+			t.Errorf("checkout payment = %v, unapplied = %v, want unapplied 450 EUR", completed.PaymentId, completed.UnappliedAmount)
+		}
+		return nil
+	})
+}
+
+func TestGetPendingBillCheckout(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name        string
+		expiresAt   time.Time
+		completed   bool
+		wantPending bool
+	}{
+		{name: "awaiting payment", expiresAt: now.Add(time.Hour), wantPending: true},
+		{name: "expired", expiresAt: now.Add(-time.Minute)},
+		{name: "completed", expiresAt: now.Add(time.Hour), completed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			tabId, bill := f.createBilledTab(t, 500)
+
+			f.tx(t, func(q *PgxQueries) error {
+				checkout, err := q.CreateBillCheckout(context.Background(), f.shopId, tabId, bill.Id, f.userId, &models.BillCheckoutCreate{
+					Provider:    "fake",
+					SessionId:   f.userId,
+					CheckoutURL: "https://example.com",
+					Amount:      models.NewMoney(500, ""),
+					ExpiresAt:   tt.expiresAt,
+				})
+				if err != nil {
+					return err
+				}
+				if tt.completed {
+					err = q.CompleteBillCheckoutUnapplied(context.Background(), checkout, models.NewMoney(500, ""), "pi_test")
+					if err != nil {
+						return err
+					}
+				}
+
+				pending, err := q.GetPendingBillCheckout(context.Background(), f.shopId, tabId, bill.Id, now)
+				if err != nil {
+					return err
+				}
+				if (pending != nil) != tt.wantPending {
+					t.Errorf("GetPendingBillCheckout() = %v, want pending %v", pending, tt.wantPending)
+				}
+				return nil
+			})
+		})
+	}
+}
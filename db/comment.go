@@ -0,0 +1,71 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/willtrojniak/TabAppBackend/models"
+)
+
+func (q *PgxQueries) GetBillComments(ctx context.Context, shopId int, tabId int, billId int) ([]models.BillComment, error) {
+	return q.getBillComments(ctx, shopId, tabId, billId, nil)
+}
+
+func (q *PgxQueries) GetBillCommentById(ctx context.Context, shopId int, tabId int, billId int, commentId int) (*models.BillComment, error) {
+	comments, err := q.getBillComments(ctx, shopId, tabId, billId, &commentId)
+	if err != nil {
+		return nil, err
+	}
+	if len(comments) == 0 {
+		return nil, handlePgxError(pgx.ErrNoRows)
+	}
+	return &comments[0], nil
+}
+
+func (q *PgxQueries) getBillComments(ctx context.Context, shopId int, tabId int, billId int, commentId *int) ([]models.BillComment, error) {
+	rows, err := q.tx.Query(ctx, `
+    SELECT c.id, c.bill_id, c.user_id, users.name AS user_name, c.body, c.created_at
+    FROM bill_comments AS c
+    LEFT JOIN users ON users.id = c.user_id
+    WHERE c.shop_id = @shopId AND c.tab_id = @tabId AND c.bill_id = @billId
+      AND ((@commentId::INTEGER IS NULL) OR (c.id = @commentId))
+    ORDER BY c.created_at, c.id`,
+		pgx.NamedArgs{
+			"shopId":    shopId,
+			"tabId":     tabId,
+			"billId":    billId,
+			"commentId": commentId,
+		})
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+
+	comments, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.BillComment])
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+	return comments, nil
+}
+
+func (q *PgxQueries) AddBillComment(ctx context.Context, shopId int, tabId int, billId int, userId string, data *models.BillCommentCreate) (int, error) {
+	return q.insertBillComment(ctx, shopId, tabId, billId, userId, data.Body)
+}
+
+func (q *PgxQueries) insertBillComment(ctx context.Context, shopId int, tabId int, billId int, userId string, body string) (int, error) {
+	var commentId int
+	err := q.tx.QueryRow(ctx, `
+    INSERT INTO bill_comments (shop_id, tab_id, bill_id, user_id, body)
+    VALUES (@shopId, @tabId, @billId, @userId, @body)
+    RETURNING id`,
+		pgx.NamedArgs{
+			"shopId": shopId,
+			"tabId":  tabId,
+			"billId": billId,
+			"userId": userId,
+			"body":   body,
+		}).Scan(&commentId)
+	if err != nil {
+		return 0, handlePgxError(err)
+	}
+	return commentId, nil
+}
@@ -59,6 +59,10 @@ func (q *PgxQueries) GetItems(ctx context.Context, shopId int) ([]models.ItemOve
 	if err != nil {
 		return nil, handlePgxError(err)
 	}
+	err = q.setShopCurrency(ctx, shopId, items)
+	if err != nil {
+		return nil, err
+	}
 
 	return items, nil
 
@@ -114,6 +118,10 @@ func (q *PgxQueries) GetItem(ctx context.Context, shopId int, itemId int) (*mode
 	if err != nil {
 		return nil, handlePgxError(err)
 	}
+	err = q.setShopCurrency(ctx, shopId, item)
+	if err != nil {
+		return nil, err
+	}
 
 	return item, nil
 
@@ -0,0 +1,316 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/willtrojniak/TabAppBackend/models"
+	"github.com/willtrojniak/TabAppBackend/services"
+)
+
+// Gets the shop's journal settings. Shops which have not configured journal exports have no revenue account.
+func (q *PgxQueries) GetJournalSettings(ctx context.Context, shopId int) (*models.JournalSettings, error) {
+	rows, err := q.tx.Query(ctx, `
+    SELECT COALESCE(s.revenue_account, '') AS revenue_account, s.export_day,
+      (SELECT COALESCE(json_agg(c ORDER BY c.position), '[]')
+        FROM (SELECT position, header, field, value
+              FROM shop_journal_columns
+              WHERE shop_id = shops.id) AS c
+      ) AS columns
+    FROM shops
+    LEFT JOIN shop_journal_settings AS s ON s.shop_id = shops.id
+    WHERE shops.id = @shopId`,
+		pgx.NamedArgs{
+			"shopId": shopId,
+		})
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+
+	settings, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[models.JournalSettings])
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+	return settings, nil
+}
+
+func (q *PgxQueries) SetJournalSettings(ctx context.Context, shopId int, data *models.JournalSettingsUpdate) error {
+	return q.WithTx(ctx, func(q *PgxQueries) error {
+		_, err := q.tx.Exec(ctx, `
+    INSERT INTO shop_journal_settings (shop_id, revenue_account, export_day)
+    VALUES (@shopId, @revenueAccount, @exportDay)
+    ON CONFLICT (shop_id) DO UPDATE
+    SET (revenue_account, export_day) = (excluded.revenue_account, excluded.export_day)`,
+			pgx.NamedArgs{
+				"shopId":         shopId,
+				"revenueAccount": data.RevenueAccount,
+				"exportDay":      data.ExportDay,
+			})
+		if err != nil {
+			return handlePgxError(err)
+		}
+
+		_, err = q.tx.Exec(ctx, `DELETE FROM shop_journal_columns WHERE shop_id = @shopId`,
+			pgx.NamedArgs{
+				"shopId": shopId,
+			})
+		if err != nil {
+			return handlePgxError(err)
+		}
+
+		for i, column := range data.Columns {
+			_, err := q.tx.Exec(ctx, `
+        INSERT INTO shop_journal_columns (shop_id, position, header, field, value)
+        VALUES (@shopId, @position, @header, @field::journal_field, @value)`,
+				pgx.NamedArgs{
+					"shopId":   shopId,
+					"position": i,
+					"header":   column.Header,
+					"field":    string(column.Field),
+					"value":    column.Value,
+				})
+			if err != nil {
+				return handlePgxError(err)
+			}
+		}
+		return nil
+	})
+}
+
+func (q *PgxQueries) GetJournalExports(ctx context.Context, shopId int) ([]models.JournalExportOverview, error) {
+	rows, err := q.tx.Query(ctx, `
+    SELECT e.id, e.start_date, e.end_date, e.revenue_account, e.user_id, e.created_at,
+      (SELECT COALESCE(SUM(l.amount), 0)::BIGINT
+        FROM journal_export_lines AS l
+        WHERE l.shop_id = e.shop_id AND l.export_id = e.id
+      ) AS total
+    FROM journal_exports AS e
+    WHERE e.shop_id = @shopId
+    ORDER BY e.created_at DESC, e.id DESC`,
+		pgx.NamedArgs{
+			"shopId": shopId,
+		})
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+
+	exports, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.JournalExportOverview])
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+	err = q.setShopCurrency(ctx, shopId, exports)
+	if err != nil {
+		return nil, err
+	}
+	return exports, nil
+}
+
+func (q *PgxQueries) GetJournalExportById(ctx context.Context, shopId int, exportId int) (*models.JournalExport, error) {
+	rows, err := q.tx.Query(ctx, `
+    SELECT e.id, e.start_date, e.end_date, e.revenue_account, e.user_id, e.created_at,
+      (SELECT COALESCE(SUM(l.amount), 0)::BIGINT
+        FROM journal_export_lines AS l
+        WHERE l.shop_id = e.shop_id AND l.export_id = e.id
+      ) AS total,
+      (SELECT COALESCE(json_agg(lines ORDER BY lines.id), '[]')
+        FROM (SELECT l.id, l.tab_id, tabs.display_name AS tab_name, l.bill_id, b.start_date AS bill_start_date, b.end_date AS bill_end_date,
+                l.chartstring, l.amount
+              FROM journal_export_lines AS l
+              JOIN tabs ON tabs.shop_id = l.shop_id AND tabs.id = l.tab_id
+              JOIN tab_bills AS b ON b.shop_id = l.shop_id AND b.tab_id = l.tab_id AND b.id = l.bill_id
+              WHERE l.shop_id = e.shop_id AND l.export_id = e.id) AS lines
+      ) AS lines
+    FROM journal_exports AS e
+    WHERE e.shop_id = @shopId AND e.id = @exportId`,
+		pgx.NamedArgs{
+			"shopId":   shopId,
+			"exportId": exportId,
+		})
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+
+	export, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[models.JournalExport])
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+	err = q.setShopCurrency(ctx, shopId, export)
+	if err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// Returned when none of the period's bills have an outstanding balance to export
+var ErrNoJournalBills = services.NewDataConflictServiceError(errors.New("No bills to export"))
+
+type journalBill struct {
+	TabId  int `db:"tab_id"`
+	BillId int `db:"bill_id"`
+}
+
+// Collects the closed bills of the shop's chartstring tabs which ended by the end of the period, have been approved
+// by the tab owner and have not been exported, locking them until the transaction completes. Bills approved after
+// their own period was exported are carried over to the next export.
+func (q *PgxQueries) getUnexportedBills(ctx context.Context, shopId int, endDate models.Date) ([]journalBill, error) {
+	rows, err := q.tx.Query(ctx, `
+    SELECT b.tab_id, b.id AS bill_id
+    FROM tab_bills AS b
+    JOIN tabs ON tabs.shop_id = b.shop_id AND tabs.id = b.tab_id
+    WHERE b.shop_id = @shopId AND b.is_closed AND b.journal_export_id IS NULL
+      AND b.signoff_status = 'approved' AND b.end_date <= @endDate
+      AND tabs.payment_method = ANY(@methods)
+    ORDER BY b.tab_id, b.end_date
+    FOR UPDATE OF b`,
+		pgx.NamedArgs{
+			"shopId":  shopId,
+			"endDate": endDate,
+			"methods": models.JournalPaymentMethods(),
+		})
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+
+	bills, err := pgx.CollectRows(rows, pgx.RowToStructByName[journalBill])
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+	return bills, nil
+}
+
+// Posts the outstanding balances of the period's unexported, approved chartstring bills to a new journal export
+// and marks the bills as exported, recording the posted balances as their payment. Bills without an outstanding
+// balance are left unexported. The export starts on the earliest start date of the bills it posts, which precedes
+// the period for bills carried over. Returns the export along with the bills which have been paid by it.
+func (q *PgxQueries) CreateJournalExport(ctx context.Context, shop *models.Shop, data *models.JournalExportCreate, revenueAccount string, userId *string) (int, []models.SettledBill, error) {
+	var exportId int
+	settled := make([]models.SettledBill, 0)
+	err := q.WithTx(ctx, func(q *PgxQueries) error {
+		bills, err := q.getUnexportedBills(ctx, int(shop.Id), data.EndDate)
+		if err != nil {
+			return err
+		}
+
+		lines := make([]models.JournalExportLine, 0)
+		exported := make([]exportedBill, 0, len(bills))
+		var tab *models.Tab
+		for _, b := range bills {
+			if tab == nil || tab.Id != b.TabId {
+				tab, err = q.GetTabById(ctx, int(shop.Id), b.TabId)
+				if err != nil {
+					return err
+				}
+			}
+
+			for i := range tab.Bills {
+				if tab.Bills[i].Id == b.BillId {
+					billLines, err := models.JournalLinesOf(tab, &tab.Bills[i], shop.ChartstringFormats)
+					if err != nil {
+						return err
+					}
+					if len(billLines) > 0 {
+						exported = append(exported, exportedBill{tab: tab, bill: &tab.Bills[i].BillOverview, lines: billLines})
+					}
+					lines = append(lines, billLines...)
+				}
+			}
+		}
+
+		if len(lines) == 0 {
+			return ErrNoJournalBills
+		}
+
+		startDate := exported[0].bill.StartDate
+		for _, e := range exported[1:] {
+			if e.bill.StartDate.Before(startDate.Date) {
+				startDate = e.bill.StartDate
+			}
+		}
+
+		err = q.tx.QueryRow(ctx, `
+    INSERT INTO journal_exports (shop_id, start_date, end_date, revenue_account, user_id)
+    VALUES (@shopId, @startDate, @endDate, @revenueAccount, @userId)
+    RETURNING id`,
+			pgx.NamedArgs{
+				"shopId":         shop.Id,
+				"startDate":      startDate,
+				"endDate":        data.EndDate,
+				"revenueAccount": revenueAccount,
+				"userId":         userId,
+			}).Scan(&exportId)
+		if err != nil {
+			return handlePgxError(err)
+		}
+
+		for _, line := range lines {
+			_, err := q.tx.Exec(ctx, `
+      INSERT INTO journal_export_lines (shop_id, export_id, tab_id, bill_id, chartstring, amount)
+      VALUES (@shopId, @exportId, @tabId, @billId, @chartstring, @amount)`,
+				pgx.NamedArgs{
+					"shopId":      shop.Id,
+					"exportId":    exportId,
+					"tabId":       line.TabId,
+					"billId":      line.BillId,
+					"chartstring": line.Chartstring,
+					"amount":      line.Amount,
+				})
+			if err != nil {
+				return handlePgxError(err)
+			}
+		}
+
+		_, err = q.tx.Exec(ctx, `
+    UPDATE tab_bills AS b
+    SET journal_export_id = @exportId
+    WHERE EXISTS(SELECT 1 FROM journal_export_lines AS l
+                 WHERE l.shop_id = b.shop_id AND l.tab_id = b.tab_id AND l.bill_id = b.id
+                   AND l.shop_id = @shopId AND l.export_id = @exportId)`,
+			pgx.NamedArgs{
+				"shopId":   shop.Id,
+				"exportId": exportId,
+			})
+		if err != nil {
+			return handlePgxError(err)
+		}
+
+		// The exported balances are paid through the journal, settling the bills
+		for _, e := range exported {
+			amounts := make([]models.Money, len(e.lines))
+			for i, line := range e.lines {
+				amounts[i] = line.Amount
+			}
+			amount, err := models.Sum(amounts...)
+			if err != nil {
+				return err
+			}
+			_, err = q.insertBillPayment(ctx, e.tab.ShopId, e.tab.Id, e.bill.Id, userId, &models.BillPaymentCreate{
+				Amount:    amount,
+				Method:    e.tab.PaymentMethod,
+				Reference: fmt.Sprintf("Journal export %v", exportId),
+			})
+			if err != nil {
+				return err
+			}
+			paid, err := q.settleBill(ctx, e.tab.ShopId, e.tab.Id, e.bill, shop.Today())
+			if err != nil {
+				return err
+			}
+			if paid {
+				settled = append(settled, models.SettledBill{TabId: e.tab.Id, BillId: e.bill.Id})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return exportId, settled, nil
+}
+
+type exportedBill struct {
+	tab   *models.Tab
+	bill  *models.BillOverview
+	lines []models.JournalExportLine
+}
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/willtrojniak/TabAppBackend/models"
+	"github.com/willtrojniak/TabAppBackend/services"
+)
+
+// Replaces the limit rules of the tab
+func (q *PgxQueries) SetTabLimitRules(ctx context.Context, shopId int, tabId int, rules []models.TabLimitRuleCreate) error {
+	return WithTx(ctx, q, func(q *PgxQueries) error {
+		_, err := q.tx.Exec(ctx, `DELETE FROM tab_limit_rules WHERE shop_id = @shopId AND tab_id = @tabId`,
+			pgx.NamedArgs{
+				"shopId": shopId,
+				"tabId":  tabId,
+			})
+		if err != nil {
+			return handlePgxError(err)
+		}
+
+		for i, rule := range rules {
+			// Rules are only inserted if the targeted item or category belongs to the shop
+			result, err := q.tx.Exec(ctx, `
+        INSERT INTO tab_limit_rules (shop_id, tab_id, target, item_id, category_id, scope, period, max_quantity, max_amount)
+        SELECT @shopId, @tabId, @target::limit_rule_target,
+          CASE WHEN @target::limit_rule_target = 'item' THEN @targetId::INTEGER END,
+          CASE WHEN @target::limit_rule_target = 'category' THEN @targetId::INTEGER END,
+          @scope::limit_rule_scope, @period::limit_rule_period, @maxQuantity::INTEGER, @maxAmount::BIGINT
+        WHERE (@target::limit_rule_target = 'item' AND EXISTS(SELECT 1 FROM items WHERE shop_id = @shopId AND id = @targetId))
+          OR (@target::limit_rule_target = 'category' AND EXISTS(SELECT 1 FROM item_categories WHERE shop_id = @shopId AND id = @targetId))`,
+				pgx.NamedArgs{
+					"shopId":      shopId,
+					"tabId":       tabId,
+					"target":      string(rule.Target),
+					"targetId":    rule.TargetId,
+					"scope":       string(rule.Scope),
+					"period":      string(rule.Period),
+					"maxQuantity": rule.MaxQuantity,
+					"maxAmount":   rule.MaxAmount,
+				})
+			if err != nil {
+				return handlePgxError(err)
+			}
+			if result.RowsAffected() != 1 {
+				return services.NewValidationServiceError(errors.New("Limit rule target does not exist"), services.ValidationErrors{
+					fmt.Sprintf("rules[%v].target_id", i): services.ValidationError{Value: rule.TargetId, Error: "invalid"},
+				})
+			}
+		}
+		return nil
+	})
+}
+
+// Gets the usage of each of the tab's limit rules, including the order staged in the temporary order tables.
+// Per day rules count the orders created in [dayStart, dayStart + 1 day), per bill rules count the orders on the bill.
+func (q *PgxQueries) getTabLimitRuleUsages(ctx context.Context, shopId int, tabId int, billId int, dayStart time.Time, person *string) ([]models.TabLimitRuleUsage, error) {
+	return q.queryLimitRuleUsages(ctx, pendingLimitRuleUsage, shopId, tabId, &billId, dayStart, person)
+}
+
+// Gets the usage of the tab's limit rules by the person, without a pending order.
+// Nil billId indicates that no orders are counted against per bill rules.
+func (q *PgxQueries) GetMemberLimitRuleUsages(ctx context.Context, shopId int, tabId int, billId *int, dayStart time.Time, person string) ([]models.TabLimitRuleUsage, error) {
+	return q.queryLimitRuleUsages(ctx,
+		`LEFT JOIN LATERAL (SELECT 0 AS quantity, 0 AS amount) AS pending ON TRUE`, shopId, tabId, billId, dayStart, &person)
+}
+
+// Prices the order staged in the temporary order tables against each rule it applies to
+const pendingLimitRuleUsage = `LEFT JOIN LATERAL (
+      SELECT SUM(p.quantity) AS quantity, SUM(p.amount) AS amount
+      FROM
+      (SELECT t.quantity,
+        i.base_price * t.quantity +
+        COALESCE((SELECT SUM(iv.price * tv.quantity) FROM _temp_order_variants AS tv
+          JOIN item_variants AS iv ON iv.shop_id = i.shop_id AND iv.item_id = tv.item_id AND iv.id = tv.variant_id
+          WHERE tv.item_id = t.item_id), 0) +
+        COALESCE((SELECT SUM(addons.base_price * ta.quantity) FROM _temp_order_addons AS ta
+          JOIN items AS addons ON addons.shop_id = i.shop_id AND addons.id = ta.addon_id
+          WHERE ta.item_id = t.item_id), 0) +
+        COALESCE((SELECT SUM(subs.price * ts.quantity) FROM _temp_order_substitutions AS ts
+          JOIN item_substitution_prices AS subs ON subs.shop_id = i.shop_id
+            AND subs.substitution_group_id = ts.substitution_group_id AND subs.item_id = ts.substitution_id
+          WHERE ts.item_id = t.item_id), 0) AS amount
+        FROM (SELECT item_id, SUM(quantity) AS quantity FROM _temp_order_items GROUP BY item_id) AS t
+        JOIN items AS i ON i.shop_id = r.shop_id AND i.id = t.item_id
+        WHERE t.item_id = r.item_id OR EXISTS(SELECT 1 FROM items_to_categories AS ic
+          WHERE ic.shop_id = i.shop_id AND ic.item_id = t.item_id AND ic.item_category_id = r.category_id)
+      ) AS p
+    ) AS pending ON TRUE`
+
+func (q *PgxQueries) queryLimitRuleUsages(ctx context.Context, pendingJoin string, shopId int, tabId int, billId *int, dayStart time.Time, person *string) ([]models.TabLimitRuleUsage, error) {
+	rows, err := q.tx.Query(ctx, fmt.Sprintf(`
+    SELECT r.id, r.target, COALESCE(r.item_id, r.category_id) AS target_id, COALESCE(items.name, item_categories.name) AS target_name,
+      r.scope, r.period, r.max_quantity, r.max_amount,
+      COALESCE(used.quantity, 0)::INTEGER AS used_quantity, COALESCE(used.amount, 0)::BIGINT AS used_amount,
+      COALESCE(pending.quantity, 0)::INTEGER AS pending_quantity, COALESCE(pending.amount, 0)::BIGINT AS pending_amount
+    FROM tab_limit_rules AS r
+    LEFT JOIN items ON items.shop_id = r.shop_id AND items.id = r.item_id
+    LEFT JOIN item_categories ON item_categories.shop_id = r.shop_id AND item_categories.id = r.category_id
+    LEFT JOIN LATERAL (
+      SELECT SUM(l.sign * l.quantity) AS quantity, SUM(l.sign * l.amount) AS amount
+      FROM
+      (SELECT CASE WHEN o.type = 'remove' THEN -1 ELSE 1 END AS sign, oi.quantity,
+        oi.unit_price * oi.quantity +
+        COALESCE((SELECT SUM(ov.unit_price * ov.quantity) FROM order_variants AS ov
+          WHERE ov.shop_id = oi.shop_id AND ov.tab_id = oi.tab_id AND ov.bill_id = oi.bill_id AND ov.order_item_id = oi.id), 0) +
+        COALESCE((SELECT SUM(oa.unit_price * oa.quantity) FROM order_addons AS oa
+          WHERE oa.shop_id = oi.shop_id AND oa.tab_id = oi.tab_id AND oa.bill_id = oi.bill_id AND oa.order_item_id = oi.id), 0) +
+        COALESCE((SELECT SUM(os.unit_price * os.quantity) FROM order_substitutions AS os
+          WHERE os.shop_id = oi.shop_id AND os.tab_id = oi.tab_id AND os.bill_id = oi.bill_id AND os.order_item_id = oi.id), 0) AS amount
+        FROM order_items AS oi
+        JOIN orders AS o ON o.shop_id = oi.shop_id AND o.tab_id = oi.tab_id AND o.bill_id = oi.bill_id AND o.id = oi.order_id
+        JOIN order_item_orderers AS oo ON oo.shop_id = oi.shop_id AND oo.tab_id = oi.tab_id AND oo.bill_id = oi.bill_id AND oo.order_item_id = oi.id
+        WHERE oi.shop_id = r.shop_id AND oi.tab_id = r.tab_id
+          AND NOT EXISTS(SELECT 1 FROM order_voids AS v WHERE v.shop_id = o.shop_id AND v.tab_id = o.tab_id AND v.bill_id = o.bill_id AND v.order_id = o.id)
+          AND (oi.item_id = r.item_id OR EXISTS(SELECT 1 FROM items_to_categories AS ic
+            WHERE ic.shop_id = oi.shop_id AND ic.item_id = oi.item_id AND ic.item_category_id = r.category_id))
+          AND ((r.period = 'bill' AND oi.bill_id = @billId::INTEGER) OR (r.period = 'day' AND o.created_at >= @dayStart AND o.created_at < @dayEnd))
+          AND (r.scope = 'tab' OR COALESCE(LOWER(oo.ordered_by_email), LOWER(oo.ordered_by_name)) = @person)
+      ) AS l
+    ) AS used ON TRUE
+    %s
+    WHERE r.shop_id = @shopId AND r.tab_id = @tabId
+    ORDER BY r.id`, pendingJoin),
+		pgx.NamedArgs{
+			"shopId":   shopId,
+			"tabId":    tabId,
+			"billId":   billId,
+			"dayStart": dayStart,
+			"dayEnd":   dayStart.AddDate(0, 0, 1),
+			"person":   person,
+		})
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+
+	usages, err := pgx.CollectRows(rows, pgx.RowToStructByNameLax[models.TabLimitRuleUsage])
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+	err = q.setShopCurrency(ctx, shopId, usages)
+	if err != nil {
+		return nil, err
+	}
+	return usages, nil
+}
@@ -0,0 +1,450 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/willtrojniak/TabAppBackend/models"
+	"github.com/willtrojniak/TabAppBackend/services"
+)
+
+func (q *PgxQueries) GetTabOrders(ctx context.Context, shopId int, tabId int, params *models.GetOrdersQueryParams) ([]models.Order, error) {
+	if params == nil {
+		return nil, services.NewInternalServiceError(nil)
+	}
+	return q.getTabOrders(ctx, shopId, tabId, nil, params.OrderedByEmail, params.Limit, params.Offset)
+}
+
+func (q *PgxQueries) GetTabOrderById(ctx context.Context, shopId int, tabId int, orderId int) (*models.Order, error) {
+	orders, err := q.getTabOrders(ctx, shopId, tabId, &orderId, nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, services.NewNotFoundServiceError(nil)
+	}
+	return &orders[0], nil
+}
+
+func (q *PgxQueries) getTabOrders(ctx context.Context, shopId int, tabId int, orderId *int, orderedByEmail *string, limit *int, offset int) ([]models.Order, error) {
+	rows, err := q.tx.Query(ctx, `
+    SELECT o.id, o.bill_id, o.type, o.staff_id, users.name AS staff_name, o.location_id, locations.name AS location_name,
+      o.schedule_override, o.ordered_by_name, o.ordered_by_email, tab_vouchers.code AS voucher_code, o.created_at,
+      (SELECT COALESCE(json_agg(items ORDER BY items.id) FILTER (WHERE items.id IS NOT NULL), '[]') AS items
+        FROM
+        (SELECT oi.id, oi.item_id, oi.name, oi.unit_price, oi.quantity,
+          (SELECT COALESCE(json_agg(variants ORDER BY variants.variant_id) FILTER (WHERE variants.variant_id IS NOT NULL), '[]') AS variants
+            FROM
+            (SELECT ov.variant_id, ov.name, ov.unit_price, ov.quantity
+              FROM order_variants AS ov
+              WHERE ov.shop_id = oi.shop_id AND ov.tab_id = oi.tab_id AND ov.bill_id = oi.bill_id AND ov.order_item_id = oi.id) AS variants
+          ) AS variants,
+          (SELECT COALESCE(json_agg(addons ORDER BY addons.addon_id) FILTER (WHERE addons.addon_id IS NOT NULL), '[]') AS addons
+            FROM
+            (SELECT oa.addon_id, oa.name, oa.unit_price, oa.quantity
+              FROM order_addons AS oa
+              WHERE oa.shop_id = oi.shop_id AND oa.tab_id = oi.tab_id AND oa.bill_id = oi.bill_id AND oa.order_item_id = oi.id) AS addons
+          ) AS addons,
+          (SELECT COALESCE(json_agg(substitutions ORDER BY substitutions.substitution_group_id, substitutions.substitution_id) FILTER (WHERE substitutions.substitution_id IS NOT NULL), '[]') AS substitutions
+            FROM
+            (SELECT os.substitution_group_id, os.substitution_id, os.name, os.unit_price, os.quantity
+              FROM order_substitutions AS os
+              WHERE os.shop_id = oi.shop_id AND os.tab_id = oi.tab_id AND os.bill_id = oi.bill_id AND os.order_item_id = oi.id) AS substitutions
+          ) AS substitutions
+          FROM order_items AS oi
+          WHERE oi.shop_id = o.shop_id AND oi.tab_id = o.tab_id AND oi.bill_id = o.bill_id AND oi.order_id = o.id) AS items
+      ) AS items,
+      (SELECT to_jsonb(voids) AS void
+        FROM
+        (SELECT v.order_id, v.reason, v.note, v.paid_bill_override, v.staff_id, void_staff.name AS staff_name, v.created_at
+          FROM order_voids AS v
+          LEFT JOIN users AS void_staff ON void_staff.id = v.staff_id
+          WHERE v.shop_id = o.shop_id AND v.tab_id = o.tab_id AND v.bill_id = o.bill_id AND v.order_id = o.id) AS voids
+      ) AS void,
+      (SELECT to_jsonb(transfers) AS transfer
+        FROM
+        (SELECT t.id, t.source_tab_id, t.source_bill_id, t.source_order_id, t.removal_order_id,
+            t.target_tab_id, t.target_bill_id, t.target_order_id, t.note, t.staff_id, transfer_staff.name AS staff_name, t.created_at,
+            (SELECT COALESCE(json_agg(ti.order_item_id ORDER BY ti.order_item_id), '[]')
+              FROM order_transfer_items AS ti
+              WHERE ti.shop_id = t.shop_id AND ti.transfer_id = t.id) AS order_item_ids
+          FROM order_transfers AS t
+          LEFT JOIN users AS transfer_staff ON transfer_staff.id = t.staff_id
+          WHERE t.shop_id = o.shop_id
+            AND ((t.source_tab_id = o.tab_id AND t.source_bill_id = o.bill_id AND t.removal_order_id = o.id)
+              OR (t.target_tab_id = o.tab_id AND t.target_bill_id = o.bill_id AND t.target_order_id = o.id))) AS transfers
+      ) AS transfer
+    FROM orders AS o
+    LEFT JOIN users ON users.id = o.staff_id
+    LEFT JOIN locations ON locations.shop_id = o.shop_id AND locations.id = o.location_id
+    LEFT JOIN voucher_redemptions ON voucher_redemptions.shop_id = o.shop_id AND voucher_redemptions.tab_id = o.tab_id
+      AND voucher_redemptions.bill_id = o.bill_id AND voucher_redemptions.order_id = o.id
+    LEFT JOIN tab_vouchers ON tab_vouchers.shop_id = voucher_redemptions.shop_id AND tab_vouchers.tab_id = voucher_redemptions.tab_id
+      AND tab_vouchers.id = voucher_redemptions.voucher_id
+    WHERE o.shop_id = @shopId AND o.tab_id = @tabId AND ((@orderId::INTEGER IS NULL) OR (o.id = @orderId))
+      AND ((@orderedByEmail::TEXT IS NULL) OR (LOWER(o.ordered_by_email) = LOWER(@orderedByEmail)))
+    ORDER BY o.created_at DESC, o.id DESC
+    LIMIT @limit OFFSET @offset`,
+		pgx.NamedArgs{
+			"shopId":         shopId,
+			"tabId":          tabId,
+			"orderId":        orderId,
+			"orderedByEmail": orderedByEmail,
+			"limit":          limit,
+			"offset":         offset,
+		})
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+
+	orders, err := pgx.CollectRows(rows, pgx.RowToStructByNameLax[models.Order])
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+	err = q.setShopCurrency(ctx, shopId, orders)
+	if err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// Voids the order, settling its bill against the reduced total. Voids on paid bills may leave the bill overpaid.
+func (q *PgxQueries) VoidTabOrder(ctx context.Context, shopId int, tabId int, orderId int, staffId string, data *models.OrderVoidCreate, today models.Date) error {
+	return q.WithTx(ctx, func(q *PgxQueries) error {
+		row := q.tx.QueryRow(ctx, `
+    INSERT INTO order_voids (shop_id, tab_id, bill_id, order_id, reason, note, paid_bill_override, staff_id)
+    SELECT o.shop_id, o.tab_id, o.bill_id, o.id, @reason, @note, @paidBillOverride, @staffId
+    FROM orders AS o
+    WHERE o.shop_id = @shopId AND o.tab_id = @tabId AND o.id = @orderId
+    RETURNING bill_id`,
+			pgx.NamedArgs{
+				"shopId":           shopId,
+				"tabId":            tabId,
+				"orderId":          orderId,
+				"reason":           string(data.Reason),
+				"note":             data.Note,
+				"paidBillOverride": data.PaidBillOverride,
+				"staffId":          staffId,
+			})
+
+		var billId int
+		err := row.Scan(&billId)
+		if err != nil {
+			return handlePgxError(err)
+		}
+
+		bill, err := q.getBillForUpdate(ctx, shopId, tabId, billId)
+		if err != nil {
+			return err
+		}
+
+		// Voiding an addition may leave later removals without a matching order
+		err = q.validateBillQuantities(ctx, shopId, tabId, billId)
+		if err != nil {
+			return err
+		}
+
+		err = q.resetBillSignoff(ctx, shopId, tabId, billId)
+		if err != nil {
+			return err
+		}
+
+		// The bill's payments may now cover its reduced total
+		_, err = q.settleBill(ctx, shopId, tabId, bill, today)
+		return err
+	})
+}
+
+func (q *PgxQueries) insertOrder(ctx context.Context, shopId int, tabId int, billId int, orderType models.OrderType, staffId string, data *models.BillOrderCreate) (int, error) {
+	row := q.tx.QueryRow(ctx, `
+    INSERT INTO orders (shop_id, tab_id, bill_id, type, staff_id, location_id, schedule_override, ordered_by_name, ordered_by_email)
+    VALUES (@shopId, @tabId, @billId, @type, @staffId, @locationId, @scheduleOverride, @orderedByName, @orderedByEmail)
+    RETURNING id`,
+		pgx.NamedArgs{
+			"shopId":           shopId,
+			"tabId":            tabId,
+			"billId":           billId,
+			"type":             string(orderType),
+			"staffId":          staffId,
+			"locationId":       data.LocationId,
+			"scheduleOverride": data.ScheduleOverride,
+			"orderedByName":    data.OrderedByName,
+			"orderedByEmail":   data.OrderedByEmail,
+		})
+
+	var orderId int
+	err := row.Scan(&orderId)
+	if err != nil {
+		return 0, handlePgxError(err)
+	}
+	return orderId, nil
+}
+
+// Records the order staged in the temporary order tables as one line per staged line, capturing the current name and price
+// of each item and variant.
+// Removals are instead matched against the quantity still remaining on the bill at each name and price the same item,
+// variant, addon or substitution was captured at, oldest first, so that items ordered before a price change are credited
+// at the price they were charged. A line that spans several captured prices is recorded once per price, and any quantity
+// beyond what remains is captured at the current price.
+func (q *PgxQueries) insertOrderLines(ctx context.Context, shopId int, tabId int, billId int, orderId int, orderType models.OrderType, staged stagedOrder) error {
+	args := pgx.NamedArgs{
+		"shopId":    shopId,
+		"tabId":     tabId,
+		"billId":    billId,
+		"orderId":   orderId,
+		"isRemoval": orderType == models.ORDER_TYPE_REMOVE,
+	}
+
+	var n int
+	err := q.tx.QueryRow(ctx, `
+    WITH demand AS (
+      SELECT o.line, items.id AS item_id, items.name, items.base_price AS unit_price, o.quantity,
+        SUM(o.quantity) OVER (PARTITION BY items.id ORDER BY o.line) - o.quantity AS start
+      FROM _temp_order_items AS o
+      JOIN items ON items.shop_id = @shopId AND items.id = o.item_id
+    ), remaining AS (
+      SELECT oi.item_id, oi.name, oi.unit_price, MIN(oi.id) FILTER (WHERE po.type = 'add') AS first_id,
+        SUM(CASE WHEN po.type = 'remove' THEN -oi.quantity ELSE oi.quantity END) AS quantity
+      FROM order_items AS oi
+      JOIN orders AS po ON po.shop_id = oi.shop_id AND po.tab_id = oi.tab_id AND po.bill_id = oi.bill_id AND po.id = oi.order_id
+      WHERE @isRemoval AND oi.shop_id = @shopId AND oi.tab_id = @tabId AND oi.bill_id = @billId AND oi.order_id <> @orderId
+        AND NOT EXISTS(SELECT 1 FROM order_voids AS v WHERE v.shop_id = po.shop_id AND v.tab_id = po.tab_id AND v.bill_id = po.bill_id AND v.order_id = po.id)
+      GROUP BY oi.item_id, oi.name, oi.unit_price
+      HAVING SUM(CASE WHEN po.type = 'remove' THEN -oi.quantity ELSE oi.quantity END) > 0
+    ), supply AS (
+      SELECT r.item_id, r.name, r.unit_price, r.quantity,
+        SUM(r.quantity) OVER (PARTITION BY r.item_id ORDER BY r.first_id) - r.quantity AS start
+      FROM remaining AS r
+      UNION ALL
+      SELECT DISTINCT d.item_id, d.name, d.unit_price, NULL::BIGINT,
+        COALESCE((SELECT SUM(r.quantity) FROM remaining AS r WHERE r.item_id = d.item_id), 0)
+      FROM demand AS d
+    ), inserted AS (
+      INSERT INTO order_items (shop_id, tab_id, bill_id, order_id, line, item_id, name, unit_price, quantity)
+      SELECT @shopId, @tabId, @billId, @orderId, d.line, d.item_id, s.name, s.unit_price,
+        LEAST(d.start + d.quantity, COALESCE(s.start + s.quantity, d.start + d.quantity)) - GREATEST(d.start, s.start)
+      FROM demand AS d
+      JOIN supply AS s ON s.item_id = d.item_id AND s.start < d.start + d.quantity AND (s.quantity IS NULL OR s.start + s.quantity > d.start)
+      RETURNING line)
+    SELECT COUNT(DISTINCT line) FROM inserted`, args).Scan(&n)
+	if err != nil {
+		return handlePgxError(err)
+	}
+	if n != staged.nItems {
+		return services.NewNotFoundServiceError(nil)
+	}
+
+	err = q.tx.QueryRow(ctx, `
+    WITH lines AS (
+      SELECT oi.line, oi.item_id, MIN(oi.id) AS id
+      FROM order_items AS oi
+      WHERE oi.shop_id = @shopId AND oi.tab_id = @tabId AND oi.bill_id = @billId AND oi.order_id = @orderId
+      GROUP BY oi.line, oi.item_id
+    ), demand AS (
+      SELECT l.id AS order_item_id, iv.item_id, iv.id AS variant_id, iv.name, iv.price AS unit_price, SUM(o.quantity) AS quantity,
+        SUM(SUM(o.quantity)) OVER (PARTITION BY iv.item_id, iv.id ORDER BY l.line) - SUM(o.quantity) AS start
+      FROM _temp_order_variants AS o
+      JOIN item_variants AS iv ON iv.shop_id = @shopId AND iv.item_id = o.item_id AND iv.id = o.variant_id
+      JOIN lines AS l ON l.line = o.line AND l.item_id = iv.item_id
+      GROUP BY l.id, l.line, iv.item_id, iv.id, iv.name, iv.price
+    ), remaining AS (
+      SELECT ov.item_id, ov.variant_id, ov.name, ov.unit_price, MIN(ov.order_item_id) FILTER (WHERE po.type = 'add') AS first_id,
+        SUM(CASE WHEN po.type = 'remove' THEN -ov.quantity ELSE ov.quantity END) AS quantity
+      FROM order_variants AS ov
+      JOIN order_items AS oi ON oi.shop_id = ov.shop_id AND oi.tab_id = ov.tab_id AND oi.bill_id = ov.bill_id AND oi.id = ov.order_item_id
+      JOIN orders AS po ON po.shop_id = oi.shop_id AND po.tab_id = oi.tab_id AND po.bill_id = oi.bill_id AND po.id = oi.order_id
+      WHERE @isRemoval AND ov.shop_id = @shopId AND ov.tab_id = @tabId AND ov.bill_id = @billId AND oi.order_id <> @orderId
+        AND NOT EXISTS(SELECT 1 FROM order_voids AS v WHERE v.shop_id = po.shop_id AND v.tab_id = po.tab_id AND v.bill_id = po.bill_id AND v.order_id = po.id)
+      GROUP BY ov.item_id, ov.variant_id, ov.name, ov.unit_price
+      HAVING SUM(CASE WHEN po.type = 'remove' THEN -ov.quantity ELSE ov.quantity END) > 0
+    ), supply AS (
+      SELECT r.item_id, r.variant_id, r.name, r.unit_price, r.quantity,
+        SUM(r.quantity) OVER (PARTITION BY r.item_id, r.variant_id ORDER BY r.first_id) - r.quantity AS start
+      FROM remaining AS r
+      UNION ALL
+      SELECT DISTINCT d.item_id, d.variant_id, d.name, d.unit_price, NULL::BIGINT,
+        COALESCE((SELECT SUM(r.quantity) FROM remaining AS r WHERE r.item_id = d.item_id AND r.variant_id = d.variant_id), 0)
+      FROM demand AS d
+    ), inserted AS (
+      INSERT INTO order_variants (shop_id, tab_id, bill_id, order_item_id, item_id, variant_id, name, unit_price, quantity)
+      SELECT @shopId, @tabId, @billId, d.order_item_id, d.item_id, d.variant_id, s.name, s.unit_price,
+        LEAST(d.start + d.quantity, COALESCE(s.start + s.quantity, d.start + d.quantity)) - GREATEST(d.start, s.start)
+      FROM demand AS d
+      JOIN supply AS s ON s.item_id = d.item_id AND s.variant_id = d.variant_id
+        AND s.start < d.start + d.quantity AND (s.quantity IS NULL OR s.start + s.quantity > d.start)
+      RETURNING order_item_id, variant_id)
+    SELECT COUNT(DISTINCT (order_item_id, variant_id)) FROM inserted`, args).Scan(&n)
+	if err != nil {
+		return handlePgxError(err)
+	}
+	if n != staged.nVariants {
+		return services.NewNotFoundServiceError(nil)
+	}
+
+	// Addons and substitutions must be configured for the item they are ordered with
+	err = q.tx.QueryRow(ctx, `
+    WITH lines AS (
+      SELECT oi.line, oi.item_id, MIN(oi.id) AS id
+      FROM order_items AS oi
+      WHERE oi.shop_id = @shopId AND oi.tab_id = @tabId AND oi.bill_id = @billId AND oi.order_id = @orderId
+      GROUP BY oi.line, oi.item_id
+    ), demand AS (
+      SELECT l.id AS order_item_id, ia.item_id, addons.id AS addon_id, addons.name, addons.base_price AS unit_price, SUM(o.quantity) AS quantity,
+        SUM(SUM(o.quantity)) OVER (PARTITION BY ia.item_id, addons.id ORDER BY l.line) - SUM(o.quantity) AS start
+      FROM _temp_order_addons AS o
+      JOIN item_addons AS ia ON ia.shop_id = @shopId AND ia.item_id = o.item_id AND ia.addon_id = o.addon_id
+      JOIN items AS addons ON addons.shop_id = ia.shop_id AND addons.id = ia.addon_id
+      JOIN lines AS l ON l.line = o.line AND l.item_id = ia.item_id
+      GROUP BY l.id, l.line, ia.item_id, addons.id, addons.name, addons.base_price
+    ), remaining AS (
+      SELECT oa.item_id, oa.addon_id, oa.name, oa.unit_price, MIN(oa.order_item_id) FILTER (WHERE po.type = 'add') AS first_id,
+        SUM(CASE WHEN po.type = 'remove' THEN -oa.quantity ELSE oa.quantity END) AS quantity
+      FROM order_addons AS oa
+      JOIN order_items AS oi ON oi.shop_id = oa.shop_id AND oi.tab_id = oa.tab_id AND oi.bill_id = oa.bill_id AND oi.id = oa.order_item_id
+      JOIN orders AS po ON po.shop_id = oi.shop_id AND po.tab_id = oi.tab_id AND po.bill_id = oi.bill_id AND po.id = oi.order_id
+      WHERE @isRemoval AND oa.shop_id = @shopId AND oa.tab_id = @tabId AND oa.bill_id = @billId AND oi.order_id <> @orderId
+        AND NOT EXISTS(SELECT 1 FROM order_voids AS v WHERE v.shop_id = po.shop_id AND v.tab_id = po.tab_id AND v.bill_id = po.bill_id AND v.order_id = po.id)
+      GROUP BY oa.item_id, oa.addon_id, oa.name, oa.unit_price
+      HAVING SUM(CASE WHEN po.type = 'remove' THEN -oa.quantity ELSE oa.quantity END) > 0
+    ), supply AS (
+      SELECT r.item_id, r.addon_id, r.name, r.unit_price, r.quantity,
+        SUM(r.quantity) OVER (PARTITION BY r.item_id, r.addon_id ORDER BY r.first_id) - r.quantity AS start
+      FROM remaining AS r
+      UNION ALL
+      SELECT DISTINCT d.item_id, d.addon_id, d.name, d.unit_price, NULL::BIGINT,
+        COALESCE((SELECT SUM(r.quantity) FROM remaining AS r WHERE r.item_id = d.item_id AND r.addon_id = d.addon_id), 0)
+      FROM demand AS d
+    ), inserted AS (
+      INSERT INTO order_addons (shop_id, tab_id, bill_id, order_item_id, item_id, addon_id, name, unit_price, quantity)
+      SELECT @shopId, @tabId, @billId, d.order_item_id, d.item_id, d.addon_id, s.name, s.unit_price,
+        LEAST(d.start + d.quantity, COALESCE(s.start + s.quantity, d.start + d.quantity)) - GREATEST(d.start, s.start)
+      FROM demand AS d
+      JOIN supply AS s ON s.item_id = d.item_id AND s.addon_id = d.addon_id
+        AND s.start < d.start + d.quantity AND (s.quantity IS NULL OR s.start + s.quantity > d.start)
+      RETURNING order_item_id, addon_id)
+    SELECT COUNT(DISTINCT (order_item_id, addon_id)) FROM inserted`, args).Scan(&n)
+	if err != nil {
+		return handlePgxError(err)
+	}
+	if n != staged.nAddons {
+		return services.NewValidationServiceError(errors.New("Addon is not available for item"), services.ValidationErrors{
+			"addons": services.ValidationError{Value: nil, Error: "invalid"},
+		})
+	}
+
+	err = q.tx.QueryRow(ctx, `
+    WITH lines AS (
+      SELECT oi.line, oi.item_id, MIN(oi.id) AS id
+      FROM order_items AS oi
+      WHERE oi.shop_id = @shopId AND oi.tab_id = @tabId AND oi.bill_id = @billId AND oi.order_id = @orderId
+      GROUP BY oi.line, oi.item_id
+    ), demand AS (
+      SELECT l.id AS order_item_id, isg.item_id, isg.substitution_group_id, subs.item_id AS substitution_id, subs.name, subs.price AS unit_price,
+        SUM(o.quantity) AS quantity,
+        SUM(SUM(o.quantity)) OVER (PARTITION BY isg.item_id, isg.substitution_group_id, subs.item_id ORDER BY l.line) - SUM(o.quantity) AS start
+      FROM _temp_order_substitutions AS o
+      JOIN items_to_item_substitution_groups AS isg ON isg.shop_id = @shopId AND isg.item_id = o.item_id
+        AND isg.substitution_group_id = o.substitution_group_id
+      JOIN item_substitution_prices AS subs ON subs.shop_id = isg.shop_id
+        AND subs.substitution_group_id = isg.substitution_group_id AND subs.item_id = o.substitution_id
+      JOIN lines AS l ON l.line = o.line AND l.item_id = isg.item_id
+      GROUP BY l.id, l.line, isg.item_id, isg.substitution_group_id, subs.item_id, subs.name, subs.price
+    ), remaining AS (
+      SELECT os.item_id, os.substitution_group_id, os.substitution_id, os.name, os.unit_price,
+        MIN(os.order_item_id) FILTER (WHERE po.type = 'add') AS first_id,
+        SUM(CASE WHEN po.type = 'remove' THEN -os.quantity ELSE os.quantity END) AS quantity
+      FROM order_substitutions AS os
+      JOIN order_items AS oi ON oi.shop_id = os.shop_id AND oi.tab_id = os.tab_id AND oi.bill_id = os.bill_id AND oi.id = os.order_item_id
+      JOIN orders AS po ON po.shop_id = oi.shop_id AND po.tab_id = oi.tab_id AND po.bill_id = oi.bill_id AND po.id = oi.order_id
+      WHERE @isRemoval AND os.shop_id = @shopId AND os.tab_id = @tabId AND os.bill_id = @billId AND oi.order_id <> @orderId
+        AND NOT EXISTS(SELECT 1 FROM order_voids AS v WHERE v.shop_id = po.shop_id AND v.tab_id = po.tab_id AND v.bill_id = po.bill_id AND v.order_id = po.id)
+      GROUP BY os.item_id, os.substitution_group_id, os.substitution_id, os.name, os.unit_price
+      HAVING SUM(CASE WHEN po.type = 'remove' THEN -os.quantity ELSE os.quantity END) > 0
+    ), supply AS (
+      SELECT r.item_id, r.substitution_group_id, r.substitution_id, r.name, r.unit_price, r.quantity,
+        SUM(r.quantity) OVER (PARTITION BY r.item_id, r.substitution_group_id, r.substitution_id ORDER BY r.first_id) - r.quantity AS start
+      FROM remaining AS r
+      UNION ALL
+      SELECT DISTINCT d.item_id, d.substitution_group_id, d.substitution_id, d.name, d.unit_price, NULL::BIGINT,
+        COALESCE((SELECT SUM(r.quantity) FROM remaining AS r WHERE r.item_id = d.item_id
+          AND r.substitution_group_id = d.substitution_group_id AND r.substitution_id = d.substitution_id), 0)
+      FROM demand AS d
+    ), inserted AS (
+      INSERT INTO order_substitutions (shop_id, tab_id, bill_id, order_item_id, item_id, substitution_group_id, substitution_id, name, unit_price, quantity)
+      SELECT @shopId, @tabId, @billId, d.order_item_id, d.item_id, d.substitution_group_id, d.substitution_id, s.name, s.unit_price,
+        LEAST(d.start + d.quantity, COALESCE(s.start + s.quantity, d.start + d.quantity)) - GREATEST(d.start, s.start)
+      FROM demand AS d
+      JOIN supply AS s ON s.item_id = d.item_id AND s.substitution_group_id = d.substitution_group_id AND s.substitution_id = d.substitution_id
+        AND s.start < d.start + d.quantity AND (s.quantity IS NULL OR s.start + s.quantity > d.start)
+      RETURNING order_item_id, substitution_group_id, substitution_id)
+    SELECT COUNT(DISTINCT (order_item_id, substitution_group_id, substitution_id)) FROM inserted`, args).Scan(&n)
+	if err != nil {
+		return handlePgxError(err)
+	}
+	if n != staged.nSubstitutions {
+		return services.NewValidationServiceError(errors.New("Substitution is not available for item"), services.ValidationErrors{
+			"substitutions": services.ValidationError{Value: nil, Error: "invalid"},
+		})
+	}
+	return nil
+}
+
+// Ensures that no item, variant, addon or substitution on the bill has been removed more times than it was ordered, ignoring voided orders.
+// Quantities are matched by identity across the prices they were captured at.
+func (q *PgxQueries) validateBillQuantities(ctx context.Context, shopId int, tabId int, billId int) error {
+	row := q.tx.QueryRow(ctx, `
+    SELECT EXISTS(
+      SELECT 1
+      FROM order_items AS oi
+      JOIN orders AS o ON o.shop_id = oi.shop_id AND o.tab_id = oi.tab_id AND o.bill_id = oi.bill_id AND o.id = oi.order_id
+      WHERE oi.shop_id = @shopId AND oi.tab_id = @tabId AND oi.bill_id = @billId
+        AND NOT EXISTS(SELECT 1 FROM order_voids AS v WHERE v.shop_id = o.shop_id AND v.tab_id = o.tab_id AND v.bill_id = o.bill_id AND v.order_id = o.id)
+      GROUP BY oi.item_id
+      HAVING SUM(CASE WHEN o.type = 'remove' THEN -oi.quantity ELSE oi.quantity END) < 0
+    ) OR EXISTS(
+      SELECT 1
+      FROM order_variants AS ov
+      JOIN order_items AS oi ON oi.shop_id = ov.shop_id AND oi.tab_id = ov.tab_id AND oi.bill_id = ov.bill_id AND oi.id = ov.order_item_id
+      JOIN orders AS o ON o.shop_id = oi.shop_id AND o.tab_id = oi.tab_id AND o.bill_id = oi.bill_id AND o.id = oi.order_id
+      WHERE ov.shop_id = @shopId AND ov.tab_id = @tabId AND ov.bill_id = @billId
+        AND NOT EXISTS(SELECT 1 FROM order_voids AS v WHERE v.shop_id = o.shop_id AND v.tab_id = o.tab_id AND v.bill_id = o.bill_id AND v.order_id = o.id)
+      GROUP BY oi.item_id, ov.variant_id
+      HAVING SUM(CASE WHEN o.type = 'remove' THEN -ov.quantity ELSE ov.quantity END) < 0
+    ) OR EXISTS(
+      SELECT 1
+      FROM order_addons AS oa
+      JOIN order_items AS oi ON oi.shop_id = oa.shop_id AND oi.tab_id = oa.tab_id AND oi.bill_id = oa.bill_id AND oi.id = oa.order_item_id
+      JOIN orders AS o ON o.shop_id = oi.shop_id AND o.tab_id = oi.tab_id AND o.bill_id = oi.bill_id AND o.id = oi.order_id
+      WHERE oa.shop_id = @shopId AND oa.tab_id = @tabId AND oa.bill_id = @billId
+        AND NOT EXISTS(SELECT 1 FROM order_voids AS v WHERE v.shop_id = o.shop_id AND v.tab_id = o.tab_id AND v.bill_id = o.bill_id AND v.order_id = o.id)
+      GROUP BY oi.item_id, oa.addon_id
+      HAVING SUM(CASE WHEN o.type = 'remove' THEN -oa.quantity ELSE oa.quantity END) < 0
+    ) OR EXISTS(
+      SELECT 1
+      FROM order_substitutions AS os
+      JOIN order_items AS oi ON oi.shop_id = os.shop_id AND oi.tab_id = os.tab_id AND oi.bill_id = os.bill_id AND oi.id = os.order_item_id
+      JOIN orders AS o ON o.shop_id = oi.shop_id AND o.tab_id = oi.tab_id AND o.bill_id = oi.bill_id AND o.id = oi.order_id
+      WHERE os.shop_id = @shopId AND os.tab_id = @tabId AND os.bill_id = @billId
+        AND NOT EXISTS(SELECT 1 FROM order_voids AS v WHERE v.shop_id = o.shop_id AND v.tab_id = o.tab_id AND v.bill_id = o.bill_id AND v.order_id = o.id)
+      GROUP BY oi.item_id, os.substitution_group_id, os.substitution_id
+      HAVING SUM(CASE WHEN o.type = 'remove' THEN -os.quantity ELSE os.quantity END) < 0
+    )`,
+		pgx.NamedArgs{
+			"shopId": shopId,
+			"tabId":  tabId,
+			"billId": billId,
+		})
+
+	var overdrawn bool
+	err := row.Scan(&overdrawn)
+	if err != nil {
+		return handlePgxError(err)
+	}
+	if overdrawn {
+		return services.NewValidationServiceError(errors.New("Order quantities on the bill cannot be negative"), services.ValidationErrors{
+			"items": services.ValidationError{Value: billId, Error: "exceeds ordered quantity"},
+		})
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/willtrojniak/TabAppBackend/models"
+)
+
+func TestAddOrderToTabKeepsRepeatedItemsApart(t *testing.T) {
+	f := newFixture(t)
+	cheese := f.createItem(t, "Cheese", 50, nil, nil)
+	white := f.createItem(t, "White", 0, nil, nil)
+	rye := f.createItem(t, "Rye", 75, nil, nil)
+	bread := f.createSubstitutionGroup(t, "Bread", []int{white, rye})
+	sandwich := f.createItem(t, "Sandwich", 500, []int{cheese}, []int{bread})
+
+	now := time.Now()
+	tabId := f.createTab(t, models.DateOf(now))
+
+	one := 1
+	withCheese := itemOrder(sandwich, 1)
+	withCheese.Addons = []models.OrderCreate{{Id: cheese, Quantity: &one}}
+	onRye := itemOrder(sandwich, 1)
+	onRye.Substitutions = []models.SubstitutionOrderCreate{{OrderCreate: models.OrderCreate{Id: rye, Quantity: &one}, SubstitutionGroupId: bread}}
+	orderId := f.addOrder(t, tabId, now, withCheese, onRye)
+
+	var order *models.Order
+	f.tx(t, func(q *PgxQueries) error {
+		var err error
+		order, err = q.GetTabOrderById(context.Background(), f.shopId, tabId, orderId)
+		return err
+	})
+
+	if len(order.Items) != 2 {
+		t.Fatalf("order has %v lines, want 2", len(order.Items))
+	}
+
+	tests := []struct {
+		name              string
+		line              models.OrderLine
+		wantAddons        int
+		wantSubstitutions int
+		wantTotal         int64
+	}{
+		{name: "with addon", line: order.Items[0], wantAddons: 1, wantTotal: 550},
+		{name: "with substitution", line: order.Items[1], wantSubstitutions: 1, wantTotal: 575},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.line.Quantity != 1 {
+				t.Errorf("quantity = %v, want 1", tt.line.Quantity)
+			}
+			if len(tt.line.Addons) != tt.wantAddons || len(tt.line.Substitutions) != tt.wantSubstitutions {
+				t.Errorf("line has %v addons and %v substitutions, want %v and %v",
+					len(tt.line.Addons), len(tt.line.Substitutions), tt.wantAddons, tt.wantSubstitutions)
+			}
+			total, err := tt.line.Total()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total.Amount != tt.wantTotal {
+				t.Errorf("total = %v, want %v", total.Amount, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestRemoveOrderFromTabCreditsOldestPricesFirst(t *testing.T) {
+	f := newFixture(t)
+	coffee := f.createItem(t, "Coffee", 300, nil, nil)
+
+	now := time.Now()
+	tabId := f.createTab(t, models.DateOf(now))
+	f.addOrder(t, tabId, now, itemOrder(coffee, 2))
+
+	price := models.NewMoney(400, "")
+	update := &models.ItemUpdate{CategoryIds: []int{}, AddonIds: []int{}, SubstitutionGroupIds: []int{}}
+	update.Name = "Coffee"
+	update.BasePrice = &price
+	f.tx(t, func(q *PgxQueries) error {
+		return q.UpdateItem(context.Background(), f.shopId, coffee, update)
+	})
+	f.addOrder(t, tabId, now, itemOrder(coffee, 2))
+
+	tests := []struct {
+		name      string
+		quantity  int
+		wantTotal int64
+	}{
+		{name: "within oldest price", quantity: 1, wantTotal: 300},
+		{name: "across prices", quantity: 2, wantTotal: 700},
+		{name: "remaining newest price", quantity: 1, wantTotal: 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var order *models.Order
+			f.tx(t, func(q *PgxQueries) error {
+				orderId, err := q.RemoveOrderFromTab(context.Background(), f.shopId, tabId, f.userId, now, &models.BillOrderCreate{
+					Items:      []models.ItemOrderCreate{itemOrder(coffee, tt.quantity)},
+					LocationId: f.locationId,
+				})
+				if err != nil {
+					return err
+				}
+				order, err = q.GetTabOrderById(context.Background(), f.shopId, tabId, orderId)
+				return err
+			})
+
+			var total int64
+			for _, line := range order.Items {
+				lineTotal, err := line.Total()
+				if err != nil {
+					t.Fatal(err)
+				}
+				total += lineTotal.Amount
+			}
+			if total != tt.wantTotal {
+				t.Errorf("credited %v, want %v", total, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestGetTabByIdMergesScheduleOverrides(t *testing.T) {
+	f := newFixture(t)
+	coffee := f.createItem(t, "Coffee", 300, nil, nil)
+
+	now := time.Now()
+	tabId := f.createTab(t, models.DateOf(now))
+	f.tx(t, func(q *PgxQueries) error {
+		_, err := q.AddOrderToTab(context.Background(), f.shopId, tabId, f.userId, now, &models.BillOrderCreate{
+			Items:            []models.ItemOrderCreate{itemOrder(coffee, 2)},
+			LocationId:       f.locationId,
+			ScheduleOverride: true,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = q.RemoveOrderFromTab(context.Background(), f.shopId, tabId, f.userId, now, &models.BillOrderCreate{
+			Items:      []models.ItemOrderCreate{itemOrder(coffee, 1)},
+			LocationId: f.locationId,
+		})
+		return err
+	})
+
+	items := f.getTab(t, tabId).Bills[0].Items
+	if len(items) != 1 {
+		t.Fatalf("bill has %v lines, want 1", len(items))
+	}
+	if items[0].Quantity != 1 || !items[0].ScheduleOverride {
+		t.Errorf("line has quantity %v and schedule override %v, want 1 and true", items[0].Quantity, items[0].ScheduleOverride)
+	}
+}
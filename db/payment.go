@@ -0,0 +1,405 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/willtrojniak/TabAppBackend/models"
+	"github.com/willtrojniak/TabAppBackend/services"
+)
+
+func (q *PgxQueries) GetBillPayments(ctx context.Context, shopId int, tabId int, billId int) ([]models.BillPayment, error) {
+	return q.getBillPayments(ctx, shopId, tabId, billId, nil)
+}
+
+func (q *PgxQueries) GetBillPaymentById(ctx context.Context, shopId int, tabId int, billId int, paymentId int) (*models.BillPayment, error) {
+	payments, err := q.getBillPayments(ctx, shopId, tabId, billId, &paymentId)
+	if err != nil {
+		return nil, err
+	}
+	if len(payments) == 0 {
+		return nil, services.NewNotFoundServiceError(nil)
+	}
+	return &payments[0], nil
+}
+
+func (q *PgxQueries) getBillPayments(ctx context.Context, shopId int, tabId int, billId int, paymentId *int) ([]models.BillPayment, error) {
+	rows, err := q.tx.Query(ctx, `
+    SELECT p.id, p.bill_id, p.amount, p.method, p.reference, p.staff_id, users.name AS staff_name, p.created_at,
+      (SELECT to_jsonb(reversals) AS reversal
+        FROM
+        (SELECT r.note, r.staff_id, reversal_staff.name AS staff_name, r.created_at
+          FROM bill_payment_reversals AS r
+          LEFT JOIN users AS reversal_staff ON reversal_staff.id = r.staff_id
+          WHERE r.shop_id = p.shop_id AND r.tab_id = p.tab_id AND r.bill_id = p.bill_id AND r.payment_id = p.id) AS reversals
+      ) AS reversal
+    FROM bill_payments AS p
+    LEFT JOIN users ON users.id = p.staff_id
+    WHERE p.shop_id = @shopId AND p.tab_id = @tabId AND p.bill_id = @billId
+      AND ((@paymentId::INTEGER IS NULL) OR (p.id = @paymentId))
+    ORDER BY p.created_at, p.id`,
+		pgx.NamedArgs{
+			"shopId":    shopId,
+			"tabId":     tabId,
+			"billId":    billId,
+			"paymentId": paymentId,
+		})
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+
+	payments, err := pgx.CollectRows(rows, pgx.RowToStructByNameLax[models.BillPayment])
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+	err = q.setShopCurrency(ctx, shopId, payments)
+	if err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+// Records a payment towards the bill, settling the bill once its payments cover its total.
+// Bills of tabs requiring sign off must be approved by the tab owner first.
+func (q *PgxQueries) RecordBillPayment(ctx context.Context, tab *models.Tab, billId int, staffId string, data *models.BillPaymentCreate, today models.Date) (int, error) {
+	return WithTxRet(ctx, q, func(q *PgxQueries) (int, error) {
+		bill, err := q.getAdjustableBill(ctx, tab, billId)
+		if err != nil {
+			return 0, err
+		}
+		if !bill.IsChargeable(tab.PaymentMethod) {
+			return 0, ErrBillNotApproved
+		}
+
+		paymentId, err := q.insertBillPayment(ctx, tab.ShopId, tab.Id, billId, &staffId, data)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = q.settleBill(ctx, tab.ShopId, tab.Id, bill, today)
+		if err != nil {
+			return 0, err
+		}
+		return paymentId, nil
+	})
+}
+
+// Records the outstanding balance of the bill as paid with the tab's payment details.
+// Open bills must be cut first, as their total may still change.
+func (q *PgxQueries) MarkTabBillPaid(ctx context.Context, tab *models.Tab, billId int, staffId string, today models.Date) error {
+	return q.WithTx(ctx, func(q *PgxQueries) error {
+		bill, err := q.getAdjustableBill(ctx, tab, billId)
+		if err != nil {
+			return err
+		}
+		if !bill.IsClosed && !bill.EndDate.Before(today.Date) {
+			return services.NewDataConflictServiceError(errors.New("Bill is still open"))
+		}
+
+		total, err := q.getTabSpent(ctx, tab.ShopId, tab.Id, &billId, nil)
+		if err != nil {
+			return err
+		}
+		paid, err := q.getBillPaid(ctx, tab.ShopId, tab.Id, billId)
+		if err != nil {
+			return err
+		}
+
+		balance, err := total.Sub(paid)
+		if err != nil {
+			return err
+		}
+		if !balance.IsNegative() && !balance.IsZero() {
+			if !bill.IsChargeable(tab.PaymentMethod) {
+				return ErrBillNotApproved
+			}
+
+			reference := []rune(tab.PaymentDetails)
+			if len(reference) > 64 {
+				reference = reference[:64]
+			}
+			_, err = q.insertBillPayment(ctx, tab.ShopId, tab.Id, billId, &staffId, &models.BillPaymentCreate{
+				Amount:    balance,
+				Method:    tab.PaymentMethod,
+				Reference: string(reference),
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = q.settleBill(ctx, tab.ShopId, tab.Id, bill, today)
+		return err
+	})
+}
+
+// Returned when a bill which must be signed off by the tab owner is charged before the owner has approved it
+var ErrBillNotApproved = services.NewDataConflictServiceError(errors.New("Bill has not been approved by the tab owner"))
+
+// Approves the closed bill on behalf of the tab owner, allowing it to be charged to the tab's payment details.
+// Approving a disputed bill withdraws the dispute.
+func (q *PgxQueries) ApproveTabBill(ctx context.Context, tab *models.Tab, billId int) error {
+	return q.WithTx(ctx, func(q *PgxQueries) error {
+		bill, err := q.getSignableBill(ctx, tab, billId)
+		if err != nil {
+			return err
+		}
+		if bill.SignoffStatus == models.BILL_SIGNOFF_APPROVED {
+			return services.NewDataConflictServiceError(errors.New("Bill has already been approved"))
+		}
+
+		return q.setBillSignoff(ctx, tab.ShopId, tab.Id, billId, models.BILL_SIGNOFF_APPROVED)
+	})
+}
+
+// Disputes the closed bill on behalf of the tab owner, adding the owner's comment to the bill's comment thread
+func (q *PgxQueries) DisputeTabBill(ctx context.Context, tab *models.Tab, billId int, userId string, data *models.BillCommentCreate) (int, error) {
+	return WithTxRet(ctx, q, func(q *PgxQueries) (int, error) {
+		bill, err := q.getSignableBill(ctx, tab, billId)
+		if err != nil {
+			return 0, err
+		}
+		if bill.SignoffStatus == models.BILL_SIGNOFF_DISPUTED {
+			return 0, services.NewDataConflictServiceError(errors.New("Bill is already disputed"))
+		}
+
+		err = q.setBillSignoff(ctx, tab.ShopId, tab.Id, billId, models.BILL_SIGNOFF_DISPUTED)
+		if err != nil {
+			return 0, err
+		}
+		return q.insertBillComment(ctx, tab.ShopId, tab.Id, billId, userId, data.Body)
+	})
+}
+
+// Resolves the dispute by adding the adjustments and comment to the bill, returning it to the tab owner for approval.
+// The adjustments may not bring the bill's total below zero.
+func (q *PgxQueries) ResolveBillDispute(ctx context.Context, tab *models.Tab, billId int, staffId string, data *models.BillDisputeResolve, today models.Date) (int, error) {
+	return WithTxRet(ctx, q, func(q *PgxQueries) (int, error) {
+		bill, err := q.getAdjustableBill(ctx, tab, billId)
+		if err != nil {
+			return 0, err
+		}
+		if bill.SignoffStatus != models.BILL_SIGNOFF_DISPUTED {
+			return 0, services.NewDataConflictServiceError(errors.New("Bill is not disputed"))
+		}
+
+		for i := range data.Adjustments {
+			_, err := q.insertBillAdjustment(ctx, tab, billId, staffId, &data.Adjustments[i])
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		total, err := q.getTabSpent(ctx, tab.ShopId, tab.Id, &billId, nil)
+		if err != nil {
+			return 0, err
+		}
+		if total.IsNegative() {
+			return 0, services.NewValidationServiceError(errors.New("Credit exceeds the bill total"), services.ValidationErrors{
+				"adjustments": services.ValidationError{Value: data.Adjustments, Error: "gte"},
+			})
+		}
+
+		commentId, err := q.insertBillComment(ctx, tab.ShopId, tab.Id, billId, staffId, data.Comment)
+		if err != nil {
+			return 0, err
+		}
+
+		err = q.setBillSignoff(ctx, tab.ShopId, tab.Id, billId, models.BILL_SIGNOFF_PENDING)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = q.settleBill(ctx, tab.ShopId, tab.Id, bill, today)
+		if err != nil {
+			return 0, err
+		}
+		return commentId, nil
+	})
+}
+
+// Locks the bill for sign off by the tab owner, which is only possible once the bill has closed
+// and until it has been paid or posted to the journal
+func (q *PgxQueries) getSignableBill(ctx context.Context, tab *models.Tab, billId int) (*models.BillOverview, error) {
+	bill, err := q.getAdjustableBill(ctx, tab, billId)
+	if err != nil {
+		return nil, err
+	}
+	if !bill.IsClosed || bill.IsPaid {
+		return nil, services.NewDataConflictServiceError(errors.New("Only closed, unpaid bills may be signed off"))
+	}
+	return bill, nil
+}
+
+func (q *PgxQueries) setBillSignoff(ctx context.Context, shopId int, tabId int, billId int, status models.BillSignoffStatus) error {
+	_, err := q.tx.Exec(ctx, `
+    UPDATE tab_bills
+    SET (signoff_status, signed_off_at) = (@status::bill_signoff_status, CASE WHEN @status::bill_signoff_status = 'pending' THEN NULL ELSE NOW() END)
+    WHERE shop_id = @shopId AND tab_id = @tabId AND id = @billId
+    `, pgx.NamedArgs{
+		"shopId": shopId,
+		"tabId":  tabId,
+		"billId": billId,
+		"status": string(status),
+	})
+	if err != nil {
+		return handlePgxError(err)
+	}
+	return nil
+}
+
+// Withdraws the owner's approval of the bill, e.g. after its total has changed, so that the owner signs off on the new total
+func (q *PgxQueries) resetBillSignoff(ctx context.Context, shopId int, tabId int, billId int) error {
+	_, err := q.tx.Exec(ctx, `
+    UPDATE tab_bills
+    SET (signoff_status, signed_off_at) = ('pending', NULL)
+    WHERE shop_id = @shopId AND tab_id = @tabId AND id = @billId AND signoff_status = 'approved'
+    `, pgx.NamedArgs{
+		"shopId": shopId,
+		"tabId":  tabId,
+		"billId": billId,
+	})
+	if err != nil {
+		return handlePgxError(err)
+	}
+	return nil
+}
+
+// Reverses the payment, reopening the balance of the bill if it is no longer covered by its payments.
+// Payments on bills posted to the journal, including the payment recorded by the export, may not be reversed.
+func (q *PgxQueries) ReverseBillPayment(ctx context.Context, tab *models.Tab, billId int, paymentId int, staffId string, data *models.BillPaymentReversalCreate, today models.Date) error {
+	return q.WithTx(ctx, func(q *PgxQueries) error {
+		bill, err := q.getAdjustableBill(ctx, tab, billId)
+		if err != nil {
+			return err
+		}
+
+		row := q.tx.QueryRow(ctx, `
+    INSERT INTO bill_payment_reversals (shop_id, tab_id, bill_id, payment_id, note, staff_id)
+    SELECT p.shop_id, p.tab_id, p.bill_id, p.id, @note, @staffId
+    FROM bill_payments AS p
+    WHERE p.shop_id = @shopId AND p.tab_id = @tabId AND p.bill_id = @billId AND p.id = @paymentId
+    RETURNING payment_id`,
+			pgx.NamedArgs{
+				"shopId":    tab.ShopId,
+				"tabId":     tab.Id,
+				"billId":    billId,
+				"paymentId": paymentId,
+				"note":      data.Note,
+				"staffId":   staffId,
+			})
+
+		var reversedId int
+		err = row.Scan(&reversedId)
+		if err != nil {
+			return handlePgxError(err)
+		}
+
+		_, err = q.settleBill(ctx, tab.ShopId, tab.Id, bill, today)
+		return err
+	})
+}
+
+// Records the payment, staffId being nil for payments which were not recorded by a user
+func (q *PgxQueries) insertBillPayment(ctx context.Context, shopId int, tabId int, billId int, staffId *string, data *models.BillPaymentCreate) (int, error) {
+	row := q.tx.QueryRow(ctx, `
+    INSERT INTO bill_payments (shop_id, tab_id, bill_id, amount, method, reference, staff_id)
+    VALUES (@shopId, @tabId, @billId, @amount, @method, @reference, @staffId)
+    RETURNING id`,
+		pgx.NamedArgs{
+			"shopId":    shopId,
+			"tabId":     tabId,
+			"billId":    billId,
+			"amount":    data.Amount,
+			"method":    data.Method,
+			"reference": data.Reference,
+			"staffId":   staffId,
+		})
+
+	var paymentId int
+	err := row.Scan(&paymentId)
+	if err != nil {
+		return 0, handlePgxError(err)
+	}
+	return paymentId, nil
+}
+
+// The sum of the bill's payments which have not been reversed
+func (q *PgxQueries) getBillPaid(ctx context.Context, shopId int, tabId int, billId int) (models.Money, error) {
+	row := q.tx.QueryRow(ctx, `
+    SELECT COALESCE(SUM(p.amount), 0)::BIGINT
+    FROM bill_payments AS p
+    WHERE p.shop_id = @shopId AND p.tab_id = @tabId AND p.bill_id = @billId
+      AND NOT EXISTS(SELECT 1 FROM bill_payment_reversals AS r WHERE r.shop_id = p.shop_id AND r.tab_id = p.tab_id AND r.bill_id = p.bill_id AND r.payment_id = p.id)`,
+		pgx.NamedArgs{
+			"shopId": shopId,
+			"tabId":  tabId,
+			"billId": billId,
+		})
+
+	var paid models.Money
+	err := row.Scan(&paid)
+	if err != nil {
+		return paid, handlePgxError(err)
+	}
+	return paid, nil
+}
+
+// Derives whether the bill is paid from its payments, reporting whether the bill has just been paid so that the
+// tab owner can be notified. Only bills which no longer accept orders are settled, payments towards an open bill
+// are credited once it closes, and closed bills without a total are paid as soon as they close. Bills with neither a total
+// nor payments are never reported as paid, as there is nothing to notify the tab owner of.
+func (q *PgxQueries) settleBill(ctx context.Context, shopId int, tabId int, bill *models.BillOverview, today models.Date) (bool, error) {
+	if !bill.IsClosed && !bill.EndDate.Before(today.Date) {
+		return false, nil
+	}
+
+	total, err := q.getTabSpent(ctx, shopId, tabId, &bill.Id, nil)
+	if err != nil {
+		return false, err
+	}
+	paid, err := q.getBillPaid(ctx, shopId, tabId, bill.Id)
+	if err != nil {
+		return false, err
+	}
+
+	status, err := models.PaymentStatusOf(total, paid)
+	if err != nil {
+		return false, err
+	}
+	isPaid := status == models.PAYMENT_STATUS_PAID || status == models.PAYMENT_STATUS_OVERPAID
+	if isPaid == bill.IsPaid {
+		return false, nil
+	}
+
+	if !isPaid {
+		_, err = q.tx.Exec(ctx, `
+    UPDATE tab_bills
+    SET is_paid = false
+    WHERE shop_id = @shopId AND tab_id = @tabId AND id = @billId
+    `, pgx.NamedArgs{
+			"shopId": shopId,
+			"tabId":  tabId,
+			"billId": bill.Id,
+		})
+		if err != nil {
+			return false, handlePgxError(err)
+		}
+		return false, nil
+	}
+
+	_, err = q.tx.Exec(ctx, `
+    UPDATE tab_bills
+    SET (is_paid, is_closed) = (true, true)
+    WHERE shop_id = @shopId AND tab_id = @tabId AND id = @billId
+    `, pgx.NamedArgs{
+		"shopId": shopId,
+		"tabId":  tabId,
+		"billId": bill.Id,
+	})
+	if err != nil {
+		return false, handlePgxError(err)
+	}
+	return total.Amount != 0 || paid.Amount != 0, nil
+}
@@ -0,0 +1,177 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/willtrojniak/TabAppBackend/models"
+	"github.com/willtrojniak/TabAppBackend/services"
+)
+
+// Creates a tab with an open bill covering today, ordering an item of the given price unless it is zero
+func (f *fixture) createBilledTab(t *testing.T, price int64) (int, models.BillOverview) {
+	t.Helper()
+	now := time.Now()
+	today := models.DateOf(now)
+	tabId := f.createTab(t, models.Date{Date: today.AddDays(-14)})
+	tab := f.getTab(t, tabId)
+	f.tx(t, func(q *PgxQueries) error {
+		return q.EnsureBillingPeriods(context.Background(), &tab.TabOverview, today)
+	})
+	if price > 0 {
+		f.addOrder(t, tabId, now, itemOrder(f.createItem(t, "Item", price, nil, nil), 1))
+	}
+
+	bill := f.getTab(t, tabId).CurrentBill(today)
+	if bill == nil {
+		t.Fatal("tab has no bill covering today")
+	}
+	return tabId, bill.BillOverview
+}
+
+func (f *fixture) recordPayment(t *testing.T, q *PgxQueries, tabId int, billId int, amount int64) int {
+	t.Helper()
+	paymentId, err := q.insertBillPayment(context.Background(), f.shopId, tabId, billId, &f.userId, &models.BillPaymentCreate{
+		Amount: models.NewMoney(amount, ""),
+		Method: "in person",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paymentId
+}
+
+// Posts the bill to an empty journal export
+func (f *fixture) markExported(t *testing.T, tabId int, bill models.BillOverview) {
+	t.Helper()
+	f.tx(t, func(q *PgxQueries) error {
+		var exportId int
+		err := q.tx.QueryRow(context.Background(), `
+      INSERT INTO journal_exports (shop_id, start_date, end_date, revenue_account)
+      VALUES (@shopId, @startDate, @endDate, 'Revenue')
+      RETURNING id`,
+			pgx.NamedArgs{"shopId": f.shopId, "startDate": bill.StartDate, "endDate": bill.EndDate}).Scan(&exportId)
+		if err != nil {
+			return err
+		}
+		_, err = q.tx.Exec(context.Background(), `
+      UPDATE tab_bills SET journal_export_id = @exportId WHERE shop_id = @shopId AND tab_id = @tabId AND id = @billId`,
+			pgx.NamedArgs{"shopId": f.shopId, "tabId": tabId, "billId": bill.Id, "exportId": exportId})
+		return err
+	})
+}
+
+func TestSettleBill(t *testing.T) {
+	tests := []struct {
+		name         string
+		price        int64
+		paid         int64
+		closed       bool
+		wantPaid     bool
+		wantReported bool
+	}{
+		{name: "open bill covered", price: 500, paid: 500},
+		{name: "closed bill covered", price: 500, paid: 500, closed: true, wantPaid: true, wantReported: true},
+		{name: "closed bill partially paid", price: 500, paid: 200, closed: true},
+		{name: "closed bill overpaid", price: 500, paid: 800, closed: true, wantPaid: true, wantReported: true},
+		{name: "closed bill without orders", closed: true, wantPaid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			tabId, bill := f.createBilledTab(t, tt.price)
+
+			settleAt := models.DateOf(time.Now())
+			if tt.closed {
+				settleAt = models.Date{Date: bill.EndDate.AddDays(1)}
+			}
+
+			f.tx(t, func(q *PgxQueries) error {
+				if tt.paid > 0 {
+					f.recordPayment(t, q, tabId, bill.Id, tt.paid)
+				}
+				paid, err := q.settleBill(context.Background(), f.shopId, tabId, &bill, settleAt)
+				if err != nil {
+					return err
+				}
+				if paid != tt.wantReported {
+					t.Errorf("settleBill() = %v, want %v", paid, tt.wantReported)
+				}
+
+				updated, err := q.getBillForUpdate(context.Background(), f.shopId, tabId, bill.Id)
+				if err != nil {
+					return err
+				}
+				if updated.IsPaid != tt.wantPaid {
+					t.Errorf("bill paid = %v, want %v", updated.IsPaid, tt.wantPaid)
+				}
+
+				// Settling again does not report the bill as paid a second time
+				again, err := q.settleBill(context.Background(), f.shopId, tabId, updated, settleAt)
+				if err != nil {
+					return err
+				}
+				if again {
+					t.Error("settleBill() reported the bill as paid again")
+				}
+				return nil
+			})
+		})
+	}
+}
+
+func TestSettleBillReopensReversedBill(t *testing.T) {
+	f := newFixture(t)
+	tabId, bill := f.createBilledTab(t, 500)
+	settleAt := models.Date{Date: bill.EndDate.AddDays(1)}
+
+	var paymentId int
+	f.tx(t, func(q *PgxQueries) error {
+		paymentId = f.recordPayment(t, q, tabId, bill.Id, 500)
+		_, err := q.settleBill(context.Background(), f.shopId, tabId, &bill, settleAt)
+		return err
+	})
+
+	tab := f.getTab(t, tabId)
+	f.tx(t, func(q *PgxQueries) error {
+		return q.ReverseBillPayment(context.Background(), tab, bill.Id, paymentId, f.userId, &models.BillPaymentReversalCreate{Note: "Refunded"}, settleAt)
+	})
+
+	f.tx(t, func(q *PgxQueries) error {
+		updated, err := q.getBillForUpdate(context.Background(), f.shopId, tabId, bill.Id)
+		if err != nil {
+			return err
+		}
+		if updated.IsPaid {
+			t.Error("bill is still paid after its payment was reversed")
+		}
+		return nil
+	})
+}
+
+func TestReverseBillPaymentOnExportedBill(t *testing.T) {
+	f := newFixture(t)
+	tabId, bill := f.createBilledTab(t, 500)
+
+	var paymentId int
+	f.tx(t, func(q *PgxQueries) error {
+		paymentId = f.recordPayment(t, q, tabId, bill.Id, 500)
+		return nil
+	})
+	f.markExported(t, tabId, bill)
+
+	tab := f.getTab(t, tabId)
+	err := WithTx(context.Background(), f.store, func(q *PgxQueries) error {
+		return q.ReverseBillPayment(context.Background(), tab, bill.Id, paymentId, f.userId, &models.BillPaymentReversalCreate{Note: "Refunded"}, models.DateOf(time.Now()))
+	})
+
+	var httpErr services.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode() != http.StatusConflict {
+		t.Fatalf("ReverseBillPayment() error = %v, want a conflict", err)
+	}
+}
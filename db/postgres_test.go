@@ -0,0 +1,206 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/willtrojniak/TabAppBackend/models"
+)
+
+// Store for tests which need a database, nil unless TEST_DATABASE_URL names a database the migrations can be applied to.
+// Each test creates its own shop, so tests may share the database.
+var testStore *PgxStore
+
+func TestMain(m *testing.M) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL != "" {
+		mig, err := migrate.New("file://../cmd/migrate/migrations", databaseURL)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := mig.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			log.Fatal(err)
+		}
+
+		config, err := pgxpool.ParseConfig(databaseURL)
+		if err != nil {
+			log.Fatal(err)
+		}
+		testStore, err = NewPostgresStorage(context.Background(), config)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	os.Exit(m.Run())
+}
+
+// A shop with an owner and a single location for tests to record tabs against
+type fixture struct {
+	store      *PgxStore
+	userId     string
+	shopId     int
+	locationId int
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	if testStore == nil {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	f := &fixture{store: testStore, userId: uuid.NewString()}
+	f.tx(t, func(q *PgxQueries) error {
+		_, err := q.CreateUser(context.Background(), &models.UserCreate{Id: f.userId, Email: f.userId + "@example.com", Name: "Owner"})
+		if err != nil {
+			return err
+		}
+
+		f.shopId, err = q.CreateShop(context.Background(), &models.ShopCreate{
+			OwnerId:    f.userId,
+			ShopUpdate: models.ShopUpdate{Name: "Shop", PaymentMethods: []string{"in person"}},
+		})
+		if err != nil {
+			return err
+		}
+
+		err = q.CreateLocation(context.Background(), &models.LocationCreate{ShopId: f.shopId, LocationUpdate: models.LocationUpdate{Name: "Counter"}})
+		if err != nil {
+			return err
+		}
+		return q.tx.QueryRow(context.Background(), `SELECT id FROM locations WHERE shop_id = @shopId`,
+			pgx.NamedArgs{"shopId": f.shopId}).Scan(&f.locationId)
+	})
+	return f
+}
+
+// Runs fn in its own transaction, failing the test if it returns an error
+func (f *fixture) tx(t *testing.T, fn func(q *PgxQueries) error) {
+	t.Helper()
+	err := WithTx(context.Background(), f.store, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (f *fixture) createItem(t *testing.T, name string, price int64, addonIds []int, substitutionGroupIds []int) int {
+	t.Helper()
+	basePrice := models.NewMoney(price, "")
+	data := &models.ItemCreate{
+		ShopId: f.shopId,
+		ItemUpdate: models.ItemUpdate{
+			CategoryIds:          []int{},
+			AddonIds:             append([]int{}, addonIds...),
+			SubstitutionGroupIds: append([]int{}, substitutionGroupIds...),
+		},
+	}
+	data.Name = name
+	data.BasePrice = &basePrice
+
+	var itemId int
+	f.tx(t, func(q *PgxQueries) error {
+		err := q.CreateItem(context.Background(), data)
+		if err != nil {
+			return err
+		}
+		return q.tx.QueryRow(context.Background(), `SELECT id FROM items WHERE shop_id = @shopId AND name = @name`,
+			pgx.NamedArgs{"shopId": f.shopId, "name": name}).Scan(&itemId)
+	})
+	return itemId
+}
+
+func (f *fixture) createSubstitutionGroup(t *testing.T, name string, itemIds []int) int {
+	t.Helper()
+	data := &models.SubstitutionGroupCreate{
+		ShopId:                  f.shopId,
+		SubstitutionGroupUpdate: models.SubstitutionGroupUpdate{SubstitutionItemIds: itemIds},
+	}
+	data.Name = name
+
+	var groupId int
+	f.tx(t, func(q *PgxQueries) error {
+		err := q.CreateSubstitutionGroup(context.Background(), data)
+		if err != nil {
+			return err
+		}
+		return q.tx.QueryRow(context.Background(), `SELECT id FROM item_substitution_groups WHERE shop_id = @shopId AND name = @name`,
+			pgx.NamedArgs{"shopId": f.shopId, "name": name}).Scan(&groupId)
+	})
+	return groupId
+}
+
+// Creates a confirmed tab billed weekly, open all day every day from the given date
+func (f *fixture) createTab(t *testing.T, start models.Date) int {
+	t.Helper()
+	var tabId int
+	f.tx(t, func(q *PgxQueries) error {
+		var err error
+		tabId, err = q.CreateTab(context.Background(), &models.TabCreate{
+			ShopId:  f.shopId,
+			OwnerId: f.userId,
+			TabUpdate: models.TabUpdate{
+				TabBase: models.TabBase{
+					PaymentMethod:       "in person",
+					Organization:        "Organization",
+					DisplayName:         "Tab",
+					StartDate:           start,
+					EndDate:             models.Date{Date: start.AddDays(365)},
+					ActiveDaysOfWk:      0b1111111,
+					DollarLimitPerOrder: models.NewMoney(0, ""),
+					VerificationMethod:  "specify",
+					BillingIntervalDays: 7,
+					BillingTermEnds:     []models.Date{},
+				},
+				VerificationList: []string{},
+				LocationIds:      []uint{uint(f.locationId)},
+				Allocations:      []models.TabAllocationCreate{},
+			},
+		}, models.TAB_STATUS_CONFIRMED)
+		return err
+	})
+	return tabId
+}
+
+func (f *fixture) getTab(t *testing.T, tabId int) *models.Tab {
+	t.Helper()
+	var tab *models.Tab
+	f.tx(t, func(q *PgxQueries) error {
+		var err error
+		tab, err = q.GetTabById(context.Background(), f.shopId, tabId)
+		return err
+	})
+	return tab
+}
+
+// Orders the given quantity of each item on its own line
+func (f *fixture) addOrder(t *testing.T, tabId int, now time.Time, items ...models.ItemOrderCreate) int {
+	t.Helper()
+	var orderId int
+	f.tx(t, func(q *PgxQueries) error {
+		var err error
+		orderId, err = q.AddOrderToTab(context.Background(), f.shopId, tabId, f.userId, now, &models.BillOrderCreate{
+			Items:      items,
+			LocationId: f.locationId,
+		})
+		return err
+	})
+	return orderId
+}
+
+func itemOrder(itemId int, quantity int) models.ItemOrderCreate {
+	return models.ItemOrderCreate{
+		OrderCreate:   models.OrderCreate{Id: itemId, Quantity: &quantity},
+		Variants:      []models.OrderCreate{},
+		Addons:        []models.OrderCreate{},
+		Substitutions: []models.SubstitutionOrderCreate{},
+	}
+}
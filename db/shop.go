@@ -75,16 +75,26 @@ func (q *PgxQueries) GetShopById(ctx context.Context, shopId int) (*models.Shop,
 				WHEN shop_slack_connections.slack_access_token IS NOT NULL THEN TRUE
 				ELSE FALSE
 			END AS slack_integrated,
+			COALESCE(shop_settings.timezone, 'America/New_York') AS timezone,
+			COALESCE(shop_settings.currency, 'USD') AS currency,
+			COALESCE(shop_settings.contact_email, '') AS contact_email,
+			COALESCE(shop_settings.contact_phone, '') AS contact_phone,
+			COALESCE(shop_settings.address, '') AS address,
       array_remove(array_agg(payment_methods.method), NULL) as payment_methods,
       (SELECT COALESCE(json_agg(locations.*) FILTER (WHERE locations.id IS NOT NULL), '[]') AS locations
        FROM locations
        WHERE locations.shop_id = shops.id
-      ) AS locations
+      ) AS locations,
+      (SELECT COALESCE(json_agg(f.* ORDER BY f.id), '[]') AS chartstring_formats
+       FROM shop_chartstring_formats AS f
+       WHERE f.shop_id = shops.id
+      ) AS chartstring_formats
     FROM shops
     LEFT JOIN payment_methods on shops.id = payment_methods.shop_id
 		LEFT JOIN shop_slack_connections on shops.id = shop_slack_connections.shop_id
+		LEFT JOIN shop_settings on shops.id = shop_settings.shop_id
     WHERE shops.id = @shopId
-    GROUP BY shops.id, shop_slack_connections.shop_id`,
+    GROUP BY shops.id, shop_slack_connections.shop_id, shop_settings.shop_id`,
 		pgx.NamedArgs{
 			"shopId": shopId,
 		})
@@ -340,3 +350,43 @@ func (pq *PgxQueries) UpdateShopSlackChannels(ctx context.Context, shopId int, d
 
 	return nil
 }
+
+func (pq *PgxQueries) UpdateShopSettings(ctx context.Context, shopId int, data *models.ShopSettingsUpdate) error {
+	_, err := pq.tx.Exec(ctx, `
+    INSERT INTO shop_settings (shop_id, timezone, currency, contact_email, contact_phone, address)
+    VALUES (@shopId, @timezone, @currency, @contactEmail, @contactPhone, @address)
+    ON CONFLICT (shop_id) DO UPDATE
+    SET (timezone, currency, contact_email, contact_phone, address) = 
+    (excluded.timezone, excluded.currency, excluded.contact_email, excluded.contact_phone, excluded.address)
+		`, pgx.NamedArgs{
+		"shopId":       shopId,
+		"timezone":     data.Timezone,
+		"currency":     data.Currency,
+		"contactEmail": data.ContactEmail,
+		"contactPhone": data.ContactPhone,
+		"address":      data.Address,
+	})
+
+	if err != nil {
+		return handlePgxError(err)
+	}
+
+	return nil
+}
+
+// Gives the amounts reachable through v the shop's currency, as amounts are stored without one
+func (q *PgxQueries) setShopCurrency(ctx context.Context, shopId int, v any) error {
+	var currency models.Currency
+	err := q.tx.QueryRow(ctx, `
+    SELECT COALESCE((SELECT currency FROM shop_settings WHERE shop_id = @shopId), @defaultCurrency)`,
+		pgx.NamedArgs{
+			"shopId":          shopId,
+			"defaultCurrency": models.DefaultCurrency,
+		}).Scan(&currency)
+	if err != nil {
+		return handlePgxError(err)
+	}
+
+	models.SetCurrency(v, currency)
+	return nil
+}
@@ -81,6 +81,10 @@ func (q *PgxQueries) GetSubstitutionGroups(ctx context.Context, shopId int) ([]m
 	if err != nil {
 		return nil, handlePgxError(err)
 	}
+	err = q.setShopCurrency(ctx, shopId, data)
+	if err != nil {
+		return nil, err
+	}
 
 	return data, nil
 }
@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -16,10 +17,10 @@ func (q *PgxQueries) CreateTab(ctx context.Context, data *models.TabCreate, stat
     INSERT INTO tabs 
       (shop_id, owner_id, payment_method, organization, display_name,
       start_date, end_date, daily_start_time, daily_end_time, active_days_of_wk,
-      dollar_limit_per_order, verification_method, payment_details, billing_interval_days, status) 
+      dollar_limit_per_order, total_dollar_limit, dollar_limit_per_bill, verification_method, payment_details, billing_interval_days, billing_schedule, billing_anchor_day, billing_term_ends, status) 
     VALUES (@shopId, @ownerId, @paymentMethod, @organization, @displayName,
             @startDate, @endDate, @dailyStartTime, @dailyEndTime, @activeDaysOfWk,
-            @dollarLimitPerOrder, @verificationMethod, @paymentDetails, @billingIntervalDays, @status)
+            @dollarLimitPerOrder, @totalDollarLimit, @dollarLimitPerBill, @verificationMethod, @paymentDetails, @billingIntervalDays, @billingSchedule, @billingAnchorDay, @billingTermEnds, @status)
     RETURNING id`,
 			pgx.NamedArgs{
 				"shopId":              data.ShopId,
@@ -33,9 +34,14 @@ func (q *PgxQueries) CreateTab(ctx context.Context, data *models.TabCreate, stat
 				"dailyEndTime":        data.DailyEndTime,
 				"activeDaysOfWk":      data.ActiveDaysOfWk,
 				"dollarLimitPerOrder": data.DollarLimitPerOrder,
+				"totalDollarLimit":    data.TotalDollarLimit,
+				"dollarLimitPerBill":  data.DollarLimitPerBill,
 				"verificationMethod":  data.VerificationMethod,
 				"paymentDetails":      data.PaymentDetails,
 				"billingIntervalDays": data.BillingIntervalDays,
+				"billingSchedule":     data.Schedule(),
+				"billingAnchorDay":    data.BillingAnchorDay,
+				"billingTermEnds":     data.TermEnds(),
 				"status":              status,
 			})
 
@@ -54,20 +60,26 @@ func (q *PgxQueries) CreateTab(ctx context.Context, data *models.TabCreate, stat
 		if err != nil {
 			return -1, err
 		}
+
+		err = q.setTabAllocations(ctx, data.ShopId, tabId, data.Allocations)
+		if err != nil {
+			return -1, err
+		}
 		return tabId, nil
 	})
 }
 
-func (q *PgxQueries) UpdateTab(ctx context.Context, shopId int, tabId int, data *models.TabUpdate) error {
+// Updates the tab directly, upcoming billing periods are regenerated from the updated schedule
+func (q *PgxQueries) UpdateTab(ctx context.Context, shopId int, tabId int, data *models.TabUpdate, today models.Date) error {
 	return q.WithTx(ctx, func(q *PgxQueries) error {
 		_, err := q.tx.Exec(ctx, `
     UPDATE tabs SET
       (payment_method, organization, display_name,
       start_date, end_date, daily_start_time, daily_end_time, active_days_of_wk,
-      dollar_limit_per_order, verification_method, payment_details, billing_interval_days) 
+      dollar_limit_per_order, total_dollar_limit, dollar_limit_per_bill, verification_method, payment_details, billing_interval_days, billing_schedule, billing_anchor_day, billing_term_ends) 
     = (@paymentMethod, @organization, @displayName,
             @startDate, @endDate, @dailyStartTime, @dailyEndTime, @activeDaysOfWk,
-            @dollarLimitPerOrder, @verificationMethod, @paymentDetails, @billingIntervalDays)
+            @dollarLimitPerOrder, @totalDollarLimit, @dollarLimitPerBill, @verificationMethod, @paymentDetails, @billingIntervalDays, @billingSchedule, @billingAnchorDay, @billingTermEnds)
     WHERE id = @tabId AND shop_id = @shopId`,
 			pgx.NamedArgs{
 				"shopId":              shopId,
@@ -81,9 +93,14 @@ func (q *PgxQueries) UpdateTab(ctx context.Context, shopId int, tabId int, data
 				"dailyEndTime":        data.DailyEndTime,
 				"activeDaysOfWk":      data.ActiveDaysOfWk,
 				"dollarLimitPerOrder": data.DollarLimitPerOrder,
+				"totalDollarLimit":    data.TotalDollarLimit,
+				"dollarLimitPerBill":  data.DollarLimitPerBill,
 				"verificationMethod":  data.VerificationMethod,
 				"paymentDetails":      data.PaymentDetails,
 				"billingIntervalDays": data.BillingIntervalDays,
+				"billingSchedule":     data.Schedule(),
+				"billingAnchorDay":    data.BillingAnchorDay,
+				"billingTermEnds":     data.TermEnds(),
 			})
 		if err != nil {
 			return handlePgxError(err)
@@ -98,11 +115,18 @@ func (q *PgxQueries) UpdateTab(ctx context.Context, shopId int, tabId int, data
 		if err != nil {
 			return err
 		}
-		return nil
+
+		err = q.setTabAllocations(ctx, shopId, tabId, data.Allocations)
+		if err != nil {
+			return err
+		}
+
+		return q.resetUpcomingBills(ctx, shopId, tabId, today)
 	})
 }
 
-func (q *PgxQueries) ApproveTab(ctx context.Context, shopId int, tabId int) error {
+// Applies the tab's pending updates, upcoming billing periods are regenerated from the updated schedule
+func (q *PgxQueries) ApproveTab(ctx context.Context, shopId int, tabId int, today models.Date) error {
 	return q.WithTx(ctx, func(q *PgxQueries) error {
 		_, err := q.tx.Exec(ctx, `
     UPDATE tabs SET
@@ -115,9 +139,14 @@ func (q *PgxQueries) ApproveTab(ctx context.Context, shopId int, tabId int) erro
       daily_end_time = u.daily_end_time,
       active_days_of_wk = u.active_days_of_wk,
       dollar_limit_per_order = u.dollar_limit_per_order,
+      total_dollar_limit = u.total_dollar_limit,
+      dollar_limit_per_bill = u.dollar_limit_per_bill,
       verification_method = u.verification_method,
       payment_details = u.payment_details,
-      billing_interval_days = u.billing_interval_days
+      billing_interval_days = u.billing_interval_days,
+      billing_schedule = u.billing_schedule,
+      billing_anchor_day = u.billing_anchor_day,
+      billing_term_ends = u.billing_term_ends
     FROM tab_updates AS u
     WHERE tabs.id = @tabId AND tabs.shop_id = @shopId 
       AND u.shop_id = tabs.shop_id AND u.tab_id = tabs.id`,
@@ -128,6 +157,33 @@ func (q *PgxQueries) ApproveTab(ctx context.Context, shopId int, tabId int) erro
 		if err != nil {
 			return handlePgxError(err)
 		}
+
+		// Copy over new allocations, which are removed along with the pending updates
+		_, err = q.tx.Exec(ctx, `
+    DELETE FROM tab_allocations
+    WHERE shop_id = @shopId AND tab_id = @tabId
+      AND EXISTS(SELECT 1 FROM tab_updates AS u WHERE u.shop_id = @shopId AND u.tab_id = @tabId)`,
+			pgx.NamedArgs{
+				"shopId": shopId,
+				"tabId":  tabId,
+			})
+		if err != nil {
+			return handlePgxError(err)
+		}
+
+		_, err = q.tx.Exec(ctx, `
+    INSERT INTO tab_allocations (shop_id, tab_id, chartstring, percent, amount)
+    SELECT shop_id, tab_id, chartstring, percent, amount
+    FROM tab_update_allocations
+    WHERE shop_id = @shopId AND tab_id = @tabId
+    ORDER BY id`,
+			pgx.NamedArgs{
+				"shopId": shopId,
+				"tabId":  tabId,
+			})
+		if err != nil {
+			return handlePgxError(err)
+		}
 		result, err := q.tx.Exec(ctx, `
     UPDATE tabs SET
       status = @status
@@ -197,7 +253,7 @@ func (q *PgxQueries) ApproveTab(ctx context.Context, shopId int, tabId int) erro
 			return handlePgxError(err)
 		}
 
-		return nil
+		return q.resetUpcomingBills(ctx, shopId, tabId, today)
 	})
 
 }
@@ -236,46 +292,23 @@ func (q *PgxQueries) CloseTab(ctx context.Context, shopId int, tabId int) error
 	})
 }
 
-func (q *PgxQueries) MarkTabBillPaid(ctx context.Context, shopId int, tabId int, billId int) error {
-	endDate := models.DateOf(time.Now())
-	println(endDate.String())
-	result, err := q.tx.Exec(ctx, `
-    UPDATE tab_bills 
-    SET (is_paid, end_date) = (true, @endDate)
-    WHERE shop_id = @shopId AND tab_id = @tabId AND id = @billId 
-    `, pgx.NamedArgs{
-		"shopId":  shopId,
-		"tabId":   tabId,
-		"billId":  billId,
-		"endDate": endDate,
-	})
-	if err != nil {
-		return handlePgxError(err)
-	}
-	if result.RowsAffected() == 0 {
-		return services.NewNotFoundServiceError(nil)
-	}
-
-	return nil
-}
-
 func (q *PgxQueries) SetTabUpdates(ctx context.Context, shopId int, tabId int, data *models.TabUpdate) error {
 	return q.WithTx(ctx, func(q *PgxQueries) error {
 		_, err := q.tx.Exec(ctx, `
     INSERT INTO tab_updates 
       (shop_id, tab_id, payment_method, organization, display_name,
       start_date, end_date, daily_start_time, daily_end_time, active_days_of_wk,
-      dollar_limit_per_order, verification_method, payment_details, billing_interval_days) 
+      dollar_limit_per_order, total_dollar_limit, dollar_limit_per_bill, verification_method, payment_details, billing_interval_days, billing_schedule, billing_anchor_day, billing_term_ends) 
     VALUES (@shopId, @tabId, @paymentMethod, @organization, @displayName,
             @startDate, @endDate, @dailyStartTime, @dailyEndTime, @activeDaysOfWk,
-            @dollarLimitPerOrder, @verificationMethod, @paymentDetails, @billingIntervalDays)
+            @dollarLimitPerOrder, @totalDollarLimit, @dollarLimitPerBill, @verificationMethod, @paymentDetails, @billingIntervalDays, @billingSchedule, @billingAnchorDay, @billingTermEnds)
     ON CONFLICT (shop_id, tab_id) DO UPDATE SET
       (payment_method, organization, display_name,
       start_date, end_date, daily_start_time, daily_end_time, active_days_of_wk,
-      dollar_limit_per_order, verification_method, payment_details, billing_interval_days) 
+      dollar_limit_per_order, total_dollar_limit, dollar_limit_per_bill, verification_method, payment_details, billing_interval_days, billing_schedule, billing_anchor_day, billing_term_ends) 
     = (excluded.payment_method, excluded.organization, excluded.display_name,
       excluded.start_date, excluded.end_date, excluded.daily_start_time, excluded.daily_end_time, excluded.active_days_of_wk,
-      excluded.dollar_limit_per_order, excluded.verification_method, excluded.payment_details, excluded.billing_interval_days)`,
+      excluded.dollar_limit_per_order, excluded.total_dollar_limit, excluded.dollar_limit_per_bill, excluded.verification_method, excluded.payment_details, excluded.billing_interval_days, excluded.billing_schedule, excluded.billing_anchor_day, excluded.billing_term_ends)`,
 			pgx.NamedArgs{
 				"shopId":              shopId,
 				"tabId":               tabId,
@@ -288,9 +321,14 @@ func (q *PgxQueries) SetTabUpdates(ctx context.Context, shopId int, tabId int, d
 				"dailyEndTime":        data.DailyEndTime,
 				"activeDaysOfWk":      data.ActiveDaysOfWk,
 				"dollarLimitPerOrder": data.DollarLimitPerOrder,
+				"totalDollarLimit":    data.TotalDollarLimit,
+				"dollarLimitPerBill":  data.DollarLimitPerBill,
 				"verificationMethod":  data.VerificationMethod,
 				"paymentDetails":      data.PaymentDetails,
 				"billingIntervalDays": data.BillingIntervalDays,
+				"billingSchedule":     data.Schedule(),
+				"billingAnchorDay":    data.BillingAnchorDay,
+				"billingTermEnds":     data.TermEnds(),
 			})
 		if err != nil {
 			return handlePgxError(err)
@@ -306,6 +344,11 @@ func (q *PgxQueries) SetTabUpdates(ctx context.Context, shopId int, tabId int, d
 			return err
 		}
 
+		err = q.setTabUpdateAllocations(ctx, shopId, tabId, data.Allocations)
+		if err != nil {
+			return err
+		}
+
 		return nil
 	})
 }
@@ -316,7 +359,12 @@ func (q *PgxQueries) GetTabs(ctx context.Context, query *models.GetTabsQueryPara
       tabs.*, 
       (SELECT to_jsonb(tab_updates) as pending_updates
        FROM (SELECT tab_updates.*, 
-             COALESCE(json_agg(locations.*) FILTER (WHERE locations.id IS NOT NULL), '[]') AS locations
+             COALESCE(json_agg(locations.*) FILTER (WHERE locations.id IS NOT NULL), '[]') AS locations,
+             (SELECT COALESCE(json_agg(allocations ORDER BY allocations.id), '[]')
+              FROM (SELECT a.id, a.chartstring, a.percent, a.amount
+                    FROM tab_update_allocations AS a
+                    WHERE a.shop_id = tab_updates.shop_id AND a.tab_id = tab_updates.tab_id) AS allocations
+             ) AS allocations
              FROM tab_updates
              LEFT JOIN tab_update_locations ON tab_updates.shop_id = tab_update_locations.shop_id
                AND tab_updates.tab_id = tab_update_locations.tab_id
@@ -336,17 +384,26 @@ func (q *PgxQueries) GetTabs(ctx context.Context, query *models.GetTabsQueryPara
        FROM locations
        LEFT JOIN tab_locations ON tab_locations.shop_id = locations.shop_id AND tab_locations.location_id = locations.id
        WHERE tab_locations.tab_id = tabs.id
-      ) AS locations
+      ) AS locations,
+      (SELECT COALESCE(json_agg(allocations ORDER BY allocations.id), '[]') AS allocations
+       FROM (SELECT a.id, a.chartstring, a.percent, a.amount
+             FROM tab_allocations AS a
+             WHERE a.shop_id = tabs.shop_id AND a.tab_id = tabs.id) AS allocations
+      ) AS allocations
     FROM tabs
     LEFT JOIN tab_users ON tabs.shop_id = tab_users.shop_id AND tabs.id = tab_users.tab_id
 		WHERE ((@shopId::INTEGER is NULL) OR (tabs.shop_id = @shopId))
 		AND ((@ownerId::text is NULL) OR (tabs.owner_id = @ownerId))
+		AND ((@memberEmail::text is NULL) OR EXISTS(
+		  SELECT 1 FROM tab_users AS members
+		  WHERE members.shop_id = tabs.shop_id AND members.tab_id = tabs.id AND LOWER(members.email) = LOWER(@memberEmail)))
     GROUP BY tabs.shop_id, tabs.id
     ORDER BY tabs.display_name, tabs.start_date, tabs.end_date 
     `,
 		pgx.NamedArgs{ // TODO: Limit and offset
-			"shopId":  query.ShopId,
-			"ownerId": query.OwnerId,
+			"shopId":      query.ShopId,
+			"ownerId":     query.OwnerId,
+			"memberEmail": query.MemberEmail,
 		})
 
 	if err != nil {
@@ -357,6 +414,12 @@ func (q *PgxQueries) GetTabs(ctx context.Context, query *models.GetTabsQueryPara
 	if err != nil {
 		return nil, handlePgxError(err)
 	}
+	for i := range tabs {
+		err = q.setShopCurrency(ctx, tabs[i].ShopId, &tabs[i])
+		if err != nil {
+			return nil, err
+		}
+	}
 	return tabs, nil
 }
 
@@ -371,7 +434,12 @@ func (q *PgxQueries) GetTabById(ctx context.Context, shopId int, tabId int) (*mo
       ) as is_pending_balance,
       (SELECT to_jsonb(tab_updates) as pending_updates
        FROM (SELECT tab_updates.*, 
-             COALESCE(json_agg(locations.*) FILTER (WHERE locations.id IS NOT NULL), '[]') AS locations
+             COALESCE(json_agg(locations.*) FILTER (WHERE locations.id IS NOT NULL), '[]') AS locations,
+             (SELECT COALESCE(json_agg(allocations ORDER BY allocations.id), '[]')
+              FROM (SELECT a.id, a.chartstring, a.percent, a.amount
+                    FROM tab_update_allocations AS a
+                    WHERE a.shop_id = tab_updates.shop_id AND a.tab_id = tab_updates.tab_id) AS allocations
+             ) AS allocations
              FROM tab_updates
              LEFT JOIN tab_update_locations ON tab_updates.shop_id = tab_update_locations.shop_id
                AND tab_updates.tab_id = tab_update_locations.tab_id
@@ -385,23 +453,94 @@ func (q *PgxQueries) GetTabById(ctx context.Context, shopId int, tabId int) (*mo
        LEFT JOIN tab_locations ON tab_locations.shop_id = locations.shop_id AND tab_locations.location_id = locations.id
        WHERE tab_locations.tab_id = tabs.id
       ) AS locations,
+      (SELECT COALESCE(json_agg(allocations ORDER BY allocations.id), '[]') AS allocations
+       FROM (SELECT a.id, a.chartstring, a.percent, a.amount
+             FROM tab_allocations AS a
+             WHERE a.shop_id = tabs.shop_id AND a.tab_id = tabs.id) AS allocations
+      ) AS allocations,
       (SELECT COALESCE(json_agg(tab_bills) FILTER (WHERE tab_bills.id IS NOT NULL), '[]') AS bills
         FROM 
         (SELECT tab_bills.*, 
-          (SELECT COALESCE(json_agg(items) FILTER (WHERE items.id IS NOT NULL), '[]') AS items
+          (SELECT COALESCE(json_agg(items ORDER BY items.line_id) FILTER (WHERE items.id IS NOT NULL), '[]') AS items
             FROM
-            (SELECT items.*, oi.quantity,
-              (SELECT COALESCE(json_agg(variants) FILTER (WHERE variants.id IS NOT NULL), '[]') AS variants
+            (SELECT MIN(oi.id) AS line_id, oi.item_id AS id, oi.name, oi.unit_price AS base_price,
+              COALESCE(BOOL_OR(o.schedule_override) FILTER (WHERE o.type = 'add'), FALSE) AS schedule_override,
+              SUM(CASE WHEN o.type = 'remove' THEN -oi.quantity ELSE oi.quantity END) AS quantity,
+              (SELECT COALESCE(json_agg(variants ORDER BY variants.line_id) FILTER (WHERE variants.id IS NOT NULL), '[]') AS variants
                 FROM
-                (SELECT iv.*, ov.quantity
+                (SELECT MIN(ov.order_item_id) AS line_id, ov.variant_id AS id, ov.name, ov.unit_price AS price,
+                  SUM(CASE WHEN vo.type = 'remove' THEN -ov.quantity ELSE ov.quantity END) AS quantity
                   FROM order_variants AS ov
-                  LEFT JOIN item_variants AS iv ON ov.shop_id = iv.shop_id AND iv.item_id = ov.item_id AND iv.id = ov.variant_id
-                  WHERE ov.shop_id = oi.shop_id AND ov.tab_id = oi.tab_id AND ov.bill_id = oi.bill_id AND ov.item_id = oi.item_id) AS variants
-            ) AS variants
+                  JOIN order_items AS voi ON voi.shop_id = ov.shop_id AND voi.tab_id = ov.tab_id AND voi.bill_id = ov.bill_id AND voi.id = ov.order_item_id
+                  JOIN orders AS vo ON vo.shop_id = voi.shop_id AND vo.tab_id = voi.tab_id AND vo.bill_id = voi.bill_id AND vo.id = voi.order_id
+                  WHERE voi.shop_id = tab_bills.shop_id AND voi.tab_id = tab_bills.tab_id AND voi.bill_id = tab_bills.id
+                    AND voi.item_id = oi.item_id AND voi.name = oi.name AND voi.unit_price = oi.unit_price
+                    AND NOT EXISTS(SELECT 1 FROM order_voids AS v WHERE v.shop_id = vo.shop_id AND v.tab_id = vo.tab_id AND v.bill_id = vo.bill_id AND v.order_id = vo.id)
+                  GROUP BY ov.variant_id, ov.name, ov.unit_price) AS variants
+            ) AS variants,
+              (SELECT COALESCE(json_agg(addons ORDER BY addons.line_id) FILTER (WHERE addons.id IS NOT NULL), '[]') AS addons
+                FROM
+                (SELECT MIN(oa.order_item_id) AS line_id, oa.addon_id AS id, oa.name, oa.unit_price AS base_price,
+                  SUM(CASE WHEN ao.type = 'remove' THEN -oa.quantity ELSE oa.quantity END) AS quantity
+                  FROM order_addons AS oa
+                  JOIN order_items AS aoi ON aoi.shop_id = oa.shop_id AND aoi.tab_id = oa.tab_id AND aoi.bill_id = oa.bill_id AND aoi.id = oa.order_item_id
+                  JOIN orders AS ao ON ao.shop_id = aoi.shop_id AND ao.tab_id = aoi.tab_id AND ao.bill_id = aoi.bill_id AND ao.id = aoi.order_id
+                  WHERE aoi.shop_id = tab_bills.shop_id AND aoi.tab_id = tab_bills.tab_id AND aoi.bill_id = tab_bills.id
+                    AND aoi.item_id = oi.item_id AND aoi.name = oi.name AND aoi.unit_price = oi.unit_price
+                    AND NOT EXISTS(SELECT 1 FROM order_voids AS v WHERE v.shop_id = ao.shop_id AND v.tab_id = ao.tab_id AND v.bill_id = ao.bill_id AND v.order_id = ao.id)
+                  GROUP BY oa.addon_id, oa.name, oa.unit_price) AS addons
+            ) AS addons,
+              (SELECT COALESCE(json_agg(substitutions ORDER BY substitutions.line_id) FILTER (WHERE substitutions.id IS NOT NULL), '[]') AS substitutions
+                FROM
+                (SELECT MIN(os.order_item_id) AS line_id, os.substitution_group_id, os.substitution_id AS id, os.name, os.unit_price AS base_price,
+                  SUM(CASE WHEN so.type = 'remove' THEN -os.quantity ELSE os.quantity END) AS quantity
+                  FROM order_substitutions AS os
+                  JOIN order_items AS soi ON soi.shop_id = os.shop_id AND soi.tab_id = os.tab_id AND soi.bill_id = os.bill_id AND soi.id = os.order_item_id
+                  JOIN orders AS so ON so.shop_id = soi.shop_id AND so.tab_id = soi.tab_id AND so.bill_id = soi.bill_id AND so.id = soi.order_id
+                  WHERE soi.shop_id = tab_bills.shop_id AND soi.tab_id = tab_bills.tab_id AND soi.bill_id = tab_bills.id
+                    AND soi.item_id = oi.item_id AND soi.name = oi.name AND soi.unit_price = oi.unit_price
+                    AND NOT EXISTS(SELECT 1 FROM order_voids AS v WHERE v.shop_id = so.shop_id AND v.tab_id = so.tab_id AND v.bill_id = so.bill_id AND v.order_id = so.id)
+                  GROUP BY os.substitution_group_id, os.substitution_id, os.name, os.unit_price) AS substitutions
+            ) AS substitutions
               FROM order_items AS oi
-              LEFT JOIN items ON items.shop_id = oi.shop_id AND items.id = oi.item_id
-              WHERE oi.shop_id = tab_bills.shop_id AND oi.tab_id = tab_bills.tab_id AND oi.bill_id = tab_bills.id) AS items
-          ) AS items
+              JOIN orders AS o ON o.shop_id = oi.shop_id AND o.tab_id = oi.tab_id AND o.bill_id = oi.bill_id AND o.id = oi.order_id
+              WHERE oi.shop_id = tab_bills.shop_id AND oi.tab_id = tab_bills.tab_id AND oi.bill_id = tab_bills.id
+                AND NOT EXISTS(SELECT 1 FROM order_voids AS v WHERE v.shop_id = o.shop_id AND v.tab_id = o.tab_id AND v.bill_id = o.bill_id AND v.order_id = o.id)
+              GROUP BY oi.item_id, oi.name, oi.unit_price) AS items
+          ) AS items,
+          (SELECT COALESCE(json_agg(voids ORDER BY voids.created_at), '[]') AS voids
+            FROM
+            (SELECT v.order_id, v.reason, v.note, v.paid_bill_override, v.staff_id, users.name AS staff_name, v.created_at
+              FROM order_voids AS v
+              LEFT JOIN users ON users.id = v.staff_id
+              WHERE v.shop_id = tab_bills.shop_id AND v.tab_id = tab_bills.tab_id AND v.bill_id = tab_bills.id) AS voids
+          ) AS voids,
+          (SELECT COALESCE(json_agg(adjustments ORDER BY adjustments.created_at, adjustments.id), '[]') AS adjustments
+            FROM
+            (SELECT a.id, a.bill_id, a.amount, a.reason, a.staff_id, users.name AS staff_name, a.created_at
+              FROM bill_adjustments AS a
+              LEFT JOIN users ON users.id = a.staff_id
+              WHERE a.shop_id = tab_bills.shop_id AND a.tab_id = tab_bills.tab_id AND a.bill_id = tab_bills.id) AS adjustments
+          ) AS adjustments,
+          (SELECT COALESCE(json_agg(payments ORDER BY payments.created_at, payments.id), '[]') AS payments
+            FROM
+            (SELECT p.id, p.bill_id, p.amount, p.method, p.reference, p.staff_id, users.name AS staff_name, p.created_at,
+              (SELECT to_jsonb(reversals) AS reversal
+                FROM
+                (SELECT r.note, r.staff_id, reversal_staff.name AS staff_name, r.created_at
+                  FROM bill_payment_reversals AS r
+                  LEFT JOIN users AS reversal_staff ON reversal_staff.id = r.staff_id
+                  WHERE r.shop_id = p.shop_id AND r.tab_id = p.tab_id AND r.bill_id = p.bill_id AND r.payment_id = p.id) AS reversals
+              ) AS reversal
+              FROM bill_payments AS p
+              LEFT JOIN users ON users.id = p.staff_id
+              WHERE p.shop_id = tab_bills.shop_id AND p.tab_id = tab_bills.tab_id AND p.bill_id = tab_bills.id) AS payments
+          ) AS payments,
+          (SELECT COALESCE(SUM(p.amount), 0)
+            FROM bill_payments AS p
+            WHERE p.shop_id = tab_bills.shop_id AND p.tab_id = tab_bills.tab_id AND p.bill_id = tab_bills.id
+              AND NOT EXISTS(SELECT 1 FROM bill_payment_reversals AS r WHERE r.shop_id = p.shop_id AND r.tab_id = p.tab_id AND r.bill_id = p.bill_id AND r.payment_id = p.id)
+          ) AS amount_paid
           FROM tab_bills
           WHERE tab_bills.shop_id = tabs.shop_id AND tab_bills.tab_id = tabs.id
           GROUP BY tab_bills.shop_id, tab_bills.tab_id, tab_bills.id
@@ -410,7 +549,31 @@ func (q *PgxQueries) GetTabById(ctx context.Context, shopId int, tabId int) (*mo
       (SELECT array_remove(array_agg(tab_users.email), null)
        FROM tab_users
        WHERE tab_users.shop_id = tabs.shop_id AND tab_users.tab_id = tabs.id
-      ) AS verification_list
+      ) AS verification_list,
+      (SELECT to_jsonb(vouchers) AS vouchers
+        FROM
+        (SELECT COUNT(*) AS issued, COUNT(*) FILTER (WHERE uses >= max_uses) AS exhausted,
+          COALESCE(SUM(uses), 0) AS uses, COALESCE(SUM(max_uses), 0) AS max_uses
+          FROM
+          (SELECT v.max_uses,
+            (SELECT COUNT(*)
+              FROM voucher_redemptions AS r
+              WHERE r.shop_id = v.shop_id AND r.tab_id = v.tab_id AND r.voucher_id = v.id
+                AND NOT EXISTS(SELECT 1 FROM order_voids AS ov WHERE ov.shop_id = r.shop_id AND ov.tab_id = r.tab_id AND ov.bill_id = r.bill_id AND ov.order_id = r.order_id)
+            ) AS uses
+            FROM tab_vouchers AS v
+            WHERE v.shop_id = tabs.shop_id AND v.tab_id = tabs.id) AS tab_vouchers
+        ) AS vouchers
+      ) AS vouchers,
+      (SELECT COALESCE(json_agg(limit_rules ORDER BY limit_rules.id), '[]') AS limit_rules
+        FROM
+        (SELECT r.id, r.target, COALESCE(r.item_id, r.category_id) AS target_id, COALESCE(items.name, item_categories.name) AS target_name,
+          r.scope, r.period, r.max_quantity, r.max_amount
+          FROM tab_limit_rules AS r
+          LEFT JOIN items ON items.shop_id = r.shop_id AND items.id = r.item_id
+          LEFT JOIN item_categories ON item_categories.shop_id = r.shop_id AND item_categories.id = r.category_id
+          WHERE r.shop_id = tabs.shop_id AND r.tab_id = tabs.id) AS limit_rules
+      ) AS limit_rules
     FROM tabs
     WHERE tabs.shop_id = @shopId AND tabs.id = @tabId
     GROUP BY tabs.shop_id, tabs.id`,
@@ -427,6 +590,29 @@ func (q *PgxQueries) GetTabById(ctx context.Context, shopId int, tabId int) (*mo
 	if err != nil {
 		return nil, handlePgxError(err)
 	}
+	err = q.setShopCurrency(ctx, shopId, tab)
+	if err != nil {
+		return nil, err
+	}
+	for i := range tab.Bills {
+		total, err := tab.Bills[i].Total()
+		if err != nil {
+			return nil, err
+		}
+		tab.Bills[i].PaymentStatus, err = models.PaymentStatusOf(total, tab.Bills[i].AmountPaid)
+		if err != nil {
+			return nil, err
+		}
+		tab.Bills[i].Status = tab.Bills[i].BillOverview.Status()
+		tab.Bills[i].Allocations, err = tab.Allocate(total)
+		if errors.Is(err, models.ErrAllocationsExceedTotal) {
+			// The bill cannot be charged to the allocations until its total covers their fixed amounts
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
 	return tab, nil
 }
 
@@ -538,200 +724,325 @@ func (q *PgxQueries) SetTabUpdateLocations(ctx context.Context, shopId int, tabI
 	return nil
 }
 
-func (q *PgxQueries) insertBill(ctx context.Context, shopId int, tabId int, startDate models.Date, endDate models.Date) (int, error) {
-	var billId int
-	println("start ", startDate.String(), "end", endDate.String())
+// Adds the order at the given time, which is expected to be in the shop's timezone
+func (q *PgxQueries) AddOrderToTab(ctx context.Context, shopId int, tabId int, staffId string, now time.Time, data *models.BillOrderCreate) (int, error) {
+	return q.recordTabOrder(ctx, models.ORDER_TYPE_ADD, func(q *PgxQueries, tab *models.Tab, billId int) error {
+		orderTotal, err := q.getPendingOrderTotal(ctx, shopId)
+		if err != nil {
+			return err
+		}
+		tabSpent, err := q.getTabSpent(ctx, shopId, tabId, nil, nil)
+		if err != nil {
+			return err
+		}
+		billSpent, err := q.getTabSpent(ctx, shopId, tabId, &billId, nil)
+		if err != nil {
+			return err
+		}
+		err = tab.ValidateOrderTotal(orderTotal, tabSpent, billSpent)
+		if err != nil {
+			return err
+		}
 
-	row := q.tx.QueryRow(ctx, `
-    INSERT INTO tab_bills 
-    (shop_id, tab_id, start_date, end_date) VALUES (@shopId, @tabId, @startDate, @endDate) RETURNING id
-    `, pgx.NamedArgs{
-		"shopId":    shopId,
-		"tabId":     tabId,
-		"startDate": startDate,
-		"endDate":   endDate,
-	})
-	err := row.Scan(&billId)
-	if err != nil {
-		return 0, handlePgxError(err)
-	}
+		person := data.OrdererKey()
+		dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		usages, err := q.getTabLimitRuleUsages(ctx, shopId, tabId, billId, dayStart, person)
+		if err != nil {
+			return err
+		}
+		return models.ValidateLimitRules(usages, person != nil)
+	}, shopId, tabId, staffId, now, data)
+}
 
-	return billId, nil
+// Removes items from the bill covering the given time, crediting them at the price they were last ordered at on that bill
+func (q *PgxQueries) RemoveOrderFromTab(ctx context.Context, shopId int, tabId int, staffId string, now time.Time, data *models.BillOrderCreate) (int, error) {
+	return q.recordTabOrder(ctx, models.ORDER_TYPE_REMOVE, nil, shopId, tabId, staffId, now, data)
 }
 
-func (q *PgxQueries) getTargetBill(ctx context.Context, shopId int, tabId int) (int, error) {
-	// TODO: Implement and change to get tab overview by id
-	tab, err := q.GetTabById(ctx, shopId, tabId)
-	if err != nil {
-		return 0, err
-	}
+// Stages the order in temporary tables, validates it, and records it against the target bill.
+// The tab is locked so that concurrent orders are validated against each other's spending.
+func (q *PgxQueries) recordTabOrder(ctx context.Context, orderType models.OrderType, validateFn func(q *PgxQueries, tab *models.Tab, billId int) error, shopId int, tabId int, staffId string, now time.Time, data *models.BillOrderCreate) (int, error) {
+	return WithTxRet(ctx, q, func(q *PgxQueries) (int, error) {
+		err := q.lockTab(ctx, shopId, tabId)
+		if err != nil {
+			return 0, err
+		}
 
-	rows, _ := q.tx.Query(ctx, `
-    SELECT b.id, b.start_date, b.end_date, b.is_paid
-    FROM tab_bills b
-    LEFT JOIN tabs ON b.shop_id = tabs.shop_id AND b.tab_id = tabs.id
-    WHERE b.shop_id = @shopId AND b.tab_id = @tabId
-    ORDER BY is_paid, end_date DESC
-    `,
-		pgx.NamedArgs{
-			"shopId": shopId,
-			"tabId":  tabId,
-		})
+		tab, err := q.GetTabById(ctx, shopId, tabId)
+		if err != nil {
+			return 0, err
+		}
 
-	bill, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[models.BillOverview])
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			endDate := tab.EndDate
-			if tab.StartDate.AddDays(tab.BillingIntervalDays).Before(endDate.Date) {
-				endDate = models.Date{Date: tab.StartDate.AddDays(tab.BillingIntervalDays - 1)}
+		billId, err := q.getTargetBill(ctx, tab, models.DateOf(now))
+		if err != nil {
+			return 0, err
+		}
+
+		staged, err := q.stageOrder(ctx, data)
+		if err != nil {
+			return 0, err
+		}
+
+		if validateFn != nil {
+			err = validateFn(q, tab, billId)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		orderId, err := q.insertOrder(ctx, shopId, tabId, billId, orderType, staffId, data)
+		if err != nil {
+			return 0, err
+		}
+
+		err = q.insertOrderLines(ctx, shopId, tabId, billId, orderId, orderType, staged)
+		if err != nil {
+			return 0, err
+		}
+
+		if orderType == models.ORDER_TYPE_ADD && data.VoucherCode != nil {
+			err = q.redeemVoucher(ctx, tab, billId, orderId, *data.VoucherCode)
+			if err != nil {
+				return 0, err
 			}
+		}
 
-			id, err := q.insertBill(ctx, shopId, tabId, tab.StartDate, endDate)
+		if orderType == models.ORDER_TYPE_REMOVE {
+			err = q.validateBillQuantities(ctx, shopId, tabId, billId)
 			if err != nil {
-				return 0, handlePgxError(err)
+				return 0, err
 			}
-			return id, nil
 		}
 
-		return 0, handlePgxError(err)
+		return orderId, nil
+	})
+}
+
+// Locks the tab until the transaction completes
+func (q *PgxQueries) lockTab(ctx context.Context, shopId int, tabId int) error {
+	_, err := q.tx.Exec(ctx, `
+    SELECT 1 FROM tabs WHERE shop_id = @shopId AND id = @tabId FOR UPDATE`,
+		pgx.NamedArgs{
+			"shopId": shopId,
+			"tabId":  tabId,
+		})
+	if err != nil {
+		return handlePgxError(err)
 	}
+	return nil
+}
 
-	now := time.Now()
-	today := models.DateOf(now)
+// The number of distinct entries of each kind in a staged order
+type stagedOrder struct {
+	nItems         int
+	nVariants      int
+	nAddons        int
+	nSubstitutions int
+}
+
+// Copies the order into temporary tables, keeping each line of the order apart by its position in the order
+func (q *PgxQueries) stageOrder(ctx context.Context, data *models.BillOrderCreate) (stagedOrder, error) {
+	_, err := q.tx.Exec(ctx, `
+    CREATE TEMPORARY TABLE _temp_order_items (line INT NOT NULL, item_id INT NOT NULL, quantity INT NOT NULL) ON COMMIT DROP`)
+	if err != nil {
+		return stagedOrder{}, handlePgxError(err)
+	}
+	_, err = q.tx.Exec(ctx, `
+	   CREATE TEMPORARY TABLE _temp_order_variants (line INT NOT NULL, item_id INT NOT NULL, variant_id INT NOT NULL, quantity INT NOT NULL) ON COMMIT DROP`)
+	if err != nil {
+		return stagedOrder{}, handlePgxError(err)
+	}
+	_, err = q.tx.Exec(ctx, `
+	   CREATE TEMPORARY TABLE _temp_order_addons (line INT NOT NULL, item_id INT NOT NULL, addon_id INT NOT NULL, quantity INT NOT NULL) ON COMMIT DROP`)
+	if err != nil {
+		return stagedOrder{}, handlePgxError(err)
+	}
+	_, err = q.tx.Exec(ctx, `
+	   CREATE TEMPORARY TABLE _temp_order_substitutions (line INT NOT NULL, item_id INT NOT NULL, substitution_group_id INT NOT NULL, substitution_id INT NOT NULL, quantity INT NOT NULL) ON COMMIT DROP`)
+	if err != nil {
+		return stagedOrder{}, handlePgxError(err)
+	}
 
-	if !bill.StartDate.After(today.Date) && !bill.EndDate.Before(today.Date) && !bill.IsPaid {
-		return bill.Id, nil
+	itemOrders := make([][]any, 0)
+	variantOrders := make([][]any, 0)
+	addonOrders := make([][]any, 0)
+	substitutionOrders := make([][]any, 0)
+	variantIds := make(map[[2]int]bool)
+	addonIds := make(map[[2]int]bool)
+	substitutionIds := make(map[[3]int]bool)
+	for line, i := range data.Items {
+		itemOrders = append(itemOrders, []any{line, i.Id, *i.Quantity})
+		for _, v := range i.Variants {
+			variantOrders = append(variantOrders, []any{line, i.Id, v.Id, *v.Quantity})
+			variantIds[[2]int{line, v.Id}] = true
+		}
+		for _, a := range i.Addons {
+			addonOrders = append(addonOrders, []any{line, i.Id, a.Id, *a.Quantity})
+			addonIds[[2]int{line, a.Id}] = true
+		}
+		for _, sub := range i.Substitutions {
+			substitutionOrders = append(substitutionOrders, []any{line, i.Id, sub.SubstitutionGroupId, sub.Id, *sub.Quantity})
+			substitutionIds[[3]int{line, sub.SubstitutionGroupId, sub.Id}] = true
+		}
 	}
 
-	endDate := tab.EndDate
-	if bill.EndDate.AddDays(tab.BillingIntervalDays - 1).Before(endDate.Date) {
-		endDate = models.Date{Date: bill.EndDate.AddDays(tab.BillingIntervalDays - 1)}
+	_, err = q.tx.CopyFrom(ctx, pgx.Identifier{"_temp_order_items"},
+		[]string{"line", "item_id", "quantity"}, pgx.CopyFromRows(itemOrders))
+	if err != nil {
+		return stagedOrder{}, handlePgxError(err)
 	}
 
-	id, err := q.insertBill(ctx, shopId, tabId, bill.EndDate, endDate)
+	_, err = q.tx.CopyFrom(ctx, pgx.Identifier{"_temp_order_variants"},
+		[]string{"line", "item_id", "variant_id", "quantity"}, pgx.CopyFromRows(variantOrders))
 	if err != nil {
-		return 0, handlePgxError(err)
+		return stagedOrder{}, handlePgxError(err)
 	}
-	return id, nil
 
-}
+	_, err = q.tx.CopyFrom(ctx, pgx.Identifier{"_temp_order_addons"},
+		[]string{"line", "item_id", "addon_id", "quantity"}, pgx.CopyFromRows(addonOrders))
+	if err != nil {
+		return stagedOrder{}, handlePgxError(err)
+	}
 
-func (q *PgxQueries) AddOrderToTab(ctx context.Context, shopId int, tabId int, data *models.BillOrderCreate) error {
-	err := q.updateTabOrders(ctx, func(tx pgx.Tx) error {
-		_, err := tx.Exec(ctx, `
-    INSERT INTO order_items SELECT * FROM _temp_upsert_order_items ON CONFLICT (shop_id, tab_id, bill_id, item_id) DO UPDATE
-    SET quantity = order_items.quantity + excluded.quantity`)
-		if err != nil {
-			return handlePgxError(err)
-		}
-		_, err = tx.Exec(ctx, `
-	   INSERT INTO order_variants SELECT * FROM _temp_upsert_order_variants ON CONFLICT (shop_id, tab_id, bill_id, item_id, variant_id) DO UPDATE
-	   SET quantity = order_variants.quantity + excluded.quantity`)
-		if err != nil {
-			return handlePgxError(err)
-		}
-		return nil
-	}, shopId, tabId, data)
+	_, err = q.tx.CopyFrom(ctx, pgx.Identifier{"_temp_order_substitutions"},
+		[]string{"line", "item_id", "substitution_group_id", "substitution_id", "quantity"}, pgx.CopyFromRows(substitutionOrders))
 	if err != nil {
-		return err
+		return stagedOrder{}, handlePgxError(err)
 	}
 
-	return nil
+	return stagedOrder{
+		nItems:         len(itemOrders),
+		nVariants:      len(variantIds),
+		nAddons:        len(addonIds),
+		nSubstitutions: len(substitutionIds),
+	}, nil
 }
 
-func (q *PgxQueries) RemoveOrderFromTab(ctx context.Context, shopId int, tabId int, data *models.BillOrderCreate) error {
-	err := q.updateTabOrders(ctx, func(tx pgx.Tx) error {
-		_, err := tx.Exec(ctx, `
-      UPDATE order_items SET
-        quantity = order_items.quantity - u.quantity
-      FROM _temp_upsert_order_items AS u
-      WHERE order_items.shop_id = u.shop_id
-        AND order_items.tab_id = u.tab_id 
-        AND order_items.bill_id = u.bill_id 
-        AND order_items.item_id = u.item_id`)
+// Prices the order staged in the temporary order tables at current menu prices
+func (q *PgxQueries) getPendingOrderTotal(ctx context.Context, shopId int) (models.Money, error) {
+	row := q.tx.QueryRow(ctx, `
+    SELECT (
+      (SELECT COALESCE(SUM(items.base_price * o.quantity), 0)
+       FROM _temp_order_items AS o
+       JOIN items ON items.shop_id = @shopId AND items.id = o.item_id) +
+      (SELECT COALESCE(SUM(iv.price * o.quantity), 0)
+       FROM _temp_order_variants AS o
+       JOIN item_variants AS iv ON iv.shop_id = @shopId AND iv.item_id = o.item_id AND iv.id = o.variant_id) +
+      (SELECT COALESCE(SUM(items.base_price * o.quantity), 0)
+       FROM _temp_order_addons AS o
+       JOIN items ON items.shop_id = @shopId AND items.id = o.addon_id) +
+      (SELECT COALESCE(SUM(subs.price * o.quantity), 0)
+       FROM _temp_order_substitutions AS o
+       JOIN item_substitution_prices AS subs ON subs.shop_id = @shopId
+         AND subs.substitution_group_id = o.substitution_group_id AND subs.item_id = o.substitution_id)
+    )::BIGINT`,
+		pgx.NamedArgs{
+			"shopId": shopId,
+		})
 
-		if err != nil {
-			return handlePgxError(err)
-		}
-		_, err = tx.Exec(ctx, `
-      UPDATE order_variants SET
-        quantity = order_variants.quantity - u.quantity
-      FROM _temp_upsert_order_variants AS u
-      WHERE order_variants.shop_id = u.shop_id
-        AND order_variants.tab_id = u.tab_id 
-        AND order_variants.bill_id = u.bill_id 
-        AND order_variants.item_id = u.item_id
-        AND order_variants.variant_id = u.variant_id`)
-		if err != nil {
-			return handlePgxError(err)
-		}
-		return nil
-	}, shopId, tabId, data)
+	var total models.Money
+	err := row.Scan(&total)
 	if err != nil {
-		return err
+		return total, handlePgxError(err)
 	}
-
-	return nil
+	return total, nil
 }
 
-func (q *PgxQueries) updateTabOrders(ctx context.Context, updateFn func(pgx.Tx) error, shopId int, tabId int, data *models.BillOrderCreate) error {
-	return q.WithTx(ctx, func(q *PgxQueries) error {
-		billId, err := q.getTargetBill(ctx, shopId, tabId)
-		if err != nil {
-			return err
-		}
+// Sums the non-voided orders placed for the member on the tab, including the removals which reverse them
+func (q *PgxQueries) GetMemberSpent(ctx context.Context, shopId int, tabId int, email string) (models.Money, error) {
+	return q.getTabSpent(ctx, shopId, tabId, nil, &email)
+}
 
-		_, err = q.tx.Exec(ctx, `
-    CREATE TEMPORARY TABLE _temp_upsert_order_items (LIKE order_items INCLUDING ALL ) ON COMMIT DROP`)
-		if err != nil {
-			return handlePgxError(err)
-		}
-		_, err = q.tx.Exec(ctx, `
-	   CREATE TEMPORARY TABLE _temp_upsert_order_variants (LIKE order_variants INCLUDING ALL ) ON COMMIT DROP`)
-		if err != nil {
-			return handlePgxError(err)
-		}
+// Sums the tab's orders, optionally limited to a bill or to the orders placed by a member.
+// Adjustments are included unless limited to a member, as they are not placed by anyone.
+func (q *PgxQueries) getTabSpent(ctx context.Context, shopId int, tabId int, billId *int, orderedByEmail *string) (models.Money, error) {
+	row := q.tx.QueryRow(ctx, `
+    SELECT (
+      (SELECT COALESCE(SUM(CASE WHEN o.type = 'remove' THEN -1 ELSE 1 END * oi.unit_price * oi.quantity), 0)
+       FROM order_items AS oi
+       JOIN orders AS o ON o.shop_id = oi.shop_id AND o.tab_id = oi.tab_id AND o.bill_id = oi.bill_id AND o.id = oi.order_id
+       JOIN order_item_orderers AS oo ON oo.shop_id = oi.shop_id AND oo.tab_id = oi.tab_id AND oo.bill_id = oi.bill_id AND oo.order_item_id = oi.id
+       WHERE oi.shop_id = @shopId AND oi.tab_id = @tabId AND ((@billId::INTEGER IS NULL) OR (oi.bill_id = @billId))
+         AND ((@orderedByEmail::TEXT IS NULL) OR (LOWER(oo.ordered_by_email) = LOWER(@orderedByEmail)))
+         AND NOT EXISTS(SELECT 1 FROM order_voids AS v WHERE v.shop_id = o.shop_id AND v.tab_id = o.tab_id AND v.bill_id = o.bill_id AND v.order_id = o.id)) +
+      (SELECT COALESCE(SUM(CASE WHEN o.type = 'remove' THEN -1 ELSE 1 END * ov.unit_price * ov.quantity), 0)
+       FROM order_variants AS ov
+       JOIN order_items AS oi ON oi.shop_id = ov.shop_id AND oi.tab_id = ov.tab_id AND oi.bill_id = ov.bill_id AND oi.id = ov.order_item_id
+       JOIN orders AS o ON o.shop_id = oi.shop_id AND o.tab_id = oi.tab_id AND o.bill_id = oi.bill_id AND o.id = oi.order_id
+       JOIN order_item_orderers AS oo ON oo.shop_id = oi.shop_id AND oo.tab_id = oi.tab_id AND oo.bill_id = oi.bill_id AND oo.order_item_id = oi.id
+       WHERE ov.shop_id = @shopId AND ov.tab_id = @tabId AND ((@billId::INTEGER IS NULL) OR (ov.bill_id = @billId))
+         AND ((@orderedByEmail::TEXT IS NULL) OR (LOWER(oo.ordered_by_email) = LOWER(@orderedByEmail)))
+         AND NOT EXISTS(SELECT 1 FROM order_voids AS v WHERE v.shop_id = o.shop_id AND v.tab_id = o.tab_id AND v.bill_id = o.bill_id AND v.order_id = o.id)) +
+      (SELECT COALESCE(SUM(CASE WHEN o.type = 'remove' THEN -1 ELSE 1 END * oa.unit_price * oa.quantity), 0)
+       FROM order_addons AS oa
+       JOIN order_items AS oi ON oi.shop_id = oa.shop_id AND oi.tab_id = oa.tab_id AND oi.bill_id = oa.bill_id AND oi.id = oa.order_item_id
+       JOIN orders AS o ON o.shop_id = oi.shop_id AND o.tab_id = oi.tab_id AND o.bill_id = oi.bill_id AND o.id = oi.order_id
+       JOIN order_item_orderers AS oo ON oo.shop_id = oi.shop_id AND oo.tab_id = oi.tab_id AND oo.bill_id = oi.bill_id AND oo.order_item_id = oi.id
+       WHERE oa.shop_id = @shopId AND oa.tab_id = @tabId AND ((@billId::INTEGER IS NULL) OR (oa.bill_id = @billId))
+         AND ((@orderedByEmail::TEXT IS NULL) OR (LOWER(oo.ordered_by_email) = LOWER(@orderedByEmail)))
+         AND NOT EXISTS(SELECT 1 FROM order_voids AS v WHERE v.shop_id = o.shop_id AND v.tab_id = o.tab_id AND v.bill_id = o.bill_id AND v.order_id = o.id)) +
+      (SELECT COALESCE(SUM(CASE WHEN o.type = 'remove' THEN -1 ELSE 1 END * os.unit_price * os.quantity), 0)
+       FROM order_substitutions AS os
+       JOIN order_items AS oi ON oi.shop_id = os.shop_id AND oi.tab_id = os.tab_id AND oi.bill_id = os.bill_id AND oi.id = os.order_item_id
+       JOIN orders AS o ON o.shop_id = oi.shop_id AND o.tab_id = oi.tab_id AND o.bill_id = oi.bill_id AND o.id = oi.order_id
+       JOIN order_item_orderers AS oo ON oo.shop_id = oi.shop_id AND oo.tab_id = oi.tab_id AND oo.bill_id = oi.bill_id AND oo.order_item_id = oi.id
+       WHERE os.shop_id = @shopId AND os.tab_id = @tabId AND ((@billId::INTEGER IS NULL) OR (os.bill_id = @billId))
+         AND ((@orderedByEmail::TEXT IS NULL) OR (LOWER(oo.ordered_by_email) = LOWER(@orderedByEmail)))
+         AND NOT EXISTS(SELECT 1 FROM order_voids AS v WHERE v.shop_id = o.shop_id AND v.tab_id = o.tab_id AND v.bill_id = o.bill_id AND v.order_id = o.id)) +
+      (SELECT COALESCE(SUM(a.amount), 0)
+       FROM bill_adjustments AS a
+       WHERE a.shop_id = @shopId AND a.tab_id = @tabId AND ((@billId::INTEGER IS NULL) OR (a.bill_id = @billId))
+         AND @orderedByEmail::TEXT IS NULL)
+    )::BIGINT`,
+		pgx.NamedArgs{
+			"shopId":         shopId,
+			"tabId":          tabId,
+			"billId":         billId,
+			"orderedByEmail": orderedByEmail,
+		})
 
-		type itemOrder struct {
-			id       int
-			quantity int
-		}
+	var spent models.Money
+	err := row.Scan(&spent)
+	if err != nil {
+		return spent, handlePgxError(err)
+	}
+	return spent, nil
+}
 
-		type variantOrder struct {
-			itemOrder
-			variantId int
-		}
+func (q *PgxQueries) setTabAllocations(ctx context.Context, shopId int, tabId int, allocations []models.TabAllocationCreate) error {
+	return q.setAllocations(ctx, "tab_allocations", shopId, tabId, allocations)
+}
 
-		itemOrders := make([]itemOrder, 0)
-		variantOrders := make([]variantOrder, 0)
-		for _, i := range data.Items {
-			itemOrders = append(itemOrders, itemOrder{id: i.Id, quantity: *i.Quantity})
-			for _, v := range i.Variants {
-				variantOrders = append(variantOrders, variantOrder{itemOrder: itemOrder{id: i.Id, quantity: *v.Quantity}, variantId: v.Id})
-			}
-		}
+func (q *PgxQueries) setTabUpdateAllocations(ctx context.Context, shopId int, tabId int, allocations []models.TabAllocationCreate) error {
+	return q.setAllocations(ctx, "tab_update_allocations", shopId, tabId, allocations)
+}
 
-		_, err = q.tx.CopyFrom(ctx, pgx.Identifier{"_temp_upsert_order_items"},
-			[]string{"shop_id", "tab_id", "bill_id", "item_id", "quantity"}, pgx.CopyFromSlice(len(itemOrders), func(i int) ([]any, error) {
-				return []any{shopId, tabId, billId, itemOrders[i].id, itemOrders[i].quantity}, nil
-			}))
-		if err != nil {
-			return handlePgxError(err)
-		}
+// Replaces the allocations in the given table, preserving their order
+func (q *PgxQueries) setAllocations(ctx context.Context, table string, shopId int, tabId int, allocations []models.TabAllocationCreate) error {
+	_, err := q.tx.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE shop_id = @shopId AND tab_id = @tabId`, pgx.Identifier{table}.Sanitize()),
+		pgx.NamedArgs{
+			"shopId": shopId,
+			"tabId":  tabId,
+		})
+	if err != nil {
+		return handlePgxError(err)
+	}
 
-		_, err = q.tx.CopyFrom(ctx, pgx.Identifier{"_temp_upsert_order_variants"},
-			[]string{"shop_id", "tab_id", "bill_id", "item_id", "variant_id", "quantity"}, pgx.CopyFromSlice(len(variantOrders), func(i int) ([]any, error) {
-				return []any{shopId, tabId, billId, variantOrders[i].id, variantOrders[i].variantId, variantOrders[i].quantity}, nil
-			}))
+	for _, a := range allocations {
+		_, err = q.tx.Exec(ctx, fmt.Sprintf(`
+    INSERT INTO %s (shop_id, tab_id, chartstring, percent, amount)
+    VALUES (@shopId, @tabId, @chartstring, @percent, @amount)`, pgx.Identifier{table}.Sanitize()),
+			pgx.NamedArgs{
+				"shopId":      shopId,
+				"tabId":       tabId,
+				"chartstring": a.Chartstring,
+				"percent":     a.Percent,
+				"amount":      a.Amount,
+			})
 		if err != nil {
 			return handlePgxError(err)
 		}
+	}
 
-		err = updateFn(q.tx)
-		if err != nil {
-			return err
-		}
-
-		return nil
-	})
+	return nil
 }
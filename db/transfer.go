@@ -0,0 +1,318 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/willtrojniak/TabAppBackend/models"
+	"github.com/willtrojniak/TabAppBackend/services"
+)
+
+func (q *PgxQueries) GetOrderTransferById(ctx context.Context, shopId int, transferId int) (*models.OrderTransfer, error) {
+	rows, _ := q.tx.Query(ctx, `
+    SELECT t.id, t.source_tab_id, t.source_bill_id, t.source_order_id, t.removal_order_id,
+      t.target_tab_id, t.target_bill_id, t.target_order_id, t.note, t.staff_id, users.name AS staff_name, t.created_at,
+      ARRAY(SELECT ti.order_item_id
+            FROM order_transfer_items AS ti
+            WHERE ti.shop_id = t.shop_id AND ti.transfer_id = t.id
+            ORDER BY ti.order_item_id) AS order_item_ids
+    FROM order_transfers AS t
+    LEFT JOIN users ON users.id = t.staff_id
+    WHERE t.shop_id = @shopId AND t.id = @transferId`,
+		pgx.NamedArgs{
+			"shopId":     shopId,
+			"transferId": transferId,
+		})
+
+	transfer, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[models.OrderTransfer])
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+	return transfer, nil
+}
+
+// Moves the lines of the order to the target bill, which defaults to the target tab's bill covering the given time of the order.
+// The lines are validated against the target tab's limits as if they were ordered on the target bill at that time.
+// Neither bill may have been paid or posted to the journal.
+func (q *PgxQueries) TransferTabOrder(ctx context.Context, source *models.Tab, target *models.Tab, order *models.Order, lines []models.OrderLine, targetOrder *models.BillOrderCreate, staffId string, data *models.OrderTransferCreate, at time.Time, today models.Date) (int, error) {
+	return WithTxRet(ctx, q, func(q *PgxQueries) (int, error) {
+		// Serializes the transfer with orders on both tabs, as the target's spending is validated against and the
+		// source's quantities are reduced. Tabs are locked in order of their ids so that opposing transfers cannot deadlock.
+		first, second := source, target
+		if target.Id < source.Id {
+			first, second = target, source
+		}
+		err := q.lockTab(ctx, first.ShopId, first.Id)
+		if err != nil {
+			return 0, err
+		}
+		if second.Id != first.Id {
+			err = q.lockTab(ctx, second.ShopId, second.Id)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		sourceBill, err := q.getAdjustableBill(ctx, source, order.BillId)
+		if err != nil {
+			return 0, err
+		}
+		if sourceBill.IsPaid {
+			return 0, services.NewDataConflictServiceError(errors.New("Orders on paid bills cannot be transferred"))
+		}
+
+		targetBillId, err := q.getTransferTargetBill(ctx, target, data.TargetBillId, models.DateOf(at))
+		if err != nil {
+			return 0, err
+		}
+		if target.Id == source.Id && targetBillId == order.BillId {
+			return 0, services.NewValidationServiceError(errors.New("Order is already on the target bill"), services.ValidationErrors{
+				"target_bill_id": services.ValidationError{Value: targetBillId, Error: "invalid"},
+			})
+		}
+		targetBill, err := q.getAdjustableBill(ctx, target, targetBillId)
+		if err != nil {
+			return 0, err
+		}
+		if targetBill.IsPaid {
+			return 0, services.NewDataConflictServiceError(errors.New("Target bill has already been paid"))
+		}
+
+		_, err = q.stageOrder(ctx, targetOrder)
+		if err != nil {
+			return 0, err
+		}
+		var orderTotal models.Money
+		for i := range lines {
+			lineTotal, err := lines[i].Total()
+			if err != nil {
+				return 0, err
+			}
+			orderTotal, err = orderTotal.Add(lineTotal)
+			if err != nil {
+				return 0, err
+			}
+		}
+		tabSpent, err := q.getTabSpent(ctx, target.ShopId, target.Id, nil, nil)
+		if err != nil {
+			return 0, err
+		}
+		billSpent, err := q.getTabSpent(ctx, target.ShopId, target.Id, &targetBillId, nil)
+		if err != nil {
+			return 0, err
+		}
+		err = target.ValidateOrderTotal(orderTotal, tabSpent, billSpent)
+		if err != nil {
+			return 0, err
+		}
+
+		person := targetOrder.OrdererKey()
+		dayStart := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, at.Location())
+		usages, err := q.getTabLimitRuleUsages(ctx, target.ShopId, target.Id, targetBillId, dayStart, person)
+		if err != nil {
+			return 0, err
+		}
+		err = models.ValidateLimitRules(usages, person != nil)
+		if err != nil {
+			return 0, err
+		}
+
+		removalOrderId, err := q.insertTransferOrder(ctx, source.ShopId, source.Id, order.BillId, models.ORDER_TYPE_REMOVE, order, order.OrderedByName, order.OrderedByEmail)
+		if err != nil {
+			return 0, err
+		}
+		targetOrderId, err := q.insertTransferOrder(ctx, target.ShopId, target.Id, targetBillId, models.ORDER_TYPE_ADD, order, targetOrder.OrderedByName, targetOrder.OrderedByEmail)
+		if err != nil {
+			return 0, err
+		}
+		for i, l := range lines {
+			err = q.copyOrderLine(ctx, source.ShopId, source.Id, order.BillId, l.Id, source.Id, order.BillId, removalOrderId, i)
+			if err != nil {
+				return 0, err
+			}
+			err = q.copyOrderLine(ctx, source.ShopId, source.Id, order.BillId, l.Id, target.Id, targetBillId, targetOrderId, i)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		// The order's lines may have been removed from the source bill since it was placed
+		err = q.validateBillQuantities(ctx, source.ShopId, source.Id, order.BillId)
+		if err != nil {
+			return 0, err
+		}
+
+		if targetOrder.VoucherCode != nil {
+			err = q.redeemVoucher(ctx, target, targetBillId, targetOrderId, *targetOrder.VoucherCode)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		var transferId int
+		err = q.tx.QueryRow(ctx, `
+    INSERT INTO order_transfers (shop_id, source_tab_id, source_bill_id, source_order_id, removal_order_id,
+      target_tab_id, target_bill_id, target_order_id, note, staff_id)
+    VALUES (@shopId, @sourceTabId, @sourceBillId, @sourceOrderId, @removalOrderId,
+      @targetTabId, @targetBillId, @targetOrderId, @note, @staffId)
+    RETURNING id`,
+			pgx.NamedArgs{
+				"shopId":         source.ShopId,
+				"sourceTabId":    source.Id,
+				"sourceBillId":   order.BillId,
+				"sourceOrderId":  order.Id,
+				"removalOrderId": removalOrderId,
+				"targetTabId":    target.Id,
+				"targetBillId":   targetBillId,
+				"targetOrderId":  targetOrderId,
+				"note":           data.Note,
+				"staffId":        staffId,
+			}).Scan(&transferId)
+		if err != nil {
+			return 0, handlePgxError(err)
+		}
+
+		// Lines which were already transferred violate the uniqueness of the transferred lines
+		for _, l := range lines {
+			_, err := q.tx.Exec(ctx, `
+      INSERT INTO order_transfer_items (shop_id, transfer_id, tab_id, bill_id, order_item_id)
+      VALUES (@shopId, @transferId, @tabId, @billId, @orderItemId)`,
+				pgx.NamedArgs{
+					"shopId":      source.ShopId,
+					"transferId":  transferId,
+					"tabId":       source.Id,
+					"billId":      order.BillId,
+					"orderItemId": l.Id,
+				})
+			if err != nil {
+				return 0, handlePgxError(err)
+			}
+		}
+
+		err = q.resetBillSignoff(ctx, source.ShopId, source.Id, order.BillId)
+		if err != nil {
+			return 0, err
+		}
+		err = q.resetBillSignoff(ctx, target.ShopId, target.Id, targetBillId)
+		if err != nil {
+			return 0, err
+		}
+
+		// The source bill's payments may now cover its reduced total
+		_, err = q.settleBill(ctx, source.ShopId, source.Id, sourceBill, today)
+		if err != nil {
+			return 0, err
+		}
+		return transferId, nil
+	})
+}
+
+// Finds the target tab's bill covering the date unless a bill was given
+func (q *PgxQueries) getTransferTargetBill(ctx context.Context, target *models.Tab, billId *int, date models.Date) (int, error) {
+	if billId != nil {
+		return *billId, nil
+	}
+
+	var targetBillId int
+	err := q.tx.QueryRow(ctx, `
+    SELECT id
+    FROM tab_bills
+    WHERE shop_id = @shopId AND tab_id = @tabId AND start_date <= @date AND end_date >= @date
+    ORDER BY start_date
+    LIMIT 1`,
+		pgx.NamedArgs{
+			"shopId": target.ShopId,
+			"tabId":  target.Id,
+			"date":   date,
+		}).Scan(&targetBillId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, services.NewValidationServiceError(errors.New("Target tab has no bill covering the date of the order"), services.ValidationErrors{
+			"target_bill_id": services.ValidationError{Value: nil, Error: "required"},
+		})
+	}
+	if err != nil {
+		return 0, handlePgxError(err)
+	}
+	return targetBillId, nil
+}
+
+// Records an order of the transfer, which is attributed to the staff, location and time of the original order
+func (q *PgxQueries) insertTransferOrder(ctx context.Context, shopId int, tabId int, billId int, orderType models.OrderType, original *models.Order, orderedByName *string, orderedByEmail *string) (int, error) {
+	var orderId int
+	err := q.tx.QueryRow(ctx, `
+    INSERT INTO orders (shop_id, tab_id, bill_id, type, staff_id, location_id, schedule_override, ordered_by_name, ordered_by_email, created_at)
+    VALUES (@shopId, @tabId, @billId, @type, @staffId, @locationId, @scheduleOverride, @orderedByName, @orderedByEmail, @createdAt)
+    RETURNING id`,
+		pgx.NamedArgs{
+			"shopId":           shopId,
+			"tabId":            tabId,
+			"billId":           billId,
+			"type":             string(orderType),
+			"staffId":          original.StaffId,
+			"locationId":       original.LocationId,
+			"scheduleOverride": original.ScheduleOverride,
+			"orderedByName":    orderedByName,
+			"orderedByEmail":   orderedByEmail,
+			"createdAt":        original.CreatedAt,
+		}).Scan(&orderId)
+	if err != nil {
+		return 0, handlePgxError(err)
+	}
+	return orderId, nil
+}
+
+// Copies the order line with its variants, addons and substitutions to the given line of the order, keeping the line's captured names and prices
+func (q *PgxQueries) copyOrderLine(ctx context.Context, shopId int, tabId int, billId int, lineId int, toTabId int, toBillId int, toOrderId int, toLine int) error {
+	args := pgx.NamedArgs{
+		"shopId":    shopId,
+		"tabId":     tabId,
+		"billId":    billId,
+		"lineId":    lineId,
+		"toTabId":   toTabId,
+		"toBillId":  toBillId,
+		"toOrderId": toOrderId,
+		"toLine":    toLine,
+	}
+
+	var toLineId int
+	err := q.tx.QueryRow(ctx, `
+    INSERT INTO order_items (shop_id, tab_id, bill_id, order_id, line, item_id, name, unit_price, quantity)
+    SELECT shop_id, @toTabId, @toBillId, @toOrderId, @toLine, item_id, name, unit_price, quantity
+    FROM order_items
+    WHERE shop_id = @shopId AND tab_id = @tabId AND bill_id = @billId AND id = @lineId
+    RETURNING id`, args).Scan(&toLineId)
+	if err != nil {
+		return handlePgxError(err)
+	}
+	args["toLineId"] = toLineId
+
+	_, err = q.tx.Exec(ctx, `
+    INSERT INTO order_variants (shop_id, tab_id, bill_id, order_item_id, item_id, variant_id, name, unit_price, quantity)
+    SELECT shop_id, @toTabId, @toBillId, @toLineId, item_id, variant_id, name, unit_price, quantity
+    FROM order_variants
+    WHERE shop_id = @shopId AND tab_id = @tabId AND bill_id = @billId AND order_item_id = @lineId`, args)
+	if err != nil {
+		return handlePgxError(err)
+	}
+
+	_, err = q.tx.Exec(ctx, `
+    INSERT INTO order_addons (shop_id, tab_id, bill_id, order_item_id, item_id, addon_id, name, unit_price, quantity)
+    SELECT shop_id, @toTabId, @toBillId, @toLineId, item_id, addon_id, name, unit_price, quantity
+    FROM order_addons
+    WHERE shop_id = @shopId AND tab_id = @tabId AND bill_id = @billId AND order_item_id = @lineId`, args)
+	if err != nil {
+		return handlePgxError(err)
+	}
+
+	_, err = q.tx.Exec(ctx, `
+    INSERT INTO order_substitutions (shop_id, tab_id, bill_id, order_item_id, item_id, substitution_group_id, substitution_id, name, unit_price, quantity)
+    SELECT shop_id, @toTabId, @toBillId, @toLineId, item_id, substitution_group_id, substitution_id, name, unit_price, quantity
+    FROM order_substitutions
+    WHERE shop_id = @shopId AND tab_id = @tabId AND bill_id = @billId AND order_item_id = @lineId`, args)
+	if err != nil {
+		return handlePgxError(err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/willtrojniak/TabAppBackend/models"
+)
+
+func TestTransferTabOrderBetweenTabs(t *testing.T) {
+	tests := []struct {
+		name          string
+		removedFirst  bool
+		wantErr       bool
+		wantSourceAmt int64
+		wantTargetAmt int64
+	}{
+		{name: "transfer", wantTargetAmt: 500},
+		{name: "lines already removed from source", removedFirst: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			now := time.Now()
+			start := models.Date{Date: models.DateOf(now).AddDays(-14)}
+			item := f.createItem(t, "Item", 500, nil, nil)
+			sourceId := f.createTab(t, start)
+			targetId := f.createTab(t, start)
+			orderId := f.addOrder(t, sourceId, now, itemOrder(item, 1))
+
+			if tt.removedFirst {
+				f.tx(t, func(q *PgxQueries) error {
+					_, err := q.RemoveOrderFromTab(context.Background(), f.shopId, sourceId, f.userId, now, &models.BillOrderCreate{
+						Items:      []models.ItemOrderCreate{itemOrder(item, 1)},
+						LocationId: f.locationId,
+					})
+					return err
+				})
+			}
+
+			source := f.getTab(t, sourceId)
+			target := f.getTab(t, targetId)
+			err := WithTx(context.Background(), f.store, func(q *PgxQueries) error {
+				order, err := q.GetTabOrderById(context.Background(), f.shopId, sourceId, orderId)
+				if err != nil {
+					return err
+				}
+				data := &models.OrderTransferCreate{TargetTabId: targetId, OrderItemIds: []int{order.Items[0].Id}, Note: "Moved"}
+				lines, err := order.TransferLines(data)
+				if err != nil {
+					return err
+				}
+				_, err = q.TransferTabOrder(context.Background(), source, target, order, lines, order.TransferOrder(data, lines), f.userId, data, order.CreatedAt, models.DateOf(now))
+				return err
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TransferTabOrder() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			f.tx(t, func(q *PgxQueries) error {
+				sourceSpent, err := q.getTabSpent(context.Background(), f.shopId, sourceId, nil, nil)
+				if err != nil {
+					return err
+				}
+				targetSpent, err := q.getTabSpent(context.Background(), f.shopId, targetId, nil, nil)
+				if err != nil {
+					return err
+				}
+				if sourceSpent.Amount != tt.wantSourceAmt || targetSpent.Amount != tt.wantTargetAmt {
+					t.Errorf("spent = %v on source and %v on target, want %v and %v",
+						sourceSpent.Amount, targetSpent.Amount, tt.wantSourceAmt, tt.wantTargetAmt)
+				}
+				return nil
+			})
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/willtrojniak/TabAppBackend/models"
+	"github.com/willtrojniak/TabAppBackend/services"
+)
+
+func (q *PgxQueries) CreateTabVouchers(ctx context.Context, shopId int, tabId int, createdBy string, codes []string, data *models.VoucherBatchCreate) ([]models.Voucher, error) {
+	return WithTxRet(ctx, q, func(q *PgxQueries) ([]models.Voucher, error) {
+		_, err := q.tx.Exec(ctx, `
+      INSERT INTO tab_vouchers (shop_id, tab_id, code, max_uses, value_cap, expires_at, created_by)
+      SELECT @shopId, @tabId, code, @maxUses, @valueCap, @expiresAt, @createdBy
+      FROM unnest(@codes::VARCHAR[]) AS code`,
+			pgx.NamedArgs{
+				"shopId":    shopId,
+				"tabId":     tabId,
+				"codes":     codes,
+				"maxUses":   data.MaxUses,
+				"valueCap":  data.ValueCap,
+				"expiresAt": data.ExpiresAt,
+				"createdBy": createdBy,
+			})
+		if err != nil {
+			return nil, handlePgxError(err)
+		}
+		return q.getTabVouchers(ctx, shopId, tabId, codes)
+	})
+}
+
+func (q *PgxQueries) GetTabVouchers(ctx context.Context, shopId int, tabId int) ([]models.Voucher, error) {
+	return q.getTabVouchers(ctx, shopId, tabId, nil)
+}
+
+// Gets the vouchers of the tab, limited to the given codes when codes is non-nil
+func (q *PgxQueries) getTabVouchers(ctx context.Context, shopId int, tabId int, codes []string) ([]models.Voucher, error) {
+	rows, err := q.tx.Query(ctx, `
+    SELECT v.id, v.tab_id, v.code, v.max_uses, v.value_cap, v.expires_at, v.created_at,
+      (SELECT COUNT(*)
+        FROM voucher_redemptions AS r
+        WHERE r.shop_id = v.shop_id AND r.tab_id = v.tab_id AND r.voucher_id = v.id
+          AND NOT EXISTS(SELECT 1 FROM order_voids AS ov WHERE ov.shop_id = r.shop_id AND ov.tab_id = r.tab_id AND ov.bill_id = r.bill_id AND ov.order_id = r.order_id)
+      ) AS uses,
+      (SELECT COALESCE(SUM(
+          (SELECT COALESCE(SUM(oi.unit_price * oi.quantity), 0) FROM order_items AS oi
+            WHERE oi.shop_id = r.shop_id AND oi.tab_id = r.tab_id AND oi.bill_id = r.bill_id AND oi.order_id = r.order_id) +
+          (SELECT COALESCE(SUM(ov.unit_price * ov.quantity), 0) FROM order_variants AS ov
+            JOIN order_items AS oi ON oi.shop_id = ov.shop_id AND oi.tab_id = ov.tab_id AND oi.bill_id = ov.bill_id AND oi.id = ov.order_item_id
+            WHERE oi.shop_id = r.shop_id AND oi.tab_id = r.tab_id AND oi.bill_id = r.bill_id AND oi.order_id = r.order_id) +
+          (SELECT COALESCE(SUM(oa.unit_price * oa.quantity), 0) FROM order_addons AS oa
+            JOIN order_items AS oi ON oi.shop_id = oa.shop_id AND oi.tab_id = oa.tab_id AND oi.bill_id = oa.bill_id AND oi.id = oa.order_item_id
+            WHERE oi.shop_id = r.shop_id AND oi.tab_id = r.tab_id AND oi.bill_id = r.bill_id AND oi.order_id = r.order_id) +
+          (SELECT COALESCE(SUM(os.unit_price * os.quantity), 0) FROM order_substitutions AS os
+            JOIN order_items AS oi ON oi.shop_id = os.shop_id AND oi.tab_id = os.tab_id AND oi.bill_id = os.bill_id AND oi.id = os.order_item_id
+            WHERE oi.shop_id = r.shop_id AND oi.tab_id = r.tab_id AND oi.bill_id = r.bill_id AND oi.order_id = r.order_id)
+        ), 0)
+        FROM voucher_redemptions AS r
+        WHERE r.shop_id = v.shop_id AND r.tab_id = v.tab_id AND r.voucher_id = v.id
+          AND NOT EXISTS(SELECT 1 FROM order_voids AS ov WHERE ov.shop_id = r.shop_id AND ov.tab_id = r.tab_id AND ov.bill_id = r.bill_id AND ov.order_id = r.order_id)
+      )::BIGINT AS redeemed
+    FROM tab_vouchers AS v
+    WHERE v.shop_id = @shopId AND v.tab_id = @tabId AND ((@codes::VARCHAR[] IS NULL) OR (v.code = ANY(@codes)))
+    ORDER BY v.created_at, v.id`,
+		pgx.NamedArgs{
+			"shopId": shopId,
+			"tabId":  tabId,
+			"codes":  codes,
+		})
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+
+	vouchers, err := pgx.CollectRows(rows, pgx.RowToStructByNameLax[models.Voucher])
+	if err != nil {
+		return nil, handlePgxError(err)
+	}
+	err = q.setShopCurrency(ctx, shopId, vouchers)
+	if err != nil {
+		return nil, err
+	}
+	return vouchers, nil
+}
+
+// Redeems the voucher against the order staged in the temporary order tables, which is recorded on the tab's bill.
+// The voucher row is locked so that concurrent orders cannot exceed its uses or value cap.
+func (q *PgxQueries) redeemVoucher(ctx context.Context, tab *models.Tab, billId int, orderId int, code string) error {
+	code = models.NormalizeVoucherCode(code)
+	invalidErr := services.NewValidationServiceError(errors.New("Voucher is not valid for tab"), services.ValidationErrors{
+		"voucher_code": services.ValidationError{Value: code, Error: "invalid"},
+	})
+	if tab.VerificationMethod != models.TAB_VERIFICATION_VOUCHER {
+		return invalidErr
+	}
+	shopId, tabId := tab.ShopId, tab.Id
+
+	var voucherId int
+	err := q.tx.QueryRow(ctx, `
+    SELECT id FROM tab_vouchers WHERE shop_id = @shopId AND tab_id = @tabId AND code = @code FOR UPDATE`,
+		pgx.NamedArgs{
+			"shopId": shopId,
+			"tabId":  tabId,
+			"code":   code,
+		}).Scan(&voucherId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return invalidErr
+	}
+	if err != nil {
+		return handlePgxError(err)
+	}
+
+	vouchers, err := q.getTabVouchers(ctx, shopId, tabId, []string{code})
+	if err != nil {
+		return err
+	}
+	if len(vouchers) != 1 {
+		return invalidErr
+	}
+
+	orderTotal, err := q.getPendingOrderTotal(ctx, shopId)
+	if err != nil {
+		return err
+	}
+	err = vouchers[0].ValidateRedemption(orderTotal, time.Now())
+	if err != nil {
+		return err
+	}
+
+	_, err = q.tx.Exec(ctx, `
+    INSERT INTO voucher_redemptions (shop_id, tab_id, bill_id, order_id, voucher_id)
+    VALUES (@shopId, @tabId, @billId, @orderId, @voucherId)`,
+		pgx.NamedArgs{
+			"shopId":    shopId,
+			"tabId":     tabId,
+			"billId":    billId,
+			"orderId":   orderId,
+			"voucherId": voucherId,
+		})
+	if err != nil {
+		return handlePgxError(err)
+	}
+	return nil
+}
@@ -31,6 +31,8 @@ type config struct {
 	EMAIL_CLIENT_PASSWORD       string
 	EMAIL_CLIENT_ENABLED        bool
 	SLACK_CLIENT_ENABLED        bool
+	PAYMENT_PROVIDER            string `env:"optional"` // Empty or unset value indicates online payments are disabled
+	PAYMENT_WEBHOOK_SECRET      string `env:"optional"`
 }
 
 var Envs = getConfig()
@@ -59,6 +61,10 @@ func getConfig() config {
 
 	for i := range configStruct.NumField() {
 		key := types.Field(i).Name
+		if types.Field(i).Tag.Get("env") == "optional" {
+			configStruct.Field(i).SetString(os.Getenv(key))
+			continue
+		}
 		switch configStruct.Field(i).Type().Kind() {
 		case reflect.String:
 			configStruct.Field(i).SetString(getEnvStringOrFail(key))
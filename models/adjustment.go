@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+type BillAdjustmentCreate struct {
+	Amount Money  `json:"amount" db:"amount" validate:"ne=0"` // Positive values are charged to the bill, negative values are credited
+	Reason string `json:"reason" db:"reason" validate:"required,min=3,max=255"`
+}
+
+// A manual charge or credit on a bill which is not tied to a menu item
+type BillAdjustment struct {
+	BillAdjustmentCreate
+	Id        int       `json:"id" db:"id"`
+	BillId    int       `json:"bill_id" db:"bill_id"`
+	StaffId   *string   `json:"staff_id" db:"staff_id"` // Nil value indicates the staff user was deleted
+	StaffName *string   `json:"staff_name" db:"staff_name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// The net amount of the bill's adjustments
+func (b *Bill) AdjustmentTotal() (Money, error) {
+	amounts := make([]Money, len(b.Adjustments))
+	for i, a := range b.Adjustments {
+		amounts[i] = a.Amount
+	}
+	return Sum(amounts...)
+}
@@ -0,0 +1,35 @@
+package models
+
+import "testing"
+
+func adjustment(amount int64, currency Currency) BillAdjustment {
+	return BillAdjustment{BillAdjustmentCreate: BillAdjustmentCreate{Amount: NewMoney(amount, currency), Reason: "Reason"}}
+}
+
+func TestAdjustmentTotal(t *testing.T) {
+	tests := []struct {
+		name        string
+		adjustments []BillAdjustment
+		want        int64
+		wantErr     bool
+	}{
+		{name: "none", want: 0},
+		{name: "charge", adjustments: []BillAdjustment{adjustment(500, "USD")}, want: 500},
+		{name: "charge and credit", adjustments: []BillAdjustment{adjustment(500, "USD"), adjustment(-200, "USD")}, want: 300},
+		{name: "net credit", adjustments: []BillAdjustment{adjustment(100, "USD"), adjustment(-400, "USD")}, want: -300},
+		{name: "mixed currencies", adjustments: []BillAdjustment{adjustment(500, "USD"), adjustment(100, "EUR")}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bill := &Bill{Adjustments: tt.adjustments}
+			got, err := bill.AdjustmentTotal()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AdjustmentTotal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.Amount != tt.want {
+				t.Errorf("AdjustmentTotal() = %v, want %v", got.Amount, tt.want)
+			}
+		})
+	}
+}
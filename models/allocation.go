@@ -0,0 +1,129 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/willtrojniak/TabAppBackend/services"
+)
+
+// Returned when a bill is broken down across fixed allocations totalling more than the amount being allocated
+var ErrAllocationsExceedTotal = services.NewDataConflictServiceError(errors.New("Fixed allocations exceed the bill total"))
+
+// A share of the tab's bills charged to a chartstring, either a percentage or a fixed amount
+type TabAllocationCreate struct {
+	Chartstring string `json:"chartstring" db:"chartstring" validate:"required,max=64"`
+	Percent     *int   `json:"percent" db:"percent" validate:"omitempty,gte=1,lte=100"` // Share of the bill remaining after fixed amounts
+	Amount      *Money `json:"amount" db:"amount" validate:"omitempty,gt=0"`            // Fixed amount charged on each bill
+}
+
+type TabAllocation struct {
+	TabAllocationCreate
+	Id int `json:"id" db:"id"`
+}
+
+type BillAllocation struct {
+	Chartstring string `json:"chartstring"`
+	Amount      Money  `json:"amount"`
+}
+
+func TabAllocationCreateStructLevelValidation(sl validator.StructLevel) {
+	data := sl.Current().Interface().(TabAllocationCreate)
+
+	if (data.Percent == nil) == (data.Amount == nil) {
+		field, _ := reflect.ValueOf(data).Type().FieldByName("Percent")
+		tag, ok := field.Tag.Lookup("json")
+		if !ok {
+			tag = field.Name
+		}
+		sl.ReportError(data.Percent, tag, field.Name, "excluded_with", "amount")
+	}
+}
+
+// Checks that any percentages of the allocations cover the whole of the bill remaining after fixed amounts.
+// Allocations of fixed amounts only are always valid.
+func isValidAllocationSplit(allocations []TabAllocationCreate) bool {
+	percent := 0
+	for _, a := range allocations {
+		if a.Percent != nil {
+			percent += *a.Percent
+		}
+	}
+	return percent == 0 || percent == 100
+}
+
+// Checks whether the requested allocations match the tab's current allocations
+func SameAllocations(current []TabAllocation, requested []TabAllocationCreate) bool {
+	if len(current) != len(requested) {
+		return false
+	}
+	for i := range current {
+		if !reflect.DeepEqual(current[i].TabAllocationCreate, requested[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Breaks the bill total down per allocation. Fixed amounts are charged first and the remainder is split by percentage,
+// with any rounding difference going to the last percentage. Without percentages the remainder is charged to the last allocation.
+// Returns nil if the tab has no allocations, and ErrAllocationsExceedTotal if the fixed amounts exceed the total.
+func (t *TabOverview) Allocate(total Money) ([]BillAllocation, error) {
+	if len(t.Allocations) == 0 {
+		return nil, nil
+	}
+
+	breakdown := make([]BillAllocation, len(t.Allocations))
+	remaining := total
+	last := -1
+	for i, a := range t.Allocations {
+		breakdown[i] = BillAllocation{Chartstring: a.Chartstring, Amount: NewMoney(0, total.currency())}
+		if a.Amount == nil {
+			last = i
+			continue
+		}
+		amount := a.Amount.WithCurrency(total.currency())
+		var err error
+		remaining, err = remaining.Sub(amount)
+		if err != nil {
+			return nil, err
+		}
+		if remaining.IsNegative() {
+			return nil, ErrAllocationsExceedTotal
+		}
+		breakdown[i].Amount = amount
+	}
+
+	if last == -1 {
+		end := len(breakdown) - 1
+		amount, err := breakdown[end].Amount.Add(remaining)
+		if err != nil {
+			return nil, err
+		}
+		breakdown[end].Amount = amount
+		return breakdown, nil
+	}
+
+	allocated := NewMoney(0, total.currency())
+	for i, a := range t.Allocations {
+		if a.Percent == nil {
+			continue
+		}
+		share := NewMoney(remaining.Amount*int64(*a.Percent)/100, total.currency())
+		var err error
+		if i == last {
+			share, err = remaining.Sub(allocated)
+			if err != nil {
+				return nil, err
+			}
+		}
+		breakdown[i].Amount = share
+		allocated, err = allocated.Add(share)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return breakdown, nil
+}
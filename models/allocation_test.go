@@ -0,0 +1,108 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func percentAllocation(chartstring string, percent int) TabAllocation {
+	return TabAllocation{TabAllocationCreate: TabAllocationCreate{Chartstring: chartstring, Percent: &percent}}
+}
+
+func fixedAllocation(chartstring string, amount int64) TabAllocation {
+	money := NewMoney(amount, "USD")
+	return TabAllocation{TabAllocationCreate: TabAllocationCreate{Chartstring: chartstring, Amount: &money}}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name        string
+		allocations []TabAllocation
+		total       Money
+		want        []BillAllocation
+		wantErr     error
+	}{
+		{name: "no allocations", total: NewMoney(1000, "USD")},
+		{
+			name:        "percentages",
+			allocations: []TabAllocation{percentAllocation("A", 50), percentAllocation("B", 50)},
+			total:       NewMoney(1000, "USD"),
+			want:        []BillAllocation{{Chartstring: "A", Amount: NewMoney(500, "USD")}, {Chartstring: "B", Amount: NewMoney(500, "USD")}},
+		},
+		{
+			name:        "rounding goes to last percentage",
+			allocations: []TabAllocation{percentAllocation("A", 33), percentAllocation("B", 33), percentAllocation("C", 34)},
+			total:       NewMoney(1001, "USD"),
+			want: []BillAllocation{
+				{Chartstring: "A", Amount: NewMoney(330, "USD")},
+				{Chartstring: "B", Amount: NewMoney(330, "USD")},
+				{Chartstring: "C", Amount: NewMoney(341, "USD")},
+			},
+		},
+		{
+			name:        "fixed with percentage remainder",
+			allocations: []TabAllocation{percentAllocation("A", 100), fixedAllocation("B", 300)},
+			total:       NewMoney(1000, "USD"),
+			want:        []BillAllocation{{Chartstring: "A", Amount: NewMoney(700, "USD")}, {Chartstring: "B", Amount: NewMoney(300, "USD")}},
+		},
+		{
+			name:        "fixed only remainder goes to last allocation",
+			allocations: []TabAllocation{fixedAllocation("A", 300), fixedAllocation("B", 200)},
+			total:       NewMoney(1000, "USD"),
+			want:        []BillAllocation{{Chartstring: "A", Amount: NewMoney(300, "USD")}, {Chartstring: "B", Amount: NewMoney(700, "USD")}},
+		},
+		{
+			name:        "fixed only covering total",
+			allocations: []TabAllocation{fixedAllocation("A", 600), fixedAllocation("B", 400)},
+			total:       NewMoney(1000, "USD"),
+			want:        []BillAllocation{{Chartstring: "A", Amount: NewMoney(600, "USD")}, {Chartstring: "B", Amount: NewMoney(400, "USD")}},
+		},
+		{
+			name:        "fixed exceeding total",
+			allocations: []TabAllocation{fixedAllocation("A", 600), percentAllocation("B", 100), fixedAllocation("C", 500)},
+			total:       NewMoney(1000, "USD"),
+			wantErr:     ErrAllocationsExceedTotal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tab := &TabOverview{Allocations: tt.allocations}
+			got, err := tab.Allocate(tt.total)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Allocate() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Allocate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsValidAllocationSplit(t *testing.T) {
+	tests := []struct {
+		name        string
+		allocations []TabAllocation
+		want        bool
+	}{
+		{name: "empty", want: true},
+		{name: "percentages sum to 100", allocations: []TabAllocation{percentAllocation("A", 40), percentAllocation("B", 60)}, want: true},
+		{name: "percentages short of 100", allocations: []TabAllocation{percentAllocation("A", 40), percentAllocation("B", 50)}, want: false},
+		{name: "fixed only", allocations: []TabAllocation{fixedAllocation("A", 300), fixedAllocation("B", 200)}, want: true},
+		{name: "fixed with percentage remainder", allocations: []TabAllocation{fixedAllocation("A", 300), percentAllocation("B", 100)}, want: true},
+		{name: "fixed with partial percentage", allocations: []TabAllocation{fixedAllocation("A", 300), percentAllocation("B", 50)}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allocations := make([]TabAllocationCreate, len(tt.allocations))
+			for i, a := range tt.allocations {
+				allocations[i] = a.TabAllocationCreate
+			}
+			if got := isValidAllocationSplit(allocations); got != tt.want {
+				t.Errorf("isValidAllocationSplit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
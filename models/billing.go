@@ -0,0 +1,129 @@
+package models
+
+import (
+	"slices"
+	"time"
+
+	"cloud.google.com/go/civil"
+)
+
+type BillingSchedule string
+
+const (
+	BILLING_SCHEDULE_INTERVAL BillingSchedule = "interval" // Periods of billing_interval_days, starting from the tab's start date
+	BILLING_SCHEDULE_WEEKLY   BillingSchedule = "weekly"   // Periods starting on the anchor day of the week, 0 being Sunday
+	BILLING_SCHEDULE_MONTHLY  BillingSchedule = "monthly"  // Periods starting on the anchor day of the month
+	BILLING_SCHEDULE_TERM     BillingSchedule = "term"     // Periods ending on each of the term end dates, the last ending with the tab
+)
+
+// A bill which has just been paid in full, identified within its shop
+type SettledBill struct {
+	TabId  int
+	BillId int
+}
+
+type BillCutoff struct {
+	EndDate *Date `json:"end_date" db:"end_date"` // Nil value indicates the bill ends today
+}
+
+// The tab's billing schedule, which defaults to interval periods
+func (t *TabBase) Schedule() BillingSchedule {
+	if t.BillingSchedule == "" {
+		return BILLING_SCHEDULE_INTERVAL
+	}
+	return t.BillingSchedule
+}
+
+// The term end dates in ascending order, never nil so that they can be stored as an empty array
+func (t *TabBase) TermEnds() []Date {
+	ends := make([]Date, len(t.BillingTermEnds))
+	copy(ends, t.BillingTermEnds)
+	slices.SortFunc(ends, func(a Date, b Date) int { return a.Compare(b.Date) })
+	return ends
+}
+
+// Term end dates must fall within the tab's dates
+func (t *TabBase) IsValidBillingTermEnds() bool {
+	for _, end := range t.BillingTermEnds {
+		if end.Before(t.StartDate.Date) || end.After(t.EndDate.Date) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *TabBase) IsValidBillingAnchor() bool {
+	switch t.BillingSchedule {
+	case BILLING_SCHEDULE_WEEKLY:
+		return t.BillingAnchorDay >= 0 && t.BillingAnchorDay <= 6
+	case BILLING_SCHEDULE_MONTHLY:
+		return t.BillingAnchorDay >= 1 && t.BillingAnchorDay <= 28
+	default:
+		return true
+	}
+}
+
+// Computes the last day of the billing period beginning on the given date.
+// Periods never extend past the tab's end date.
+func (t *TabBase) BillingPeriodEnd(start Date) Date {
+	var end civil.Date
+	switch t.Schedule() {
+	case BILLING_SCHEDULE_WEEKLY:
+		// The period runs up to the day before the next anchor day of the week
+		weekday := int(start.In(time.UTC).Weekday())
+		end = start.AddDays((t.BillingAnchorDay - weekday + 6) % 7)
+	case BILLING_SCHEDULE_MONTHLY:
+		next := time.Date(start.Year, start.Month, t.BillingAnchorDay, 0, 0, 0, 0, time.UTC)
+		if start.Day >= t.BillingAnchorDay {
+			next = next.AddDate(0, 1, 0)
+		}
+		end = civil.DateOf(next).AddDays(-1)
+	case BILLING_SCHEDULE_TERM:
+		end = t.EndDate.Date
+		for _, termEnd := range t.TermEnds() {
+			if !termEnd.Before(start.Date) {
+				end = termEnd.Date
+				break
+			}
+		}
+	default:
+		end = start.AddDays(max(t.BillingIntervalDays, 1) - 1)
+	}
+
+	if end.After(t.EndDate.Date) {
+		end = t.EndDate.Date
+	}
+	return Date{Date: end}
+}
+
+// Computes the billing period of the tab's schedule containing the given date.
+// Dates outside of the tab's dates are billed in a period of their own.
+func (t *TabBase) BillingPeriodContaining(day Date) (Date, Date) {
+	if day.Before(t.StartDate.Date) || day.After(t.EndDate.Date) {
+		return day, day
+	}
+
+	start := t.StartDate
+	for {
+		end := t.BillingPeriodEnd(start)
+		if !end.Before(day.Date) {
+			return start, end
+		}
+		start = Date{Date: end.AddDays(1)}
+	}
+}
+
+// Finds the bill which orders placed on the given date are recorded against,
+// which is the earliest open bill that has not yet ended
+func (t *Tab) CurrentBill(today Date) *Bill {
+	var current *Bill
+	for i, b := range t.Bills {
+		if b.IsPaid || b.IsClosed || b.EndDate.Before(today.Date) {
+			continue
+		}
+		if current == nil || b.StartDate.Before(current.StartDate.Date) {
+			current = &t.Bills[i]
+		}
+	}
+	return current
+}
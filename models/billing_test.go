@@ -0,0 +1,80 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+)
+
+func date(month time.Month, day int) Date {
+	return Date{Date: civil.Date{Year: 2026, Month: month, Day: day}}
+}
+
+// A tab running from September through December 2026 with the given schedule
+func billingTab(schedule BillingSchedule, anchorDay int, intervalDays int, termEnds ...Date) *TabBase {
+	return &TabBase{
+		StartDate:           date(time.September, 1),
+		EndDate:             date(time.December, 18),
+		BillingSchedule:     schedule,
+		BillingAnchorDay:    anchorDay,
+		BillingIntervalDays: intervalDays,
+		BillingTermEnds:     termEnds,
+	}
+}
+
+func TestBillingPeriodEnd(t *testing.T) {
+	tests := []struct {
+		name  string
+		tab   *TabBase
+		start Date
+		want  Date
+	}{
+		{name: "interval", tab: billingTab(BILLING_SCHEDULE_INTERVAL, 0, 14), start: date(time.September, 1), want: date(time.September, 14)},
+		{name: "default schedule is interval", tab: billingTab("", 0, 7), start: date(time.September, 1), want: date(time.September, 7)},
+		{name: "interval clamped to tab end", tab: billingTab(BILLING_SCHEDULE_INTERVAL, 0, 30), start: date(time.December, 1), want: date(time.December, 18)},
+		{name: "weekly from anchor day", tab: billingTab(BILLING_SCHEDULE_WEEKLY, 1, 1), start: date(time.September, 7), want: date(time.September, 13)},
+		{name: "weekly from mid week", tab: billingTab(BILLING_SCHEDULE_WEEKLY, 1, 1), start: date(time.September, 1), want: date(time.September, 6)},
+		{name: "monthly from anchor day", tab: billingTab(BILLING_SCHEDULE_MONTHLY, 1, 1), start: date(time.September, 1), want: date(time.September, 30)},
+		{name: "monthly before anchor day", tab: billingTab(BILLING_SCHEDULE_MONTHLY, 15, 1), start: date(time.September, 1), want: date(time.September, 14)},
+		{name: "monthly after anchor day", tab: billingTab(BILLING_SCHEDULE_MONTHLY, 15, 1), start: date(time.September, 20), want: date(time.October, 14)},
+		{name: "term without term ends", tab: billingTab(BILLING_SCHEDULE_TERM, 0, 1), start: date(time.September, 1), want: date(time.December, 18)},
+		{name: "first term", tab: billingTab(BILLING_SCHEDULE_TERM, 0, 1, date(time.November, 20), date(time.October, 16)), start: date(time.September, 1), want: date(time.October, 16)},
+		{name: "second term", tab: billingTab(BILLING_SCHEDULE_TERM, 0, 1, date(time.November, 20), date(time.October, 16)), start: date(time.October, 17), want: date(time.November, 20)},
+		{name: "final term ends with tab", tab: billingTab(BILLING_SCHEDULE_TERM, 0, 1, date(time.October, 16)), start: date(time.October, 17), want: date(time.December, 18)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.tab.BillingPeriodEnd(tt.start); got != tt.want {
+				t.Errorf("BillingPeriodEnd() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBillingPeriodContaining(t *testing.T) {
+	weekly := billingTab(BILLING_SCHEDULE_WEEKLY, 1, 1)
+
+	tests := []struct {
+		name      string
+		tab       *TabBase
+		day       Date
+		wantStart Date
+		wantEnd   Date
+	}{
+		{name: "first period", tab: weekly, day: date(time.September, 3), wantStart: date(time.September, 1), wantEnd: date(time.September, 6)},
+		{name: "later period", tab: weekly, day: date(time.October, 14), wantStart: date(time.October, 12), wantEnd: date(time.October, 18)},
+		{name: "last period", tab: weekly, day: date(time.December, 18), wantStart: date(time.December, 14), wantEnd: date(time.December, 18)},
+		{name: "after tab end", tab: weekly, day: date(time.December, 20), wantStart: date(time.December, 20), wantEnd: date(time.December, 20)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := tt.tab.BillingPeriodContaining(tt.day)
+			if start != tt.wantStart || end != tt.wantEnd {
+				t.Errorf("BillingPeriodContaining() = %v - %v, want %v - %v", start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
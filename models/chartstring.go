@@ -0,0 +1,221 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type ChartstringCharset string
+
+const (
+	CHARTSTRING_CHARSET_ALPHANUMERIC ChartstringCharset = "alphanumeric"
+	CHARTSTRING_CHARSET_NUMERIC      ChartstringCharset = "numeric"
+	CHARTSTRING_CHARSET_ALPHA        ChartstringCharset = "alpha"
+)
+
+type ChartstringChecksum string
+
+const (
+	CHARTSTRING_CHECKSUM_NONE ChartstringChecksum = "none"
+	CHARTSTRING_CHECKSUM_LUHN ChartstringChecksum = "luhn" // Computed over the digits of all segments
+)
+
+// Maximum length of a chartstring, including separators
+const chartstringMaxLength = 64
+
+// Describes an account string as fixed length segments, e.g. "12345-ABCDE-00001"
+type ChartstringFormatCreate struct {
+	Name              string              `json:"name" db:"name" validate:"required,min=1,max=64"`
+	Segments          []int               `json:"segments" db:"segments" validate:"required,min=1,max=8,dive,gte=1,lte=32"` // Length of each segment
+	RequiredSegments  int                 `json:"required_segments" db:"required_segments" validate:"gte=1"`                // Trailing segments beyond this count may be omitted
+	Separators        string              `json:"separators" db:"separators" validate:"max=8,printascii"`                   // Characters accepted between segments, the first is used when normalizing
+	SeparatorOptional bool                `json:"separator_optional" db:"separator_optional"`
+	Charset           ChartstringCharset  `json:"charset" db:"charset" validate:"required,oneof=alphanumeric numeric alpha"`
+	Checksum          ChartstringChecksum `json:"checksum" db:"checksum" validate:"required,oneof=none luhn"`
+}
+
+type ChartstringFormatsUpdate struct {
+	Formats []ChartstringFormatCreate `json:"formats" validate:"max=10,unique=Name,dive"`
+}
+
+type ChartstringFormat struct {
+	ChartstringFormatCreate
+	Id int `json:"id" db:"id"`
+}
+
+type ChartstringValidate struct {
+	Chartstring string `json:"chartstring" validate:"max=64"`
+}
+
+type ChartstringValidation struct {
+	Valid      bool    `json:"valid"`
+	Format     *string `json:"format"`     // Name of the matching format. Nil value indicates no format matched
+	Normalized string  `json:"normalized"` // Empty value indicates no format matched
+}
+
+// The format accepted by shops which have not configured any formats
+var DefaultChartstringFormat = ChartstringFormat{
+	ChartstringFormatCreate: ChartstringFormatCreate{
+		Name:              "Default",
+		Segments:          []int{5, 5, 5},
+		RequiredSegments:  2,
+		Separators:        "-| ",
+		SeparatorOptional: true,
+		Charset:           CHARTSTRING_CHARSET_ALPHANUMERIC,
+		Checksum:          CHARTSTRING_CHECKSUM_NONE,
+	},
+}
+
+func ChartstringFormatCreateStructLevelValidation(sl validator.StructLevel) {
+	data := sl.Current().Interface().(ChartstringFormatCreate)
+
+	if data.RequiredSegments > len(data.Segments) {
+		field, _ := reflect.ValueOf(data).Type().FieldByName("RequiredSegments")
+		tag, ok := field.Tag.Lookup("json")
+		if !ok {
+			tag = field.Name
+		}
+		sl.ReportError(data.RequiredSegments, tag, field.Name, "lte", "segments")
+	}
+
+	if data.maxLength() > chartstringMaxLength {
+		field, _ := reflect.ValueOf(data).Type().FieldByName("Segments")
+		tag, ok := field.Tag.Lookup("json")
+		if !ok {
+			tag = field.Name
+		}
+		sl.ReportError(data.Segments, tag, field.Name, "max", fmt.Sprint(chartstringMaxLength))
+	}
+
+	if strings.ContainsFunc(data.Separators, isChartstringAlphanumeric) {
+		field, _ := reflect.ValueOf(data).Type().FieldByName("Separators")
+		tag, ok := field.Tag.Lookup("json")
+		if !ok {
+			tag = field.Name
+		}
+		sl.ReportError(data.Separators, tag, field.Name, "excludesall", "alphanumeric")
+	}
+
+	if data.Checksum == CHARTSTRING_CHECKSUM_LUHN && data.Charset != CHARTSTRING_CHARSET_NUMERIC {
+		field, _ := reflect.ValueOf(data).Type().FieldByName("Checksum")
+		tag, ok := field.Tag.Lookup("json")
+		if !ok {
+			tag = field.Name
+		}
+		sl.ReportError(data.Checksum, tag, field.Name, "required_if", "charset numeric")
+	}
+}
+
+// The length of a chartstring with every segment and separator present
+func (f *ChartstringFormatCreate) maxLength() int {
+	length := 0
+	for _, segment := range f.Segments {
+		length += segment
+	}
+	if f.Separators != "" && len(f.Segments) > 1 {
+		length += len(f.Segments) - 1
+	}
+	return length
+}
+
+func (f *ChartstringFormatCreate) allows(r rune) bool {
+	switch f.Charset {
+	case CHARTSTRING_CHARSET_NUMERIC:
+		return r >= '0' && r <= '9'
+	case CHARTSTRING_CHARSET_ALPHA:
+		return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+	default:
+		return isChartstringAlphanumeric(r)
+	}
+}
+
+// Checks the chartstring against the format, returning the chartstring with its letters
+// upper cased and its segments joined by the format's first separator
+func (f *ChartstringFormatCreate) Match(s string) (string, bool) {
+	rest := strings.TrimSpace(s)
+	segments := make([]string, 0, len(f.Segments))
+	for i, length := range f.Segments {
+		if i > 0 {
+			if rest == "" && i >= f.RequiredSegments {
+				break
+			}
+			if r, size := utf8.DecodeRuneInString(rest); size > 0 && strings.ContainsRune(f.Separators, r) {
+				rest = rest[size:]
+			} else if !f.SeparatorOptional && f.Separators != "" {
+				return "", false
+			}
+		}
+
+		if len(rest) < length {
+			return "", false
+		}
+		segment := rest[:length]
+		for _, r := range segment {
+			if !f.allows(r) {
+				return "", false
+			}
+		}
+		segments = append(segments, strings.ToUpper(segment))
+		rest = rest[length:]
+	}
+
+	if rest != "" {
+		return "", false
+	}
+	if f.Checksum == CHARTSTRING_CHECKSUM_LUHN && !isValidLuhn(strings.Join(segments, "")) {
+		return "", false
+	}
+
+	separator := ""
+	if r, size := utf8.DecodeRuneInString(f.Separators); size > 0 {
+		separator = string(r)
+	}
+	return strings.Join(segments, separator), true
+}
+
+// Finds the first of the shop's formats the chartstring matches.
+// Shops without any formats accept chartstrings matching the default format.
+func MatchChartstring(formats []ChartstringFormat, s string) (*ChartstringFormat, string, bool) {
+	if len(formats) == 0 {
+		formats = []ChartstringFormat{DefaultChartstringFormat}
+	}
+	for i := range formats {
+		if normalized, ok := formats[i].Match(s); ok {
+			return &formats[i], normalized, true
+		}
+	}
+	return nil, "", false
+}
+
+func ValidateChartstring(formats []ChartstringFormat, s string) ChartstringValidation {
+	format, normalized, ok := MatchChartstring(formats, s)
+	if !ok {
+		return ChartstringValidation{}
+	}
+	return ChartstringValidation{Valid: true, Format: &format.Name, Normalized: normalized}
+}
+
+func isChartstringAlphanumeric(r rune) bool {
+	return (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func isValidLuhn(digits string) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,107 @@
+package models
+
+import "testing"
+
+func TestChartstringFormatMatch(t *testing.T) {
+	luhn := ChartstringFormatCreate{
+		Name:             "Luhn",
+		Segments:         []int{4, 7},
+		RequiredSegments: 2,
+		Separators:       "-",
+		Charset:          CHARTSTRING_CHARSET_NUMERIC,
+		Checksum:         CHARTSTRING_CHECKSUM_LUHN,
+	}
+	strict := ChartstringFormatCreate{
+		Name:             "Strict",
+		Segments:         []int{3, 3},
+		RequiredSegments: 2,
+		Separators:       ".",
+		Charset:          CHARTSTRING_CHARSET_ALPHA,
+		Checksum:         CHARTSTRING_CHECKSUM_NONE,
+	}
+
+	tests := []struct {
+		name           string
+		format         ChartstringFormatCreate
+		chartstring    string
+		wantNormalized string
+		wantOk         bool
+	}{
+		{name: "default with separators", format: DefaultChartstringFormat.ChartstringFormatCreate, chartstring: "12345-abcde-00001", wantNormalized: "12345-ABCDE-00001", wantOk: true},
+		{name: "default normalizes separators", format: DefaultChartstringFormat.ChartstringFormatCreate, chartstring: " 12345|ABCDE 00001 ", wantNormalized: "12345-ABCDE-00001", wantOk: true},
+		{name: "default without separators", format: DefaultChartstringFormat.ChartstringFormatCreate, chartstring: "12345ABCDE00001", wantNormalized: "12345-ABCDE-00001", wantOk: true},
+		{name: "default omits optional segment", format: DefaultChartstringFormat.ChartstringFormatCreate, chartstring: "12345-ABCDE", wantNormalized: "12345-ABCDE", wantOk: true},
+		{name: "default missing required segment", format: DefaultChartstringFormat.ChartstringFormatCreate, chartstring: "12345"},
+		{name: "default short segment", format: DefaultChartstringFormat.ChartstringFormatCreate, chartstring: "1234-ABCDE"},
+		{name: "default trailing characters", format: DefaultChartstringFormat.ChartstringFormatCreate, chartstring: "12345-ABCDE-000011"},
+		{name: "default invalid character", format: DefaultChartstringFormat.ChartstringFormatCreate, chartstring: "12345-ABC_E"},
+		{name: "separator required", format: strict, chartstring: "abcdef"},
+		{name: "separator present", format: strict, chartstring: "abc.def", wantNormalized: "ABC.DEF", wantOk: true},
+		{name: "charset rejects digits", format: strict, chartstring: "abc.de1"},
+		{name: "valid checksum", format: luhn, chartstring: "7992-7398713", wantNormalized: "7992-7398713", wantOk: true},
+		{name: "invalid checksum", format: luhn, chartstring: "7992-7398710"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normalized, ok := tt.format.Match(tt.chartstring)
+			if ok != tt.wantOk || normalized != tt.wantNormalized {
+				t.Errorf("Match() = %q, %v, want %q, %v", normalized, ok, tt.wantNormalized, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestIsValidLuhn(t *testing.T) {
+	tests := []struct {
+		digits string
+		want   bool
+	}{
+		{digits: "79927398713", want: true},
+		{digits: "79927398710", want: false},
+		{digits: "0", want: true},
+		{digits: "18", want: true},
+		{digits: "4111111111111111", want: true},
+		{digits: "4111111111111112", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.digits, func(t *testing.T) {
+			if got := isValidLuhn(tt.digits); got != tt.want {
+				t.Errorf("isValidLuhn(%q) = %v, want %v", tt.digits, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchChartstring(t *testing.T) {
+	formats := []ChartstringFormat{
+		{Id: 1, ChartstringFormatCreate: ChartstringFormatCreate{Name: "Short", Segments: []int{2}, RequiredSegments: 1, Charset: CHARTSTRING_CHARSET_NUMERIC, Checksum: CHARTSTRING_CHECKSUM_NONE}},
+		{Id: 2, ChartstringFormatCreate: ChartstringFormatCreate{Name: "Long", Segments: []int{2, 2}, RequiredSegments: 2, Separators: "-", SeparatorOptional: true, Charset: CHARTSTRING_CHARSET_NUMERIC, Checksum: CHARTSTRING_CHECKSUM_NONE}},
+	}
+
+	tests := []struct {
+		name        string
+		formats     []ChartstringFormat
+		chartstring string
+		wantFormat  string
+		wantOk      bool
+	}{
+		{name: "first matching format", formats: formats, chartstring: "12", wantFormat: "Short", wantOk: true},
+		{name: "later format", formats: formats, chartstring: "1234", wantFormat: "Long", wantOk: true},
+		{name: "no matching format", formats: formats, chartstring: "123"},
+		{name: "default format without formats", chartstring: "12345-ABCDE", wantFormat: "Default", wantOk: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, _, ok := MatchChartstring(tt.formats, tt.chartstring)
+			if ok != tt.wantOk {
+				t.Fatalf("MatchChartstring() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if ok && format.Name != tt.wantFormat {
+				t.Errorf("MatchChartstring() format = %q, want %q", format.Name, tt.wantFormat)
+			}
+		})
+	}
+}
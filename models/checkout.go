@@ -0,0 +1,49 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type BillCheckoutCreate struct {
+	Provider    string    `db:"provider"`
+	SessionId   string    `db:"session_id"`
+	CheckoutURL string    `db:"checkout_url"`
+	Amount      Money     `db:"amount"`
+	ExpiresAt   time.Time `db:"expires_at"`
+}
+
+// An online payment of a bill through a payment provider
+type BillCheckout struct {
+	Id                 int        `json:"id" db:"id"`
+	ShopId             int        `json:"shop_id" db:"shop_id"`
+	TabId              int        `json:"tab_id" db:"tab_id"`
+	BillId             int        `json:"bill_id" db:"bill_id"`
+	Provider           string     `json:"provider" db:"provider"`
+	SessionId          string     `json:"-" db:"session_id"`
+	CheckoutURL        string     `json:"checkout_url" db:"checkout_url"` // Where the customer is sent to pay
+	Amount             Money      `json:"amount" db:"amount"`
+	PaymentId          *int       `json:"payment_id" db:"payment_id"`                   // Nil value indicates the provider has not yet confirmed the payment, or that it was not applied to the bill
+	UnappliedAmount    *Money     `json:"unapplied_amount" db:"unapplied_amount"`       // Set when the payment was captured after the bill was posted to the journal or in another currency, and must be refunded
+	UnappliedReference *string    `json:"unapplied_reference" db:"unapplied_reference"` // The provider's reference for the unapplied payment
+	UnappliedCurrency  *Currency  `json:"-" db:"unapplied_currency"`
+	CreatedAt          time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt          time.Time  `json:"expires_at" db:"expires_at"`
+	CompletedAt        *time.Time `json:"completed_at" db:"completed_at"`
+}
+
+var ErrInvalidCapturedAmount = errors.New("Captured amount must be positive")
+
+// Checks the amount the provider reports capturing for a checkout created in the given currency.
+// Amounts reported without a currency are taken to be in the default currency.
+func CapturedAmount(reported Money, currency Currency) (Money, error) {
+	if reported.IsNegative() || reported.IsZero() {
+		return Money{}, ErrInvalidCapturedAmount
+	}
+	expected := NewMoney(0, currency).currency()
+	if reported.currency() != expected {
+		return Money{}, fmt.Errorf("%w (%v, %v)", ErrCurrencyMismatch, reported.currency(), expected)
+	}
+	return reported.WithCurrency(expected), nil
+}
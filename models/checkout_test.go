@@ -0,0 +1,36 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCapturedAmount(t *testing.T) {
+	tests := []struct {
+		name     string
+		reported Money
+		currency Currency
+		want     Money
+		wantErr  error
+	}{
+		{name: "positive", reported: NewMoney(450, "USD"), currency: "USD", want: NewMoney(450, "USD")},
+		{name: "default currency", reported: Money{Amount: 450}, currency: "", want: NewMoney(450, "USD")},
+		{name: "zero", reported: NewMoney(0, "USD"), currency: "USD", wantErr: ErrInvalidCapturedAmount},
+		{name: "negative", reported: NewMoney(-450, "USD"), currency: "USD", wantErr: ErrInvalidCapturedAmount},
+		{name: "other currency", reported: NewMoney(450, "EUR"), currency: "USD", wantErr: ErrCurrencyMismatch},
+		{name: "missing currency", reported: Money{Amount: 450}, currency: "EUR", wantErr: ErrCurrencyMismatch},
+		{name: "zero in other currency", reported: NewMoney(0, "EUR"), currency: "USD", wantErr: ErrInvalidCapturedAmount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CapturedAmount(tt.reported, tt.currency)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CapturedAmount() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("CapturedAmount() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
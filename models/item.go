@@ -1,8 +1,8 @@
 package models
 
 type itemBase struct {
-	Name      string   `json:"name" db:"name" validate:"required,min=1,max=64"`
-	BasePrice *float32 `json:"base_price" db:"base_price" validate:"required,gte=0"`
+	Name      string `json:"name" db:"name" validate:"required,min=1,max=64"`
+	BasePrice *Money `json:"base_price" db:"base_price" validate:"required,gte=0"`
 }
 
 type ItemUpdate struct {
@@ -24,8 +24,37 @@ type ItemOverview struct {
 
 type ItemOrder struct {
 	ItemOverview
-	Quantity int                `json:"quantity" db:"quantity" validate:"required,gte=0"`
-	Variants []ItemVariantOrder `json:"variants" db:"variants" validate:"required,dive"`
+	Quantity         int                     `json:"quantity" db:"quantity" validate:"required,gte=0"`
+	Variants         []ItemVariantOrder      `json:"variants" db:"variants" validate:"required,dive"`
+	Addons           []ItemAddonOrder        `json:"addons" db:"addons"`
+	Substitutions    []ItemSubstitutionOrder `json:"substitutions" db:"substitutions"`
+	ScheduleOverride bool                    `json:"schedule_override" db:"schedule_override"` // Whether any addition to the line was placed outside of the tab's schedule
+}
+
+type ItemAddonOrder struct {
+	ItemOverview
+	Quantity int `json:"quantity" db:"quantity"`
+}
+
+// A substitution ordered with an item, whose base price is the amount charged over the group's first option
+type ItemSubstitutionOrder struct {
+	ItemOverview
+	SubstitutionGroupId int `json:"substitution_group_id" db:"substitution_group_id"`
+	Quantity            int `json:"quantity" db:"quantity"`
+}
+
+func (item *ItemOrder) Total() (Money, error) {
+	parts := []Money{item.BasePrice.Mul(item.Quantity)}
+	for _, variant := range item.Variants {
+		parts = append(parts, variant.Price.Mul(variant.Quantity))
+	}
+	for _, addon := range item.Addons {
+		parts = append(parts, addon.BasePrice.Mul(addon.Quantity))
+	}
+	for _, substitution := range item.Substitutions {
+		parts = append(parts, substitution.BasePrice.Mul(substitution.Quantity))
+	}
+	return Sum(parts...)
 }
 
 type Item struct {
@@ -47,8 +76,8 @@ func (item *Item) GetOverview() ItemOverview {
 }
 
 type itemVariantBase struct {
-	Name  string   `json:"name" db:"name" validate:"required,min=1,max=64"`
-	Price *float32 `json:"price" db:"price" validate:"required,gte=0"`
+	Name  string `json:"name" db:"name" validate:"required,min=1,max=64"`
+	Price *Money `json:"price" db:"price" validate:"required,gte=0"`
 }
 
 type ItemVariantUpdate struct {
@@ -0,0 +1,204 @@
+package models
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/civil"
+)
+
+type JournalField string
+
+const (
+	JOURNAL_FIELD_ACCOUNT     JournalField = "account" // Chartstring of debit lines, revenue account of the credit line
+	JOURNAL_FIELD_DEBIT       JournalField = "debit"   // Empty on the credit line
+	JOURNAL_FIELD_CREDIT      JournalField = "credit"  // Empty on debit lines
+	JOURNAL_FIELD_AMOUNT      JournalField = "amount"  // Positive for debits and negative for the credit
+	JOURNAL_FIELD_DESCRIPTION JournalField = "description"
+	JOURNAL_FIELD_REFERENCE   JournalField = "reference" // Invoice number of debit lines
+	JOURNAL_FIELD_DATE        JournalField = "date"      // Last day of the export period
+	JOURNAL_FIELD_TAB         JournalField = "tab"
+	JOURNAL_FIELD_BILL        JournalField = "bill"
+	JOURNAL_FIELD_CONSTANT    JournalField = "constant" // The column's value on every line
+)
+
+// A column of the journal file
+type JournalColumn struct {
+	Header string       `json:"header" db:"header" validate:"required,max=64"`
+	Field  JournalField `json:"field" db:"field" validate:"required,oneof=account debit credit amount description reference date tab bill constant"`
+	Value  string       `json:"value" db:"value" validate:"required_if=Field constant,max=64"`
+}
+
+type JournalSettingsUpdate struct {
+	RevenueAccount string          `json:"revenue_account" db:"revenue_account" validate:"required,max=64"` // Credited with the total of each export
+	ExportDay      *int            `json:"export_day" db:"export_day" validate:"omitempty,gte=1,lte=28"`    // Nil value indicates exports are not scheduled
+	Columns        []JournalColumn `json:"columns" db:"columns" validate:"max=32,dive"`                     // Empty value indicates the default columns are used
+}
+
+type JournalSettings struct {
+	JournalSettingsUpdate
+}
+
+// Columns of the journal file for shops which have not configured any columns
+var DefaultJournalColumns = []JournalColumn{
+	{Header: "Account", Field: JOURNAL_FIELD_ACCOUNT},
+	{Header: "Debit", Field: JOURNAL_FIELD_DEBIT},
+	{Header: "Credit", Field: JOURNAL_FIELD_CREDIT},
+	{Header: "Description", Field: JOURNAL_FIELD_DESCRIPTION},
+	{Header: "Reference", Field: JOURNAL_FIELD_REFERENCE},
+	{Header: "Date", Field: JOURNAL_FIELD_DATE},
+}
+
+// Exports the unexported bills which ended by the end date. The export starts on the earliest start date of its bills.
+type JournalExportCreate struct {
+	EndDate Date `json:"end_date" db:"end_date" validate:"required"`
+}
+
+// A debit of a bill's balance to one of its chartstrings
+type JournalExportLine struct {
+	Id            int    `json:"id" db:"id"`
+	TabId         int    `json:"tab_id" db:"tab_id"`
+	TabName       string `json:"tab_name" db:"tab_name"`
+	BillId        int    `json:"bill_id" db:"bill_id"`
+	BillStartDate Date   `json:"bill_start_date" db:"bill_start_date"`
+	BillEndDate   Date   `json:"bill_end_date" db:"bill_end_date"`
+	Chartstring   string `json:"chartstring" db:"chartstring"`
+	Amount        Money  `json:"amount" db:"amount"`
+}
+
+type JournalExportOverview struct {
+	Id             int       `json:"id" db:"id"`
+	StartDate      Date      `json:"start_date" db:"start_date"`
+	EndDate        Date      `json:"end_date" db:"end_date"`
+	RevenueAccount string    `json:"revenue_account" db:"revenue_account"`
+	UserId         *string   `json:"user_id" db:"user_id"` // Nil value indicates the export was scheduled
+	Total          Money     `json:"total" db:"total"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+type JournalExport struct {
+	JournalExportOverview
+	Lines []JournalExportLine `json:"lines" db:"lines"`
+}
+
+// Payment methods whose tabs are paid by journal, which are those with chartstring payment details
+func JournalPaymentMethods() []string {
+	methods := make([]string, 0)
+	for _, t := range PaymentMethodTypes() {
+		if t.Details.Format == PAYMENT_DETAILS_FORMAT_CHARTSTRING {
+			methods = append(methods, string(t.Method))
+		}
+	}
+	return methods
+}
+
+// The last day of the month before today if today is the shop's export day
+func (s *JournalSettings) ScheduledEndDate(today Date) (end Date, ok bool) {
+	if s.ExportDay == nil || today.Day != *s.ExportDay {
+		return end, false
+	}
+
+	first := civil.Date{Year: today.Year, Month: today.Month, Day: 1}
+	return Date{Date: first.AddDays(-1)}, true
+}
+
+// Breaks the outstanding balance of the bill down into journal lines, one per chartstring.
+// Chartstrings are normalized when they match one of the shop's formats. The whole balance is charged to the tab's
+// chartstring when the tab has no allocations, or when its fixed allocations exceed the balance.
+func JournalLinesOf(tab *Tab, bill *Bill, formats []ChartstringFormat) ([]JournalExportLine, error) {
+	balance, err := bill.Balance()
+	if err != nil {
+		return nil, err
+	}
+	if balance.IsNegative() || balance.IsZero() {
+		return nil, nil
+	}
+
+	breakdown, err := tab.Allocate(balance)
+	if err != nil && !errors.Is(err, ErrAllocationsExceedTotal) {
+		return nil, err
+	}
+	if breakdown == nil {
+		breakdown = []BillAllocation{{Chartstring: tab.PaymentDetails, Amount: balance}}
+	}
+
+	lines := make([]JournalExportLine, 0, len(breakdown))
+	for _, a := range breakdown {
+		if a.Amount.IsZero() {
+			continue
+		}
+		chartstring := a.Chartstring
+		if _, normalized, ok := MatchChartstring(formats, chartstring); ok {
+			chartstring = normalized
+		}
+		lines = append(lines, JournalExportLine{
+			TabId:         tab.Id,
+			TabName:       tab.DisplayName,
+			BillId:        bill.Id,
+			BillStartDate: bill.StartDate,
+			BillEndDate:   bill.EndDate,
+			Chartstring:   chartstring,
+			Amount:        a.Amount,
+		})
+	}
+	return lines, nil
+}
+
+// Renders the export as a CSV file with the given columns, a debit line for each of the export's lines
+// followed by a single credit of the total to the revenue account
+func (e *JournalExport) CSV(shop *Shop, columns []JournalColumn) []byte {
+	if len(columns) == 0 {
+		columns = DefaultJournalColumns
+	}
+
+	var b bytes.Buffer
+	writer := csv.NewWriter(&b)
+
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = c.Header
+	}
+	writer.Write(header)
+
+	for _, line := range e.Lines {
+		amount := line.Amount
+		writer.Write(e.record(columns, map[JournalField]string{
+			JOURNAL_FIELD_ACCOUNT:     line.Chartstring,
+			JOURNAL_FIELD_DEBIT:       amount.Decimal(),
+			JOURNAL_FIELD_AMOUNT:      amount.Decimal(),
+			JOURNAL_FIELD_DESCRIPTION: fmt.Sprintf("%s %s - %s", line.TabName, line.BillStartDate, line.BillEndDate),
+			JOURNAL_FIELD_REFERENCE:   fmt.Sprintf("%v-%v-%v", shop.Id, line.TabId, line.BillId),
+			JOURNAL_FIELD_TAB:         fmt.Sprint(line.TabId),
+			JOURNAL_FIELD_BILL:        fmt.Sprint(line.BillId),
+		}))
+	}
+
+	total := e.Total
+	writer.Write(e.record(columns, map[JournalField]string{
+		JOURNAL_FIELD_ACCOUNT:     e.RevenueAccount,
+		JOURNAL_FIELD_CREDIT:      total.Decimal(),
+		JOURNAL_FIELD_AMOUNT:      Money{Amount: -total.Amount, Currency: total.Currency}.Decimal(),
+		JOURNAL_FIELD_DESCRIPTION: fmt.Sprintf("%s revenue %s - %s", shop.Name, e.StartDate, e.EndDate),
+	}))
+
+	writer.Flush()
+	return b.Bytes()
+}
+
+func (e *JournalExport) record(columns []JournalColumn, values map[JournalField]string) []string {
+	record := make([]string, len(columns))
+	for i, c := range columns {
+		switch c.Field {
+		case JOURNAL_FIELD_CONSTANT:
+			record[i] = c.Value
+		case JOURNAL_FIELD_DATE:
+			record[i] = e.EndDate.String()
+		default:
+			record[i] = values[c.Field]
+		}
+	}
+	return record
+}
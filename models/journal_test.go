@@ -0,0 +1,63 @@
+package models
+
+import "testing"
+
+func adjustedBill(charged int64, paid int64) *Bill {
+	return &Bill{
+		BillOverview: BillOverview{Id: 1},
+		Adjustments:  []BillAdjustment{{BillAdjustmentCreate: BillAdjustmentCreate{Amount: NewMoney(charged, "USD"), Reason: "Catering"}}},
+		AmountPaid:   NewMoney(paid, "USD"),
+	}
+}
+
+func TestJournalLinesOf(t *testing.T) {
+	tests := []struct {
+		name        string
+		allocations []TabAllocation
+		bill        *Bill
+		want        map[string]int64
+	}{
+		{name: "outstanding balance", bill: adjustedBill(1000, 300), want: map[string]int64{"PAYMENT": 700}},
+		{name: "paid in full", bill: adjustedBill(1000, 1000), want: map[string]int64{}},
+		{name: "overpaid", bill: adjustedBill(1000, 1500), want: map[string]int64{}},
+		{name: "credited", bill: adjustedBill(-200, 0), want: map[string]int64{}},
+		{
+			name:        "allocated",
+			allocations: []TabAllocation{percentAllocation("A", 50), percentAllocation("B", 50)},
+			bill:        adjustedBill(1000, 0),
+			want:        map[string]int64{"A": 500, "B": 500},
+		},
+		{
+			name:        "fixed allocations exceed balance",
+			allocations: []TabAllocation{fixedAllocation("A", 800), percentAllocation("B", 100)},
+			bill:        adjustedBill(1000, 300),
+			want:        map[string]int64{"PAYMENT": 700},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tab := &Tab{TabOverview: TabOverview{Id: 2, TabBase: TabBase{PaymentDetails: "PAYMENT"}, Allocations: tt.allocations}}
+			lines, err := JournalLinesOf(tab, tt.bill, nil)
+			if err != nil {
+				t.Fatalf("JournalLinesOf() error = %v", err)
+			}
+
+			got := make(map[string]int64)
+			for _, line := range lines {
+				if line.TabId != 2 || line.BillId != 1 {
+					t.Errorf("line for tab %v bill %v, want tab 2 bill 1", line.TabId, line.BillId)
+				}
+				got[line.Chartstring] += line.Amount.Amount
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("JournalLinesOf() = %v, want %v", got, tt.want)
+			}
+			for chartstring, amount := range tt.want {
+				if got[chartstring] != amount {
+					t.Errorf("JournalLinesOf() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/willtrojniak/TabAppBackend/services"
+)
+
+type LimitRuleTarget string
+
+const (
+	LIMIT_RULE_TARGET_ITEM     LimitRuleTarget = "item"
+	LIMIT_RULE_TARGET_CATEGORY LimitRuleTarget = "category"
+)
+
+type LimitRuleScope string
+
+const (
+	LIMIT_RULE_SCOPE_PERSON LimitRuleScope = "person"
+	LIMIT_RULE_SCOPE_TAB    LimitRuleScope = "tab"
+)
+
+type LimitRulePeriod string
+
+const (
+	LIMIT_RULE_PERIOD_DAY  LimitRulePeriod = "day"
+	LIMIT_RULE_PERIOD_BILL LimitRulePeriod = "bill"
+)
+
+type TabLimitRuleCreate struct {
+	Target      LimitRuleTarget `json:"target" db:"target" validate:"required,oneof=item category"`
+	TargetId    int             `json:"target_id" db:"target_id" validate:"required,gte=1"` // The id of the item or category
+	Scope       LimitRuleScope  `json:"scope" db:"scope" validate:"required,oneof=person tab"`
+	Period      LimitRulePeriod `json:"period" db:"period" validate:"required,oneof=day bill"`
+	MaxQuantity *int            `json:"max_quantity" db:"max_quantity" validate:"omitempty,gte=1"` // Nil value indicates no quantity limit
+	MaxAmount   *Money          `json:"max_amount" db:"max_amount" validate:"omitempty,gte=0"`     // Nil value indicates no amount limit
+}
+
+type TabLimitRulesUpdate struct {
+	Rules []TabLimitRuleCreate `json:"rules" validate:"max=50,dive"`
+}
+
+type TabLimitRule struct {
+	TabLimitRuleCreate
+	Id         int    `json:"id" db:"id"`
+	TargetName string `json:"target_name" db:"target_name"`
+}
+
+// The amounts already counted against a rule, and the amounts the pending order would add
+type TabLimitRuleUsage struct {
+	TabLimitRule
+	UsedQuantity    int   `db:"used_quantity"`
+	UsedAmount      Money `db:"used_amount"`
+	PendingQuantity int   `db:"pending_quantity"`
+	PendingAmount   Money `db:"pending_amount"`
+}
+
+func TabLimitRuleCreateStructLevelValidation(sl validator.StructLevel) {
+	data := sl.Current().Interface().(TabLimitRuleCreate)
+
+	if data.MaxQuantity == nil && data.MaxAmount == nil {
+		field, _ := reflect.ValueOf(data).Type().FieldByName("MaxQuantity")
+		tag, ok := field.Tag.Lookup("json")
+		if !ok {
+			tag = field.Name
+		}
+		sl.ReportError(data.MaxQuantity, tag, field.Name, "required_without", "max_amount")
+	}
+}
+
+// Describes the rule in a form suitable for error messages, e.g. "2 Latte per person per day"
+func (r *TabLimitRule) Description() string {
+	limits := make([]string, 0, 2)
+	if r.MaxQuantity != nil {
+		limits = append(limits, fmt.Sprintf("%v %s", *r.MaxQuantity, r.TargetName))
+	}
+	if r.MaxAmount != nil {
+		limits = append(limits, fmt.Sprintf("%s of %s", r.MaxAmount.String(), r.TargetName))
+	}
+	return fmt.Sprintf("%s per %s per %s", strings.Join(limits, " and "), r.Scope, r.Period)
+}
+
+// Checks that the pending order does not exceed any of the limit rules it applies to.
+// Rules which the pending order does not apply to are ignored, even if they have already been exceeded.
+func ValidateLimitRules(usages []TabLimitRuleUsage, isIdentified bool) error {
+	errs := make(services.ValidationErrors)
+	for _, u := range usages {
+		if u.PendingQuantity <= 0 {
+			continue
+		}
+		key := fmt.Sprintf("limit_rules.%v", u.Id)
+		if u.Scope == LIMIT_RULE_SCOPE_PERSON && !isIdentified {
+			errs[key] = services.ValidationError{Value: u.Description(), Error: "unidentified"}
+			continue
+		}
+		if u.MaxQuantity != nil && u.UsedQuantity+u.PendingQuantity > *u.MaxQuantity {
+			errs[key] = services.ValidationError{Value: u.Description(), Error: "exceeded"}
+			continue
+		}
+		if u.MaxAmount != nil {
+			amount, err := u.UsedAmount.Add(u.PendingAmount)
+			if err != nil {
+				return err
+			}
+			if amount.Amount > u.MaxAmount.Amount {
+				errs[key] = services.ValidationError{Value: u.Description(), Error: "exceeded"}
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return services.NewValidationServiceError(errors.New("Order exceeds tab limit rules"), errs)
+	}
+	return nil
+}
+
+// Identifies the person an order was placed for, used to apply per person limit rules
+func (data *BillOrderCreate) OrdererKey() *string {
+	var key string
+	if data.OrderedByEmail != nil {
+		key = strings.ToLower(*data.OrderedByEmail)
+	} else if data.OrderedByName != nil {
+		key = strings.ToLower(*data.OrderedByName)
+	} else {
+		return nil
+	}
+	return &key
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/willtrojniak/TabAppBackend/services"
+)
+
+func limitUsage(id int, scope LimitRuleScope, maxQuantity *int, maxAmount *Money, used int, usedAmount Money, pending int, pendingAmount Money) TabLimitRuleUsage {
+	return TabLimitRuleUsage{
+		TabLimitRule: TabLimitRule{
+			TabLimitRuleCreate: TabLimitRuleCreate{
+				Target:      LIMIT_RULE_TARGET_ITEM,
+				TargetId:    1,
+				Scope:       scope,
+				Period:      LIMIT_RULE_PERIOD_DAY,
+				MaxQuantity: maxQuantity,
+				MaxAmount:   maxAmount,
+			},
+			Id:         id,
+			TargetName: "Latte",
+		},
+		UsedQuantity:    used,
+		UsedAmount:      usedAmount,
+		PendingQuantity: pending,
+		PendingAmount:   pendingAmount,
+	}
+}
+
+func TestValidateLimitRules(t *testing.T) {
+	two := 2
+	fiveDollars := NewMoney(500, "USD")
+
+	tests := []struct {
+		name         string
+		usages       []TabLimitRuleUsage
+		isIdentified bool
+		wantKeys     []string
+	}{
+		{name: "no rules", isIdentified: true},
+		{name: "within quantity", usages: []TabLimitRuleUsage{limitUsage(1, LIMIT_RULE_SCOPE_PERSON, &two, nil, 1, NewMoney(450, "USD"), 1, NewMoney(450, "USD"))}, isIdentified: true},
+		{name: "exceeds quantity", usages: []TabLimitRuleUsage{limitUsage(1, LIMIT_RULE_SCOPE_TAB, &two, nil, 2, NewMoney(900, "USD"), 1, NewMoney(450, "USD"))}, wantKeys: []string{"limit_rules.1"}},
+		{name: "exceeds amount", usages: []TabLimitRuleUsage{limitUsage(2, LIMIT_RULE_SCOPE_TAB, nil, &fiveDollars, 0, Money{}, 2, NewMoney(501, "USD"))}, wantKeys: []string{"limit_rules.2"}},
+		{name: "amount at limit", usages: []TabLimitRuleUsage{limitUsage(2, LIMIT_RULE_SCOPE_TAB, nil, &fiveDollars, 1, NewMoney(250, "USD"), 1, NewMoney(250, "USD"))}},
+		{name: "already exceeded rule not ordered against", usages: []TabLimitRuleUsage{limitUsage(1, LIMIT_RULE_SCOPE_TAB, &two, nil, 5, NewMoney(2250, "USD"), 0, Money{})}},
+		{name: "quantity at limit", usages: []TabLimitRuleUsage{limitUsage(1, LIMIT_RULE_SCOPE_PERSON, &two, nil, 0, Money{}, 2, NewMoney(900, "USD"))}, isIdentified: true},
+		{name: "per person rule without orderer", usages: []TabLimitRuleUsage{limitUsage(3, LIMIT_RULE_SCOPE_PERSON, &two, nil, 0, Money{}, 1, NewMoney(450, "USD"))}, wantKeys: []string{"limit_rules.3"}},
+		{
+			name: "reports every exceeded rule",
+			usages: []TabLimitRuleUsage{
+				limitUsage(1, LIMIT_RULE_SCOPE_TAB, &two, nil, 2, NewMoney(900, "USD"), 1, NewMoney(450, "USD")),
+				limitUsage(2, LIMIT_RULE_SCOPE_TAB, nil, &fiveDollars, 1, NewMoney(450, "USD"), 1, NewMoney(450, "USD")),
+			},
+			wantKeys: []string{"limit_rules.1", "limit_rules.2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateLimitRules(tt.usages, tt.isIdentified)
+			if len(tt.wantKeys) == 0 {
+				if err != nil {
+					t.Fatalf("ValidateLimitRules() error = %v, want nil", err)
+				}
+				return
+			}
+
+			var serviceErr *services.ServiceError
+			if !errors.As(err, &serviceErr) {
+				t.Fatalf("ValidateLimitRules() error = %v, want validation error", err)
+			}
+			errs, ok := serviceErr.Data().(services.ValidationErrors)
+			if !ok || len(errs) != len(tt.wantKeys) {
+				t.Fatalf("ValidateLimitRules() errors = %v, want keys %v", serviceErr.Data(), tt.wantKeys)
+			}
+			for _, key := range tt.wantKeys {
+				if _, ok := errs[key]; !ok {
+					t.Errorf("ValidateLimitRules() missing error for %q", key)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package models
+
+// The view of a tab available to the members of its verification list
+type MemberTab struct {
+	Id                 int        `json:"id"`
+	ShopId             int        `json:"shop_id"`
+	DisplayName        string     `json:"display_name"`
+	Organization       string     `json:"organization"`
+	StartDate          Date       `json:"start_date"`
+	EndDate            Date       `json:"end_date"`
+	DailyStartTime     Time       `json:"daily_start_time"`
+	DailyEndTime       Time       `json:"daily_end_time"`
+	ActiveDaysOfWk     int8       `json:"active_days_of_wk"`
+	VerificationMethod string     `json:"verification_method"`
+	Status             string     `json:"status"`
+	Locations          []Location `json:"locations"`
+}
+
+// The amounts a member may still order on a tab
+type MemberAllowance struct {
+	DollarLimitPerOrder Money                  `json:"dollar_limit_per_order"` // Zero value indicates no limit
+	Spent               Money                  `json:"spent"`
+	TotalRemaining      *Money                 `json:"total_remaining"` // Nil value indicates no limit
+	BillRemaining       *Money                 `json:"bill_remaining"`  // Nil value indicates no limit
+	Limits              []MemberLimitAllowance `json:"limits"`
+}
+
+// The amounts a member may still order under one of the tab's limit rules, for the current day or bill
+type MemberLimitAllowance struct {
+	RuleId            int             `json:"rule_id"`
+	Description       string          `json:"description"`
+	Scope             LimitRuleScope  `json:"scope"`
+	Period            LimitRulePeriod `json:"period"`
+	QuantityRemaining *int            `json:"quantity_remaining"` // Nil value indicates no quantity limit
+	AmountRemaining   *Money          `json:"amount_remaining"`   // Nil value indicates no amount limit
+}
+
+type MemberTabDetail struct {
+	MemberTab
+	Email     string          `json:"email"`
+	IsActive  bool            `json:"is_active"`
+	Allowance MemberAllowance `json:"allowance"`
+}
+
+func (t *TabOverview) MemberView() MemberTab {
+	return MemberTab{
+		Id:                 t.Id,
+		ShopId:             t.ShopId,
+		DisplayName:        t.DisplayName,
+		Organization:       t.Organization,
+		StartDate:          t.StartDate,
+		EndDate:            t.EndDate,
+		DailyStartTime:     t.DailyStartTime,
+		DailyEndTime:       t.DailyEndTime,
+		ActiveDaysOfWk:     t.ActiveDaysOfWk,
+		VerificationMethod: t.VerificationMethod,
+		Status:             t.Status,
+		Locations:          t.Locations,
+	}
+}
+
+// Reports the member's spending alongside the tab's remaining budget and what remains of each limit rule for the member,
+// where usages counts the member's orders against per person rules
+func (t *Tab) MemberAllowance(today Date, memberSpent Money, usages []TabLimitRuleUsage) (MemberAllowance, error) {
+	budget, err := t.Budget(today)
+	if err != nil {
+		return MemberAllowance{}, err
+	}
+
+	limits := make([]MemberLimitAllowance, 0, len(usages))
+	for _, u := range usages {
+		limit := MemberLimitAllowance{
+			RuleId:      u.Id,
+			Description: u.Description(),
+			Scope:       u.Scope,
+			Period:      u.Period,
+		}
+		if u.MaxQuantity != nil {
+			quantity := max(*u.MaxQuantity-u.UsedQuantity, 0)
+			limit.QuantityRemaining = &quantity
+		}
+		limit.AmountRemaining, err = remaining(u.MaxAmount, u.UsedAmount)
+		if err != nil {
+			return MemberAllowance{}, err
+		}
+		if limit.AmountRemaining != nil && limit.AmountRemaining.Amount < 0 {
+			limit.AmountRemaining.Amount = 0
+		}
+		limits = append(limits, limit)
+	}
+
+	return MemberAllowance{
+		DollarLimitPerOrder: t.DollarLimitPerOrder,
+		Spent:               memberSpent,
+		TotalRemaining:      budget.TotalRemaining,
+		BillRemaining:       budget.BillRemaining,
+		Limits:              limits,
+	}, nil
+}
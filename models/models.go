@@ -1,6 +1,7 @@
 package models
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -30,8 +31,14 @@ func init() {
 		return name
 	})
 
+	Validate.RegisterCustomTypeFunc(moneyValidationValue, Money{})
 	Validate.RegisterStructValidation(TabUpdateStructLevelValidation, TabUpdate{})
+	Validate.RegisterStructValidation(ItemOrderCreateStructLevelValidation, ItemOrderCreate{})
+	Validate.RegisterStructValidation(TabLimitRuleCreateStructLevelValidation, TabLimitRuleCreate{})
+	Validate.RegisterStructValidation(ChartstringFormatCreateStructLevelValidation, ChartstringFormatCreate{})
+	Validate.RegisterStructValidation(TabAllocationCreateStructLevelValidation, TabAllocationCreate{})
 	Validate.RegisterValidation("future", dateFutureValidation)
+	Validate.RegisterValidation("paymentmethod", paymentMethodValidation)
 }
 
 func dateFutureValidation(f1 validator.FieldLevel) bool {
@@ -66,7 +73,8 @@ func ReadRequestJson(r *http.Request, dest interface{}) error {
 		return services.NewServiceError(nil, http.StatusUnsupportedMediaType, nil)
 	}
 
-	decoder := json.NewDecoder(r.Body)
+	var body bytes.Buffer
+	decoder := json.NewDecoder(io.TeeReader(r.Body, &body))
 	err := decoder.Decode(dest)
 	if err != nil {
 		var syntaxError *json.SyntaxError
@@ -86,6 +94,17 @@ func ReadRequestJson(r *http.Request, dest interface{}) error {
 		}
 	}
 
+	var data any
+	amounts := json.NewDecoder(&body)
+	amounts.UseNumber()
+	if err := amounts.Decode(&data); err != nil {
+		return services.NewInternalServiceError(err)
+	}
+	err = checkAmountObjects(data, reflect.TypeOf(dest), "")
+	if err != nil {
+		return services.NewServiceError(err, http.StatusBadRequest, err.Error())
+	}
+
 	return nil
 }
 
@@ -0,0 +1,349 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type Currency string
+
+const DefaultCurrency Currency = "USD"
+
+var currencySymbols = map[Currency]string{
+	"USD": "$",
+	"CAD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+}
+
+// The number of decimal places of the minor unit of currencies which do not use cents
+var currencyExponents = map[Currency]int{
+	"JPY": 0,
+	"KRW": 0,
+	"BHD": 3,
+	"JOD": 3,
+	"KWD": 3,
+	"OMR": 3,
+	"TND": 3,
+}
+
+func (c Currency) IsValid() bool {
+	if len(c) != 3 {
+		return false
+	}
+	for _, r := range c {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Currency) decimals() int {
+	if exponent, ok := currencyExponents[c]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// Money is an exact monetary value stored as an integer number of minor units (e.g. cents).
+// In JSON it is represented as {"amount": 450, "currency": "USD"}, but a bare integer of
+// minor units is also accepted, which is how Postgres emits money columns inside json_agg.
+// Request bodies must give amounts as objects (see ReadRequestJson), and an amount given without
+// a currency is in the shop's currency.
+// An empty currency indicates an amount whose currency is not known, which is reported as DefaultCurrency.
+type Money struct {
+	Amount   int64    `json:"amount"`
+	Currency Currency `json:"currency"`
+}
+
+func NewMoney(amount int64, currency Currency) Money {
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	return Money{Amount: amount, Currency: currency}
+}
+
+func (m Money) currency() Currency {
+	if m.Currency == "" {
+		return DefaultCurrency
+	}
+	return m.Currency
+}
+
+var ErrCurrencyMismatch = errors.New("Cannot combine amounts in different currencies")
+
+// Adds the amounts, which must be in the same currency. An amount without a currency, such as
+// one read from the database, takes on the currency of the other.
+func (m Money) Add(o Money) (Money, error) {
+	currency := m.Currency
+	if currency == "" {
+		currency = o.Currency
+	} else if o.Currency != "" && o.Currency != currency {
+		return Money{}, fmt.Errorf("%w (%v, %v)", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+	return Money{Amount: m.Amount + o.Amount, Currency: currency}, nil
+}
+
+func (m Money) Sub(o Money) (Money, error) {
+	return m.Add(Money{Amount: -o.Amount, Currency: o.Currency})
+}
+
+// Adds up the amounts, which must all be in the same currency
+func Sum(amounts ...Money) (Money, error) {
+	var total Money
+	for _, a := range amounts {
+		var err error
+		total, err = total.Add(a)
+		if err != nil {
+			return Money{}, err
+		}
+	}
+	return total, nil
+}
+
+func (m Money) Mul(n int) Money {
+	return Money{Amount: m.Amount * int64(n), Currency: m.Currency}
+}
+
+func (m Money) WithCurrency(c Currency) Money {
+	return Money{Amount: m.Amount, Currency: c}
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+func (m Money) String() string {
+	currency := m.currency()
+	sign := ""
+	if m.IsNegative() {
+		sign = "-"
+	}
+
+	value := Money{Amount: abs(m.Amount), Currency: currency}.Decimal()
+	if symbol, ok := currencySymbols[currency]; ok {
+		return fmt.Sprintf("%s%s%s", sign, symbol, value)
+	}
+	return fmt.Sprintf("%s%s %s", sign, value, currency)
+}
+
+// Formats the amount in major units without a currency symbol, e.g. "-4.50"
+func (m Money) Decimal() string {
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	decimals := m.currency().decimals()
+	if decimals == 0 {
+		return fmt.Sprintf("%s%d", sign, amount)
+	}
+	unit := int64(1)
+	for range decimals {
+		unit *= 10
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/unit, decimals, amount%unit)
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount   int64    `json:"amount"`
+		Currency Currency `json:"currency"`
+	}{Amount: m.Amount, Currency: m.currency()})
+}
+
+func (m *Money) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '{' {
+		var v struct {
+			Amount   *json.Number `json:"amount"`
+			Currency Currency     `json:"currency"`
+		}
+		if err := json.Unmarshal(b, &v); err != nil {
+			return err
+		}
+		if v.Amount == nil {
+			return errors.New("Invalid money (missing amount)")
+		}
+		amount, err := v.Amount.Int64()
+		if err != nil {
+			return errors.New("Invalid money (amount must be an integer number of minor units)")
+		}
+		v.Currency = Currency(strings.ToUpper(string(v.Currency)))
+		if v.Currency != "" && !v.Currency.IsValid() {
+			return errors.New("Invalid money (currency)")
+		}
+		m.Amount = amount
+		m.Currency = v.Currency
+		return nil
+	}
+
+	var amount json.Number
+	if err := json.Unmarshal(b, &amount); err != nil {
+		return errors.New("Invalid money")
+	}
+	v, err := amount.Int64()
+	if err != nil {
+		return errors.New("Invalid money (amount must be an integer number of minor units)")
+	}
+	m.Amount = v
+	return nil
+}
+
+// Amounts are stored without their currency, so a currency already set on the destination is kept
+func (m *Money) ScanInt64(v pgtype.Int8) error {
+	if !v.Valid {
+		return errors.New("Cannot scan NULL into Money")
+	}
+	m.Amount = v.Int64
+	return nil
+}
+
+func (m Money) Int64Value() (pgtype.Int8, error) {
+	return pgtype.Int8{Int64: m.Amount, Valid: true}, nil
+}
+
+var moneyType = reflect.TypeOf(Money{})
+
+// Sets the currency of every amount without one reachable through v, which must be a pointer.
+// Amounts are stored without their currency, so those read for a shop are given the shop's currency.
+func SetCurrency(v any, currency Currency) {
+	eachMoney(reflect.ValueOf(v), func(m *Money) {
+		if m.Currency == "" {
+			m.Currency = currency
+		}
+	})
+}
+
+// Checks that every amount reachable through v which has a currency is in the given currency
+func CheckCurrency(v any, currency Currency) error {
+	var err error
+	eachMoney(reflect.ValueOf(v), func(m *Money) {
+		if err == nil && m.Currency != "" && m.Currency != currency {
+			err = fmt.Errorf("%w (%v, %v)", ErrCurrencyMismatch, m.Currency, currency)
+		}
+	})
+	return err
+}
+
+// Calls fn with each settable amount reachable through v
+func eachMoney(v reflect.Value, fn func(m *Money)) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			eachMoney(v.Elem(), fn)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			eachMoney(v.Index(i), fn)
+		}
+	case reflect.Struct:
+		if v.Type() == moneyType {
+			if v.CanSet() {
+				fn(v.Addr().Interface().(*Money))
+			}
+			return
+		}
+		for i := range v.NumField() {
+			// Exported fields of embedded structs are reachable even when the embedded type is not
+			if f := v.Type().Field(i); f.IsExported() || f.Anonymous {
+				eachMoney(v.Field(i), fn)
+			}
+		}
+	}
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// Checks that the amounts in JSON data decoded with UseNumber into a value of type t are objects rather than bare
+// numbers, so that an amount a client gives in major units (e.g. "base_price": 4) is not taken as minor units
+func checkAmountObjects(data any, t reflect.Type, field string) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == moneyType {
+		if _, ok := data.(json.Number); ok {
+			return fmt.Errorf(`Request body contains a bare number for the %q amount, amounts must be given as {"amount": <minor units>, "currency": <currency>}`, field)
+		}
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := data.(map[string]any)
+		if !ok || reflect.PointerTo(t).Implements(jsonUnmarshalerType) {
+			return nil
+		}
+		for i := range t.NumField() {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			// Fields of embedded structs are decoded from the same object
+			if f.Anonymous && name == "" {
+				if err := checkAmountObjects(obj, f.Type, field); err != nil {
+					return err
+				}
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			for key, value := range obj {
+				if strings.EqualFold(key, name) {
+					if err := checkAmountObjects(value, f.Type, name); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		items, _ := data.([]any)
+		for _, item := range items {
+			if err := checkAmountObjects(item, t.Elem(), field); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		obj, _ := data.(map[string]any)
+		for _, value := range obj {
+			if err := checkAmountObjects(value, t.Elem(), field); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// moneyValidationValue lets numeric validation tags (e.g. gte=0) operate on the minor unit amount
+func moneyValidationValue(field reflect.Value) interface{} {
+	if m, ok := field.Interface().(Money); ok {
+		return m.Amount
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMoneyAdd(t *testing.T) {
+	tests := []struct {
+		name    string
+		a       Money
+		b       Money
+		want    Money
+		wantErr error
+	}{
+		{name: "same currency", a: NewMoney(450, "USD"), b: NewMoney(155, "USD"), want: NewMoney(605, "USD")},
+		{name: "negative result", a: NewMoney(100, "USD"), b: NewMoney(-250, "USD"), want: NewMoney(-150, "USD")},
+		{name: "unknown currency takes other", a: Money{Amount: 100}, b: NewMoney(50, "EUR"), want: NewMoney(150, "EUR")},
+		{name: "other currency unknown", a: NewMoney(100, "EUR"), b: Money{Amount: 50}, want: NewMoney(150, "EUR")},
+		{name: "both unknown", a: Money{Amount: 1}, b: Money{Amount: 2}, want: Money{Amount: 3}},
+		{name: "mismatched currencies", a: NewMoney(100, "USD"), b: NewMoney(100, "EUR"), wantErr: ErrCurrencyMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.a.Add(tt.b)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Add() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Add() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneySub(t *testing.T) {
+	tests := []struct {
+		name    string
+		a       Money
+		b       Money
+		want    Money
+		wantErr error
+	}{
+		{name: "same currency", a: NewMoney(450, "USD"), b: NewMoney(155, "USD"), want: NewMoney(295, "USD")},
+		{name: "below zero", a: NewMoney(100, "USD"), b: NewMoney(250, "USD"), want: NewMoney(-150, "USD")},
+		{name: "mismatched currencies", a: NewMoney(100, "JPY"), b: NewMoney(100, "USD"), wantErr: ErrCurrencyMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.a.Sub(tt.b)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Sub() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Sub() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSum(t *testing.T) {
+	tests := []struct {
+		name    string
+		amounts []Money
+		want    Money
+		wantErr error
+	}{
+		{name: "empty", want: Money{}},
+		{name: "mixed known and unknown", amounts: []Money{{Amount: 100}, NewMoney(200, "CAD"), {Amount: 300}}, want: NewMoney(600, "CAD")},
+		{name: "mismatched", amounts: []Money{NewMoney(100, "CAD"), NewMoney(200, "USD")}, wantErr: ErrCurrencyMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Sum(tt.amounts...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Sum() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Sum() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{money: NewMoney(450, "USD"), want: "$4.50"},
+		{money: NewMoney(-5, "USD"), want: "-$0.05"},
+		{money: NewMoney(450, "JPY"), want: "¥450"},
+		{money: NewMoney(1999, "CHF"), want: "19.99 CHF"},
+		{money: Money{Amount: 100}, want: "$1.00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.money.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    Money
+		wantErr bool
+	}{
+		{name: "object", json: `{"amount": 450, "currency": "eur"}`, want: NewMoney(450, "EUR")},
+		{name: "object without currency", json: `{"amount": 450}`, want: Money{Amount: 450}},
+		{name: "bare integer", json: `155`, want: Money{Amount: 155}},
+		{name: "decimal amount", json: `{"amount": 1.55}`, wantErr: true},
+		{name: "bare decimal", json: `1.55`, wantErr: true},
+		{name: "missing amount", json: `{"currency": "USD"}`, wantErr: true},
+		{name: "invalid currency", json: `{"amount": 1, "currency": "US"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Money
+			err := json.Unmarshal([]byte(tt.json), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("Unmarshal() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatMoney(t *testing.T) {
+	usd := &ShopSettings{ShopSettingsUpdate: ShopSettingsUpdate{Currency: "USD"}}
+	jpy := &ShopSettings{ShopSettingsUpdate: ShopSettingsUpdate{Currency: "JPY"}}
+
+	tests := []struct {
+		name  string
+		shop  *ShopSettings
+		money Money
+		want  string
+	}{
+		{name: "own currency in other shop", shop: jpy, money: NewMoney(450, "USD"), want: "$4.50"},
+		{name: "own zero decimal currency", shop: usd, money: NewMoney(450, "JPY"), want: "¥450"},
+		{name: "stored amount in shop currency", shop: jpy, money: Money{Amount: 450}, want: "¥450"},
+		{name: "stored amount in default shop currency", shop: usd, money: Money{Amount: 450}, want: "$4.50"},
+		{name: "three decimal currency", shop: usd, money: NewMoney(1250, "KWD"), want: "1.250 KWD"},
+		{name: "negative three decimal currency", shop: usd, money: NewMoney(-5, "BHD"), want: "-0.005 BHD"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.shop.FormatMoney(tt.money); got != tt.want {
+				t.Errorf("FormatMoney() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetCurrency(t *testing.T) {
+	item := ItemOrder{Quantity: 1}
+	item.BasePrice = &Money{Amount: 100}
+	bill := Bill{
+		Items:       []ItemOrder{item},
+		Adjustments: []BillAdjustment{{BillAdjustmentCreate: BillAdjustmentCreate{Amount: NewMoney(-50, "EUR")}}},
+		AmountPaid:  Money{Amount: 25},
+	}
+
+	SetCurrency(&bill, "JPY")
+
+	tests := []struct {
+		name  string
+		money Money
+		want  Currency
+	}{
+		{name: "amount", money: bill.AmountPaid, want: "JPY"},
+		{name: "amount in embedded unexported struct", money: *bill.Items[0].BasePrice, want: "JPY"},
+		{name: "amount with currency", money: bill.Adjustments[0].Amount, want: "EUR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.money.Currency != tt.want {
+				t.Errorf("currency = %q, want %q", tt.money.Currency, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadRequestJsonAmounts(t *testing.T) {
+	tests := []struct {
+		name    string
+		dest    any
+		body    string
+		wantErr bool
+	}{
+		{name: "object amount", dest: &ItemUpdate{}, body: `{"name": "Coffee", "base_price": {"amount": 400}}`},
+		{name: "missing amount", dest: &ItemUpdate{}, body: `{"name": "Coffee"}`},
+		{name: "bare amount in embedded struct", dest: &ItemUpdate{}, body: `{"name": "Coffee", "base_price": 4}`, wantErr: true},
+		{name: "bare amount in slice", dest: &TabUpdate{}, body: `{"allocations": [{"chartstring": "A", "amount": 500}]}`, wantErr: true},
+		{name: "object amount in slice", dest: &TabUpdate{}, body: `{"allocations": [{"chartstring": "A", "amount": {"amount": 500}}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			err := ReadRequestJson(r, tt.dest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadRequestJson() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyCurrency(t *testing.T) {
+	shop := &ShopSettings{ShopSettingsUpdate: ShopSettingsUpdate{Currency: "JPY"}}
+
+	tests := []struct {
+		name    string
+		amount  Money
+		want    Currency
+		wantErr bool
+	}{
+		{name: "without currency", amount: Money{Amount: 450}, want: "JPY"},
+		{name: "shop currency", amount: NewMoney(450, "JPY"), want: "JPY"},
+		{name: "other currency", amount: NewMoney(450, "USD"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &BillPaymentCreate{Amount: tt.amount}
+			err := shop.ApplyCurrency(data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyCurrency() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && data.Amount.Currency != tt.want {
+				t.Errorf("currency = %q, want %q", data.Amount.Currency, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package models
+
+import "time"
+
+type OrderType string
+
+const (
+	ORDER_TYPE_ADD    OrderType = "add"
+	ORDER_TYPE_REMOVE OrderType = "remove"
+)
+
+type OrderVoidReason string
+
+const (
+	ORDER_VOID_REASON_ENTRY_ERROR      OrderVoidReason = "entry_error"
+	ORDER_VOID_REASON_WRONG_TAB        OrderVoidReason = "wrong_tab"
+	ORDER_VOID_REASON_CUSTOMER_REQUEST OrderVoidReason = "customer_request"
+	ORDER_VOID_REASON_ITEM_UNAVAILABLE OrderVoidReason = "item_unavailable"
+	ORDER_VOID_REASON_OTHER            OrderVoidReason = "other"
+)
+
+type OrderVoidCreate struct {
+	Reason           OrderVoidReason `json:"reason" db:"reason" validate:"required,oneof=entry_error wrong_tab customer_request item_unavailable other"`
+	Note             string          `json:"note" db:"note" validate:"required,min=3,max=255"`
+	PaidBillOverride bool            `json:"paid_bill_override" db:"paid_bill_override"` // Allows managers to void orders on bills which have already been paid
+}
+
+type OrderVoid struct {
+	OrderVoidCreate
+	OrderId   int       `json:"order_id" db:"order_id"`
+	StaffId   *string   `json:"staff_id" db:"staff_id"`
+	StaffName *string   `json:"staff_name" db:"staff_name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type OrderVariantLine struct {
+	VariantId int    `json:"variant_id" db:"variant_id"`
+	Name      string `json:"name" db:"name"`
+	UnitPrice Money  `json:"unit_price" db:"unit_price"`
+	Quantity  int    `json:"quantity" db:"quantity"`
+}
+
+type OrderAddonLine struct {
+	AddonId   int    `json:"addon_id" db:"addon_id"`
+	Name      string `json:"name" db:"name"`
+	UnitPrice Money  `json:"unit_price" db:"unit_price"`
+	Quantity  int    `json:"quantity" db:"quantity"`
+}
+
+type OrderSubstitutionLine struct {
+	SubstitutionGroupId int    `json:"substitution_group_id" db:"substitution_group_id"`
+	SubstitutionId      int    `json:"substitution_id" db:"substitution_id"`
+	Name                string `json:"name" db:"name"`
+	UnitPrice           Money  `json:"unit_price" db:"unit_price"`
+	Quantity            int    `json:"quantity" db:"quantity"`
+}
+
+type OrderLine struct {
+	Id            int                     `json:"id" db:"id"`
+	ItemId        int                     `json:"item_id" db:"item_id"`
+	Name          string                  `json:"name" db:"name"`
+	UnitPrice     Money                   `json:"unit_price" db:"unit_price"`
+	Quantity      int                     `json:"quantity" db:"quantity"`
+	Variants      []OrderVariantLine      `json:"variants" db:"variants"`
+	Addons        []OrderAddonLine        `json:"addons" db:"addons"`
+	Substitutions []OrderSubstitutionLine `json:"substitutions" db:"substitutions"`
+}
+
+// An immutable record of a single add or remove call against a tab
+type Order struct {
+	Id               int            `json:"id" db:"id"`
+	BillId           int            `json:"bill_id" db:"bill_id"`
+	Type             OrderType      `json:"type" db:"type"`
+	StaffId          *string        `json:"staff_id" db:"staff_id"` // Nil value indicates the staff user was deleted or the order predates attribution
+	StaffName        *string        `json:"staff_name" db:"staff_name"`
+	LocationId       *int           `json:"location_id" db:"location_id"`     // Nil value indicates the order predates attribution
+	LocationName     *string        `json:"location_name" db:"location_name"` // Nil value indicates the location was deleted
+	ScheduleOverride bool           `json:"schedule_override" db:"schedule_override"`
+	OrderedByName    *string        `json:"ordered_by_name" db:"ordered_by_name"`
+	OrderedByEmail   *string        `json:"ordered_by_email" db:"ordered_by_email"`
+	VoucherCode      *string        `json:"voucher_code" db:"voucher_code"` // Nil value indicates no voucher was redeemed
+	CreatedAt        time.Time      `json:"created_at" db:"created_at"`
+	Items            []OrderLine    `json:"items" db:"items"`
+	Void             *OrderVoid     `json:"void" db:"void"`         // Nil value indicates the order has not been voided
+	Transfer         *OrderTransfer `json:"transfer" db:"transfer"` // Nil value indicates the order was not placed by a transfer
+}
+
+type GetOrdersQueryParams struct {
+	Limit          *int
+	Offset         int
+	OrderedByEmail *string
+}
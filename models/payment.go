@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+)
+
+type PaymentStatus string
+
+const (
+	PAYMENT_STATUS_UNPAID   PaymentStatus = "unpaid"
+	PAYMENT_STATUS_PARTIAL  PaymentStatus = "partially_paid"
+	PAYMENT_STATUS_PAID     PaymentStatus = "paid"
+	PAYMENT_STATUS_OVERPAID PaymentStatus = "overpaid"
+)
+
+type BillPaymentCreate struct {
+	Amount    Money  `json:"amount" db:"amount" validate:"gt=0"`
+	Method    string `json:"method" db:"method" validate:"required,paymentmethod"`
+	Reference string `json:"reference" db:"reference" validate:"max=64"` // Chartstring or receipt number the payment was made with
+}
+
+type BillPaymentReversalCreate struct {
+	Note string `json:"note" db:"note" validate:"required,min=3,max=255"`
+}
+
+type BillPaymentReversal struct {
+	BillPaymentReversalCreate
+	StaffId   *string   `json:"staff_id" db:"staff_id"`
+	StaffName *string   `json:"staff_name" db:"staff_name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// An immutable record of a payment made towards a bill
+type BillPayment struct {
+	BillPaymentCreate
+	Id        int                  `json:"id" db:"id"`
+	BillId    int                  `json:"bill_id" db:"bill_id"`
+	StaffId   *string              `json:"staff_id" db:"staff_id"` // Nil value indicates the staff user was deleted or the payment predates the ledger
+	StaffName *string              `json:"staff_name" db:"staff_name"`
+	CreatedAt time.Time            `json:"created_at" db:"created_at"`
+	Reversal  *BillPaymentReversal `json:"reversal" db:"reversal"` // Nil value indicates the payment has not been reversed
+}
+
+// Derives the payment status of a bill from its total and the sum of its payments which have not been reversed
+func PaymentStatusOf(total Money, paid Money) (PaymentStatus, error) {
+	balance, err := total.Sub(paid)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case balance.IsNegative():
+		return PAYMENT_STATUS_OVERPAID, nil
+	case balance.IsZero():
+		return PAYMENT_STATUS_PAID, nil
+	case paid.IsZero():
+		return PAYMENT_STATUS_UNPAID, nil
+	default:
+		return PAYMENT_STATUS_PARTIAL, nil
+	}
+}
+
+// The amount remaining to be paid on the bill, negative if the bill has been overpaid
+func (b *Bill) Balance() (Money, error) {
+	total, err := b.Total()
+	if err != nil {
+		return Money{}, err
+	}
+	return total.Sub(b.AmountPaid)
+}
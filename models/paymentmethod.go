@@ -0,0 +1,204 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"unicode/utf8"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/willtrojniak/TabAppBackend/services"
+)
+
+type PaymentMethod string
+
+const (
+	PaymentMethodInPerson             PaymentMethod = "in person"
+	PaymentMethodChartstring          PaymentMethod = "chartstring"
+	PaymentMethodPurchaseOrder        PaymentMethod = "purchase order"
+	PaymentMethodDepartmentalTransfer PaymentMethod = "departmental transfer"
+	PaymentMethodCard                 PaymentMethod = "card" // Paid online by the tab owner through the payment provider
+)
+
+type PaymentDetailsFormat string
+
+const (
+	PAYMENT_DETAILS_FORMAT_TEXT        PaymentDetailsFormat = "text"
+	PAYMENT_DETAILS_FORMAT_CHARTSTRING PaymentDetailsFormat = "chartstring" // Checked against the shop's chartstring formats
+)
+
+// Describes the payment details a payment method expects, both for validation and for rendering forms
+type PaymentDetailsSchema struct {
+	Label       string               `json:"label"`
+	Placeholder string               `json:"placeholder"`
+	Format      PaymentDetailsFormat `json:"format"`
+	Required    bool                 `json:"required"`
+	MaxLength   int                  `json:"max_length"`
+	Pattern     string               `json:"pattern"` // Empty value indicates any characters are accepted
+
+	pattern *regexp.Regexp
+}
+
+type PaymentMethodType struct {
+	Method              PaymentMethod        `json:"method"`
+	Label               string               `json:"label"`
+	Details             PaymentDetailsSchema `json:"details"`
+	SupportsAllocations bool                 `json:"supports_allocations"` // Whether bills may be split across chartstrings
+}
+
+// Payment method types in the order they are presented to users
+var paymentMethodTypes = []PaymentMethodType{
+	{
+		Method: PaymentMethodInPerson,
+		Label:  "In Person",
+		Details: PaymentDetailsSchema{
+			Label:     "Notes",
+			Format:    PAYMENT_DETAILS_FORMAT_TEXT,
+			MaxLength: 255,
+		},
+	},
+	{
+		Method: PaymentMethodChartstring,
+		Label:  "Chartstring",
+		Details: PaymentDetailsSchema{
+			Label:       "Chartstring",
+			Placeholder: "XXXXX-XXXXX-XXXXX",
+			Format:      PAYMENT_DETAILS_FORMAT_CHARTSTRING,
+			Required:    true,
+			MaxLength:   64,
+		},
+		SupportsAllocations: true,
+	},
+	{
+		Method: PaymentMethodPurchaseOrder,
+		Label:  "Purchase Order",
+		Details: PaymentDetailsSchema{
+			Label:       "PO Number",
+			Placeholder: "PO-000000",
+			Format:      PAYMENT_DETAILS_FORMAT_TEXT,
+			Required:    true,
+			MaxLength:   32,
+			Pattern:     `^[A-Za-z0-9][A-Za-z0-9\-/]*$`,
+		},
+	},
+	{
+		Method: PaymentMethodDepartmentalTransfer,
+		Label:  "Departmental Transfer",
+		Details: PaymentDetailsSchema{
+			Label:     "Department and Contact",
+			Format:    PAYMENT_DETAILS_FORMAT_TEXT,
+			Required:  true,
+			MaxLength: 255,
+		},
+	},
+	{
+		Method: PaymentMethodCard,
+		Label:  "Card (Online)",
+		Details: PaymentDetailsSchema{
+			Label:     "Payment Reference",
+			Format:    PAYMENT_DETAILS_FORMAT_TEXT,
+			MaxLength: 64,
+		},
+	},
+}
+
+func init() {
+	for i := range paymentMethodTypes {
+		paymentMethodTypes[i].Details.compile()
+	}
+}
+
+func (s *PaymentDetailsSchema) compile() {
+	if s.Pattern != "" {
+		s.pattern = regexp.MustCompile(s.Pattern)
+	}
+}
+
+func PaymentMethodTypes() []PaymentMethodType {
+	types := make([]PaymentMethodType, len(paymentMethodTypes))
+	copy(types, paymentMethodTypes)
+	return types
+}
+
+func GetPaymentMethodType(method string) (*PaymentMethodType, bool) {
+	for i := range paymentMethodTypes {
+		if string(paymentMethodTypes[i].Method) == method {
+			t := paymentMethodTypes[i]
+			return &t, true
+		}
+	}
+	return nil, false
+}
+
+// Whether bills of tabs paid with the method may be split across chartstrings
+func SupportsAllocations(method string) bool {
+	t, ok := GetPaymentMethodType(method)
+	return ok && t.SupportsAllocations
+}
+
+func paymentMethodValidation(fl validator.FieldLevel) bool {
+	_, ok := GetPaymentMethodType(fl.Field().String())
+	return ok
+}
+
+// Checks the details against the method's schema, returning the tag of the failed check
+// or an empty string if the details are valid
+func (t *PaymentMethodType) ValidateDetails(details string, formats []ChartstringFormat) string {
+	if details == "" {
+		if t.Details.Required {
+			return "required"
+		}
+		return ""
+	}
+	if t.Details.MaxLength > 0 && utf8.RuneCountInString(details) > t.Details.MaxLength {
+		return "max"
+	}
+	if t.Details.pattern != nil && !t.Details.pattern.MatchString(details) {
+		return "pattern"
+	}
+	if t.Details.Format == PAYMENT_DETAILS_FORMAT_CHARTSTRING {
+		if _, _, ok := MatchChartstring(formats, details); !ok {
+			return "charstringformat"
+		}
+	}
+	return ""
+}
+
+// Checks that the shop accepts the tab's payment method, the tab's payment details against the method
+// and the allocations against the shop's chartstring formats
+func (t *TabUpdate) ValidatePaymentDetails(shop *Shop) error {
+	errs := make(services.ValidationErrors)
+	if !slices.Contains(shop.PaymentMethods, t.PaymentMethod) {
+		errs["payment_method"] = services.ValidationError{Value: t.PaymentMethod, Error: "disabled"}
+	} else if method, ok := GetPaymentMethodType(t.PaymentMethod); ok {
+		if tag := method.ValidateDetails(t.PaymentDetails, shop.ChartstringFormats); tag != "" {
+			errs["payment_details"] = services.ValidationError{Value: t.PaymentDetails, Error: tag}
+		}
+	}
+	for i, a := range t.Allocations {
+		if _, _, ok := MatchChartstring(shop.ChartstringFormats, a.Chartstring); !ok {
+			errs[fmt.Sprintf("allocations[%v].chartstring", i)] = services.ValidationError{Value: a.Chartstring, Error: "charstringformat"}
+		}
+	}
+
+	if len(errs) > 0 {
+		return services.NewValidationServiceError(errors.New("Invalid payment details"), errs)
+	}
+	return nil
+}
+
+// Checks the payment's reference against its payment method. Payments may be recorded without a reference
+// unless the method requires payment details.
+func (p *BillPaymentCreate) ValidatePaymentDetails(shop *Shop) error {
+	method, ok := GetPaymentMethodType(p.Method)
+	if !ok {
+		return nil
+	}
+	if tag := method.ValidateDetails(p.Reference, shop.ChartstringFormats); tag != "" {
+		return services.NewValidationServiceError(errors.New("Invalid payment reference"), services.ValidationErrors{
+			"reference": services.ValidationError{Value: p.Reference, Error: tag},
+		})
+	}
+	return nil
+}
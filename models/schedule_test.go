@@ -0,0 +1,93 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+)
+
+// A confirmed tab running through October 2026 on weekdays, with the given daily hours
+func scheduleTab(start time.Duration, end time.Duration) *TabOverview {
+	tab := &TabOverview{Status: TAB_STATUS_CONFIRMED.String()}
+	tab.StartDate = Date{Date: civil.Date{Year: 2026, Month: time.October, Day: 1}}
+	tab.EndDate = Date{Date: civil.Date{Year: 2026, Month: time.October, Day: 31}}
+	tab.DailyStartTime = Time{Duration: start}
+	tab.DailyEndTime = Time{Duration: end}
+	for _, d := range []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday} {
+		tab.ActiveDaysOfWk |= 1 << uint(d)
+	}
+	return tab
+}
+
+func at(day int, hour int, minute int) time.Time {
+	return time.Date(2026, time.October, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestCheckSchedule(t *testing.T) {
+	daytime := scheduleTab(9*time.Hour, 17*time.Hour)
+	overnight := scheduleTab(22*time.Hour, 2*time.Hour)
+	allDay := scheduleTab(0, 0)
+
+	tests := []struct {
+		name string
+		tab  *TabOverview
+		at   time.Time
+		want ScheduleViolation
+	}{
+		{name: "within hours", tab: daytime, at: at(14, 12, 0), want: SCHEDULE_VIOLATION_NONE},
+		{name: "end minute is inclusive", tab: daytime, at: at(14, 17, 0), want: SCHEDULE_VIOLATION_NONE},
+		{name: "before hours", tab: daytime, at: at(14, 8, 59), want: SCHEDULE_VIOLATION_DAILY_HOURS},
+		{name: "after hours", tab: daytime, at: at(14, 17, 1), want: SCHEDULE_VIOLATION_DAILY_HOURS},
+		{name: "inactive day", tab: daytime, at: at(17, 12, 0), want: SCHEDULE_VIOLATION_DAY_OF_WEEK},
+		{name: "before start date", tab: daytime, at: time.Date(2026, time.September, 30, 12, 0, 0, 0, time.UTC), want: SCHEDULE_VIOLATION_DATE_RANGE},
+		{name: "overnight before midnight", tab: overnight, at: at(14, 23, 0), want: SCHEDULE_VIOLATION_NONE},
+		{name: "overnight after midnight", tab: overnight, at: at(15, 1, 30), want: SCHEDULE_VIOLATION_NONE},
+		{name: "overnight between windows", tab: overnight, at: at(14, 12, 0), want: SCHEDULE_VIOLATION_DAILY_HOURS},
+		{name: "overnight after midnight belongs to previous day", tab: overnight, at: at(17, 1, 0), want: SCHEDULE_VIOLATION_NONE},
+		{name: "overnight from inactive day", tab: overnight, at: at(18, 1, 0), want: SCHEDULE_VIOLATION_DAY_OF_WEEK},
+		{name: "overnight after midnight past end date", tab: overnight, at: time.Date(2026, time.November, 1, 1, 0, 0, 0, time.UTC), want: SCHEDULE_VIOLATION_DAY_OF_WEEK},
+		{name: "overnight after midnight before start date", tab: overnight, at: at(1, 1, 0), want: SCHEDULE_VIOLATION_DATE_RANGE},
+		{name: "equal hours run all day", tab: allDay, at: at(14, 12, 0), want: SCHEDULE_VIOLATION_NONE},
+		{name: "equal hours before midnight", tab: allDay, at: at(14, 23, 59), want: SCHEDULE_VIOLATION_NONE},
+		{name: "equal hours on inactive day", tab: allDay, at: at(17, 12, 0), want: SCHEDULE_VIOLATION_DAY_OF_WEEK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.tab.CheckSchedule(tt.at); got != tt.want {
+				t.Errorf("CheckSchedule() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateOrderTime(t *testing.T) {
+	confirmed := scheduleTab(9*time.Hour, 17*time.Hour)
+	pending := scheduleTab(9*time.Hour, 17*time.Hour)
+	pending.Status = TAB_STATUS_PENDING.String()
+
+	tests := []struct {
+		name     string
+		tab      *TabOverview
+		at       time.Time
+		override bool
+		wantErr  bool
+	}{
+		{name: "active", tab: confirmed, at: at(14, 12, 0)},
+		{name: "outside hours", tab: confirmed, at: at(14, 20, 0), wantErr: true},
+		{name: "outside hours with override", tab: confirmed, at: at(14, 20, 0), override: true},
+		{name: "inactive day with override", tab: confirmed, at: at(17, 12, 0), override: true},
+		{name: "outside dates with override", tab: confirmed, at: time.Date(2026, time.November, 2, 12, 0, 0, 0, time.UTC), override: true, wantErr: true},
+		{name: "pending tab with override", tab: pending, at: at(14, 12, 0), override: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.tab.ValidateOrderTime(tt.at, tt.override)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateOrderTime() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
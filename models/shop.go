@@ -1,17 +1,17 @@
 package models
 
-import "time"
+import (
+	"time"
 
-type PaymentMethod string
-
-const (
-	PaymentMethodInPerson    PaymentMethod = "in person"
-	PaymentMethodChartstring PaymentMethod = "chartstring"
+	"github.com/willtrojniak/TabAppBackend/services"
 )
 
+// Timezone used for shop date and time calculations unless configured in the shop settings
+const DefaultTimezone = "America/New_York"
+
 type ShopUpdate struct {
 	Name           string   `json:"name" db:"name" validate:"required,min=1,max=64"`
-	PaymentMethods []string `json:"payment_methods" db:"payment_methods" validate:"dive,oneof='in person' 'chartstring'"`
+	PaymentMethods []string `json:"payment_methods" db:"payment_methods" validate:"dive,paymentmethod"`
 }
 
 type ShopCreate struct {
@@ -26,9 +26,11 @@ type ShopOverview struct {
 
 type Shop struct {
 	ShopOverview
-	Locations []Location `json:"locations" db:"locations"`
-	Users     []ShopUser `json:"users" db:"users"`
+	Locations          []Location          `json:"locations" db:"locations"`
+	Users              []ShopUser          `json:"users" db:"users"`
+	ChartstringFormats []ChartstringFormat `json:"chartstring_formats" db:"chartstring_formats"` // Empty value indicates the default format is accepted
 	ShopSlackData
+	ShopSettings
 }
 
 type GetShopsQueryParams struct {
@@ -66,6 +68,20 @@ type Location struct {
 	LocationUpdate
 }
 
+func (shop *Shop) Location() *time.Location {
+	return shop.ShopSettings.Location()
+}
+
+// The current time in the shop's timezone
+func (shop *Shop) Now() time.Time {
+	return time.Now().In(shop.Location())
+}
+
+// The current date in the shop's timezone
+func (shop *Shop) Today() Date {
+	return DateOf(shop.Now())
+}
+
 func (shop *Shop) ConfirmedUsers() []*User {
 	var users []*User
 	for _, u := range shop.Users {
@@ -87,3 +103,47 @@ type ShopSlackDataUpdate struct {
 	TabRequestSlackChannel     string `json:"tab_request_slack_channel" db:"tab_request_slack_channel" validate:"max=64"`           // Empty value indicates disabled
 	TabBillReceiptSlackChannel string `json:"tab_bill_receipt_slack_channel" db:"tab_bill_receipt_slack_channel" validate:"max=64"` // Empty value indicates disabled
 }
+
+type ShopSettings struct {
+	ShopSettingsUpdate
+}
+
+type ShopSettingsUpdate struct {
+	Timezone     string   `json:"timezone" db:"timezone" validate:"required,timezone"`
+	Currency     Currency `json:"currency" db:"currency" validate:"required,iso4217"`
+	ContactEmail string   `json:"contact_email" db:"contact_email" validate:"omitempty,email,max=64"`
+	ContactPhone string   `json:"contact_phone" db:"contact_phone" validate:"max=32"`
+	Address      string   `json:"address" db:"address" validate:"max=255"`
+}
+
+func (s *ShopSettings) Location() *time.Location {
+	tz := s.Timezone
+	if tz == "" {
+		tz = DefaultTimezone
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Formats an amount in its own currency and minor units, or in the shop's currency if the amount has none.
+// The amount is not converted to the shop's currency.
+func (s *ShopSettings) FormatMoney(m Money) string {
+	if m.Currency == "" {
+		m.Currency = s.Currency
+	}
+	return m.String()
+}
+
+// Checks that the amounts reachable through v, such as those of a request, are in the shop's currency,
+// and gives the shop's currency to those given without one
+func (s *ShopSettings) ApplyCurrency(v any) error {
+	err := CheckCurrency(v, s.Currency)
+	if err != nil {
+		return services.NewValidationServiceError(err, "Amounts must be in the shop's currency")
+	}
+	SetCurrency(v, s.Currency)
+	return nil
+}
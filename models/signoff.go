@@ -0,0 +1,69 @@
+package models
+
+import "time"
+
+type BillSignoffStatus string
+
+const (
+	BILL_SIGNOFF_PENDING  BillSignoffStatus = "pending"
+	BILL_SIGNOFF_APPROVED BillSignoffStatus = "approved"
+	BILL_SIGNOFF_DISPUTED BillSignoffStatus = "disputed"
+)
+
+type BillStatus string
+
+const (
+	BILL_STATUS_OPEN     BillStatus = "open"
+	BILL_STATUS_CLOSED   BillStatus = "closed" // Awaiting sign off by the tab owner
+	BILL_STATUS_DISPUTED BillStatus = "disputed"
+	BILL_STATUS_APPROVED BillStatus = "approved"
+	BILL_STATUS_PAID     BillStatus = "paid"
+)
+
+type BillCommentCreate struct {
+	Body string `json:"body" db:"body" validate:"required,min=1,max=1000"`
+}
+
+type BillComment struct {
+	BillCommentCreate
+	Id        int       `json:"id" db:"id"`
+	BillId    int       `json:"bill_id" db:"bill_id"`
+	UserId    *string   `json:"user_id" db:"user_id"` // Nil value indicates the user was deleted
+	UserName  *string   `json:"user_name" db:"user_name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type BillDisputeResolve struct {
+	Adjustments []BillAdjustmentCreate `json:"adjustments" db:"adjustments" validate:"max=16,dive"` // Empty value indicates the bill stands as charged
+	Comment     string                 `json:"comment" db:"comment" validate:"required,min=3,max=1000"`
+}
+
+// Derives the stage of the bill's lifecycle, open -> closed -> approved -> paid, with disputes
+// returning to closed once resolved
+func (b *BillOverview) Status() BillStatus {
+	switch {
+	case b.IsPaid:
+		return BILL_STATUS_PAID
+	case !b.IsClosed:
+		return BILL_STATUS_OPEN
+	case b.SignoffStatus == BILL_SIGNOFF_APPROVED:
+		return BILL_STATUS_APPROVED
+	case b.SignoffStatus == BILL_SIGNOFF_DISPUTED:
+		return BILL_STATUS_DISPUTED
+	default:
+		return BILL_STATUS_CLOSED
+	}
+}
+
+// Whether bills of tabs paid with the method must be approved by the tab owner before they are charged,
+// which is the case for methods charged by journal
+func RequiresSignoff(method string) bool {
+	t, ok := GetPaymentMethodType(method)
+	return ok && t.Details.Format == PAYMENT_DETAILS_FORMAT_CHARTSTRING
+}
+
+// Whether the bill may be charged to the payment details of a tab paid with the method, which for methods
+// requiring sign off is once the tab owner has approved it
+func (b *BillOverview) IsChargeable(method string) bool {
+	return !RequiresSignoff(method) || b.SignoffStatus == BILL_SIGNOFF_APPROVED
+}
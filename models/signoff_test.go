@@ -0,0 +1,49 @@
+package models
+
+import "testing"
+
+func TestBillStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		bill BillOverview
+		want BillStatus
+	}{
+		{name: "open", bill: BillOverview{SignoffStatus: BILL_SIGNOFF_PENDING}, want: BILL_STATUS_OPEN},
+		{name: "closed", bill: BillOverview{IsClosed: true, SignoffStatus: BILL_SIGNOFF_PENDING}, want: BILL_STATUS_CLOSED},
+		{name: "approved", bill: BillOverview{IsClosed: true, SignoffStatus: BILL_SIGNOFF_APPROVED}, want: BILL_STATUS_APPROVED},
+		{name: "disputed", bill: BillOverview{IsClosed: true, SignoffStatus: BILL_SIGNOFF_DISPUTED}, want: BILL_STATUS_DISPUTED},
+		{name: "paid", bill: BillOverview{IsPaid: true, IsClosed: true, SignoffStatus: BILL_SIGNOFF_APPROVED}, want: BILL_STATUS_PAID},
+		{name: "paid without sign off", bill: BillOverview{IsPaid: true, IsClosed: true, SignoffStatus: BILL_SIGNOFF_PENDING}, want: BILL_STATUS_PAID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.bill.Status(); got != tt.want {
+				t.Errorf("Status() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBillIsChargeable(t *testing.T) {
+	tests := []struct {
+		name   string
+		method PaymentMethod
+		status BillSignoffStatus
+		want   bool
+	}{
+		{name: "in person pending", method: PaymentMethodInPerson, status: BILL_SIGNOFF_PENDING, want: true},
+		{name: "chartstring pending", method: PaymentMethodChartstring, status: BILL_SIGNOFF_PENDING},
+		{name: "chartstring disputed", method: PaymentMethodChartstring, status: BILL_SIGNOFF_DISPUTED},
+		{name: "chartstring approved", method: PaymentMethodChartstring, status: BILL_SIGNOFF_APPROVED, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bill := BillOverview{IsClosed: true, SignoffStatus: tt.status}
+			if got := bill.IsChargeable(string(tt.method)); got != tt.want {
+				t.Errorf("IsChargeable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
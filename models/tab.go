@@ -1,12 +1,12 @@
 package models
 
 import (
-	"log"
+	"errors"
 	"reflect"
-	"regexp"
 	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/willtrojniak/TabAppBackend/services"
 )
 
 type TabStatus int
@@ -30,30 +30,108 @@ func (s TabStatus) String() string {
 	}
 }
 
+type ScheduleViolation string
+
+const (
+	SCHEDULE_VIOLATION_NONE        ScheduleViolation = ""
+	SCHEDULE_VIOLATION_STATUS      ScheduleViolation = "tab_not_confirmed"
+	SCHEDULE_VIOLATION_DATE_RANGE  ScheduleViolation = "outside_date_range"
+	SCHEDULE_VIOLATION_DAY_OF_WEEK ScheduleViolation = "inactive_day_of_week"
+	SCHEDULE_VIOLATION_DAILY_HOURS ScheduleViolation = "outside_daily_hours"
+)
+
+const (
+	TAB_VERIFICATION_SPECIFY = "specify"
+	TAB_VERIFICATION_VOUCHER = "voucher"
+	TAB_VERIFICATION_EMAIL   = "email"
+)
+
 type OrderCreate struct {
 	Id       int  `json:"id" db:"id" validate:"required,gte=1"`
 	Quantity *int `json:"quantity" db:"quantity" validate:"required,gte=0"`
 }
 
+type SubstitutionOrderCreate struct {
+	OrderCreate
+	SubstitutionGroupId int `json:"substitution_group_id" db:"substitution_group_id" validate:"required,gte=1"`
+}
+
 type ItemOrderCreate struct {
 	OrderCreate
-	Variants []OrderCreate `json:"variants" db:"variants" validate:"required,dive"`
+	Variants      []OrderCreate             `json:"variants" db:"variants" validate:"required,dive"`
+	Addons        []OrderCreate             `json:"addons" db:"addons" validate:"dive"`
+	Substitutions []SubstitutionOrderCreate `json:"substitutions" db:"substitutions" validate:"dive"`
+}
+
+// Checks that no addon, and no substitution group, is ordered more times than the item it is ordered with
+func ItemOrderCreateStructLevelValidation(sl validator.StructLevel) {
+	data := sl.Current().Interface().(ItemOrderCreate)
+	if data.Quantity == nil {
+		return
+	}
+
+	for _, a := range data.Addons {
+		if a.Quantity != nil && *a.Quantity > *data.Quantity {
+			field, _ := reflect.ValueOf(data).Type().FieldByName("Addons")
+			tag, ok := field.Tag.Lookup("json")
+			if !ok {
+				tag = field.Name
+			}
+			sl.ReportError(data.Addons, tag, field.Name, "ltefield", "quantity")
+			break
+		}
+	}
+
+	groupQuantities := make(map[int]int)
+	for _, s := range data.Substitutions {
+		if s.Quantity != nil {
+			groupQuantities[s.SubstitutionGroupId] += *s.Quantity
+		}
+	}
+	for _, quantity := range groupQuantities {
+		if quantity > *data.Quantity {
+			field, _ := reflect.ValueOf(data).Type().FieldByName("Substitutions")
+			tag, ok := field.Tag.Lookup("json")
+			if !ok {
+				tag = field.Name
+			}
+			sl.ReportError(data.Substitutions, tag, field.Name, "ltefield", "quantity")
+			break
+		}
+	}
 }
 
 type BillOrderCreate struct {
-	Items []ItemOrderCreate `json:"items" db:"items" validate:"required,dive"`
+	Items            []ItemOrderCreate `json:"items" db:"items" validate:"required,dive"`
+	LocationId       int               `json:"location_id" db:"location_id" validate:"required,gte=1"`
+	ScheduleOverride bool              `json:"schedule_override" db:"schedule_override"` // Allows managers to place orders outside of the tab's schedule
+	OrderedByName    *string           `json:"ordered_by_name" db:"ordered_by_name" validate:"omitempty,min=1,max=64"`
+	OrderedByEmail   *string           `json:"ordered_by_email" db:"ordered_by_email" validate:"omitempty,email,max=255"`
+	VoucherCode      *string           `json:"voucher_code" db:"voucher_code" validate:"omitempty,min=1,max=16"`
 }
 
 type BillOverview struct {
 	Id        int  `json:"id" db:"id" validate:"required,gte=1"`
 	StartDate Date `json:"start_date" db:"start_date" validate:"required"`
 	EndDate   Date `json:"end_date" db:"end_date" validate:"required"`
-	IsPaid    bool `json:"is_paid" db:"is_paid" validate:"required"`
+	IsPaid    bool `json:"is_paid" db:"is_paid" validate:"required"` // Set once the bill's payments cover its total
+	IsClosed  bool `json:"is_closed" db:"is_closed"`                 // Closed bills no longer accept orders
+
+	SignoffStatus BillSignoffStatus `json:"signoff_status" db:"signoff_status"`
+	SignedOffAt   *time.Time        `json:"signed_off_at" db:"signed_off_at"` // Nil value indicates the owner has not approved or disputed the bill
 }
 
 type Bill struct {
 	BillOverview
-	Items []ItemOrder `json:"items" db:"items" validate:"required"`
+	Items           []ItemOrder      `json:"items" db:"items" validate:"required"`
+	Voids           []OrderVoid      `json:"voids" db:"voids"`
+	Adjustments     []BillAdjustment `json:"adjustments" db:"adjustments"`
+	Payments        []BillPayment    `json:"payments" db:"payments"`
+	AmountPaid      Money            `json:"amount_paid" db:"amount_paid"` // Excludes reversed payments
+	PaymentStatus   PaymentStatus    `json:"payment_status" db:"payment_status"`
+	Status          BillStatus       `json:"status" db:"status"`
+	Allocations     []BillAllocation `json:"allocations" db:"allocations"`             // Nil value indicates the tab has no allocations, or fixed allocations exceed the total
+	JournalExportId *int             `json:"journal_export_id" db:"journal_export_id"` // Nil value indicates the bill has not been posted to the journal
 }
 
 /*
@@ -90,23 +168,29 @@ type Bill struct {
 		}
 */
 type TabBase struct {
-	PaymentMethod       string  `json:"payment_method" db:"payment_method" validate:"required,oneof='in person' 'chartstring'"`
-	Organization        string  `json:"organization" db:"organization" validate:"required,min=3,max=64"`
-	DisplayName         string  `json:"display_name" db:"display_name" validate:"required,min=3,max=64"`
-	StartDate           Date    `json:"start_date" db:"start_date" validate:"required"`
-	EndDate             Date    `json:"end_date" db:"end_date" validate:"required"`
-	DailyStartTime      Time    `json:"daily_start_time" db:"daily_start_time" validate:"required"`
-	DailyEndTime        Time    `json:"daily_end_time" db:"daily_end_time" validate:"required"`
-	ActiveDaysOfWk      int8    `json:"active_days_of_wk" db:"active_days_of_wk"`
-	DollarLimitPerOrder float32 `json:"dollar_limit_per_order" db:"dollar_limit_per_order" validate:"gte=0"`
-	VerificationMethod  string  `json:"verification_method" db:"verification_method" validate:"required,oneof='specify' 'voucher' 'email'"`
-	PaymentDetails      string  `json:"payment_details" db:"payment_details"`
-	BillingIntervalDays int     `json:"billing_interval_days" db:"billing_interval_days" validate:"gte=1,lte=365"`
+	PaymentMethod       string          `json:"payment_method" db:"payment_method" validate:"required,paymentmethod"`
+	Organization        string          `json:"organization" db:"organization" validate:"required,min=3,max=64"`
+	DisplayName         string          `json:"display_name" db:"display_name" validate:"required,min=3,max=64"`
+	StartDate           Date            `json:"start_date" db:"start_date" validate:"required"`
+	EndDate             Date            `json:"end_date" db:"end_date" validate:"required"`
+	DailyStartTime      Time            `json:"daily_start_time" db:"daily_start_time" validate:"required"`
+	DailyEndTime        Time            `json:"daily_end_time" db:"daily_end_time" validate:"required"`
+	ActiveDaysOfWk      int8            `json:"active_days_of_wk" db:"active_days_of_wk"`
+	DollarLimitPerOrder Money           `json:"dollar_limit_per_order" db:"dollar_limit_per_order" validate:"gte=0"`         // Zero value indicates no limit
+	TotalDollarLimit    *Money          `json:"total_dollar_limit" db:"total_dollar_limit" validate:"omitempty,gte=0"`       // Nil value indicates no limit
+	DollarLimitPerBill  *Money          `json:"dollar_limit_per_bill" db:"dollar_limit_per_bill" validate:"omitempty,gte=0"` // Nil value indicates no limit
+	VerificationMethod  string          `json:"verification_method" db:"verification_method" validate:"required,oneof='specify' 'voucher' 'email'"`
+	PaymentDetails      string          `json:"payment_details" db:"payment_details"`
+	BillingIntervalDays int             `json:"billing_interval_days" db:"billing_interval_days" validate:"gte=1,lte=365"`
+	BillingSchedule     BillingSchedule `json:"billing_schedule" db:"billing_schedule" validate:"omitempty,oneof=interval weekly monthly term"` // Empty value indicates interval
+	BillingAnchorDay    int             `json:"billing_anchor_day" db:"billing_anchor_day" validate:"gte=0,lte=28"`                             // Day of the week for weekly schedules, day of the month for monthly schedules
+	BillingTermEnds     []Date          `json:"billing_term_ends" db:"billing_term_ends" validate:"max=12"`                                     // Last days of the terms billed separately by term schedules
 }
 
 type TabUpdates struct {
 	TabBase
-	Locations []Location `json:"locations" db:"locations"`
+	Locations   []Location      `json:"locations" db:"locations"`
+	Allocations []TabAllocation `json:"allocations" db:"allocations"`
 }
 
 type tabUpdateBase struct {
@@ -114,8 +198,9 @@ type tabUpdateBase struct {
 
 type TabUpdate struct {
 	TabBase
-	VerificationList []string `json:"verification_list" db:"verification_list" validate:"required,dive,required,email"`
-	LocationIds      []uint   `json:"location_ids" db:"location_ids" validate:"required,dive,gte=1,min=1"`
+	VerificationList []string              `json:"verification_list" db:"verification_list" validate:"required,dive,required,email"`
+	LocationIds      []uint                `json:"location_ids" db:"location_ids" validate:"required,dive,gte=1,min=1"`
+	Allocations      []TabAllocationCreate `json:"allocations" db:"allocations" validate:"max=10,dive"` // Empty value indicates bills are charged to the payment details in full
 }
 
 type TabCreate struct {
@@ -126,86 +211,322 @@ type TabCreate struct {
 
 type TabOverview struct {
 	TabBase
-	Id               int         `json:"id" db:"id" validate:"required,gte=1"`
-	ShopId           int         `json:"shop_id" db:"shop_id" validate:"required,gte=1"`
-	OwnerId          string      `json:"owner_id" db:"owner_id" validate:"required"`
-	VerificationList []string    `json:"verification_list" db:"verification_list" validate:"required,dive,required,email"`
-	PendingUpdates   *TabUpdates `json:"pending_updates" db:"pending_updates"`
-	Status           string      `json:"status" db:"status"`
-	IsPendingBalance bool        `json:"is_pending_balance" db:"is_pending_balance"`
-	Locations        []Location  `json:"locations" db:"locations"`
+	Id               int             `json:"id" db:"id" validate:"required,gte=1"`
+	ShopId           int             `json:"shop_id" db:"shop_id" validate:"required,gte=1"`
+	OwnerId          string          `json:"owner_id" db:"owner_id" validate:"required"`
+	VerificationList []string        `json:"verification_list" db:"verification_list" validate:"required,dive,required,email"`
+	PendingUpdates   *TabUpdates     `json:"pending_updates" db:"pending_updates"`
+	Status           string          `json:"status" db:"status"`
+	IsPendingBalance bool            `json:"is_pending_balance" db:"is_pending_balance"`
+	Locations        []Location      `json:"locations" db:"locations"`
+	Allocations      []TabAllocation `json:"allocations" db:"allocations"`
 }
 
 type Tab struct {
 	TabOverview
-	Bills []Bill `json:"bills" db:"bills" validate:"required,dive"`
+	Bills      []Bill         `json:"bills" db:"bills" validate:"required,dive"`
+	Vouchers   VoucherSummary `json:"vouchers" db:"vouchers"`
+	LimitRules []TabLimitRule `json:"limit_rules" db:"limit_rules"`
 }
 
-type GetTabsQueryParams struct {
-	Limit   int
-	Offset  int
-	OwnerId *string
-	ShopId  *int
+type TabBudget struct {
+	DollarLimitPerOrder Money  `json:"dollar_limit_per_order"`
+	TotalDollarLimit    *Money `json:"total_dollar_limit"`
+	TotalSpent          Money  `json:"total_spent"`
+	TotalRemaining      *Money `json:"total_remaining"`
+	BillId              *int   `json:"bill_id"`
+	DollarLimitPerBill  *Money `json:"dollar_limit_per_bill"`
+	BillSpent           Money  `json:"bill_spent"`
+	BillRemaining       *Money `json:"bill_remaining"`
 }
 
-func (t *TabOverview) IsActiveToday() bool {
-	// FIXME: Use time zone
-	today := DateOf(time.Now())
-	td, _ := time.Parse(time.RFC3339, today.String()+"T00:00:00Z")
+type GetTabsQueryParams struct {
+	Limit       int
+	Offset      int
+	OwnerId     *string
+	ShopId      *int
+	MemberEmail *string
+}
 
+// Checks whether the tab is active on the date of the given time, ignoring daily hours.
+// The time is expected to be in the shop's timezone.
+func (t *TabOverview) IsActiveOn(at time.Time) bool {
+	date := DateOf(at)
 	return t.Status == TAB_STATUS_CONFIRMED.String() &&
-		!t.StartDate.After(today.Date) && !t.EndDate.Before(today.Date) &&
-		(t.ActiveDaysOfWk&(1<<uint(td.Weekday()))) != 0
+		!t.StartDate.After(date.Date) && !t.EndDate.Before(date.Date) &&
+		(t.ActiveDaysOfWk&(1<<uint(at.Weekday()))) != 0
+}
+
+// Evaluates the tab's date range, active days of the week, and daily hours at the given time.
+// The time is expected to be in the shop's timezone. Daily hours which end before they start run past midnight,
+// and the hours after midnight belong to the day on which they started. Daily hours which start and end at the same
+// time run all day.
+func (t *TabBase) CheckSchedule(at time.Time) ScheduleViolation {
+	timeOfDay := time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute + time.Duration(at.Second())*time.Second
+	start, end := t.DailyStartTime.Duration, t.DailyEndTime.Duration
+	overnight := end < start
+
+	day := at
+	if overnight && timeOfDay.Truncate(time.Minute) <= end {
+		day = at.AddDate(0, 0, -1)
+	}
+
+	date := DateOf(day)
+	if t.StartDate.After(date.Date) || t.EndDate.Before(date.Date) {
+		return SCHEDULE_VIOLATION_DATE_RANGE
+	}
+
+	if (t.ActiveDaysOfWk & (1 << uint(day.Weekday()))) == 0 {
+		return SCHEDULE_VIOLATION_DAY_OF_WEEK
+	}
+
+	inHours := timeOfDay >= start && timeOfDay.Truncate(time.Minute) <= end
+	if overnight {
+		inHours = timeOfDay >= start || timeOfDay.Truncate(time.Minute) <= end
+	} else if start == end {
+		inHours = true
+	}
+	if !inHours {
+		return SCHEDULE_VIOLATION_DAILY_HOURS
+	}
+
+	return SCHEDULE_VIOLATION_NONE
+}
+
+func (t *TabOverview) CheckActiveAt(at time.Time) ScheduleViolation {
+	if t.Status != TAB_STATUS_CONFIRMED.String() {
+		return SCHEDULE_VIOLATION_STATUS
+	}
+	return t.CheckSchedule(at)
+}
+
+func (t *TabOverview) IsActiveAt(at time.Time) bool {
+	return t.CheckActiveAt(at) == SCHEDULE_VIOLATION_NONE
 }
 
-func (t *TabOverview) IsActive() bool {
-	// FIXME: Use time zone
-	today := DateOf(time.Now())
-	return t.Status == TAB_STATUS_CONFIRMED.String() && !t.StartDate.After(today.Date) && !t.EndDate.Before(today.Date)
+// Checks that orders may be placed on the tab at the given time. A schedule override permits orders outside of
+// the tab's active days and daily hours, but not on a tab which is not confirmed or outside of its dates.
+func (t *TabOverview) ValidateOrderTime(at time.Time, scheduleOverride bool) error {
+	violation := t.CheckActiveAt(at)
+	if violation == SCHEDULE_VIOLATION_NONE {
+		return nil
+	}
+	if scheduleOverride && (violation == SCHEDULE_VIOLATION_DAY_OF_WEEK || violation == SCHEDULE_VIOLATION_DAILY_HOURS) {
+		return nil
+	}
+	return services.NewValidationServiceError(errors.New("Tab is not accepting orders"), services.ValidationErrors{
+		"schedule": services.ValidationError{Value: at, Error: string(violation)},
+	})
 }
 
 func TabUpdateStructLevelValidation(sl validator.StructLevel) {
 	data := sl.Current().Interface().(TabUpdate)
 
-	if data.DailyEndTime.Duration < data.DailyStartTime.Duration {
-		field, _ := reflect.ValueOf(data).Type().FieldByName("DailyEndTime")
+	if data.EndDate.Before(data.StartDate.Date) {
+		field, _ := reflect.ValueOf(data).Type().FieldByName("EndDate")
 		tag, ok := field.Tag.Lookup("json")
 		if !ok {
 			tag = field.Name
 		}
-		sl.ReportError(data.DailyEndTime, tag, field.Name, "endafterstart", "")
+		sl.ReportError(data.EndDate, tag, field.Name, "endafterstart", "")
 	}
 
-	if data.EndDate.Before(data.StartDate.Date) {
-		field, _ := reflect.ValueOf(data).Type().FieldByName("EndDate")
+	if len(data.Allocations) > 0 && !SupportsAllocations(data.PaymentMethod) {
+		field, _ := reflect.ValueOf(data).Type().FieldByName("Allocations")
 		tag, ok := field.Tag.Lookup("json")
 		if !ok {
 			tag = field.Name
 		}
-		sl.ReportError(data.EndDate, tag, field.Name, "endafterstart", "")
+		sl.ReportError(data.Allocations, tag, field.Name, "excluded_unless", "payment_method")
+	} else if !isValidAllocationSplit(data.Allocations) {
+		field, _ := reflect.ValueOf(data).Type().FieldByName("Allocations")
+		tag, ok := field.Tag.Lookup("json")
+		if !ok {
+			tag = field.Name
+		}
+		sl.ReportError(data.Allocations, tag, field.Name, "percentsum", "100")
 	}
 
-	chartstringPattern, err := regexp.Compile(`^([A-z0-9]{5})[ |-]?([A-z0-9]{5})(?:(?:-|\s)([A-z0-9]{5})|([A-z0-9]{5}))?$`)
-	if err != nil {
-		log.Fatal("Failed to compile chartstring expression")
+	if !data.IsValidBillingAnchor() {
+		field, _ := reflect.ValueOf(data).Type().FieldByName("BillingAnchorDay")
+		tag, ok := field.Tag.Lookup("json")
+		if !ok {
+			tag = field.Name
+		}
+		sl.ReportError(data.BillingAnchorDay, tag, field.Name, "anchorday", string(data.BillingSchedule))
 	}
-	if data.PaymentMethod == "chartstring" && !chartstringPattern.MatchString(data.PaymentDetails) {
-		field, _ := reflect.ValueOf(data).Type().FieldByName("PaymentDetails")
+
+	if !data.IsValidBillingTermEnds() {
+		field, _ := reflect.ValueOf(data).Type().FieldByName("BillingTermEnds")
 		tag, ok := field.Tag.Lookup("json")
 		if !ok {
 			tag = field.Name
 		}
-		sl.ReportError(data.PaymentDetails, tag, field.Name, "charstringformat", "")
+		sl.ReportError(data.BillingTermEnds, tag, field.Name, "termends", "")
 	}
 }
 
-func (b *Bill) Total() float32 {
-	var total float32
+// The total of the bill's items and adjustments
+func (b *Bill) Total() (Money, error) {
+	total, err := b.AdjustmentTotal()
+	if err != nil {
+		return Money{}, err
+	}
 	for _, item := range b.Items {
-		total += (*item.BasePrice) * float32(item.Quantity)
-		for _, variant := range item.Variants {
-			total += (*variant.Price) * float32(variant.Quantity)
+		itemTotal, err := item.Total()
+		if err != nil {
+			return Money{}, err
+		}
+		total, err = total.Add(itemTotal)
+		if err != nil {
+			return Money{}, err
+		}
+	}
+	return total, nil
+}
+
+func remaining(limit *Money, spent Money) (*Money, error) {
+	if limit == nil {
+		return nil, nil
+	}
+	r, err := limit.Sub(spent)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Reports the remaining budget of the tab, using the bill which orders placed today are recorded against as the current bill
+func (t *Tab) Budget(today Date) (TabBudget, error) {
+	var tabSpent, billSpent Money
+	for _, b := range t.Bills {
+		total, err := b.Total()
+		if err != nil {
+			return TabBudget{}, err
 		}
+		tabSpent, err = tabSpent.Add(total)
+		if err != nil {
+			return TabBudget{}, err
+		}
+	}
+
+	var billId *int
+	if b := t.CurrentBill(today); b != nil {
+		var err error
+		billId = &b.Id
+		billSpent, err = b.Total()
+		if err != nil {
+			return TabBudget{}, err
+		}
+	}
+
+	totalRemaining, err := remaining(t.TotalDollarLimit, tabSpent)
+	if err != nil {
+		return TabBudget{}, err
+	}
+	billRemaining, err := remaining(t.DollarLimitPerBill, billSpent)
+	if err != nil {
+		return TabBudget{}, err
+	}
+
+	return TabBudget{
+		DollarLimitPerOrder: t.DollarLimitPerOrder,
+		TotalDollarLimit:    t.TotalDollarLimit,
+		TotalSpent:          tabSpent,
+		TotalRemaining:      totalRemaining,
+		BillId:              billId,
+		DollarLimitPerBill:  t.DollarLimitPerBill,
+		BillSpent:           billSpent,
+		BillRemaining:       billRemaining,
+	}, nil
+}
+
+// Checks that orders may be placed at the given location
+func (t *TabOverview) ValidateLocation(locationId int) error {
+	for _, l := range t.Locations {
+		if int(l.Id) == locationId {
+			return nil
+		}
+	}
+	return services.NewValidationServiceError(errors.New("Location is not valid for tab"), services.ValidationErrors{
+		"location_id": services.ValidationError{Value: locationId, Error: "invalid"},
+	})
+}
+
+// Checks that the person placing the order is identified as required by the tab's verification method.
+// Emails are normalized to match the casing of the tab's verification list.
+func (t *TabOverview) ValidateOrderer(data *BillOrderCreate) error {
+	switch t.VerificationMethod {
+	case TAB_VERIFICATION_EMAIL:
+		if data.OrderedByEmail == nil {
+			return services.NewValidationServiceError(errors.New("Email is required to order on tab"), services.ValidationErrors{
+				"ordered_by_email": services.ValidationError{Value: nil, Error: "required"},
+			})
+		}
+	case TAB_VERIFICATION_SPECIFY:
+		if data.OrderedByName == nil {
+			return services.NewValidationServiceError(errors.New("Name is required to order on tab"), services.ValidationErrors{
+				"ordered_by_name": services.ValidationError{Value: nil, Error: "required"},
+			})
+		}
+	case TAB_VERIFICATION_VOUCHER:
+		if data.VoucherCode == nil {
+			return services.NewValidationServiceError(errors.New("Voucher is required to order on tab"), services.ValidationErrors{
+				"voucher_code": services.ValidationError{Value: nil, Error: "required"},
+			})
+		}
+	}
+
+	if data.OrderedByEmail == nil {
+		return nil
+	}
+	if email, ok := t.VerificationMember(*data.OrderedByEmail); ok {
+		data.OrderedByEmail = &email
+		return nil
+	}
+	return services.NewValidationServiceError(errors.New("Email is not on the tab's verification list"), services.ValidationErrors{
+		"ordered_by_email": services.ValidationError{Value: *data.OrderedByEmail, Error: "invalid"},
+	})
+}
+
+// Reports the limit as exceeded if the order would take spending past it, with the amount remaining as the value
+func checkLimit(errs services.ValidationErrors, key string, limit Money, spent Money, orderTotal Money) error {
+	after, err := spent.Add(orderTotal)
+	if err != nil {
+		return err
+	}
+	if after.Amount <= limit.Amount {
+		return nil
+	}
+	r, err := remaining(&limit, spent)
+	if err != nil {
+		return err
+	}
+	errs[key] = services.ValidationError{Value: r, Error: "exceeded"}
+	return nil
+}
+
+// Checks that an order totalling orderTotal can be added given the amounts already spent
+func (t *TabBase) ValidateOrderTotal(orderTotal Money, tabSpent Money, billSpent Money) error {
+	errs := make(services.ValidationErrors)
+	if !t.DollarLimitPerOrder.IsZero() && orderTotal.Amount > t.DollarLimitPerOrder.Amount {
+		errs["dollar_limit_per_order"] = services.ValidationError{Value: orderTotal, Error: "exceeded"}
+	}
+	if t.TotalDollarLimit != nil {
+		err := checkLimit(errs, "total_dollar_limit", *t.TotalDollarLimit, tabSpent, orderTotal)
+		if err != nil {
+			return err
+		}
+	}
+	if t.DollarLimitPerBill != nil {
+		err := checkLimit(errs, "dollar_limit_per_bill", *t.DollarLimitPerBill, billSpent, orderTotal)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(errs) > 0 {
+		return services.NewValidationServiceError(errors.New("Order exceeds tab limits"), errs)
 	}
-	return total
+	return nil
 }
@@ -2,12 +2,18 @@ package models
 
 import (
 	"github.com/jackc/pgx/v5/pgtype"
-	"github.com/willtrojniak/TabAppBackend/env"
 	"github.com/willtrojniak/TabAppBackend/util"
 )
 
 type Token string
 
+// The key tokens are encrypted with at rest, set on startup with SetTokenSecret
+var tokenSecret []byte
+
+func SetTokenSecret(secret []byte) {
+	tokenSecret = secret
+}
+
 func (t Token) String() string {
 	return string(t)
 }
@@ -18,7 +24,7 @@ func (t *Token) ScanText(v pgtype.Text) error {
 		return nil
 	}
 
-	token, err := util.Decrypt(v.String, []byte(env.Envs.ENCRYPT_SECRET))
+	token, err := util.Decrypt(v.String, tokenSecret)
 	if err != nil {
 		return err
 	}
@@ -30,7 +36,7 @@ func (t *Token) ScanText(v pgtype.Text) error {
 
 func (t Token) TextValue() (pgtype.Text, error) {
 	v := pgtype.Text{}
-	cipher, err := util.Encrypt([]byte(t), []byte(env.Envs.ENCRYPT_SECRET))
+	cipher, err := util.Encrypt([]byte(t), tokenSecret)
 	if err != nil {
 		return v, err
 	}
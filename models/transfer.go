@@ -0,0 +1,110 @@
+package models
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/willtrojniak/TabAppBackend/services"
+)
+
+type OrderTransferCreate struct {
+	TargetTabId    int     `json:"target_tab_id" db:"target_tab_id" validate:"required,gte=1"`
+	TargetBillId   *int    `json:"target_bill_id" db:"target_bill_id" validate:"omitempty,gte=1"` // Nil value indicates the target tab's bill covering the date of the order
+	OrderItemIds   []int   `json:"order_item_ids" db:"order_item_ids" validate:"required,min=1,unique,dive,gte=1"`
+	Note           string  `json:"note" db:"note" validate:"required,min=3,max=255"`
+	OrderedByName  *string `json:"ordered_by_name" db:"ordered_by_name" validate:"omitempty,min=1,max=64"`    // Nil value indicates the original order's name is kept
+	OrderedByEmail *string `json:"ordered_by_email" db:"ordered_by_email" validate:"omitempty,email,max=255"` // Nil value indicates the original order's email is kept
+	VoucherCode    *string `json:"voucher_code" db:"voucher_code" validate:"omitempty,min=1,max=16"`
+}
+
+// A record of order lines moved from one bill to another. The lines are removed from the source bill by the removal order
+// and added to the target bill by the target order, both placed at the time of the source order.
+type OrderTransfer struct {
+	Id             int       `json:"id" db:"id"`
+	SourceTabId    int       `json:"source_tab_id" db:"source_tab_id"`
+	SourceBillId   int       `json:"source_bill_id" db:"source_bill_id"`
+	SourceOrderId  int       `json:"source_order_id" db:"source_order_id"`
+	RemovalOrderId int       `json:"removal_order_id" db:"removal_order_id"`
+	TargetTabId    int       `json:"target_tab_id" db:"target_tab_id"`
+	TargetBillId   int       `json:"target_bill_id" db:"target_bill_id"`
+	TargetOrderId  int       `json:"target_order_id" db:"target_order_id"`
+	OrderItemIds   []int     `json:"order_item_ids" db:"order_item_ids"` // Lines of the source order which were transferred
+	Note           string    `json:"note" db:"note"`
+	StaffId        *string   `json:"staff_id" db:"staff_id"` // Nil value indicates the staff user was deleted
+	StaffName      *string   `json:"staff_name" db:"staff_name"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+// The total of the line at its captured prices
+func (l *OrderLine) Total() (Money, error) {
+	parts := []Money{l.UnitPrice.Mul(l.Quantity)}
+	for _, v := range l.Variants {
+		parts = append(parts, v.UnitPrice.Mul(v.Quantity))
+	}
+	for _, a := range l.Addons {
+		parts = append(parts, a.UnitPrice.Mul(a.Quantity))
+	}
+	for _, s := range l.Substitutions {
+		parts = append(parts, s.UnitPrice.Mul(s.Quantity))
+	}
+	return Sum(parts...)
+}
+
+// The lines of the order selected for transfer, which must be lines of an order that added to its bill and has not been voided
+func (o *Order) TransferLines(data *OrderTransferCreate) ([]OrderLine, error) {
+	if o.Type != ORDER_TYPE_ADD || o.Void != nil {
+		return nil, services.NewDataConflictServiceError(errors.New("Only orders which have not been voided may be transferred"))
+	}
+
+	lines := make([]OrderLine, 0, len(data.OrderItemIds))
+	for _, l := range o.Items {
+		if slices.Contains(data.OrderItemIds, l.Id) {
+			lines = append(lines, l)
+		}
+	}
+	if len(lines) != len(data.OrderItemIds) {
+		return nil, services.NewValidationServiceError(errors.New("Order line is not part of the order"), services.ValidationErrors{
+			"order_item_ids": services.ValidationError{Value: data.OrderItemIds, Error: "invalid"},
+		})
+	}
+	return lines, nil
+}
+
+// The order placed on the target tab by the transfer, used to validate the lines against the target tab's rules
+func (o *Order) TransferOrder(data *OrderTransferCreate, lines []OrderLine) *BillOrderCreate {
+	order := &BillOrderCreate{
+		Items:            make([]ItemOrderCreate, len(lines)),
+		ScheduleOverride: o.ScheduleOverride,
+		OrderedByName:    o.OrderedByName,
+		OrderedByEmail:   o.OrderedByEmail,
+		VoucherCode:      data.VoucherCode,
+	}
+	if o.LocationId != nil {
+		order.LocationId = *o.LocationId
+	}
+	if data.OrderedByName != nil {
+		order.OrderedByName = data.OrderedByName
+	}
+	if data.OrderedByEmail != nil {
+		order.OrderedByEmail = data.OrderedByEmail
+	}
+
+	for i, l := range lines {
+		item := ItemOrderCreate{OrderCreate: OrderCreate{Id: l.ItemId, Quantity: &l.Quantity}}
+		for _, v := range l.Variants {
+			item.Variants = append(item.Variants, OrderCreate{Id: v.VariantId, Quantity: &v.Quantity})
+		}
+		for _, a := range l.Addons {
+			item.Addons = append(item.Addons, OrderCreate{Id: a.AddonId, Quantity: &a.Quantity})
+		}
+		for _, s := range l.Substitutions {
+			item.Substitutions = append(item.Substitutions, SubstitutionOrderCreate{
+				OrderCreate:         OrderCreate{Id: s.SubstitutionId, Quantity: &s.Quantity},
+				SubstitutionGroupId: s.SubstitutionGroupId,
+			})
+		}
+		order.Items[i] = item
+	}
+	return order
+}
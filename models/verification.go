@@ -0,0 +1,96 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/willtrojniak/TabAppBackend/services"
+	"github.com/willtrojniak/TabAppBackend/util"
+)
+
+const VerificationTokenTTL = time.Minute * 5
+
+// The signed contents of a verification token
+type VerificationClaims struct {
+	ShopId    int    `json:"shop_id"`
+	TabId     int    `json:"tab_id"`
+	Email     string `json:"email"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type VerificationToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type VerificationTokenVerify struct {
+	Token string `json:"token" validate:"required,max=1024"`
+}
+
+type VerificationResult struct {
+	Tab      TabOverview `json:"tab"`
+	Email    string      `json:"email"`
+	IsActive bool        `json:"is_active"`
+}
+
+var errInvalidVerificationToken = services.NewValidationServiceError(errors.New("Invalid verification token"), services.ValidationErrors{
+	"token": services.ValidationError{Value: nil, Error: "invalid"},
+})
+
+// Creates a token for the member of the tab, signed with the secret, which expires after VerificationTokenTTL
+func NewVerificationToken(shopId int, tabId int, email string, secret []byte, now time.Time) (*VerificationToken, error) {
+	expiresAt := now.Add(VerificationTokenTTL)
+	payload, err := json.Marshal(VerificationClaims{
+		ShopId:    shopId,
+		TabId:     tabId,
+		Email:     email,
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return nil, services.NewInternalServiceError(err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return &VerificationToken{
+		Token:     encoded + "." + util.Sign([]byte(encoded), secret),
+		ExpiresAt: time.Unix(expiresAt.Unix(), 0),
+	}, nil
+}
+
+// Checks the signature and expiry of the token against the secret, returning its claims
+func ParseVerificationToken(token string, secret []byte, now time.Time) (*VerificationClaims, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok || !util.VerifySignature([]byte(encoded), signature, secret) {
+		return nil, errInvalidVerificationToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errInvalidVerificationToken
+	}
+	claims := &VerificationClaims{}
+	err = json.Unmarshal(payload, claims)
+	if err != nil {
+		return nil, errInvalidVerificationToken
+	}
+
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, services.NewValidationServiceError(errors.New("Verification token has expired"), services.ValidationErrors{
+			"token": services.ValidationError{Value: nil, Error: "expired"},
+		})
+	}
+	return claims, nil
+}
+
+// Gets the entry of the tab's verification list matching the email, ignoring case
+func (t *TabOverview) VerificationMember(email string) (string, bool) {
+	for _, e := range t.VerificationList {
+		if strings.EqualFold(e, email) {
+			return e, true
+		}
+	}
+	return "", false
+}
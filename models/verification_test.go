@@ -0,0 +1,38 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseVerificationToken(t *testing.T) {
+	now := time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC)
+	secret := []byte("secret")
+	token, err := NewVerificationToken(1, 2, "member@example.com", secret, now)
+	if err != nil {
+		t.Fatalf("NewVerificationToken() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		secret  []byte
+		now     time.Time
+		wantErr bool
+	}{
+		{name: "valid", secret: secret, now: now},
+		{name: "other secret", secret: []byte("other"), now: now, wantErr: true},
+		{name: "expired", secret: secret, now: now.Add(VerificationTokenTTL), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ParseVerificationToken(token.Token, tt.secret, tt.now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseVerificationToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (claims.ShopId != 1 || claims.TabId != 2 || claims.Email != "member@example.com") {
+				t.Errorf("ParseVerificationToken() = %+v", claims)
+			}
+		})
+	}
+}
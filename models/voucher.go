@@ -0,0 +1,70 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/willtrojniak/TabAppBackend/services"
+)
+
+const VoucherCodeLength = 10
+
+type VoucherBatchCreate struct {
+	Count     int        `json:"count" validate:"required,gte=1,lte=500"`
+	MaxUses   int        `json:"max_uses" validate:"required,gte=1,lte=1000"`
+	ValueCap  *Money     `json:"value_cap" validate:"omitempty,gte=0"` // Nil value indicates no cap on the total value of orders redeeming each voucher
+	ExpiresAt *time.Time `json:"expires_at"`                           // Nil value indicates the vouchers do not expire
+}
+
+type Voucher struct {
+	Id        int        `json:"id" db:"id"`
+	TabId     int        `json:"tab_id" db:"tab_id"`
+	Code      string     `json:"code" db:"code"`
+	MaxUses   int        `json:"max_uses" db:"max_uses"`
+	Uses      int        `json:"uses" db:"uses"`
+	Redeemed  Money      `json:"redeemed" db:"redeemed"` // Total value of the non-voided orders the voucher was redeemed on
+	ValueCap  *Money     `json:"value_cap" db:"value_cap"`
+	ExpiresAt *time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Aggregate redemption status of the vouchers issued for a tab
+type VoucherSummary struct {
+	Issued    int `json:"issued" db:"issued"`
+	Exhausted int `json:"exhausted" db:"exhausted"`
+	Uses      int `json:"uses" db:"uses"`
+	MaxUses   int `json:"max_uses" db:"max_uses"`
+}
+
+func NormalizeVoucherCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Checks that the voucher can be redeemed at the given time for an order totalling orderTotal,
+// without its redemptions exceeding the voucher's value cap
+func (v *Voucher) ValidateRedemption(orderTotal Money, at time.Time) error {
+	if v.ExpiresAt != nil && !at.Before(*v.ExpiresAt) {
+		return services.NewValidationServiceError(errors.New("Voucher has expired"), services.ValidationErrors{
+			"voucher_code": services.ValidationError{Value: v.Code, Error: "expired"},
+		})
+	}
+	if v.Uses >= v.MaxUses {
+		return services.NewValidationServiceError(errors.New("Voucher has already been redeemed"), services.ValidationErrors{
+			"voucher_code": services.ValidationError{Value: v.Code, Error: "redeemed"},
+		})
+	}
+	if v.ValueCap == nil {
+		return nil
+	}
+	redeemed, err := v.Redeemed.Add(orderTotal)
+	if err != nil {
+		return err
+	}
+	if redeemed.Amount > v.ValueCap.Amount {
+		return services.NewValidationServiceError(errors.New("Order exceeds voucher value cap"), services.ValidationErrors{
+			"voucher_code": services.ValidationError{Value: v.ValueCap, Error: "exceeded"},
+		})
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVoucherValidateRedemption(t *testing.T) {
+	now := time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC)
+	expired := now.Add(-time.Minute)
+	valueCap := NewMoney(1000, "USD")
+
+	tests := []struct {
+		name       string
+		voucher    Voucher
+		orderTotal Money
+		wantErr    bool
+	}{
+		{name: "unused", voucher: Voucher{MaxUses: 1}, orderTotal: NewMoney(500, "USD")},
+		{name: "expired", voucher: Voucher{MaxUses: 1, ExpiresAt: &expired}, orderTotal: NewMoney(500, "USD"), wantErr: true},
+		{name: "used up", voucher: Voucher{MaxUses: 2, Uses: 2}, orderTotal: NewMoney(500, "USD"), wantErr: true},
+		{name: "within cap", voucher: Voucher{MaxUses: 3, Uses: 1, Redeemed: NewMoney(400, "USD"), ValueCap: &valueCap}, orderTotal: NewMoney(600, "USD")},
+		{name: "prior redemptions exceed cap", voucher: Voucher{MaxUses: 3, Uses: 1, Redeemed: NewMoney(400, "USD"), ValueCap: &valueCap}, orderTotal: NewMoney(601, "USD"), wantErr: true},
+		{name: "mismatched currency", voucher: Voucher{MaxUses: 3, Uses: 1, Redeemed: NewMoney(400, "USD"), ValueCap: &valueCap}, orderTotal: NewMoney(1, "EUR"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.voucher.ValidateRedemption(tt.orderTotal, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRedemption() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -19,6 +19,7 @@ const (
 	SHOP_ACTION_INSTALL_SLACK         Action = "SHOP_ACTION_INSTALL_SLACK"
 	SHOP_ACTION_UNINSTALL_SLACK       Action = "SHOP_ACTION_UNINSTALL_SLACK"
 	SHOP_ACTION_UPDATE                Action = "SHOP_ACTION_UPDATE"
+	SHOP_ACTION_UPDATE_SETTINGS       Action = "SHOP_ACTION_UPDATE_SETTINGS"
 	SHOP_ACTION_DELETE                Action = "SHOP_ACTION_DELETE"
 	SHOP_ACTION_CREATE_LOCATION       Action = "SHOP_ACTION_CREATE_LOCATION"
 	SHOP_ACTION_UPDATE_LOCATION       Action = "SHOP_ACTION_UPDATE_LOCATION"
@@ -44,6 +45,8 @@ const (
 	SHOP_ACTION_CREATE_TAB            Action = "SHOP_ACTION_CREATE_TAB"
 	SHOP_ACTION_READ_SLACK_CHANNELS   Action = "SHOP_ACTION_READ_SLACK_CHANNELS"
 	SHOP_ACTION_UPDATE_SLACK_CHANNELS Action = "SHOP_ACTION_UPDATE_SLACK_CHANNELS"
+	SHOP_ACTION_READ_JOURNAL          Action = "SHOP_ACTION_READ_JOURNAL"
+	SHOP_ACTION_EXPORT_JOURNAL        Action = "SHOP_ACTION_EXPORT_JOURNAL"
 )
 
 const (
@@ -61,6 +64,7 @@ var shopAuthorizeActionFns authorizeActionMap[models.Shop] = authorizeActionMap[
 	SHOP_ACTION_INSTALL_SLACK:         func(s *models.User, t *models.Shop) bool { return s.Id == t.OwnerId },
 	SHOP_ACTION_UNINSTALL_SLACK:       func(s *models.User, t *models.Shop) bool { return s.Id == t.OwnerId },
 	SHOP_ACTION_UPDATE:                func(s *models.User, t *models.Shop) bool { return s.Id == t.OwnerId },
+	SHOP_ACTION_UPDATE_SETTINGS:       func(s *models.User, t *models.Shop) bool { return s.Id == t.OwnerId },
 	SHOP_ACTION_DELETE:                func(s *models.User, t *models.Shop) bool { return s.Id == t.OwnerId },
 	SHOP_ACTION_CREATE_LOCATION:       func(s *models.User, t *models.Shop) bool { return HasRole(s, t, ROLE_SHOP_MANAGE_LOCATIONS) },
 	SHOP_ACTION_UPDATE_LOCATION:       func(s *models.User, t *models.Shop) bool { return HasRole(s, t, ROLE_SHOP_MANAGE_LOCATIONS) },
@@ -86,6 +90,8 @@ var shopAuthorizeActionFns authorizeActionMap[models.Shop] = authorizeActionMap[
 	SHOP_ACTION_CREATE_TAB:            func(s *models.User, t *models.Shop) bool { return HasRole(s, t, ROLE_SHOP_MANAGE_TABS) },
 	SHOP_ACTION_READ_SLACK_CHANNELS:   func(s *models.User, t *models.Shop) bool { return HasRole(s, t, 0) },
 	SHOP_ACTION_UPDATE_SLACK_CHANNELS: func(s *models.User, t *models.Shop) bool { return s.Id == t.OwnerId },
+	SHOP_ACTION_READ_JOURNAL:          func(s *models.User, t *models.Shop) bool { return HasRole(s, t, ROLE_SHOP_READ_TABS) },
+	SHOP_ACTION_EXPORT_JOURNAL:        func(s *models.User, t *models.Shop) bool { return HasRole(s, t, ROLE_SHOP_MANAGE_TABS) },
 }
 
 func HasRole(s *models.User, t *models.Shop, role uint32) bool {
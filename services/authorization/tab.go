@@ -16,14 +16,31 @@ func AuthorizeTabAction(subject *models.User, target *TabTarget, action Action)
 }
 
 const (
-	TAB_ACTION_READ           Action = "TAB_ACTION_READ"
-	TAB_ACTION_REQUEST_UPDATE Action = "TAB_ACTION_REQUEST_UPDATE"
-	TAB_ACTION_UPDATE         Action = "TAB_ACTION_UPDATE"
-	TAB_ACTION_APPROVE        Action = "TAB_ACTION_APPROVE"
-	TAB_ACTION_CLOSE          Action = "TAB_ACTION_CLOSE"
-	TAB_ACTION_CLOSE_BILL     Action = "TAB_ACTION_CLOSE_BILL"
-	TAB_ACTION_ADD_ORDER      Action = "TAB_ACTION_ADD_ORDER"
-	TAB_ACTION_REMOVE_ORDER   Action = "TAB_ACTION_REMOVE_ORDER"
+	TAB_ACTION_READ              Action = "TAB_ACTION_READ"
+	TAB_ACTION_REQUEST_UPDATE    Action = "TAB_ACTION_REQUEST_UPDATE"
+	TAB_ACTION_UPDATE            Action = "TAB_ACTION_UPDATE"
+	TAB_ACTION_APPROVE           Action = "TAB_ACTION_APPROVE"
+	TAB_ACTION_CLOSE             Action = "TAB_ACTION_CLOSE"
+	TAB_ACTION_CLOSE_BILL        Action = "TAB_ACTION_CLOSE_BILL"
+	TAB_ACTION_CUT_BILL          Action = "TAB_ACTION_CUT_BILL"
+	TAB_ACTION_RECORD_PAYMENT    Action = "TAB_ACTION_RECORD_PAYMENT"
+	TAB_ACTION_REVERSE_PAYMENT   Action = "TAB_ACTION_REVERSE_PAYMENT"
+	TAB_ACTION_ADD_ORDER         Action = "TAB_ACTION_ADD_ORDER"
+	TAB_ACTION_REMOVE_ORDER      Action = "TAB_ACTION_REMOVE_ORDER"
+	TAB_ACTION_OVERRIDE_SCHEDULE Action = "TAB_ACTION_OVERRIDE_SCHEDULE"
+	TAB_ACTION_VOID_ORDER        Action = "TAB_ACTION_VOID_ORDER"
+	TAB_ACTION_VOID_PAID_ORDER   Action = "TAB_ACTION_VOID_PAID_ORDER"
+	TAB_ACTION_CREATE_VOUCHERS   Action = "TAB_ACTION_CREATE_VOUCHERS"
+	TAB_ACTION_GET_VERIFICATION  Action = "TAB_ACTION_GET_VERIFICATION"
+	TAB_ACTION_VERIFY_MEMBER     Action = "TAB_ACTION_VERIFY_MEMBER"
+	TAB_ACTION_READ_AS_MEMBER    Action = "TAB_ACTION_READ_AS_MEMBER"
+	TAB_ACTION_SET_LIMIT_RULES   Action = "TAB_ACTION_SET_LIMIT_RULES"
+	TAB_ACTION_PAY_ONLINE        Action = "TAB_ACTION_PAY_ONLINE"
+	TAB_ACTION_ADJUST_BILL       Action = "TAB_ACTION_ADJUST_BILL"
+	TAB_ACTION_SIGNOFF_BILL      Action = "TAB_ACTION_SIGNOFF_BILL"
+	TAB_ACTION_RESOLVE_DISPUTE   Action = "TAB_ACTION_RESOLVE_DISPUTE"
+	TAB_ACTION_COMMENT_BILL      Action = "TAB_ACTION_COMMENT_BILL"
+	TAB_ACTION_TRANSFER_ORDER    Action = "TAB_ACTION_TRANSFER_ORDER"
 )
 
 var tabAuthorizeActionFns authorizeActionMap[TabTarget] = authorizeActionMap[TabTarget]{
@@ -39,10 +56,44 @@ var tabAuthorizeActionFns authorizeActionMap[TabTarget] = authorizeActionMap[Tab
 	TAB_ACTION_APPROVE:    func(s *models.User, t *TabTarget) bool { return HasRole(s, t.Shop, ROLE_SHOP_MANAGE_TABS) },
 	TAB_ACTION_CLOSE:      func(s *models.User, t *TabTarget) bool { return HasRole(s, t.Shop, ROLE_SHOP_MANAGE_TABS) },
 	TAB_ACTION_CLOSE_BILL: func(s *models.User, t *TabTarget) bool { return HasRole(s, t.Shop, ROLE_SHOP_MANAGE_ORDERS) },
-	TAB_ACTION_ADD_ORDER: func(s *models.User, t *TabTarget) bool {
-		return (HasRole(s, t.Shop, ROLE_SHOP_MANAGE_ORDERS) && t.Tab.IsActive()) || HasRole(s, t.Shop, ROLE_SHOP_MANAGE_ORDERS|ROLE_SHOP_MANAGE_TABS)
+	TAB_ACTION_CUT_BILL:   func(s *models.User, t *TabTarget) bool { return HasRole(s, t.Shop, ROLE_SHOP_MANAGE_TABS) },
+	TAB_ACTION_RECORD_PAYMENT: func(s *models.User, t *TabTarget) bool {
+		return HasRole(s, t.Shop, ROLE_SHOP_MANAGE_ORDERS)
 	},
-	TAB_ACTION_REMOVE_ORDER: func(s *models.User, t *TabTarget) bool {
-		return (HasRole(s, t.Shop, ROLE_SHOP_MANAGE_ORDERS) && t.Tab.IsActive()) || HasRole(s, t.Shop, ROLE_SHOP_MANAGE_ORDERS|ROLE_SHOP_MANAGE_TABS)
+	TAB_ACTION_REVERSE_PAYMENT: func(s *models.User, t *TabTarget) bool {
+		return HasRole(s, t.Shop, ROLE_SHOP_MANAGE_ORDERS|ROLE_SHOP_MANAGE_TABS)
 	},
+	// Whether the tab is accepting orders is checked by Tab.ValidateOrderTime, which reports why it is not
+	TAB_ACTION_ADD_ORDER:    func(s *models.User, t *TabTarget) bool { return HasRole(s, t.Shop, ROLE_SHOP_MANAGE_ORDERS) },
+	TAB_ACTION_REMOVE_ORDER: func(s *models.User, t *TabTarget) bool { return HasRole(s, t.Shop, ROLE_SHOP_MANAGE_ORDERS) },
+	TAB_ACTION_OVERRIDE_SCHEDULE: func(s *models.User, t *TabTarget) bool {
+		return HasRole(s, t.Shop, ROLE_SHOP_MANAGE_ORDERS|ROLE_SHOP_MANAGE_TABS)
+	},
+	TAB_ACTION_VOID_ORDER: func(s *models.User, t *TabTarget) bool { return HasRole(s, t.Shop, ROLE_SHOP_MANAGE_ORDERS) },
+	TAB_ACTION_VOID_PAID_ORDER: func(s *models.User, t *TabTarget) bool {
+		return HasRole(s, t.Shop, ROLE_SHOP_MANAGE_ORDERS|ROLE_SHOP_MANAGE_TABS)
+	},
+	TAB_ACTION_CREATE_VOUCHERS: func(s *models.User, t *TabTarget) bool { return HasRole(s, t.Shop, ROLE_SHOP_MANAGE_TABS) },
+	TAB_ACTION_GET_VERIFICATION: func(s *models.User, t *TabTarget) bool {
+		_, isMember := t.Tab.VerificationMember(s.Email)
+		return isMember && t.Tab.VerificationMethod == models.TAB_VERIFICATION_EMAIL
+	},
+	TAB_ACTION_VERIFY_MEMBER: func(s *models.User, t *TabTarget) bool { return HasRole(s, t.Shop, ROLE_SHOP_MANAGE_ORDERS) },
+	TAB_ACTION_READ_AS_MEMBER: func(s *models.User, t *TabTarget) bool {
+		_, isMember := t.Tab.VerificationMember(s.Email)
+		return isMember && t.Tab.Status != models.TAB_STATUS_PENDING.String()
+	},
+	TAB_ACTION_SET_LIMIT_RULES: func(s *models.User, t *TabTarget) bool { return HasRole(s, t.Shop, ROLE_SHOP_MANAGE_TABS) },
+	TAB_ACTION_PAY_ONLINE: func(s *models.User, t *TabTarget) bool {
+		return s.Id == t.Tab.OwnerId
+	},
+	TAB_ACTION_ADJUST_BILL: func(s *models.User, t *TabTarget) bool { return HasRole(s, t.Shop, ROLE_SHOP_MANAGE_ORDERS) },
+	TAB_ACTION_SIGNOFF_BILL: func(s *models.User, t *TabTarget) bool {
+		return s.Id == t.Tab.OwnerId
+	},
+	TAB_ACTION_RESOLVE_DISPUTE: func(s *models.User, t *TabTarget) bool { return HasRole(s, t.Shop, ROLE_SHOP_MANAGE_TABS) },
+	TAB_ACTION_COMMENT_BILL: func(s *models.User, t *TabTarget) bool {
+		return s.Id == t.Tab.OwnerId || HasRole(s, t.Shop, ROLE_SHOP_MANAGE_TABS)
+	},
+	TAB_ACTION_TRANSFER_ORDER: func(s *models.User, t *TabTarget) bool { return HasRole(s, t.Shop, ROLE_SHOP_MANAGE_ORDERS) },
 }
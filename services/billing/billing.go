@@ -0,0 +1,86 @@
+package billing
+
+import (
+	"context"
+
+	"github.com/willtrojniak/TabAppBackend/db"
+	"github.com/willtrojniak/TabAppBackend/models"
+	"github.com/willtrojniak/TabAppBackend/services/events"
+)
+
+type BillingHandler struct {
+	store      *db.PgxStore
+	dispatcher *events.EventDispatcher
+}
+
+func NewBillingHandler(store *db.PgxStore, dispatcher *events.EventDispatcher) *BillingHandler {
+	return &BillingHandler{
+		store:      store,
+		dispatcher: dispatcher,
+	}
+}
+
+// Closes the shop's bills whose period has ended and creates the upcoming billing periods of its confirmed tabs
+func (bh *BillingHandler) RunShopBilling(ctx context.Context, shopId int) error {
+	return db.WithTx(ctx, bh.store, func(pq *db.PgxQueries) error {
+		shop, err := pq.GetShopById(ctx, shopId)
+		if err != nil {
+			return err
+		}
+		today := shop.Today()
+
+		settled, err := pq.CloseElapsedBills(ctx, shopId, today)
+		if err != nil {
+			return err
+		}
+		err = DispatchBillsPaid(ctx, pq, bh.dispatcher, shop, settled)
+		if err != nil {
+			return err
+		}
+
+		query := models.GetTabsQueryParams{ShopId: &shopId}
+		tabs, err := pq.GetTabs(ctx, &query)
+		if err != nil {
+			return err
+		}
+
+		for _, tab := range tabs {
+			if tab.Status != models.TAB_STATUS_CONFIRMED.String() {
+				continue
+			}
+			err = pq.EnsureBillingPeriods(ctx, &tab, today)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Notifies the tab owners of bills which have just been paid in full
+func DispatchBillsPaid(ctx context.Context, pq *db.PgxQueries, dispatcher *events.EventDispatcher, shop *models.Shop, bills []models.SettledBill) error {
+	for _, settled := range bills {
+		tab, err := pq.GetTabById(ctx, int(shop.Id), settled.TabId)
+		if err != nil {
+			return err
+		}
+
+		var bill *models.Bill
+		for i := range tab.Bills {
+			if tab.Bills[i].Id == settled.BillId {
+				bill = &tab.Bills[i]
+			}
+		}
+		if bill == nil {
+			continue
+		}
+
+		owner, err := pq.GetUser(ctx, tab.OwnerId)
+		if err != nil {
+			return err
+		}
+
+		events.Dispatch(dispatcher, events.TabBillPaidEvent{Shop: shop, Tab: tab, Bill: bill, TabOwner: owner})
+	}
+	return nil
+}
@@ -35,7 +35,43 @@ type TabBillPaidEvent struct {
 	Shop     *models.Shop
 }
 
+type TabBillApprovedEvent struct {
+	Bill     *models.Bill
+	Tab      *models.Tab
+	TabOwner *models.User
+	Shop     *models.Shop
+}
+
+type TabBillDisputedEvent struct {
+	Bill     *models.Bill
+	Comment  *models.BillComment
+	Tab      *models.Tab
+	TabOwner *models.User
+	Shop     *models.Shop
+}
+
+type TabBillDisputeResolvedEvent struct {
+	Bill     *models.Bill
+	Comment  *models.BillComment
+	Tab      *models.Tab
+	TabOwner *models.User
+	Shop     *models.Shop
+}
+
+type OrderVoidedEvent struct {
+	Order *models.Order
+	Bill  *models.Bill
+	Tab   *models.Tab
+	Shop  *models.Shop
+}
+
 type DailyTabReportEvent struct {
 	Shop *models.Shop
 	Tabs []models.TabOverview
 }
+
+type JournalExportEvent struct {
+	Shop     *models.Shop
+	Settings *models.JournalSettings
+	Export   *models.JournalExport
+}
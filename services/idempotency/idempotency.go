@@ -0,0 +1,202 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/willtrojniak/TabAppBackend/cache"
+	"github.com/willtrojniak/TabAppBackend/services"
+	"github.com/willtrojniak/TabAppBackend/services/sessions"
+)
+
+const (
+	idempotency_header = "Idempotency-Key"
+	replayed_header    = "Idempotent-Replayed"
+	key_prefix         = "idempotency"
+	max_key_length     = 255
+	max_body_bytes     = 1 << 20         // Upper bound on the size of a request body buffered for its fingerprint
+	pending_ttl        = time.Minute * 5 // Upper bound on how long an in-flight request holds its key
+)
+
+// A stored request, the response fields are only set once the request has completed
+type record struct {
+	Fingerprint string
+	Complete    bool
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+type Handler struct {
+	logger      *slog.Logger
+	store       cache.Cache
+	ttl         time.Duration
+	handleError services.HTTPErrorHandler
+}
+
+func New(store cache.Cache, ttl time.Duration, h services.HTTPErrorHandler, logger *slog.Logger) *Handler {
+	return &Handler{
+		logger:      logger,
+		store:       store,
+		ttl:         ttl,
+		handleError: h,
+	}
+}
+
+// Replays the stored response for requests which repeat the Idempotency-Key header of an earlier request.
+// Requests without the header are passed through unchanged.
+func (h *Handler) WithIdempotencyKey(next func(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession)) func(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	return func(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+		key := r.Header.Get(idempotency_header)
+		if key == "" {
+			next(w, r, session)
+			return
+		}
+		if len(key) > max_key_length {
+			h.handleError(w, services.NewValidationServiceError(errors.New("Invalid idempotency key"), services.ValidationErrors{
+				idempotency_header: services.ValidationError{Value: key, Error: "max"},
+			}))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, max_body_bytes))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				h.handleError(w, services.NewServiceError(errors.New("Request body too large"), http.StatusRequestEntityTooLarge, nil))
+				return
+			}
+			h.handleError(w, services.NewValidationServiceError(err, nil))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256(body)
+		fingerprint := hex.EncodeToString(sum[:])
+		// Keys are scoped to the user and endpoint so that clients cannot collide with each other
+		storeKey := fmt.Sprintf("%s:%s:%s:%s:%s", key_prefix, session.UserId, r.Method, r.URL.Path, key)
+
+		claimed, err := h.claim(r.Context(), storeKey, fingerprint)
+		if err != nil {
+			h.handleError(w, err)
+			return
+		}
+		if !claimed {
+			h.replay(w, r, storeKey, fingerprint)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next(recorder, r, session)
+
+		// Server errors are not stored so that the request can be retried
+		if recorder.statusCode >= http.StatusInternalServerError {
+			err = h.store.Delete(context.Background(), storeKey)
+			if err != nil {
+				h.logger.Warn("Failed to release idempotency key", "key", storeKey, "err", err)
+			}
+			return
+		}
+
+		err = h.save(context.Background(), storeKey, &record{
+			Fingerprint: fingerprint,
+			Complete:    true,
+			StatusCode:  recorder.statusCode,
+			ContentType: recorder.Header().Get("Content-Type"),
+			Body:        recorder.body.Bytes(),
+		})
+		if err != nil {
+			h.logger.Warn("Failed to store idempotent response", "key", storeKey, "err", err)
+		}
+	}
+}
+
+// Reserves the key for this request, returning false if the key is already in use
+func (h *Handler) claim(ctx context.Context, storeKey string, fingerprint string) (bool, error) {
+	data, err := json.Marshal(record{Fingerprint: fingerprint})
+	if err != nil {
+		return false, services.NewInternalServiceError(err)
+	}
+
+	claimed, err := h.store.SetNX(ctx, storeKey, data, pending_ttl)
+	if err != nil {
+		return false, services.NewInternalServiceError(err)
+	}
+	return claimed, nil
+}
+
+func (h *Handler) replay(w http.ResponseWriter, r *http.Request, storeKey string, fingerprint string) {
+	data, err := h.store.Get(r.Context(), storeKey)
+	if err != nil {
+		if errors.Is(err, cache.ErrNotFound) {
+			// The original request failed or expired between the claim and the lookup
+			h.handleError(w, services.NewDataConflictServiceError(errors.New("Request with idempotency key is in progress")))
+			return
+		}
+		h.handleError(w, services.NewInternalServiceError(err))
+		return
+	}
+
+	var stored record
+	err = json.Unmarshal(data, &stored)
+	if err != nil {
+		h.handleError(w, services.NewInternalServiceError(err))
+		return
+	}
+
+	if stored.Fingerprint != fingerprint {
+		h.handleError(w, services.NewServiceError(errors.New("Idempotency key reused with a different request body"), http.StatusUnprocessableEntity, nil))
+		return
+	}
+	if !stored.Complete {
+		h.handleError(w, services.NewDataConflictServiceError(errors.New("Request with idempotency key is in progress")))
+		return
+	}
+
+	h.logger.Debug("Replaying idempotent response", "key", storeKey)
+	if stored.ContentType != "" {
+		w.Header().Set("Content-Type", stored.ContentType)
+	}
+	w.Header().Set(replayed_header, "true")
+	w.WriteHeader(stored.StatusCode)
+	w.Write(stored.Body)
+}
+
+func (h *Handler) save(ctx context.Context, storeKey string, rec *record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return h.store.Set(ctx, storeKey, data, h.ttl)
+}
+
+// Passes the response through to the client while keeping a copy of it
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(statusCode int) {
+	if !rec.wroteHeader {
+		rec.statusCode = statusCode
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
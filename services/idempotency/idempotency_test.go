@@ -0,0 +1,141 @@
+package idempotency
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/willtrojniak/TabAppBackend/cache"
+	"github.com/willtrojniak/TabAppBackend/services"
+	"github.com/willtrojniak/TabAppBackend/services/sessions"
+)
+
+// An in memory cache which ignores expirations
+type memoryCache struct {
+	mu     sync.Mutex
+	values map[string][]byte
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{values: make(map[string][]byte)}
+}
+
+func (c *memoryCache) Set(ctx context.Context, key string, value []byte, expiration time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] = value
+	return nil
+}
+
+func (c *memoryCache) SetNX(ctx context.Context, key string, value []byte, expiration time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.values[key]; ok {
+		return false, nil
+	}
+	c.values[key] = value
+	return true, nil
+}
+
+func (c *memoryCache) Get(ctx context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, ok := c.values[key]
+	if !ok {
+		return nil, cache.ErrNotFound
+	}
+	return value, nil
+}
+
+func (c *memoryCache) Delete(ctx context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		delete(c.values, key)
+	}
+	return nil
+}
+
+// A handler which counts its calls and responds with the given status
+type countingHandler struct {
+	calls  int
+	status int
+}
+
+func (c *countingHandler) handle(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	c.calls++
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(c.status)
+	w.Write(body)
+}
+
+func newHandler() *Handler {
+	return New(newMemoryCache(), time.Hour, services.HandleHttpError, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func serve(h *Handler, next *countingHandler, key string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/shops/1/tabs/1/add-order", strings.NewReader(body))
+	r.Header.Set(idempotency_header, key)
+	w := httptest.NewRecorder()
+	h.WithIdempotencyKey(next.handle)(w, r, &sessions.AuthedSession{UserId: "user"})
+	return w
+}
+
+func TestWithIdempotencyKeyReplay(t *testing.T) {
+	h := newHandler()
+	next := &countingHandler{status: http.StatusCreated}
+
+	first := serve(h, next, "key", `{"quantity":1}`)
+	second := serve(h, next, "key", `{"quantity":1}`)
+
+	if next.calls != 1 {
+		t.Fatalf("handler called %v times, want 1", next.calls)
+	}
+	if second.Code != first.Code || second.Body.String() != first.Body.String() {
+		t.Errorf("replay = %v %q, want %v %q", second.Code, second.Body.String(), first.Code, first.Body.String())
+	}
+	if second.Header().Get(replayed_header) != "true" {
+		t.Errorf("replay missing %v header", replayed_header)
+	}
+	if first.Header().Get(replayed_header) != "" {
+		t.Errorf("original response has %v header", replayed_header)
+	}
+}
+
+func TestWithIdempotencyKeyDifferentBody(t *testing.T) {
+	h := newHandler()
+	next := &countingHandler{status: http.StatusCreated}
+
+	serve(h, next, "key", `{"quantity":1}`)
+	w := serve(h, next, "key", `{"quantity":2}`)
+
+	if next.calls != 1 {
+		t.Fatalf("handler called %v times, want 1", next.calls)
+	}
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %v, want %v", w.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestWithIdempotencyKeyServerErrorReleasesKey(t *testing.T) {
+	h := newHandler()
+	next := &countingHandler{status: http.StatusInternalServerError}
+
+	serve(h, next, "key", `{"quantity":1}`)
+	next.status = http.StatusCreated
+	w := serve(h, next, "key", `{"quantity":1}`)
+
+	if next.calls != 2 {
+		t.Fatalf("handler called %v times, want 2", next.calls)
+	}
+	if w.Code != http.StatusCreated || w.Header().Get(replayed_header) != "" {
+		t.Errorf("retry = %v replayed %q, want %v without replay", w.Code, w.Header().Get(replayed_header), http.StatusCreated)
+	}
+}
@@ -0,0 +1,328 @@
+package invoices
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/willtrojniak/TabAppBackend/models"
+	"github.com/willtrojniak/TabAppBackend/util"
+)
+
+// Page layout in points
+const (
+	marginLeft   = 50.0
+	marginRight  = util.PDFPageWidth - 50.0
+	marginTop    = 60.0
+	marginBottom = util.PDFPageHeight - 70.0
+	footerY      = util.PDFPageHeight - 40.0
+	lineHeight   = 15.0
+	fontSize     = 10.0
+)
+
+// Right edges of the line item columns
+const (
+	colDescriptionEnd = 330.0
+	colQuantity       = 380.0
+	colUnitPrice      = 470.0
+	colAmount         = marginRight
+)
+
+var paymentStatusLabels = map[models.PaymentStatus]string{
+	models.PAYMENT_STATUS_UNPAID:   "Unpaid",
+	models.PAYMENT_STATUS_PARTIAL:  "Partially Paid",
+	models.PAYMENT_STATUS_PAID:     "Paid",
+	models.PAYMENT_STATUS_OVERPAID: "Overpaid",
+}
+
+type invoiceWriter struct {
+	pdf     *util.PDF
+	y       float64
+	shop    *models.Shop
+	inTable bool // Whether the line item header is repeated when a new page is started
+}
+
+func InvoiceFilename(tab *models.Tab, bill *models.Bill) string {
+	return fmt.Sprintf("invoice-%v-%v-%v.pdf", tab.ShopId, tab.Id, bill.Id)
+}
+
+// Renders a paginated invoice for the bill. The owner is optional and is listed as the tab's contact.
+func RenderBillInvoice(shop *models.Shop, tab *models.Tab, bill *models.Bill, owner *models.User) ([]byte, error) {
+	total, err := bill.Total()
+	if err != nil {
+		return nil, err
+	}
+	balance, err := bill.Balance()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &invoiceWriter{pdf: util.NewPDF(), shop: shop}
+	w.newPage()
+
+	w.header(tab, bill)
+	w.billTo(tab, bill, owner)
+	w.paymentMethod(tab, bill)
+	w.lineItems(bill)
+	w.totals(bill, total, balance)
+	w.payments(bill)
+	w.footers()
+
+	return w.pdf.Bytes(), nil
+}
+
+func (w *invoiceWriter) newPage() {
+	w.pdf.AddPage()
+	w.y = marginTop
+	if w.inTable {
+		w.tableHeader()
+	}
+}
+
+// Starts a new page if the next lines would not fit on the current page
+func (w *invoiceWriter) ensure(lines int) {
+	if w.y+float64(lines)*lineHeight > marginBottom {
+		w.newPage()
+	}
+}
+
+func (w *invoiceWriter) line(text string, bold bool) {
+	w.ensure(1)
+	w.pdf.Text(marginLeft, w.y, fontSize, bold, text)
+	w.y += lineHeight
+}
+
+func (w *invoiceWriter) rule() {
+	w.pdf.Line(marginLeft, w.y-lineHeight+4, marginRight, w.y-lineHeight+4, 0.5)
+	w.y += 4
+}
+
+func (w *invoiceWriter) header(tab *models.Tab, bill *models.Bill) {
+	w.pdf.Text(marginLeft, w.y, 18, true, w.shop.Name)
+	w.pdf.TextRight(marginRight, w.y, 18, true, "INVOICE")
+	w.y += 22
+
+	details := []string{
+		fmt.Sprintf("Invoice #: %v-%v-%v", tab.ShopId, tab.Id, bill.Id),
+		fmt.Sprintf("Issued: %s", formatDate(issueDate(w.shop, bill))),
+		fmt.Sprintf("Status: %s", paymentStatusLabels[bill.PaymentStatus]),
+	}
+	contact := make([]string, 0, 3)
+	for _, s := range []string{w.shop.Address, w.shop.ContactEmail, w.shop.ContactPhone} {
+		if s != "" {
+			contact = append(contact, s)
+		}
+	}
+
+	for i := range max(len(details), len(contact)) {
+		if i < len(contact) {
+			w.pdf.Text(marginLeft, w.y, fontSize, false, util.TruncateText(contact[i], 300, fontSize, false))
+		}
+		if i < len(details) {
+			w.pdf.TextRight(marginRight, w.y, fontSize, false, details[i])
+		}
+		w.y += lineHeight
+	}
+	w.y += lineHeight
+	w.rule()
+}
+
+// Invoices for closed bills are issued on the day the bill ended, which is the day it was cut if it was cut early.
+// Open bills are invoiced as of today.
+func issueDate(shop *models.Shop, bill *models.Bill) models.Date {
+	if bill.IsClosed || bill.IsPaid {
+		return bill.EndDate
+	}
+	return shop.Today()
+}
+
+func (w *invoiceWriter) billTo(tab *models.Tab, bill *models.Bill, owner *models.User) {
+	const periodX = 360.0
+
+	w.pdf.Text(marginLeft, w.y, fontSize, true, "Bill To")
+	w.pdf.Text(periodX, w.y, fontSize, true, "Billing Period")
+	w.y += lineHeight
+
+	w.pdf.Text(periodX, w.y, fontSize, false, fmt.Sprintf("%s - %s", formatDate(bill.StartDate), formatDate(bill.EndDate)))
+	for _, s := range []string{tab.Organization, tab.DisplayName} {
+		w.line(util.TruncateText(s, periodX-marginLeft-10, fontSize, false), false)
+	}
+	if owner != nil {
+		w.line(util.TruncateText(fmt.Sprintf("%s <%s>", owner.Name, owner.Email), periodX-marginLeft-10, fontSize, false), false)
+	}
+	w.y += lineHeight
+}
+
+func (w *invoiceWriter) paymentMethod(tab *models.Tab, bill *models.Bill) {
+	method := tab.PaymentMethod
+	if t, ok := models.GetPaymentMethodType(tab.PaymentMethod); ok {
+		method = t.Label
+		if tab.PaymentDetails != "" {
+			method = fmt.Sprintf("%s - %s: %s", method, t.Details.Label, tab.PaymentDetails)
+		}
+	}
+
+	w.line("Payment Method", true)
+	w.line(util.TruncateText(method, marginRight-marginLeft, fontSize, false), false)
+	for _, a := range bill.Allocations {
+		w.ensure(1)
+		w.pdf.Text(marginLeft+15, w.y, fontSize, false, a.Chartstring)
+		w.pdf.TextRight(colAmount, w.y, fontSize, false, w.shop.FormatMoney(a.Amount))
+		w.y += lineHeight
+	}
+	w.y += lineHeight
+}
+
+func (w *invoiceWriter) tableHeader() {
+	w.pdf.Text(marginLeft, w.y, fontSize, true, "Description")
+	w.pdf.TextRight(colQuantity, w.y, fontSize, true, "Qty")
+	w.pdf.TextRight(colUnitPrice, w.y, fontSize, true, "Unit Price")
+	w.pdf.TextRight(colAmount, w.y, fontSize, true, "Amount")
+	w.y += lineHeight
+	w.rule()
+}
+
+func (w *invoiceWriter) lineItem(description string, indent float64, quantity int, unitPrice *models.Money) {
+	w.ensure(1)
+	if unitPrice == nil {
+		unitPrice = &models.Money{}
+	}
+	w.pdf.Text(marginLeft+indent, w.y, fontSize, false, util.TruncateText(description, colDescriptionEnd-marginLeft-indent, fontSize, false))
+	w.pdf.TextRight(colQuantity, w.y, fontSize, false, fmt.Sprint(quantity))
+	w.pdf.TextRight(colUnitPrice, w.y, fontSize, false, w.shop.FormatMoney(*unitPrice))
+	w.pdf.TextRight(colAmount, w.y, fontSize, false, w.shop.FormatMoney(unitPrice.Mul(quantity)))
+	w.y += lineHeight
+}
+
+func (w *invoiceWriter) lineItems(bill *models.Bill) {
+	const subIndent = 15.0
+
+	w.ensure(3)
+	w.tableHeader()
+	w.inTable = true
+
+	if !hasLines(bill) {
+		w.line("No orders were placed during this billing period", false)
+	}
+	for _, item := range bill.Items {
+		// Items removed as many times as they were ordered are left off, along with any of their options which net to zero
+		if item.Quantity > 0 {
+			w.lineItem(item.Name, 0, item.Quantity, item.BasePrice)
+		}
+		for _, variant := range item.Variants {
+			if variant.Quantity > 0 {
+				w.lineItem(fmt.Sprintf("Variant: %s", variant.Name), subIndent, variant.Quantity, variant.Price)
+			}
+		}
+		for _, addon := range item.Addons {
+			if addon.Quantity > 0 {
+				w.lineItem(fmt.Sprintf("Add-on: %s", addon.Name), subIndent, addon.Quantity, addon.BasePrice)
+			}
+		}
+		for _, substitution := range item.Substitutions {
+			if substitution.Quantity > 0 {
+				w.lineItem(fmt.Sprintf("Substitution: %s", substitution.Name), subIndent, substitution.Quantity, substitution.BasePrice)
+			}
+		}
+	}
+
+	for _, adjustment := range bill.Adjustments {
+		label := "Charge"
+		if adjustment.Amount.IsNegative() {
+			label = "Credit"
+		}
+		w.lineItem(fmt.Sprintf("%s: %s", label, adjustment.Reason), 0, 1, &adjustment.Amount)
+	}
+
+	w.inTable = false
+	w.y += 4
+	w.rule()
+}
+
+// Whether any of the bill's items, their options or its adjustments have a quantity to invoice
+func hasLines(bill *models.Bill) bool {
+	if len(bill.Adjustments) > 0 {
+		return true
+	}
+	for _, item := range bill.Items {
+		if item.Quantity > 0 {
+			return true
+		}
+		for _, variant := range item.Variants {
+			if variant.Quantity > 0 {
+				return true
+			}
+		}
+		for _, addon := range item.Addons {
+			if addon.Quantity > 0 {
+				return true
+			}
+		}
+		for _, substitution := range item.Substitutions {
+			if substitution.Quantity > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (w *invoiceWriter) totals(bill *models.Bill, total models.Money, balance models.Money) {
+	const labelX = colQuantity
+
+	w.ensure(3)
+	rows := []struct {
+		label  string
+		amount models.Money
+		bold   bool
+	}{
+		{label: "Total", amount: total},
+		{label: "Amount Paid", amount: bill.AmountPaid},
+		{label: "Balance Due", amount: balance, bold: true},
+	}
+	for _, row := range rows {
+		w.pdf.TextRight(labelX, w.y, fontSize, row.bold, row.label)
+		w.pdf.TextRight(colAmount, w.y, fontSize, row.bold, w.shop.FormatMoney(row.amount))
+		w.y += lineHeight
+	}
+	w.y += lineHeight
+}
+
+func (w *invoiceWriter) payments(bill *models.Bill) {
+	if len(bill.Payments) == 0 {
+		return
+	}
+
+	w.ensure(3)
+	w.line("Payments", true)
+	for _, p := range bill.Payments {
+		description := p.Method
+		if t, ok := models.GetPaymentMethodType(p.Method); ok {
+			description = t.Label
+		}
+		if p.Reference != "" {
+			description = fmt.Sprintf("%s (%s)", description, p.Reference)
+		}
+		if p.Reversal != nil {
+			description = fmt.Sprintf("%s - Reversed", description)
+		}
+
+		w.ensure(1)
+		w.pdf.Text(marginLeft, w.y, fontSize, false, p.CreatedAt.In(w.shop.Location()).Format("Jan 2, 2006"))
+		w.pdf.Text(marginLeft+90, w.y, fontSize, false, util.TruncateText(description, colUnitPrice-marginLeft-100, fontSize, false))
+		w.pdf.TextRight(colAmount, w.y, fontSize, false, w.shop.FormatMoney(p.Amount))
+		w.y += lineHeight
+	}
+}
+
+func (w *invoiceWriter) footers() {
+	count := w.pdf.PageCount()
+	for i := range count {
+		w.pdf.SetPage(i)
+		w.pdf.Text(marginLeft, footerY, 8, false, w.shop.Name)
+		w.pdf.TextRight(marginRight, footerY, 8, false, fmt.Sprintf("Page %v of %v", i+1, count))
+	}
+}
+
+func formatDate(d models.Date) string {
+	return d.In(time.UTC).Format("Jan 2, 2006")
+}
@@ -2,8 +2,11 @@ package notifications
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
+	"mime/multipart"
 	"net/smtp"
+	"net/textproto"
 	"slices"
 	"strings"
 	"text/template"
@@ -78,12 +81,59 @@ func (driver *MailDriver) toHTML(emails []string, n Notification) ([]byte, error
 		return nil, err
 	}
 
-	return []byte(
-		fmt.Sprintf("To: %v\n", strings.Join(emails, ",")) +
-			fmt.Sprintf("Subject: %v\n", n.Heading()) +
-			"MIME-version: 1.0;\n" +
-			"Content-Type: text/html; charset=\"UTF-8\";\n" +
-			"\n" +
-			fmt.Sprintf("%s\r\n", res.String())), nil
+	var attachments []Attachment
+	if a, ok := n.(AttachmentNotification); ok {
+		attachments, err = a.Attachments()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(attachments) == 0 {
+		return []byte(
+			fmt.Sprintf("To: %v\n", strings.Join(emails, ",")) +
+				fmt.Sprintf("Subject: %v\n", n.Heading()) +
+				"MIME-version: 1.0;\n" +
+				"Content-Type: text/html; charset=\"UTF-8\";\n" +
+				"\n" +
+				fmt.Sprintf("%s\r\n", res.String())), nil
+	}
+
+	var msg bytes.Buffer
+	writer := multipart.NewWriter(&msg)
+	fmt.Fprintf(&msg, "To: %v\r\n", strings.Join(emails, ","))
+	fmt.Fprintf(&msg, "Subject: %v\r\n", n.Heading())
+	msg.WriteString("MIME-version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=\"%s\"\r\n\r\n", writer.Boundary())
+
+	part, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/html; charset=\"UTF-8\""}})
+	if err != nil {
+		return nil, err
+	}
+	part.Write(res.Bytes())
+
+	for _, a := range attachments {
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {a.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=\"%s\"", a.Filename)},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// Encoded lines must not exceed 76 characters
+		encoded := base64.StdEncoding.EncodeToString(a.Data)
+		for len(encoded) > 76 {
+			fmt.Fprintf(part, "%s\r\n", encoded[:76])
+			encoded = encoded[76:]
+		}
+		fmt.Fprintf(part, "%s\r\n", encoded)
+	}
 
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
 }
@@ -21,6 +21,17 @@ type Notification interface {
 	Data() []NotificationData
 }
 
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Implemented by notifications which include files, e.g. as email attachments
+type AttachmentNotification interface {
+	Attachments() ([]Attachment, error)
+}
+
 type Notifier interface {
 	Name() string
 	NotifyUsers(to []*models.User, n Notification) error
@@ -40,7 +51,12 @@ func NewNotificationService(l *slog.Logger, e *events.EventDispatcher) *Notifica
 
 	events.Register(e, n.onTabCreate)
 	events.Register(e, n.onTabBillPaid)
+	events.Register(e, n.onTabBillApproved)
+	events.Register(e, n.onTabBillDisputed)
+	events.Register(e, n.onTabBillDisputeResolved)
+	events.Register(e, n.onOrderVoided)
 	events.Register(e, n.onDailyTabReport)
+	events.Register(e, n.onJournalExport)
 
 	return n
 }
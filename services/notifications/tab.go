@@ -2,11 +2,13 @@ package notifications
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/willtrojniak/TabAppBackend/env"
 	"github.com/willtrojniak/TabAppBackend/models"
 	"github.com/willtrojniak/TabAppBackend/services/authorization"
 	"github.com/willtrojniak/TabAppBackend/services/events"
+	"github.com/willtrojniak/TabAppBackend/services/invoices"
 )
 
 type TabRequestNotification struct {
@@ -17,10 +19,30 @@ type TabBillPaidNotification struct {
 	events.TabBillPaidEvent
 }
 
+type TabBillApprovedNotification struct {
+	events.TabBillApprovedEvent
+}
+
+type TabBillDisputedNotification struct {
+	events.TabBillDisputedEvent
+}
+
+type TabBillDisputeResolvedNotification struct {
+	events.TabBillDisputeResolvedEvent
+}
+
+type OrderVoidedNotification struct {
+	events.OrderVoidedEvent
+}
+
 type ShopDailyTabReportNotification struct {
 	events.DailyTabReportEvent
 }
 
+type JournalExportNotification struct {
+	events.JournalExportEvent
+}
+
 func (n *NotificationService) onTabCreate(e events.TabCreateEvent) {
 	if e.Tab.Status != models.TAB_STATUS_PENDING.String() {
 		return
@@ -46,10 +68,30 @@ func (n *NotificationService) onTabBillPaid(e events.TabBillPaidEvent) {
 	n.NotifyUsers([]*models.User{e.TabOwner}, &TabBillPaidNotification{e})
 }
 
+func (n *NotificationService) onTabBillApproved(e events.TabBillApprovedEvent) {
+	n.NotifyShop(e.Shop, &TabBillApprovedNotification{e})
+}
+
+func (n *NotificationService) onTabBillDisputed(e events.TabBillDisputedEvent) {
+	n.NotifyShop(e.Shop, &TabBillDisputedNotification{e})
+}
+
+func (n *NotificationService) onTabBillDisputeResolved(e events.TabBillDisputeResolvedEvent) {
+	n.NotifyUsers([]*models.User{e.TabOwner}, &TabBillDisputeResolvedNotification{e})
+}
+
+func (n *NotificationService) onOrderVoided(e events.OrderVoidedEvent) {
+	n.NotifyShop(e.Shop, &OrderVoidedNotification{e})
+}
+
 func (n *NotificationService) onDailyTabReport(e events.DailyTabReportEvent) {
 	n.NotifyShop(e.Shop, &ShopDailyTabReportNotification{e})
 }
 
+func (n *NotificationService) onJournalExport(e events.JournalExportEvent) {
+	n.NotifyShop(e.Shop, &JournalExportNotification{e})
+}
+
 func (n *TabRequestNotification) IsDisabledFor(u *models.User, s *models.Shop) bool {
 	return !authorization.HasRole(u, s, authorization.ROLE_SHOP_MANAGE_TABS)
 }
@@ -94,12 +136,131 @@ func (n *TabBillPaidNotification) ResourceURL() string {
 	return fmt.Sprintf("%s/shops/%v/tabs/%v", env.Envs.UI_URI, n.Shop.Id, n.Tab.Id)
 }
 func (n *TabBillPaidNotification) Data() []NotificationData {
-	return []NotificationData{
-		{Field: "Tab", Value: n.Tab.DisplayName},
-		{Field: "Total", Value: fmt.Sprintf("$%.2f", n.Bill.Total())},
-		{Field: "Bill Start Date", Value: fmt.Sprintf("%s %v, %v", n.Bill.StartDate.Month.String(), n.Bill.StartDate.Day, n.Bill.StartDate.Year)},
-		{Field: "Bill End Date", Value: fmt.Sprintf("%s %v, %v", n.Bill.EndDate.Month.String(), n.Bill.EndDate.Day, n.Bill.EndDate.Year)},
+	return billData(n.Shop, n.Tab, n.Bill)
+}
+func (n *TabBillPaidNotification) Attachments() ([]Attachment, error) {
+	invoice, err := invoices.RenderBillInvoice(n.Shop, n.Tab, n.Bill, n.TabOwner)
+	if err != nil {
+		return nil, err
 	}
+	return []Attachment{{
+		Filename:    invoices.InvoiceFilename(n.Tab, n.Bill),
+		ContentType: "application/pdf",
+		Data:        invoice,
+	}}, nil
+}
+
+func (n *TabBillApprovedNotification) IsDisabledFor(u *models.User, s *models.Shop) bool {
+	return !authorization.HasRole(u, s, authorization.ROLE_SHOP_MANAGE_TABS)
+}
+func (n *TabBillApprovedNotification) SlackChannel(s *models.Shop) string {
+	return s.TabBillReceiptSlackChannel
+}
+func (n *TabBillApprovedNotification) Heading() string {
+	return fmt.Sprintf("Bill Approved - %s", n.Tab.DisplayName)
+}
+func (n *TabBillApprovedNotification) SubHeading() string {
+	return fmt.Sprintf("%s approved their bill at %s", n.TabOwner.Name, n.Shop.Name)
+}
+func (n *TabBillApprovedNotification) ResourceURL() string {
+	return fmt.Sprintf("%s/shops/%v/tabs/%v", env.Envs.UI_URI, n.Shop.Id, n.Tab.Id)
+}
+func (n *TabBillApprovedNotification) Data() []NotificationData {
+	return billData(n.Shop, n.Tab, n.Bill)
+}
+
+func (n *TabBillDisputedNotification) IsDisabledFor(u *models.User, s *models.Shop) bool {
+	return !authorization.HasRole(u, s, authorization.ROLE_SHOP_MANAGE_TABS)
+}
+func (n *TabBillDisputedNotification) SlackChannel(s *models.Shop) string {
+	return s.TabBillReceiptSlackChannel
+}
+func (n *TabBillDisputedNotification) Heading() string {
+	return fmt.Sprintf("Bill Disputed - %s", n.Tab.DisplayName)
+}
+func (n *TabBillDisputedNotification) SubHeading() string {
+	return fmt.Sprintf("%s disputed their bill at %s", n.TabOwner.Name, n.Shop.Name)
+}
+func (n *TabBillDisputedNotification) ResourceURL() string {
+	return fmt.Sprintf("%s/shops/%v/tabs/%v", env.Envs.UI_URI, n.Shop.Id, n.Tab.Id)
+}
+func (n *TabBillDisputedNotification) Data() []NotificationData {
+	return append(billData(n.Shop, n.Tab, n.Bill), NotificationData{Field: "Comment", Value: n.Comment.Body})
+}
+
+func (n *TabBillDisputeResolvedNotification) IsDisabledFor(u *models.User, s *models.Shop) bool {
+	return false
+}
+func (n *TabBillDisputeResolvedNotification) SlackChannel(s *models.Shop) string { return "" }
+func (n *TabBillDisputeResolvedNotification) Heading() string {
+	return fmt.Sprintf("Bill Dispute Resolved - %s", n.Tab.DisplayName)
+}
+func (n *TabBillDisputeResolvedNotification) SubHeading() string {
+	return fmt.Sprintf("%s has responded to your dispute. Please review and approve the bill.", n.Shop.Name)
+}
+func (n *TabBillDisputeResolvedNotification) ResourceURL() string {
+	return fmt.Sprintf("%s/shops/%v/tabs/%v", env.Envs.UI_URI, n.Shop.Id, n.Tab.Id)
+}
+func (n *TabBillDisputeResolvedNotification) Data() []NotificationData {
+	return append(billData(n.Shop, n.Tab, n.Bill), NotificationData{Field: "Comment", Value: n.Comment.Body})
+}
+
+// The tab, total, dates and adjustments of the bill
+func billData(shop *models.Shop, tab *models.Tab, bill *models.Bill) []NotificationData {
+	total := "Unavailable"
+	if t, err := bill.Total(); err == nil {
+		total = shop.FormatMoney(t)
+	}
+	data := []NotificationData{
+		{Field: "Tab", Value: tab.DisplayName},
+		{Field: "Total", Value: total},
+		{Field: "Bill Start Date", Value: fmt.Sprintf("%s %v, %v", bill.StartDate.Month.String(), bill.StartDate.Day, bill.StartDate.Year)},
+		{Field: "Bill End Date", Value: fmt.Sprintf("%s %v, %v", bill.EndDate.Month.String(), bill.EndDate.Day, bill.EndDate.Year)},
+	}
+	for _, a := range bill.Adjustments {
+		data = append(data, NotificationData{Field: "Adjustment", Value: fmt.Sprintf("%s (%s)", shop.FormatMoney(a.Amount), a.Reason)})
+	}
+	return data
+}
+
+func (n *OrderVoidedNotification) IsDisabledFor(u *models.User, s *models.Shop) bool {
+	return !authorization.HasRole(u, s, authorization.ROLE_SHOP_MANAGE_TABS)
+}
+func (n *OrderVoidedNotification) SlackChannel(s *models.Shop) string {
+	return s.TabBillReceiptSlackChannel
+}
+func (n *OrderVoidedNotification) Heading() string {
+	return fmt.Sprintf("Order Voided - %s", n.Tab.DisplayName)
+}
+func (n *OrderVoidedNotification) SubHeading() string {
+	return fmt.Sprintf("Order #%v was voided on %s at %s", n.Order.Id, n.Tab.DisplayName, n.Shop.Name)
+}
+func (n *OrderVoidedNotification) ResourceURL() string {
+	return fmt.Sprintf("%s/shops/%v/tabs/%v", env.Envs.UI_URI, n.Shop.Id, n.Tab.Id)
+}
+func (n *OrderVoidedNotification) Data() []NotificationData {
+	data := []NotificationData{
+		{Field: "Order Placed", Value: n.Order.CreatedAt.In(n.Shop.Location()).Format("Jan 2, 2006 3:04 PM")},
+	}
+	if n.Order.Void != nil {
+		data = append(data,
+			NotificationData{Field: "Reason", Value: string(n.Order.Void.Reason)},
+			NotificationData{Field: "Note", Value: n.Order.Void.Note},
+		)
+		if n.Order.Void.StaffName != nil {
+			data = append(data, NotificationData{Field: "Voided By", Value: *n.Order.Void.StaffName})
+		}
+	}
+	if n.Bill != nil && n.Bill.PaymentStatus == models.PAYMENT_STATUS_OVERPAID {
+		overpaid := "Unavailable"
+		if total, err := n.Bill.Total(); err == nil {
+			if o, err := n.Bill.AmountPaid.Sub(total); err == nil {
+				overpaid = n.Shop.FormatMoney(o)
+			}
+		}
+		data = append(data, NotificationData{Field: "Bill Overpaid By", Value: overpaid})
+	}
+	return data
 }
 
 func (n *ShopDailyTabReportNotification) IsDisabledFor(u *models.User, s *models.Shop) bool {
@@ -121,12 +282,42 @@ func (n *ShopDailyTabReportNotification) Data() []NotificationData {
 	data := make([]NotificationData, len(n.Tabs))
 	for i, t := range n.Tabs {
 		data[i] = NotificationData{Field: t.DisplayName,
-			Value: fmt.Sprintf("%s - %s\nLimit: $%v\nVerification: %s",
+			Value: fmt.Sprintf("%s - %s\nLimit: %s\nVerification: %s",
 				t.DailyStartTime.String(),
 				t.DailyEndTime.String(),
-				t.DollarLimitPerOrder,
+				n.Shop.FormatMoney(t.DollarLimitPerOrder),
 				t.VerificationMethod),
 		}
 	}
 	return data
 }
+
+func (n *JournalExportNotification) IsDisabledFor(u *models.User, s *models.Shop) bool {
+	return !authorization.HasRole(u, s, authorization.ROLE_SHOP_MANAGE_TABS)
+}
+func (n *JournalExportNotification) SlackChannel(s *models.Shop) string { return "" }
+func (n *JournalExportNotification) Heading() string {
+	return fmt.Sprintf("Journal Export - %s", n.Shop.Name)
+}
+func (n *JournalExportNotification) SubHeading() string {
+	return fmt.Sprintf("Chartstring bills ending %s through %s are ready to be posted",
+		n.Export.StartDate.In(time.UTC).Format("Jan 2, 2006"),
+		n.Export.EndDate.In(time.UTC).Format("Jan 2, 2006"))
+}
+func (n *JournalExportNotification) ResourceURL() string {
+	return fmt.Sprintf("%s/shops/%v/journal-exports/%v", env.Envs.UI_URI, n.Shop.Id, n.Export.Id)
+}
+func (n *JournalExportNotification) Data() []NotificationData {
+	return []NotificationData{
+		{Field: "Lines", Value: fmt.Sprint(len(n.Export.Lines))},
+		{Field: "Total", Value: n.Shop.FormatMoney(n.Export.Total)},
+		{Field: "Revenue Account", Value: n.Export.RevenueAccount},
+	}
+}
+func (n *JournalExportNotification) Attachments() ([]Attachment, error) {
+	return []Attachment{{
+		Filename:    fmt.Sprintf("journal-%v-%v.csv", n.Shop.Id, n.Export.Id),
+		ContentType: "text/csv",
+		Data:        n.Export.CSV(n.Shop, n.Settings.Columns),
+	}}, nil
+}
@@ -0,0 +1,151 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const fakeSignatureHeader = "Fake-Signature"
+
+// Maximum size of a webhook request body
+const maxWebhookBytes = 1 << 16
+
+// How long a fake checkout session accepts payment
+const fakeSessionLifetime = 30 * time.Minute
+
+// A local provider for development and tests. Visiting the checkout URL completes the payment immediately
+// and delivers a signed webhook event to the API, as a real provider would once the customer has paid.
+type FakeProvider struct {
+	secret  []byte
+	baseURI string
+	client  *http.Client
+
+	mu       sync.Mutex
+	sessions map[string]*fakeSession
+}
+
+type fakeSession struct {
+	req       CheckoutRequest
+	expiresAt time.Time
+	completed bool
+}
+
+func NewFakeProvider(webhookSecret string, baseURI string) *FakeProvider {
+	return &FakeProvider{
+		secret:   []byte(webhookSecret),
+		baseURI:  baseURI,
+		client:   &http.Client{},
+		sessions: make(map[string]*fakeSession),
+	}
+}
+
+func (p *FakeProvider) Name() string { return "fake" }
+
+func (p *FakeProvider) CreateCheckoutSession(ctx context.Context, req *CheckoutRequest) (*CheckoutSession, error) {
+	id := fmt.Sprintf("cs_fake_%v", uuid.NewString())
+	expiresAt := time.Now().Add(fakeSessionLifetime)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sessions[id] = &fakeSession{req: *req, expiresAt: expiresAt}
+
+	return &CheckoutSession{Id: id, URL: fmt.Sprintf("%v/payments/fake/checkout/%v", p.baseURI, id), ExpiresAt: expiresAt}, nil
+}
+
+func (p *FakeProvider) ParseWebhook(r *http.Request) (*WebhookEvent, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxWebhookBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := hex.DecodeString(r.Header.Get(fakeSignatureHeader))
+	if err != nil || !hmac.Equal(signature, p.sign(body)) {
+		return nil, ErrInvalidSignature
+	}
+
+	event := &WebhookEvent{}
+	err = json.Unmarshal(body, event)
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+func (p *FakeProvider) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// Simulates the customer paying for the checkout session, delivering the signed webhook event to the API.
+// Returns the URL the customer is redirected to.
+func (p *FakeProvider) CompleteCheckout(ctx context.Context, sessionId string) (string, error) {
+	p.mu.Lock()
+	session, ok := p.sessions[sessionId]
+	if ok {
+		ok = !session.completed && time.Now().Before(session.expiresAt)
+	}
+	p.mu.Unlock()
+	if !ok {
+		return "", errors.New("Unknown, expired or completed checkout session")
+	}
+
+	payload, err := json.Marshal(WebhookEvent{
+		Type:      WEBHOOK_EVENT_CHECKOUT_COMPLETED,
+		SessionId: sessionId,
+		PaymentId: fmt.Sprintf("pi_fake_%v", uuid.NewString()),
+		Amount:    session.req.Amount,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURI+WebhookPath(p.Name()), bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(fakeSignatureHeader, hex.EncodeToString(p.sign(payload)))
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return "", fmt.Errorf("Webhook delivery failed with status %v", res.StatusCode)
+	}
+
+	p.mu.Lock()
+	session.completed = true
+	p.mu.Unlock()
+
+	return session.req.SuccessURL, nil
+}
+
+func (p *FakeProvider) RegisterRoutes(router *http.ServeMux) {
+	router.HandleFunc("GET /payments/fake/checkout/{sessionId}", p.handleCheckout)
+}
+
+func (p *FakeProvider) handleCheckout(w http.ResponseWriter, r *http.Request) {
+	redirect, err := p.CompleteCheckout(r.Context(), r.PathValue("sessionId"))
+	if err != nil {
+		slog.Warn("Fake checkout failed", "err", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
@@ -0,0 +1,70 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/willtrojniak/TabAppBackend/env"
+	"github.com/willtrojniak/TabAppBackend/models"
+)
+
+type CheckoutRequest struct {
+	Amount      models.Money
+	Description string
+	Reference   string // Identifies what is being paid for, for display in the provider's dashboard
+	SuccessURL  string // Where the customer is sent once the payment is complete
+	CancelURL   string // Where the customer is sent if they abandon the checkout
+}
+
+// A hosted page the customer is sent to in order to pay
+type CheckoutSession struct {
+	Id        string
+	URL       string
+	ExpiresAt time.Time // When the provider stops accepting payment through the session
+}
+
+type WebhookEventType string
+
+const (
+	WEBHOOK_EVENT_CHECKOUT_COMPLETED WebhookEventType = "checkout.completed"
+)
+
+type WebhookEvent struct {
+	Type      WebhookEventType `json:"type"`
+	SessionId string           `json:"session_id"`
+	PaymentId string           `json:"payment_id"` // The provider's reference for the captured payment
+	Amount    models.Money     `json:"amount"`
+}
+
+// Takes payments online through hosted checkout pages, notifying the API of their outcome through signed webhooks
+type PaymentProvider interface {
+	Name() string
+	CreateCheckoutSession(ctx context.Context, req *CheckoutRequest) (*CheckoutSession, error)
+	// Verifies the signature of the webhook request and parses the event it carries
+	ParseWebhook(r *http.Request) (*WebhookEvent, error)
+}
+
+var ErrInvalidSignature = errors.New("Invalid webhook signature")
+
+// Creates the configured provider. An empty name disables online payments and returns a nil provider.
+func NewProvider(name string, webhookSecret string) (PaymentProvider, error) {
+	switch name {
+	case "":
+		return nil, nil
+	case "fake":
+		if env.EXT_ENVIRONMENT == env.PROD {
+			return nil, errors.New("The fake payment provider may not be used in production")
+		}
+		return NewFakeProvider(webhookSecret, env.Envs.BASE_URI), nil
+	default:
+		return nil, fmt.Errorf("Unknown payment provider '%v'", name)
+	}
+}
+
+// The path providers deliver webhook events to
+func WebhookPath(provider string) string {
+	return fmt.Sprintf("/webhooks/payments/%v", provider)
+}
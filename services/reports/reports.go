@@ -2,10 +2,12 @@ package reports
 
 import (
 	"context"
+	"errors"
 	"slices"
 
 	"github.com/willtrojniak/TabAppBackend/db"
 	"github.com/willtrojniak/TabAppBackend/models"
+	"github.com/willtrojniak/TabAppBackend/services/billing"
 	"github.com/willtrojniak/TabAppBackend/services/events"
 )
 
@@ -21,7 +23,21 @@ func NewReportHandler(store *db.PgxStore, dispatcher *events.EventDispatcher) *R
 	}
 }
 
+// Hour of the day, in the shop's timezone, at which the daily report is sent
+const DailyReportHour = 6
+
 func (rh *ReportHandler) GenerateShopTabOverview(ctx context.Context, shopId int) {
+	rh.generateShopTabOverview(ctx, shopId, func(*models.Shop) bool { return true })
+}
+
+// Generates the daily report for the shop if it is currently the report hour in the shop's timezone
+func (rh *ReportHandler) GenerateDailyShopTabOverview(ctx context.Context, shopId int) {
+	rh.generateShopTabOverview(ctx, shopId, func(shop *models.Shop) bool {
+		return shop.Now().Hour() == DailyReportHour
+	})
+}
+
+func (rh *ReportHandler) generateShopTabOverview(ctx context.Context, shopId int, isDue func(*models.Shop) bool) {
 	var shop *models.Shop
 	var tabs []models.TabOverview
 	err := db.WithTx(ctx, rh.store, func(pq *db.PgxQueries) error {
@@ -39,12 +55,13 @@ func (rh *ReportHandler) GenerateShopTabOverview(ctx context.Context, shopId int
 
 		return nil
 	})
-	if err != nil {
+	if err != nil || !isDue(shop) {
 		return
 	}
 
+	now := shop.Now()
 	tabs = slices.DeleteFunc(tabs, func(t models.TabOverview) bool {
-		return !t.IsActiveToday()
+		return !t.IsActiveOn(now)
 	})
 
 	slices.SortFunc(tabs, func(t1, t2 models.TabOverview) int {
@@ -53,3 +70,50 @@ func (rh *ReportHandler) GenerateShopTabOverview(ctx context.Context, shopId int
 
 	events.Dispatch(rh.dispatcher, events.DailyTabReportEvent{Shop: shop, Tabs: tabs})
 }
+
+// Exports the previous month's chartstring bills to the journal if it is the report hour on the shop's export day,
+// notifying the shop with the journal file attached
+func (rh *ReportHandler) GenerateScheduledJournalExport(ctx context.Context, shopId int) error {
+	var shop *models.Shop
+	var settings *models.JournalSettings
+	var export *models.JournalExport
+	err := db.WithTx(ctx, rh.store, func(pq *db.PgxQueries) error {
+		var err error
+		shop, err = pq.GetShopById(ctx, shopId)
+		if err != nil {
+			return err
+		}
+
+		settings, err = pq.GetJournalSettings(ctx, shopId)
+		if err != nil {
+			return err
+		}
+
+		end, ok := settings.ScheduledEndDate(shop.Today())
+		if !ok || settings.RevenueAccount == "" || shop.Now().Hour() != DailyReportHour {
+			return nil
+		}
+
+		exportId, settled, err := pq.CreateJournalExport(ctx, shop, &models.JournalExportCreate{EndDate: end}, settings.RevenueAccount, nil)
+		if errors.Is(err, db.ErrNoJournalBills) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = billing.DispatchBillsPaid(ctx, pq, rh.dispatcher, shop, settled)
+		if err != nil {
+			return err
+		}
+
+		export, err = pq.GetJournalExportById(ctx, shopId, exportId)
+		return err
+	})
+	if err != nil || export == nil {
+		return err
+	}
+
+	events.Dispatch(rh.dispatcher, events.JournalExportEvent{Shop: shop, Settings: settings, Export: export})
+	return nil
+}
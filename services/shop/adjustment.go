@@ -0,0 +1,49 @@
+package shop
+
+import (
+	"context"
+
+	"github.com/willtrojniak/TabAppBackend/db"
+	"github.com/willtrojniak/TabAppBackend/models"
+	"github.com/willtrojniak/TabAppBackend/services/authorization"
+	"github.com/willtrojniak/TabAppBackend/services/sessions"
+)
+
+func (h *Handler) AddBillAdjustment(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int, billId int, data *models.BillAdjustmentCreate) (adjustment *models.BillAdjustment, err error) {
+	err = models.ValidateData(data, h.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	err = WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_ADJUST_BILL, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		err := shop.ApplyCurrency(data)
+		if err != nil {
+			return err
+		}
+
+		adjustmentId, err := pq.AddBillAdjustment(ctx, tab, billId, user.Id, data, shop.Today())
+		if err != nil {
+			return err
+		}
+
+		adjustment, err = pq.GetBillAdjustmentById(ctx, shopId, tabId, billId, adjustmentId)
+		if err != nil {
+			return err
+		}
+
+		// A credit may cover the remaining balance of the bill
+		return h.dispatchBillSettled(ctx, pq, shop, tab, billId)
+	})
+	return adjustment, err
+}
+
+func (h *Handler) RemoveBillAdjustment(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int, billId int, adjustmentId int) error {
+	return WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_ADJUST_BILL, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		err := pq.RemoveBillAdjustment(ctx, tab, billId, adjustmentId, shop.Today())
+		if err != nil {
+			return err
+		}
+
+		return h.dispatchBillSettled(ctx, pq, shop, tab, billId)
+	})
+}
@@ -0,0 +1,50 @@
+package shop
+
+import (
+	"context"
+
+	"github.com/willtrojniak/TabAppBackend/db"
+	"github.com/willtrojniak/TabAppBackend/models"
+	"github.com/willtrojniak/TabAppBackend/services/authorization"
+	"github.com/willtrojniak/TabAppBackend/services/sessions"
+)
+
+func (h *Handler) GetChartstringFormats(ctx context.Context, session *sessions.AuthedSession, shopId int) (formats []models.ChartstringFormat, err error) {
+	err = WithAuthorizeShopAction(ctx, h.store, session, shopId, authorization.SHOP_ACTION_READ, func(pq *db.PgxQueries, user *models.User, shop *models.Shop) error {
+		formats = shop.ChartstringFormats
+		return nil
+	})
+	return formats, err
+}
+
+func (h *Handler) SetChartstringFormats(ctx context.Context, session *sessions.AuthedSession, shopId int, data *models.ChartstringFormatsUpdate) (formats []models.ChartstringFormat, err error) {
+	err = models.ValidateData(data, h.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	err = WithAuthorizeShopAction(ctx, h.store, session, shopId, authorization.SHOP_ACTION_UPDATE_SETTINGS, func(pq *db.PgxQueries, user *models.User, shop *models.Shop) error {
+		err := pq.SetChartstringFormats(ctx, shopId, data.Formats)
+		if err != nil {
+			return err
+		}
+
+		formats, err = pq.GetChartstringFormats(ctx, shopId)
+		return err
+	})
+	return formats, err
+}
+
+// Checks a chartstring against the shop's formats without saving it, e.g. as the user types
+func (h *Handler) ValidateChartstring(ctx context.Context, session *sessions.AuthedSession, shopId int, data *models.ChartstringValidate) (result models.ChartstringValidation, err error) {
+	err = models.ValidateData(data, h.logger)
+	if err != nil {
+		return result, err
+	}
+
+	err = WithAuthorizeShopAction(ctx, h.store, session, shopId, authorization.SHOP_ACTION_READ, func(pq *db.PgxQueries, user *models.User, shop *models.Shop) error {
+		result = models.ValidateChartstring(shop.ChartstringFormats, data.Chartstring)
+		return nil
+	})
+	return result, err
+}
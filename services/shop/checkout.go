@@ -0,0 +1,176 @@
+package shop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/willtrojniak/TabAppBackend/db"
+	"github.com/willtrojniak/TabAppBackend/env"
+	"github.com/willtrojniak/TabAppBackend/models"
+	"github.com/willtrojniak/TabAppBackend/services"
+	"github.com/willtrojniak/TabAppBackend/services/authorization"
+	"github.com/willtrojniak/TabAppBackend/services/payments"
+	"github.com/willtrojniak/TabAppBackend/services/sessions"
+)
+
+// Starts an online payment of the bill's outstanding balance, or returns the checkout already awaiting payment of it.
+// The payment is recorded once the provider confirms it.
+func (h *Handler) CreateBillCheckout(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int, billId int) (checkout *models.BillCheckout, err error) {
+	if h.payments == nil {
+		return nil, services.NewServiceError(errors.New("Online payments are not enabled"), http.StatusServiceUnavailable, nil)
+	}
+
+	var balance models.Money
+	var request *payments.CheckoutRequest
+	err = WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_PAY_ONLINE, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		var err error
+		balance, checkout, err = getBillCheckoutBalance(ctx, pq, shop, tab, billId)
+		if err != nil || checkout != nil {
+			return err
+		}
+
+		bill := findBill(tab, billId)
+		tabURL := fmt.Sprintf("%s/shops/%v/tabs/%v", env.Envs.UI_URI, shopId, tabId)
+		request = &payments.CheckoutRequest{
+			Amount:      models.NewMoney(balance.Amount, shop.Currency),
+			Description: fmt.Sprintf("%s %s bill (%v - %v)", shop.Name, tab.DisplayName, bill.StartDate, bill.EndDate),
+			Reference:   fmt.Sprintf("%v/%v/%v", shopId, tabId, billId),
+			SuccessURL:  tabURL,
+			CancelURL:   tabURL,
+		}
+		return nil
+	})
+	if err != nil || checkout != nil {
+		return checkout, err
+	}
+
+	// The provider is called outside of a transaction so that the bill is not locked while waiting on it
+	checkoutSession, err := h.payments.CreateCheckoutSession(ctx, request)
+	if err != nil {
+		return nil, services.NewInternalServiceError(err)
+	}
+
+	err = WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_PAY_ONLINE, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		current, pending, err := getBillCheckoutBalance(ctx, pq, shop, tab, billId)
+		if err != nil {
+			return err
+		}
+		// Another checkout of the bill was started while the session was being created
+		if pending != nil {
+			checkout = pending
+			return nil
+		}
+		if current.Amount != balance.Amount {
+			return services.NewDataConflictServiceError(errors.New("Bill balance changed while starting checkout"))
+		}
+
+		checkout, err = pq.CreateBillCheckout(ctx, shopId, tabId, billId, user.Id, &models.BillCheckoutCreate{
+			Provider:    h.payments.Name(),
+			SessionId:   checkoutSession.Id,
+			CheckoutURL: checkoutSession.URL,
+			Amount:      current,
+			ExpiresAt:   checkoutSession.ExpiresAt,
+		})
+		return err
+	})
+	return checkout, err
+}
+
+// Gets the outstanding balance of the bill to be paid online, along with the checkout already awaiting payment of it,
+// if any. The bill is locked until the transaction completes.
+func getBillCheckoutBalance(ctx context.Context, pq *db.PgxQueries, shop *models.Shop, tab *models.Tab, billId int) (models.Money, *models.BillCheckout, error) {
+	if !slices.Contains(shop.PaymentMethods, string(models.PaymentMethodCard)) {
+		return models.Money{}, nil, services.NewDataConflictServiceError(errors.New("Shop does not accept card payments"))
+	}
+
+	bill := findBill(tab, billId)
+	if bill == nil {
+		return models.Money{}, nil, services.NewNotFoundServiceError(nil)
+	}
+	balance, err := bill.Balance()
+	if err != nil {
+		return models.Money{}, nil, err
+	}
+	if bill.IsPaid || balance.IsNegative() || balance.IsZero() {
+		return models.Money{}, nil, services.NewDataConflictServiceError(errors.New("Bill has no outstanding balance"))
+	}
+	if !bill.IsChargeable(tab.PaymentMethod) {
+		return models.Money{}, nil, db.ErrBillNotApproved
+	}
+
+	pending, err := pq.GetPendingBillCheckout(ctx, tab.ShopId, tab.Id, billId, shop.Now())
+	if err != nil {
+		return models.Money{}, nil, err
+	}
+	if pending != nil && pending.Amount.Amount != balance.Amount {
+		return models.Money{}, nil, services.NewDataConflictServiceError(errors.New("A checkout of the bill is already in progress"))
+	}
+	return balance, pending, nil
+}
+
+// Records payments confirmed by the payment provider. Events for checkouts which were already completed
+// are acknowledged without being recorded again, as providers retry deliveries.
+// Events reporting nothing captured are acknowledged without being recorded, and payments captured in another currency
+// are kept on the checkout as unapplied, to be refunded.
+func (h *Handler) HandlePaymentWebhook(ctx context.Context, event *payments.WebhookEvent) error {
+	if event.Type != payments.WEBHOOK_EVENT_CHECKOUT_COMPLETED {
+		return nil
+	}
+
+	return db.WithTx(ctx, h.store, func(pq *db.PgxQueries) error {
+		checkout, err := pq.GetBillCheckoutForUpdate(ctx, h.payments.Name(), event.SessionId)
+		if err != nil {
+			return err
+		}
+		if checkout.CompletedAt != nil {
+			return nil
+		}
+
+		shop, err := pq.GetShopById(ctx, checkout.ShopId)
+		if err != nil {
+			return err
+		}
+		tab, err := pq.GetTabById(ctx, checkout.ShopId, checkout.TabId)
+		if err != nil {
+			return err
+		}
+
+		reference := []rune(event.PaymentId)
+		if len(reference) > 64 {
+			reference = reference[:64]
+		}
+
+		amount, err := models.CapturedAmount(event.Amount, shop.Currency)
+		if errors.Is(err, models.ErrInvalidCapturedAmount) {
+			h.logger.Warn("Ignoring payment webhook without a captured amount", "checkout", checkout.Id, "payment", event.PaymentId, "amount", event.Amount)
+			return nil
+		}
+		if errors.Is(err, models.ErrCurrencyMismatch) {
+			h.logger.Warn("Payment captured in another currency must be refunded",
+				"shop", checkout.ShopId, "tab", checkout.TabId, "bill", checkout.BillId, "checkout", checkout.Id, "payment", event.PaymentId, "amount", event.Amount)
+			return pq.CompleteBillCheckoutUnapplied(ctx, checkout, event.Amount, string(reference))
+		}
+		if err != nil {
+			return err
+		}
+
+		paymentId, err := pq.CompleteBillCheckout(ctx, tab, checkout, tab.OwnerId, &models.BillPaymentCreate{
+			Amount:    amount,
+			Method:    string(models.PaymentMethodCard),
+			Reference: string(reference),
+		}, shop.Today())
+		if err != nil {
+			return err
+		}
+		if paymentId == nil {
+			h.logger.Warn("Payment captured after its bill was posted to the journal must be refunded",
+				"shop", checkout.ShopId, "tab", checkout.TabId, "bill", checkout.BillId, "checkout", checkout.Id, "payment", event.PaymentId, "amount", amount)
+			return nil
+		}
+
+		return h.dispatchBillSettled(ctx, pq, shop, tab, checkout.BillId)
+	})
+}
@@ -0,0 +1,45 @@
+package shop
+
+import (
+	"context"
+
+	"github.com/willtrojniak/TabAppBackend/db"
+	"github.com/willtrojniak/TabAppBackend/models"
+	"github.com/willtrojniak/TabAppBackend/services"
+	"github.com/willtrojniak/TabAppBackend/services/authorization"
+	"github.com/willtrojniak/TabAppBackend/services/sessions"
+)
+
+func (h *Handler) GetBillComments(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int, billId int) (comments []models.BillComment, err error) {
+	err = WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_READ, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		if findBill(tab, billId) == nil {
+			return services.NewNotFoundServiceError(nil)
+		}
+
+		comments, err = pq.GetBillComments(ctx, shopId, tabId, billId)
+		return err
+	})
+	return comments, err
+}
+
+func (h *Handler) AddBillComment(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int, billId int, data *models.BillCommentCreate) (comment *models.BillComment, err error) {
+	err = models.ValidateData(data, h.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	err = WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_COMMENT_BILL, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		if findBill(tab, billId) == nil {
+			return services.NewNotFoundServiceError(nil)
+		}
+
+		commentId, err := pq.AddBillComment(ctx, shopId, tabId, billId, user.Id, data)
+		if err != nil {
+			return err
+		}
+
+		comment, err = pq.GetBillCommentById(ctx, shopId, tabId, billId, commentId)
+		return err
+	})
+	return comment, err
+}
@@ -2,7 +2,6 @@ package shop
 
 import (
 	"context"
-	"math"
 
 	"github.com/willtrojniak/TabAppBackend/db"
 	"github.com/willtrojniak/TabAppBackend/models"
@@ -15,9 +14,12 @@ func (h *Handler) CreateItem(ctx context.Context, session *sessions.AuthedSessio
 	if err != nil {
 		return err
 	}
-	rounded_price := float32(math.Round(float64(*data.BasePrice)*100) / 100)
-	data.BasePrice = &rounded_price
 	return WithAuthorizeShopAction(ctx, h.store, session, data.ShopId, authorization.SHOP_ACTION_CREATE_ITEM, func(pq *db.PgxQueries, user *models.User, shop *models.Shop) error {
+		err := shop.ApplyCurrency(data)
+		if err != nil {
+			return err
+		}
+
 		return pq.CreateItem(ctx, data)
 	})
 }
@@ -35,10 +37,13 @@ func (h *Handler) UpdateItem(ctx context.Context, session *sessions.AuthedSessio
 	if err != nil {
 		return err
 	}
-	rounded_price := float32(math.Round(float64(*data.BasePrice)*100) / 100)
-	data.BasePrice = &rounded_price
 
 	return WithAuthorizeShopAction(ctx, h.store, session, shopId, authorization.SHOP_ACTION_UPDATE_ITEM, func(pq *db.PgxQueries, user *models.User, shop *models.Shop) error {
+		err := shop.ApplyCurrency(data)
+		if err != nil {
+			return err
+		}
+
 		return pq.UpdateItem(ctx, shopId, itemId, data)
 	})
 }
@@ -65,6 +70,11 @@ func (h *Handler) CreateItemVariant(ctx context.Context, session *sessions.Authe
 	}
 
 	return WithAuthorizeShopAction(ctx, h.store, session, data.ShopId, authorization.SHOP_ACTION_CREATE_VARIANT, func(pq *db.PgxQueries, user *models.User, shop *models.Shop) error {
+		err := shop.ApplyCurrency(data)
+		if err != nil {
+			return err
+		}
+
 		return pq.CreateItemVariant(ctx, data)
 	})
 }
@@ -76,6 +86,11 @@ func (h *Handler) UpdateItemVariant(ctx context.Context, session *sessions.Authe
 	}
 
 	return WithAuthorizeShopAction(ctx, h.store, session, shopId, authorization.SHOP_ACTION_UPDATE_VARIANT, func(pq *db.PgxQueries, user *models.User, shop *models.Shop) error {
+		err := shop.ApplyCurrency(data)
+		if err != nil {
+			return err
+		}
+
 		return pq.UpdateItemVariant(ctx, shopId, itemId, variantId, data)
 	})
 }
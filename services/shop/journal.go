@@ -0,0 +1,105 @@
+package shop
+
+import (
+	"context"
+	"errors"
+
+	"github.com/willtrojniak/TabAppBackend/db"
+	"github.com/willtrojniak/TabAppBackend/models"
+	"github.com/willtrojniak/TabAppBackend/services"
+	"github.com/willtrojniak/TabAppBackend/services/authorization"
+	"github.com/willtrojniak/TabAppBackend/services/billing"
+	"github.com/willtrojniak/TabAppBackend/services/sessions"
+)
+
+func (h *Handler) GetJournalSettings(ctx context.Context, session *sessions.AuthedSession, shopId int) (settings *models.JournalSettings, err error) {
+	err = WithAuthorizeShopAction(ctx, h.store, session, shopId, authorization.SHOP_ACTION_READ_JOURNAL, func(pq *db.PgxQueries, user *models.User, shop *models.Shop) error {
+		settings, err = pq.GetJournalSettings(ctx, shopId)
+		return err
+	})
+	return settings, err
+}
+
+func (h *Handler) SetJournalSettings(ctx context.Context, session *sessions.AuthedSession, shopId int, data *models.JournalSettingsUpdate) (settings *models.JournalSettings, err error) {
+	err = models.ValidateData(data, h.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	err = WithAuthorizeShopAction(ctx, h.store, session, shopId, authorization.SHOP_ACTION_UPDATE_SETTINGS, func(pq *db.PgxQueries, user *models.User, shop *models.Shop) error {
+		err := pq.SetJournalSettings(ctx, shopId, data)
+		if err != nil {
+			return err
+		}
+
+		settings, err = pq.GetJournalSettings(ctx, shopId)
+		return err
+	})
+	return settings, err
+}
+
+func (h *Handler) GetJournalExports(ctx context.Context, session *sessions.AuthedSession, shopId int) (exports []models.JournalExportOverview, err error) {
+	err = WithAuthorizeShopAction(ctx, h.store, session, shopId, authorization.SHOP_ACTION_READ_JOURNAL, func(pq *db.PgxQueries, user *models.User, shop *models.Shop) error {
+		exports, err = pq.GetJournalExports(ctx, shopId)
+		return err
+	})
+	return exports, err
+}
+
+func (h *Handler) GetJournalExport(ctx context.Context, session *sessions.AuthedSession, shopId int, exportId int) (export *models.JournalExport, err error) {
+	err = WithAuthorizeShopAction(ctx, h.store, session, shopId, authorization.SHOP_ACTION_READ_JOURNAL, func(pq *db.PgxQueries, user *models.User, shop *models.Shop) error {
+		export, err = pq.GetJournalExportById(ctx, shopId, exportId)
+		return err
+	})
+	return export, err
+}
+
+// Renders the export as a journal file with the shop's current column mapping
+func (h *Handler) GetJournalExportFile(ctx context.Context, session *sessions.AuthedSession, shopId int, exportId int) (file []byte, err error) {
+	err = WithAuthorizeShopAction(ctx, h.store, session, shopId, authorization.SHOP_ACTION_READ_JOURNAL, func(pq *db.PgxQueries, user *models.User, shop *models.Shop) error {
+		export, err := pq.GetJournalExportById(ctx, shopId, exportId)
+		if err != nil {
+			return err
+		}
+
+		settings, err := pq.GetJournalSettings(ctx, shopId)
+		if err != nil {
+			return err
+		}
+
+		file = export.CSV(shop, settings.Columns)
+		return nil
+	})
+	return file, err
+}
+
+func (h *Handler) CreateJournalExport(ctx context.Context, session *sessions.AuthedSession, shopId int, data *models.JournalExportCreate) (export *models.JournalExport, err error) {
+	err = models.ValidateData(data, h.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	err = WithAuthorizeShopAction(ctx, h.store, session, shopId, authorization.SHOP_ACTION_EXPORT_JOURNAL, func(pq *db.PgxQueries, user *models.User, shop *models.Shop) error {
+		settings, err := pq.GetJournalSettings(ctx, shopId)
+		if err != nil {
+			return err
+		}
+		if settings.RevenueAccount == "" {
+			return services.NewDataConflictServiceError(errors.New("Journal exports are not configured"))
+		}
+
+		exportId, settled, err := pq.CreateJournalExport(ctx, shop, data, settings.RevenueAccount, &user.Id)
+		if err != nil {
+			return err
+		}
+
+		err = billing.DispatchBillsPaid(ctx, pq, h.eventDispatcher, shop, settled)
+		if err != nil {
+			return err
+		}
+
+		export, err = pq.GetJournalExportById(ctx, shopId, exportId)
+		return err
+	})
+	return export, err
+}
@@ -0,0 +1,83 @@
+package shop
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/willtrojniak/TabAppBackend/db"
+	"github.com/willtrojniak/TabAppBackend/models"
+	"github.com/willtrojniak/TabAppBackend/services/authorization"
+	"github.com/willtrojniak/TabAppBackend/services/sessions"
+)
+
+// Gets the tabs which the session user can charge to as a member of the verification list
+func (h *Handler) GetTabsForMember(ctx context.Context, session *sessions.AuthedSession) (tabs []models.MemberTab, err error) {
+	err = db.WithTx(ctx, db.PgxConn(h.store), func(pq *db.PgxQueries) error {
+		user, err := pq.GetUser(ctx, session.UserId)
+		if err != nil {
+			return err
+		}
+
+		overviews, err := pq.GetTabs(ctx, &models.GetTabsQueryParams{MemberEmail: &user.Email})
+		if err != nil {
+			return err
+		}
+
+		tabs = make([]models.MemberTab, 0, len(overviews))
+		for _, t := range overviews {
+			if t.Status == models.TAB_STATUS_PENDING.String() {
+				continue
+			}
+			tabs = append(tabs, t.MemberView())
+		}
+		return nil
+	})
+	return tabs, err
+}
+
+func (h *Handler) GetTabForMember(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int) (detail *models.MemberTabDetail, err error) {
+	err = WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_READ_AS_MEMBER, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		email, _ := tab.VerificationMember(user.Email)
+		spent, err := pq.GetMemberSpent(ctx, shopId, tabId, email)
+		if err != nil {
+			return err
+		}
+
+		var billId *int
+		if b := tab.CurrentBill(shop.Today()); b != nil {
+			billId = &b.Id
+		}
+		now := shop.Now()
+		dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		usages, err := pq.GetMemberLimitRuleUsages(ctx, shopId, tabId, billId, dayStart, strings.ToLower(email))
+		if err != nil {
+			return err
+		}
+
+		allowance, err := tab.MemberAllowance(shop.Today(), spent, usages)
+		if err != nil {
+			return err
+		}
+
+		detail = &models.MemberTabDetail{
+			MemberTab: tab.MemberView(),
+			Email:     email,
+			IsActive:  tab.IsActiveAt(shop.Now()),
+			Allowance: allowance,
+		}
+		return nil
+	})
+	return detail, err
+}
+
+// Gets the orders placed for the session user on the tab
+func (h *Handler) GetTabOrdersForMember(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int, params *models.GetOrdersQueryParams) (orders []models.Order, err error) {
+	err = WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_READ_AS_MEMBER, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		email, _ := tab.VerificationMember(user.Email)
+		params.OrderedByEmail = &email
+		orders, err = pq.GetTabOrders(ctx, shopId, tabId, params)
+		return err
+	})
+	return orders, err
+}
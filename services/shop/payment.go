@@ -0,0 +1,227 @@
+package shop
+
+import (
+	"context"
+
+	"github.com/willtrojniak/TabAppBackend/db"
+	"github.com/willtrojniak/TabAppBackend/models"
+	"github.com/willtrojniak/TabAppBackend/services"
+	"github.com/willtrojniak/TabAppBackend/services/authorization"
+	"github.com/willtrojniak/TabAppBackend/services/events"
+	"github.com/willtrojniak/TabAppBackend/services/invoices"
+	"github.com/willtrojniak/TabAppBackend/services/sessions"
+)
+
+// Pays the outstanding balance of the bill with the tab's payment details
+func (h *Handler) MarkTabBillPaid(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int, billId int) error {
+	return WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_CLOSE_BILL, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		err := pq.MarkTabBillPaid(ctx, tab, billId, user.Id, shop.Today())
+		if err != nil {
+			return err
+		}
+
+		return h.dispatchBillSettled(ctx, pq, shop, tab, billId)
+	})
+}
+
+// Approves the closed bill on behalf of the tab owner, allowing it to be charged
+func (h *Handler) ApproveTabBill(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int, billId int) error {
+	return WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_SIGNOFF_BILL, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		err := pq.ApproveTabBill(ctx, tab, billId)
+		if err != nil {
+			return err
+		}
+
+		tab, err = pq.GetTabById(ctx, shopId, tabId)
+		if err != nil {
+			return err
+		}
+
+		events.Dispatch(h.eventDispatcher, events.TabBillApprovedEvent{Shop: shop, Tab: tab, Bill: findBill(tab, billId), TabOwner: user})
+		return nil
+	})
+}
+
+// Disputes the closed bill on behalf of the tab owner, notifying the shop's managers
+func (h *Handler) DisputeTabBill(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int, billId int, data *models.BillCommentCreate) (comment *models.BillComment, err error) {
+	err = models.ValidateData(data, h.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	err = WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_SIGNOFF_BILL, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		commentId, err := pq.DisputeTabBill(ctx, tab, billId, user.Id, data)
+		if err != nil {
+			return err
+		}
+
+		comment, err = pq.GetBillCommentById(ctx, shopId, tabId, billId, commentId)
+		if err != nil {
+			return err
+		}
+
+		tab, err = pq.GetTabById(ctx, shopId, tabId)
+		if err != nil {
+			return err
+		}
+
+		events.Dispatch(h.eventDispatcher, events.TabBillDisputedEvent{Shop: shop, Tab: tab, Bill: findBill(tab, billId), Comment: comment, TabOwner: user})
+		return nil
+	})
+	return comment, err
+}
+
+// Resolves the dispute with adjustments to the bill, returning it to the tab owner for approval
+func (h *Handler) ResolveBillDispute(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int, billId int, data *models.BillDisputeResolve) (comment *models.BillComment, err error) {
+	err = models.ValidateData(data, h.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	err = WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_RESOLVE_DISPUTE, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		commentId, err := pq.ResolveBillDispute(ctx, tab, billId, user.Id, data, shop.Today())
+		if err != nil {
+			return err
+		}
+
+		comment, err = pq.GetBillCommentById(ctx, shopId, tabId, billId, commentId)
+		if err != nil {
+			return err
+		}
+
+		// A credit may cover the remaining balance of the bill
+		err = h.dispatchBillSettled(ctx, pq, shop, tab, billId)
+		if err != nil {
+			return err
+		}
+
+		tab, err = pq.GetTabById(ctx, shopId, tabId)
+		if err != nil {
+			return err
+		}
+
+		owner, err := pq.GetUser(ctx, tab.OwnerId)
+		if err != nil {
+			return err
+		}
+
+		events.Dispatch(h.eventDispatcher, events.TabBillDisputeResolvedEvent{Shop: shop, Tab: tab, Bill: findBill(tab, billId), Comment: comment, TabOwner: owner})
+		return nil
+	})
+	return comment, err
+}
+
+func (h *Handler) GetBillPayments(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int, billId int) (payments []models.BillPayment, err error) {
+	err = WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_READ, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		if findBill(tab, billId) == nil {
+			return services.NewNotFoundServiceError(nil)
+		}
+
+		payments, err = pq.GetBillPayments(ctx, shopId, tabId, billId)
+		return err
+	})
+	return payments, err
+}
+
+func (h *Handler) RecordBillPayment(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int, billId int, data *models.BillPaymentCreate) (payment *models.BillPayment, err error) {
+	err = models.ValidateData(data, h.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	err = WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_RECORD_PAYMENT, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		err := shop.ApplyCurrency(data)
+		if err != nil {
+			return err
+		}
+
+		err = data.ValidatePaymentDetails(shop)
+		if err != nil {
+			return err
+		}
+
+		paymentId, err := pq.RecordBillPayment(ctx, tab, billId, user.Id, data, shop.Today())
+		if err != nil {
+			return err
+		}
+
+		payment, err = pq.GetBillPaymentById(ctx, shopId, tabId, billId, paymentId)
+		if err != nil {
+			return err
+		}
+
+		return h.dispatchBillSettled(ctx, pq, shop, tab, billId)
+	})
+	return payment, err
+}
+
+func (h *Handler) ReverseBillPayment(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int, billId int, paymentId int, data *models.BillPaymentReversalCreate) (payment *models.BillPayment, err error) {
+	err = models.ValidateData(data, h.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	err = WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_REVERSE_PAYMENT, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		err := pq.ReverseBillPayment(ctx, tab, billId, paymentId, user.Id, data, shop.Today())
+		if err != nil {
+			return err
+		}
+
+		payment, err = pq.GetBillPaymentById(ctx, shopId, tabId, billId, paymentId)
+		return err
+	})
+	return payment, err
+}
+
+// Notifies the tab owner if the bill has just been settled in full
+func (h *Handler) dispatchBillSettled(ctx context.Context, pq *db.PgxQueries, shop *models.Shop, tab *models.Tab, billId int) error {
+	before := findBill(tab, billId)
+	if before != nil && before.IsPaid {
+		return nil
+	}
+
+	tab, err := pq.GetTabById(ctx, int(shop.Id), tab.Id)
+	if err != nil {
+		return err
+	}
+
+	bill := findBill(tab, billId)
+	if bill == nil || !bill.IsPaid {
+		return nil
+	}
+
+	owner, err := pq.GetUser(ctx, tab.OwnerId)
+	if err != nil {
+		return err
+	}
+
+	events.Dispatch(h.eventDispatcher, events.TabBillPaidEvent{Shop: shop, Tab: tab, Bill: bill, TabOwner: owner})
+	return nil
+}
+
+func findBill(tab *models.Tab, billId int) *models.Bill {
+	for i := range tab.Bills {
+		if tab.Bills[i].Id == billId {
+			return &tab.Bills[i]
+		}
+	}
+	return nil
+}
+
+func (h *Handler) GetBillInvoice(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int, billId int) (invoice []byte, err error) {
+	err = WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_READ, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		bill := findBill(tab, billId)
+		if bill == nil {
+			return services.NewNotFoundServiceError(nil)
+		}
+
+		owner, err := pq.GetUser(ctx, tab.OwnerId)
+		if err != nil {
+			return err
+		}
+
+		invoice, err = invoices.RenderBillInvoice(shop, tab, bill, owner)
+		return err
+	})
+	return invoice, err
+}
@@ -1,15 +1,20 @@
 package shop
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/willtrojniak/TabAppBackend/env"
 	"github.com/willtrojniak/TabAppBackend/models"
 	"github.com/willtrojniak/TabAppBackend/services"
+	"github.com/willtrojniak/TabAppBackend/services/payments"
 	"github.com/willtrojniak/TabAppBackend/services/sessions"
+	"github.com/willtrojniak/TabAppBackend/util"
 	"golang.org/x/oauth2"
 )
 
@@ -22,6 +27,10 @@ const (
 	substitutionGroupIdParam = "substitutionGroupId"
 	tabIdParam               = "tabId"
 	billIdParam              = "billId"
+	orderIdParam             = "orderId"
+	paymentIdParam           = "paymentId"
+	exportIdParam            = "exportId"
+	adjustmentIdParam        = "adjustmentId"
 )
 
 func (h *Handler) RegisterRoutes(router *http.ServeMux) {
@@ -29,6 +38,7 @@ func (h *Handler) RegisterRoutes(router *http.ServeMux) {
 	router.HandleFunc("POST /shops", h.sessions.WithAuthedSession(h.handleCreateShop))
 	router.HandleFunc("GET /shops", h.sessions.WithAuthedSession(h.handleGetShops))
 	router.HandleFunc("GET /tabs", h.sessions.WithAuthedSession(h.handleGetTabs))
+	router.HandleFunc("GET /tabs/member", h.sessions.WithAuthedSession(h.handleGetTabsForMember))
 
 	// Slack
 	router.HandleFunc(fmt.Sprintf("GET /auth/slack/shops/{%v}", shopIdParam), h.sessions.WithAuthedSession(h.handleBeginInstallSlack))
@@ -42,8 +52,19 @@ func (h *Handler) RegisterRoutes(router *http.ServeMux) {
 	// Shops
 	router.HandleFunc(fmt.Sprintf("GET /shops/{%v}", shopIdParam), h.sessions.WithAuthedSession(h.handleGetShopById))
 	router.HandleFunc(fmt.Sprintf("PATCH /shops/{%v}", shopIdParam), h.sessions.WithAuthedSession(h.handleUpdateShop))
+	router.HandleFunc(fmt.Sprintf("PATCH /shops/{%v}/settings", shopIdParam), h.sessions.WithAuthedSession(h.handleUpdateShopSettings))
 	router.HandleFunc(fmt.Sprintf("DELETE /shops/{%v}", shopIdParam), h.sessions.WithAuthedSession(h.handleDeleteShop))
 
+	// Chartstring Formats
+	router.HandleFunc(fmt.Sprintf("GET /shops/{%v}/chartstring-formats", shopIdParam), h.sessions.WithAuthedSession(h.handleGetChartstringFormats))
+	router.HandleFunc(fmt.Sprintf("PUT /shops/{%v}/chartstring-formats", shopIdParam), h.sessions.WithAuthedSession(h.handleSetChartstringFormats))
+	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/chartstring-formats/validate", shopIdParam), h.sessions.WithAuthedSession(h.handleValidateChartstring))
+	router.HandleFunc(fmt.Sprintf("GET /shops/{%v}/journal-settings", shopIdParam), h.sessions.WithAuthedSession(h.handleGetJournalSettings))
+	router.HandleFunc(fmt.Sprintf("PUT /shops/{%v}/journal-settings", shopIdParam), h.sessions.WithAuthedSession(h.handleSetJournalSettings))
+	router.HandleFunc(fmt.Sprintf("GET /shops/{%v}/journal-exports", shopIdParam), h.sessions.WithAuthedSession(h.handleGetJournalExports))
+	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/journal-exports", shopIdParam), h.sessions.WithAuthedSession(h.handleCreateJournalExport))
+	router.HandleFunc(fmt.Sprintf("GET /shops/{%v}/journal-exports/{%v}", shopIdParam, exportIdParam), h.sessions.WithAuthedSession(h.handleGetJournalExport))
+
 	// Users & Permissions
 	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/users/invite", shopIdParam), h.sessions.WithAuthedSession(h.handleInviteUser))
 	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/users/remove", shopIdParam), h.sessions.WithAuthedSession(h.handleRemoveUser))
@@ -79,20 +100,58 @@ func (h *Handler) RegisterRoutes(router *http.ServeMux) {
 	router.HandleFunc(fmt.Sprintf("DELETE /shops/{%v}/substitutions/{%v}", shopIdParam, substitutionGroupIdParam), h.sessions.WithAuthedSession(h.handleDeleteSubstitutionGroup))
 
 	// Tabs
-	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/tabs", shopIdParam), h.sessions.WithAuthedSession(h.handleCreateTab))
+	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/tabs", shopIdParam), h.sessions.WithAuthedSession(h.idempotency.WithIdempotencyKey(h.handleCreateTab)))
 	router.HandleFunc(fmt.Sprintf("GET /shops/{%v}/tabs", shopIdParam), h.sessions.WithAuthedSession(h.handleGetTabsForShop))
 	router.HandleFunc(fmt.Sprintf("GET /shops/{%v}/tabs/{%v}", shopIdParam, tabIdParam), h.sessions.WithAuthedSession(h.handleGetTabById))
 	router.HandleFunc(fmt.Sprintf("PATCH /shops/{%v}/tabs/{%v}", shopIdParam, tabIdParam), h.sessions.WithAuthedSession(h.handleUpdateTab))
 	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/tabs/{%v}/approve", shopIdParam, tabIdParam), h.sessions.WithAuthedSession(h.handleApproveTab))
 	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/tabs/{%v}/close", shopIdParam, tabIdParam), h.sessions.WithAuthedSession(h.handleCloseTab))
-	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/tabs/{%v}/bills/{%v}/close", shopIdParam, tabIdParam, billIdParam), h.sessions.WithAuthedSession(h.handleCloseTabBill))
+	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/tabs/{%v}/bills/{%v}/close", shopIdParam, tabIdParam, billIdParam), h.sessions.WithAuthedSession(h.idempotency.WithIdempotencyKey(h.handleCloseTabBill)))
+	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/tabs/{%v}/bills/{%v}/cutoff", shopIdParam, tabIdParam, billIdParam), h.sessions.WithAuthedSession(h.handleCutTabBill))
+	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/tabs/{%v}/bills/{%v}/approve", shopIdParam, tabIdParam, billIdParam), h.sessions.WithAuthedSession(h.handleApproveTabBill))
+	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/tabs/{%v}/bills/{%v}/dispute", shopIdParam, tabIdParam, billIdParam), h.sessions.WithAuthedSession(h.handleDisputeTabBill))
+	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/tabs/{%v}/bills/{%v}/resolve", shopIdParam, tabIdParam, billIdParam), h.sessions.WithAuthedSession(h.handleResolveBillDispute))
+	router.HandleFunc(fmt.Sprintf("GET /shops/{%v}/tabs/{%v}/bills/{%v}/comments", shopIdParam, tabIdParam, billIdParam), h.sessions.WithAuthedSession(h.handleGetBillComments))
+	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/tabs/{%v}/bills/{%v}/comments", shopIdParam, tabIdParam, billIdParam), h.sessions.WithAuthedSession(h.handleAddBillComment))
+	router.HandleFunc(fmt.Sprintf("GET /shops/{%v}/tabs/{%v}/bills/{%v}/invoice.pdf", shopIdParam, tabIdParam, billIdParam), h.sessions.WithAuthedSession(h.handleGetBillInvoice))
+	router.HandleFunc(fmt.Sprintf("GET /shops/{%v}/tabs/{%v}/bills/{%v}/payments", shopIdParam, tabIdParam, billIdParam), h.sessions.WithAuthedSession(h.handleGetBillPayments))
+	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/tabs/{%v}/bills/{%v}/payments", shopIdParam, tabIdParam, billIdParam), h.sessions.WithAuthedSession(h.handleRecordBillPayment))
+	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/tabs/{%v}/bills/{%v}/payments/{%v}/reverse", shopIdParam, tabIdParam, billIdParam, paymentIdParam), h.sessions.WithAuthedSession(h.handleReverseBillPayment))
+	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/tabs/{%v}/bills/{%v}/adjustments", shopIdParam, tabIdParam, billIdParam), h.sessions.WithAuthedSession(h.handleAddBillAdjustment))
+	router.HandleFunc(fmt.Sprintf("DELETE /shops/{%v}/tabs/{%v}/bills/{%v}/adjustments/{%v}", shopIdParam, tabIdParam, billIdParam, adjustmentIdParam), h.sessions.WithAuthedSession(h.handleRemoveBillAdjustment))
+	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/tabs/{%v}/bills/{%v}/checkout", shopIdParam, tabIdParam, billIdParam), h.sessions.WithAuthedSession(h.handleCreateBillCheckout))
+	router.HandleFunc(fmt.Sprintf("GET /shops/{%v}/tabs/{%v}/budget", shopIdParam, tabIdParam), h.sessions.WithAuthedSession(h.handleGetTabBudget))
+	router.HandleFunc(fmt.Sprintf("PUT /shops/{%v}/tabs/{%v}/limit-rules", shopIdParam, tabIdParam), h.sessions.WithAuthedSession(h.handleSetTabLimitRules))
 
 	// Orders
-	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/tabs/{%v}/add-order", shopIdParam, tabIdParam), h.sessions.WithAuthedSession(h.handleAddOrderToTab))
-	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/tabs/{%v}/remove-order", shopIdParam, tabIdParam), h.sessions.WithAuthedSession(h.handleRemoveOrderFromTab))
+	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/tabs/{%v}/add-order", shopIdParam, tabIdParam), h.sessions.WithAuthedSession(h.idempotency.WithIdempotencyKey(h.handleAddOrderToTab)))
+	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/tabs/{%v}/remove-order", shopIdParam, tabIdParam), h.sessions.WithAuthedSession(h.idempotency.WithIdempotencyKey(h.handleRemoveOrderFromTab)))
+	router.HandleFunc(fmt.Sprintf("GET /shops/{%v}/tabs/{%v}/orders", shopIdParam, tabIdParam), h.sessions.WithAuthedSession(h.handleGetTabOrders))
+	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/tabs/{%v}/orders/{%v}/void", shopIdParam, tabIdParam, orderIdParam), h.sessions.WithAuthedSession(h.idempotency.WithIdempotencyKey(h.handleVoidTabOrder)))
+	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/tabs/{%v}/orders/{%v}/transfer", shopIdParam, tabIdParam, orderIdParam), h.sessions.WithAuthedSession(h.handleTransferTabOrder))
+
+	// Member Self-Service
+	router.HandleFunc(fmt.Sprintf("GET /shops/{%v}/tabs/{%v}/member", shopIdParam, tabIdParam), h.sessions.WithAuthedSession(h.handleGetTabForMember))
+	router.HandleFunc(fmt.Sprintf("GET /shops/{%v}/tabs/{%v}/member/orders", shopIdParam, tabIdParam), h.sessions.WithAuthedSession(h.handleGetTabOrdersForMember))
+
+	// Member Verification
+	router.HandleFunc(fmt.Sprintf("GET /shops/{%v}/tabs/{%v}/verification-token", shopIdParam, tabIdParam), h.sessions.WithAuthedSession(h.handleGetVerificationToken))
+	router.HandleFunc(fmt.Sprintf("GET /shops/{%v}/tabs/{%v}/verification-token/qr", shopIdParam, tabIdParam), h.sessions.WithAuthedSession(h.handleGetVerificationQRCode))
+	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/verify", shopIdParam), h.sessions.WithAuthedSession(h.handleVerifyToken))
+
+	// Vouchers
+	router.HandleFunc(fmt.Sprintf("POST /shops/{%v}/tabs/{%v}/vouchers", shopIdParam, tabIdParam), h.sessions.WithAuthedSession(h.handleCreateTabVouchers))
+	router.HandleFunc(fmt.Sprintf("GET /shops/{%v}/tabs/{%v}/vouchers", shopIdParam, tabIdParam), h.sessions.WithAuthedSession(h.handleGetTabVouchers))
 
 }
 
+// Registers routes called by external services, which are not authenticated with a session
+func (h *Handler) RegisterWebhookRoutes(router *http.ServeMux) {
+	if h.payments != nil {
+		router.HandleFunc(fmt.Sprintf("POST %v", payments.WebhookPath(h.payments.Name())), h.handlePaymentWebhook)
+	}
+}
+
 func (h *Handler) handleCreateShop(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
 
 	data := &models.ShopCreate{}
@@ -187,6 +246,27 @@ func (h *Handler) handleUpdateShop(w http.ResponseWriter, r *http.Request, sessi
 	}
 }
 
+func (h *Handler) handleUpdateShopSettings(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shopId"))
+		return
+	}
+
+	data := models.ShopSettingsUpdate{}
+	err = models.ReadRequestJson(r, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	err = h.UpdateShopSettings(r.Context(), session, shopId, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+}
+
 func (h *Handler) handleDeleteShop(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
 	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
 	if err != nil {
@@ -201,6 +281,193 @@ func (h *Handler) handleDeleteShop(w http.ResponseWriter, r *http.Request, sessi
 	}
 }
 
+func (h *Handler) handleGetChartstringFormats(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shopId"))
+		return
+	}
+
+	formats, err := h.GetChartstringFormats(r.Context(), session, shopId)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(formats)
+}
+
+func (h *Handler) handleSetChartstringFormats(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shopId"))
+		return
+	}
+
+	data := models.ChartstringFormatsUpdate{}
+	err = models.ReadRequestJson(r, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	formats, err := h.SetChartstringFormats(r.Context(), session, shopId, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(formats)
+}
+
+func (h *Handler) handleValidateChartstring(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shopId"))
+		return
+	}
+
+	data := models.ChartstringValidate{}
+	err = models.ReadRequestJson(r, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	result, err := h.ValidateChartstring(r.Context(), session, shopId, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func (h *Handler) handleGetJournalSettings(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shopId"))
+		return
+	}
+
+	settings, err := h.GetJournalSettings(r.Context(), session, shopId)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+func (h *Handler) handleSetJournalSettings(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shopId"))
+		return
+	}
+
+	data := models.JournalSettingsUpdate{}
+	err = models.ReadRequestJson(r, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	settings, err := h.SetJournalSettings(r.Context(), session, shopId, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+func (h *Handler) handleGetJournalExports(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shopId"))
+		return
+	}
+
+	exports, err := h.GetJournalExports(r.Context(), session, shopId)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(exports)
+}
+
+func (h *Handler) handleCreateJournalExport(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shopId"))
+		return
+	}
+
+	data := models.JournalExportCreate{}
+	err = models.ReadRequestJson(r, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	export, err := h.CreateJournalExport(r.Context(), session, shopId, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(export)
+}
+
+func (h *Handler) handleGetJournalExport(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	const formatKey = "format"
+	const formatCSV = "csv"
+
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shopId"))
+		return
+	}
+
+	exportId, err := strconv.Atoi(r.PathValue(exportIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid export id"))
+		return
+	}
+
+	// CSV exports are the journal file uploaded to the finance system
+	if r.URL.Query().Get(formatKey) == formatCSV {
+		file, err := h.GetJournalExportFile(r.Context(), session, shopId, exportId)
+		if err != nil {
+			h.handleError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"journal-%v-%v.csv\"", shopId, exportId))
+		w.Write(file)
+		return
+	}
+
+	export, err := h.GetJournalExport(r.Context(), session, shopId, exportId)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(export)
+}
+
 func (h *Handler) handleBeginInstallSlack(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
 	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
 	if err != nil {
@@ -350,8 +617,7 @@ func (h *Handler) handleAcceptInvite(w http.ResponseWriter, r *http.Request, ses
 }
 
 func (h *Handler) handleGetPaymentMethods(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
-	methods := make([]models.PaymentMethod, 0)
-	methods = append(methods, models.PaymentMethodInPerson, models.PaymentMethodChartstring)
+	methods := models.PaymentMethodTypes()
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(methods)
@@ -873,150 +1139,999 @@ func (h *Handler) handleGetTabById(w http.ResponseWriter, r *http.Request, sessi
 
 }
 
-func (h *Handler) handleUpdateTab(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+func (h *Handler) handleGetTabBudget(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
 	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
 	if err != nil {
 		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
 		return
 	}
+	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
+		return
+	}
+
+	budget, err := h.GetTabBudget(r.Context(), session, shopId, tabId)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(budget)
+}
 
+func (h *Handler) handleSetTabLimitRules(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
+		return
+	}
 	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
 	if err != nil {
 		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
 		return
 	}
 
-	data := models.TabUpdate{}
+	data := models.TabLimitRulesUpdate{}
 	err = models.ReadRequestJson(r, &data)
 	if err != nil {
 		h.handleError(w, err)
 		return
 	}
 
-	err = h.UpdateTab(r.Context(), session, shopId, tabId, &data)
+	rules, err := h.SetTabLimitRules(r.Context(), session, shopId, tabId, &data)
 	if err != nil {
 		h.handleError(w, err)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
 }
 
-func (h *Handler) handleApproveTab(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+func (h *Handler) handleGetTabOrders(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
 	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
 	if err != nil {
 		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
 		return
 	}
-
 	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
 	if err != nil {
 		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
 		return
 	}
 
-	err = h.ApproveTab(r.Context(), session, shopId, tabId)
+	params := getOrdersQueryParams(r)
+	orders, err := h.GetTabOrders(r.Context(), session, shopId, tabId, &params)
 	if err != nil {
 		h.handleError(w, err)
 		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orders)
 }
 
-func (h *Handler) handleCloseTab(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+func getOrdersQueryParams(r *http.Request) models.GetOrdersQueryParams {
+	// Query params
+	const limitKey = "limit"
+	const offsetKey = "offset"
+	const defaultLimit = 50
+	const maxLimit = 100
+
+	limit := defaultLimit
+	params := models.GetOrdersQueryParams{Limit: &limit}
+
+	rawParams := r.URL.Query()
+	if rawParams.Has(limitKey) {
+		if l, err := strconv.Atoi(rawParams.Get(limitKey)); err == nil && l >= 1 {
+			limit = min(l, maxLimit)
+		}
+	}
+
+	if rawParams.Has(offsetKey) {
+		if offset, err := strconv.Atoi(rawParams.Get(offsetKey)); err == nil && offset >= 0 {
+			params.Offset = offset
+		}
+	}
+	return params
+}
+
+func (h *Handler) handleGetTabsForMember(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	tabs, err := h.GetTabsForMember(r.Context(), session)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tabs)
+}
+
+func (h *Handler) handleGetTabForMember(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
 	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
 	if err != nil {
 		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
 		return
 	}
-
 	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
 	if err != nil {
 		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
 		return
 	}
 
-	err = h.CloseTab(r.Context(), session, shopId, tabId)
+	tab, err := h.GetTabForMember(r.Context(), session, shopId, tabId)
 	if err != nil {
 		h.handleError(w, err)
 		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tab)
 }
 
-func (h *Handler) handleAddOrderToTab(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+func (h *Handler) handleGetTabOrdersForMember(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
 	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
 	if err != nil {
 		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
 		return
 	}
-
 	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
 	if err != nil {
 		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
 		return
 	}
 
-	data := models.BillOrderCreate{}
-	err = models.ReadRequestJson(r, &data)
-	if err != nil {
-		h.handleError(w, err)
-		return
-	}
-
-	err = h.AddOrderToTab(r.Context(), session, shopId, tabId, &data)
+	params := getOrdersQueryParams(r)
+	orders, err := h.GetTabOrdersForMember(r.Context(), session, shopId, tabId, &params)
 	if err != nil {
 		h.handleError(w, err)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orders)
 }
 
-func (h *Handler) handleRemoveOrderFromTab(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+func (h *Handler) handleVoidTabOrder(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
 	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
 	if err != nil {
 		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
 		return
 	}
-
 	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
 	if err != nil {
 		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
 		return
 	}
+	orderId, err := strconv.Atoi(r.PathValue(orderIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid order id"))
+		return
+	}
 
-	data := models.BillOrderCreate{}
+	data := models.OrderVoidCreate{}
 	err = models.ReadRequestJson(r, &data)
 	if err != nil {
 		h.handleError(w, err)
 		return
 	}
 
-	err = h.RemoveOrderFromTab(r.Context(), session, shopId, tabId, &data)
+	order, err := h.VoidTabOrder(r.Context(), session, shopId, tabId, orderId, &data)
 	if err != nil {
 		h.handleError(w, err)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
 }
 
-func (h *Handler) handleCloseTabBill(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+func (h *Handler) handleTransferTabOrder(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
 	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
 	if err != nil {
 		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
 		return
 	}
-
 	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
 	if err != nil {
 		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
 		return
 	}
+	orderId, err := strconv.Atoi(r.PathValue(orderIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid order id"))
+		return
+	}
 
-	billId, err := strconv.Atoi(r.PathValue(billIdParam))
+	data := models.OrderTransferCreate{}
+	err = models.ReadRequestJson(r, &data)
 	if err != nil {
-		h.handleError(w, services.NewValidationServiceError(err, "Invalid bill id"))
+		h.handleError(w, err)
 		return
 	}
 
-	err = h.MarkTabBillPaid(r.Context(), session, shopId, tabId, billId)
+	transfer, err := h.TransferTabOrder(r.Context(), session, shopId, tabId, orderId, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transfer)
+}
+
+func (h *Handler) handleCreateTabVouchers(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
+		return
+	}
+	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
+		return
+	}
+
+	data := models.VoucherBatchCreate{}
+	err = models.ReadRequestJson(r, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	vouchers, err := h.CreateTabVouchers(r.Context(), session, shopId, tabId, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(vouchers)
+}
+
+func (h *Handler) handleGetTabVouchers(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	// Query params
+	const formatKey = "format"
+	const formatCSV = "csv"
+
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
+		return
+	}
+	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
+		return
+	}
+
+	vouchers, err := h.GetTabVouchers(r.Context(), session, shopId, tabId)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	// CSV exports are intended for printing voucher codes
+	if r.URL.Query().Get(formatKey) == formatCSV {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"tab-%v-vouchers.csv\"", tabId))
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"code", "max_uses", "uses", "value_cap", "expires_at"})
+		for _, v := range vouchers {
+			valueCap := ""
+			if v.ValueCap != nil {
+				valueCap = v.ValueCap.String()
+			}
+			expiresAt := ""
+			if v.ExpiresAt != nil {
+				expiresAt = v.ExpiresAt.Format(time.RFC3339)
+			}
+			writer.Write([]string{v.Code, strconv.Itoa(v.MaxUses), strconv.Itoa(v.Uses), valueCap, expiresAt})
+		}
+		writer.Flush()
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(vouchers)
+}
+
+func (h *Handler) handleGetVerificationToken(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
+		return
+	}
+	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
+		return
+	}
+
+	token, err := h.GetVerificationToken(r.Context(), session, shopId, tabId)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(token)
+}
+
+func (h *Handler) handleGetVerificationQRCode(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	// Query params
+	const formatKey = "format"
+	const formatSVG = "svg"
+	const sizeKey = "size"
+	const defaultSize = 256
+	const maxSize = 1024
+
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
+		return
+	}
+	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
+		return
+	}
+
+	token, err := h.GetVerificationToken(r.Context(), session, shopId, tabId)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	rawParams := r.URL.Query()
+	var image []byte
+	contentType := "image/png"
+	if rawParams.Get(formatKey) == formatSVG {
+		contentType = "image/svg+xml"
+		image, err = util.QRCodeSVG(token.Token)
+	} else {
+		size := defaultSize
+		if s, err := strconv.Atoi(rawParams.Get(sizeKey)); err == nil && s >= 1 {
+			size = min(s, maxSize)
+		}
+		image, err = util.QRCodePNG(token.Token, size)
+	}
+	if err != nil {
+		h.handleError(w, services.NewInternalServiceError(err))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", contentType)
+	w.Write(image)
+}
+
+func (h *Handler) handleVerifyToken(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
+		return
+	}
+
+	data := models.VerificationTokenVerify{}
+	err = models.ReadRequestJson(r, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	result, err := h.VerifyToken(r.Context(), session, shopId, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func (h *Handler) handleUpdateTab(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
+		return
+	}
+
+	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
+		return
+	}
+
+	data := models.TabUpdate{}
+	err = models.ReadRequestJson(r, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	err = h.UpdateTab(r.Context(), session, shopId, tabId, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+}
+
+func (h *Handler) handleApproveTab(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
+		return
+	}
+
+	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
+		return
+	}
+
+	err = h.ApproveTab(r.Context(), session, shopId, tabId)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+}
+
+func (h *Handler) handleCloseTab(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
+		return
+	}
+
+	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
+		return
+	}
+
+	err = h.CloseTab(r.Context(), session, shopId, tabId)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+}
+
+func (h *Handler) handleAddOrderToTab(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
+		return
+	}
+
+	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
+		return
+	}
+
+	data := models.BillOrderCreate{}
+	err = models.ReadRequestJson(r, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	order, err := h.AddOrderToTab(r.Context(), session, shopId, tabId, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
+func (h *Handler) handleRemoveOrderFromTab(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
+		return
+	}
+
+	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
+		return
+	}
+
+	data := models.BillOrderCreate{}
+	err = models.ReadRequestJson(r, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	order, err := h.RemoveOrderFromTab(r.Context(), session, shopId, tabId, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
+func (h *Handler) handleCloseTabBill(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
+		return
+	}
+
+	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
+		return
+	}
+
+	billId, err := strconv.Atoi(r.PathValue(billIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid bill id"))
+		return
+	}
+
+	err = h.MarkTabBillPaid(r.Context(), session, shopId, tabId, billId)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+}
+
+func (h *Handler) handleApproveTabBill(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
+		return
+	}
+
+	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
+		return
+	}
+
+	billId, err := strconv.Atoi(r.PathValue(billIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid bill id"))
+		return
+	}
+
+	err = h.ApproveTabBill(r.Context(), session, shopId, tabId, billId)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+}
+
+func (h *Handler) handleDisputeTabBill(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
+		return
+	}
+
+	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
+		return
+	}
+
+	billId, err := strconv.Atoi(r.PathValue(billIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid bill id"))
+		return
+	}
+
+	data := models.BillCommentCreate{}
+	err = models.ReadRequestJson(r, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	comment, err := h.DisputeTabBill(r.Context(), session, shopId, tabId, billId, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comment)
+}
+
+func (h *Handler) handleResolveBillDispute(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
+		return
+	}
+
+	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
+		return
+	}
+
+	billId, err := strconv.Atoi(r.PathValue(billIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid bill id"))
+		return
+	}
+
+	data := models.BillDisputeResolve{}
+	err = models.ReadRequestJson(r, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	comment, err := h.ResolveBillDispute(r.Context(), session, shopId, tabId, billId, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comment)
+}
+
+func (h *Handler) handleGetBillComments(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
+		return
+	}
+
+	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
+		return
+	}
+
+	billId, err := strconv.Atoi(r.PathValue(billIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid bill id"))
+		return
+	}
+
+	comments, err := h.GetBillComments(r.Context(), session, shopId, tabId, billId)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comments)
+}
+
+func (h *Handler) handleAddBillComment(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
+		return
+	}
+
+	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
+		return
+	}
+
+	billId, err := strconv.Atoi(r.PathValue(billIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid bill id"))
+		return
+	}
+
+	data := models.BillCommentCreate{}
+	err = models.ReadRequestJson(r, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	comment, err := h.AddBillComment(r.Context(), session, shopId, tabId, billId, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comment)
+}
+
+func (h *Handler) handleCutTabBill(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
+		return
+	}
+
+	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
+		return
+	}
+
+	billId, err := strconv.Atoi(r.PathValue(billIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid bill id"))
+		return
+	}
+
+	data := models.BillCutoff{}
+	err = models.ReadRequestJson(r, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	bills, err := h.CutTabBill(r.Context(), session, shopId, tabId, billId, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bills)
+}
+
+func (h *Handler) handleGetBillPayments(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
+		return
+	}
+
+	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
+		return
+	}
+
+	billId, err := strconv.Atoi(r.PathValue(billIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid bill id"))
+		return
+	}
+
+	payments, err := h.GetBillPayments(r.Context(), session, shopId, tabId, billId)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payments)
+}
+
+func (h *Handler) handleGetBillInvoice(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
+		return
+	}
+
+	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
+		return
+	}
+
+	billId, err := strconv.Atoi(r.PathValue(billIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid bill id"))
+		return
+	}
+
+	invoice, err := h.GetBillInvoice(r.Context(), session, shopId, tabId, billId)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"invoice-%v-%v-%v.pdf\"", shopId, tabId, billId))
+	w.Write(invoice)
+}
+
+func (h *Handler) handleAddBillAdjustment(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
+		return
+	}
+
+	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
+		return
+	}
+
+	billId, err := strconv.Atoi(r.PathValue(billIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid bill id"))
+		return
+	}
+
+	data := models.BillAdjustmentCreate{}
+	err = models.ReadRequestJson(r, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	adjustment, err := h.AddBillAdjustment(r.Context(), session, shopId, tabId, billId, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(adjustment)
+}
+
+func (h *Handler) handleRemoveBillAdjustment(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
+		return
+	}
+
+	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
+		return
+	}
+
+	billId, err := strconv.Atoi(r.PathValue(billIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid bill id"))
+		return
+	}
+
+	adjustmentId, err := strconv.Atoi(r.PathValue(adjustmentIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid adjustment id"))
+		return
+	}
+
+	err = h.RemoveBillAdjustment(r.Context(), session, shopId, tabId, billId, adjustmentId)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+}
+
+func (h *Handler) handleRecordBillPayment(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
+		return
+	}
+
+	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
+		return
+	}
+
+	billId, err := strconv.Atoi(r.PathValue(billIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid bill id"))
+		return
+	}
+
+	data := models.BillPaymentCreate{}
+	err = models.ReadRequestJson(r, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	payment, err := h.RecordBillPayment(r.Context(), session, shopId, tabId, billId, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payment)
+}
+
+func (h *Handler) handleReverseBillPayment(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
+		return
+	}
+
+	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
+		return
+	}
+
+	billId, err := strconv.Atoi(r.PathValue(billIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid bill id"))
+		return
+	}
+
+	paymentId, err := strconv.Atoi(r.PathValue(paymentIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid payment id"))
+		return
+	}
+
+	data := models.BillPaymentReversalCreate{}
+	err = models.ReadRequestJson(r, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	payment, err := h.ReverseBillPayment(r.Context(), session, shopId, tabId, billId, paymentId, &data)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payment)
+}
+
+func (h *Handler) handleCreateBillCheckout(w http.ResponseWriter, r *http.Request, session *sessions.AuthedSession) {
+	shopId, err := strconv.Atoi(r.PathValue(shopIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid shop id"))
+		return
+	}
+
+	tabId, err := strconv.Atoi(r.PathValue(tabIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid tab id"))
+		return
+	}
+
+	billId, err := strconv.Atoi(r.PathValue(billIdParam))
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid bill id"))
+		return
+	}
+
+	checkout, err := h.CreateBillCheckout(r.Context(), session, shopId, tabId, billId)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(checkout)
+}
+
+func (h *Handler) handlePaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	event, err := h.payments.ParseWebhook(r)
+	if errors.Is(err, payments.ErrInvalidSignature) {
+		h.handleError(w, services.NewUnauthenticatedServiceError(err))
+		return
+	}
+	if err != nil {
+		h.handleError(w, services.NewValidationServiceError(err, "Invalid webhook event"))
+		return
+	}
+
+	err = h.HandlePaymentWebhook(r.Context(), event)
 	if err != nil {
 		h.handleError(w, err)
 		return
@@ -10,6 +10,8 @@ import (
 	"github.com/willtrojniak/TabAppBackend/services/auth"
 	"github.com/willtrojniak/TabAppBackend/services/authorization"
 	"github.com/willtrojniak/TabAppBackend/services/events"
+	"github.com/willtrojniak/TabAppBackend/services/idempotency"
+	"github.com/willtrojniak/TabAppBackend/services/payments"
 	"github.com/willtrojniak/TabAppBackend/services/sessions"
 )
 
@@ -18,17 +20,23 @@ type Handler struct {
 	store           *db.PgxStore
 	auth            *auth.Handler
 	sessions        *sessions.Handler
+	idempotency     *idempotency.Handler
 	eventDispatcher *events.EventDispatcher
+	payments        payments.PaymentProvider // Nil value indicates online payments are disabled
+	verificationKey []byte                   // Signs verification tokens
 	handleError     services.HTTPErrorHandler
 }
 
-func NewHandler(store *db.PgxStore, auth *auth.Handler, sessions *sessions.Handler, eventDispatcher *events.EventDispatcher, handleError services.HTTPErrorHandler, logger *slog.Logger) *Handler {
+func NewHandler(store *db.PgxStore, auth *auth.Handler, sessions *sessions.Handler, idempotency *idempotency.Handler, eventDispatcher *events.EventDispatcher, payments payments.PaymentProvider, verificationKey []byte, handleError services.HTTPErrorHandler, logger *slog.Logger) *Handler {
 	return &Handler{
 		logger:          logger,
 		auth:            auth,
 		sessions:        sessions,
+		idempotency:     idempotency,
 		store:           store,
 		eventDispatcher: eventDispatcher,
+		payments:        payments,
+		verificationKey: verificationKey,
 		handleError:     handleError,
 	}
 }
@@ -114,6 +122,19 @@ func (h *Handler) UpdateShop(ctx context.Context, session *sessions.AuthedSessio
 	})
 }
 
+func (h *Handler) UpdateShopSettings(ctx context.Context, session *sessions.AuthedSession, shopId int, data *models.ShopSettingsUpdate) error {
+	h.logger.Debug("Updating Shop Settings", "id", shopId)
+
+	err := models.ValidateData(data, h.logger)
+	if err != nil {
+		return err
+	}
+
+	return WithAuthorizeShopAction(ctx, h.store, session, shopId, authorization.SHOP_ACTION_UPDATE_SETTINGS, func(pq *db.PgxQueries, _ *models.User, _ *models.Shop) error {
+		return pq.UpdateShopSettings(ctx, shopId, data)
+	})
+}
+
 func (h *Handler) DeleteShop(ctx context.Context, session *sessions.AuthedSession, shopId int) error {
 	return WithAuthorizeShopAction(ctx, h.store, session, shopId, authorization.SHOP_ACTION_DELETE, func(pq *db.PgxQueries, _ *models.User, _ *models.Shop) error {
 		return pq.DeleteShop(ctx, shopId)
@@ -2,6 +2,7 @@ package shop
 
 import (
 	"context"
+	"errors"
 	"reflect"
 
 	"github.com/willtrojniak/TabAppBackend/db"
@@ -23,6 +24,16 @@ func (h *Handler) CreateTab(ctx context.Context, session *sessions.AuthedSession
 		// By default the tab status is pending, unless it is created by user with role
 		status := models.TAB_STATUS_PENDING
 
+		err := shop.ApplyCurrency(data)
+		if err != nil {
+			return err
+		}
+
+		err = data.ValidatePaymentDetails(shop)
+		if err != nil {
+			return err
+		}
+
 		// Check if the user has permission to create/manage tabs
 		if ok, err := authorization.AuthorizeShopAction(user, shop, authorization.SHOP_ACTION_CREATE_TAB); err == nil && ok {
 			status = models.TAB_STATUS_CONFIRMED
@@ -57,6 +68,11 @@ func (h *Handler) UpdateTab(ctx context.Context, session *sessions.AuthedSession
 
 	h.logger.Debug("Shop.UpdateTab")
 	return WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_REQUEST_UPDATE, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		err := shop.ApplyCurrency(data)
+		if err != nil {
+			return err
+		}
+
 		tabLocationIds := make([]uint, 0)
 		for _, location := range tab.Locations {
 			tabLocationIds = append(tabLocationIds, location.Id)
@@ -64,19 +80,27 @@ func (h *Handler) UpdateTab(ctx context.Context, session *sessions.AuthedSession
 		h.logger.Debug("Shop.UpdateTab Authorized Request")
 
 		// Check if the 'updates' are unchanged from current tab
-		if reflect.DeepEqual(tab.TabBase, data.TabBase) && reflect.DeepEqual(tab.VerificationList, data.VerificationList) && reflect.DeepEqual(tabLocationIds, data.LocationIds) {
+		if reflect.DeepEqual(tab.TabBase, data.TabBase) && reflect.DeepEqual(tab.VerificationList, data.VerificationList) && reflect.DeepEqual(tabLocationIds, data.LocationIds) && models.SameAllocations(tab.Allocations, data.Allocations) {
 			return nil
 		}
 
+		// Payment details already on the tab are not revalidated against methods or formats the shop has since changed
+		if tab.PaymentMethod != data.PaymentMethod || tab.PaymentDetails != data.PaymentDetails || !models.SameAllocations(tab.Allocations, data.Allocations) {
+			err := data.ValidatePaymentDetails(shop)
+			if err != nil {
+				return err
+			}
+		}
+
 		// Next, check if have permission to update the tab directly
 		if ok, err := authorization.AuthorizeTabAction(user, &authorization.TabTarget{Tab: tab, Shop: shop}, authorization.TAB_ACTION_UPDATE); err == nil && ok {
 			h.logger.Debug("Shop.UpdateTab Authorized Direct Update")
-			return pq.UpdateTab(ctx, shopId, tabId, data)
+			return pq.UpdateTab(ctx, shopId, tabId, data, shop.Today())
 		}
 
 		// Otherwise:
 		// Check if part of the tab data has changed and request updates
-		if !(reflect.DeepEqual(tab.TabBase, data.TabBase)) || !reflect.DeepEqual(tabLocationIds, data.LocationIds) {
+		if !(reflect.DeepEqual(tab.TabBase, data.TabBase)) || !reflect.DeepEqual(tabLocationIds, data.LocationIds) || !models.SameAllocations(tab.Allocations, data.Allocations) {
 			h.logger.Debug("Shop.UpdateTab One")
 			err = pq.SetTabUpdates(ctx, shopId, tabId, data)
 		} else {
@@ -110,7 +134,7 @@ func (h *Handler) ApproveTab(ctx context.Context, session *sessions.AuthedSessio
 			return services.NewDataConflictServiceError(nil)
 		}
 
-		err := pq.ApproveTab(ctx, shopId, tabId)
+		err := pq.ApproveTab(ctx, shopId, tabId, shop.Today())
 		if err != nil {
 			return err
 		}
@@ -146,33 +170,39 @@ func (h *Handler) CloseTab(ctx context.Context, session *sessions.AuthedSession,
 	})
 }
 
-func (h *Handler) MarkTabBillPaid(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int, billId int) error {
-	return WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_CLOSE_BILL, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
-		err := pq.MarkTabBillPaid(ctx, shopId, tabId, billId)
-		if err != nil {
-			return err
+// Ends the bill early, defaulting to today, and starts the next billing period on the following day
+func (h *Handler) CutTabBill(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int, billId int, data *models.BillCutoff) (bills []models.Bill, err error) {
+	err = models.ValidateData(data, h.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	err = WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_CUT_BILL, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		today := shop.Today()
+		endDate := today
+		if data.EndDate != nil {
+			endDate = *data.EndDate
 		}
 
-		tab, err = pq.GetTabById(ctx, shopId, tabId)
+		err := pq.CutTabBill(ctx, tab, billId, endDate, today)
 		if err != nil {
 			return err
 		}
 
-		owner, err := pq.GetUser(ctx, tab.OwnerId)
+		// Payments already recorded may cover the bill once it has closed
+		err = h.dispatchBillSettled(ctx, pq, shop, tab, billId)
 		if err != nil {
 			return err
 		}
 
-		var bill *models.Bill
-		for _, b := range tab.Bills {
-			if b.Id == billId {
-				bill = &b
-			}
+		updated, err := pq.GetTabById(ctx, shopId, tabId)
+		if err != nil {
+			return err
 		}
-
-		events.Dispatch(h.eventDispatcher, events.TabBillPaidEvent{Shop: shop, Tab: tab, Bill: bill, TabOwner: owner})
+		bills = updated.Bills
 		return nil
 	})
+	return bills, err
 }
 
 func (h *Handler) GetTabsForUser(ctx context.Context, session *sessions.AuthedSession, userId string) (tabs []models.TabOverview, err error) {
@@ -206,27 +236,184 @@ func (h *Handler) GetTabById(ctx context.Context, session *sessions.AuthedSessio
 	return t, err
 }
 
-func (h *Handler) AddOrderToTab(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int, data *models.BillOrderCreate) error {
-	err := models.ValidateData(data, h.logger)
+func (h *Handler) GetTabBudget(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int) (budget *models.TabBudget, err error) {
+	err = WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_READ, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		b, err := tab.Budget(shop.Today())
+		if err != nil {
+			return err
+		}
+		budget = &b
+		return nil
+	})
+	return budget, err
+}
+
+func (h *Handler) SetTabLimitRules(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int, data *models.TabLimitRulesUpdate) (rules []models.TabLimitRule, err error) {
+	err = models.ValidateData(data, h.logger)
 	if err != nil {
+		return nil, err
+	}
+
+	err = WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_SET_LIMIT_RULES, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		err := shop.ApplyCurrency(data)
+		if err != nil {
+			return err
+		}
+
+		err = pq.SetTabLimitRules(ctx, shopId, tabId, data.Rules)
+		if err != nil {
+			return err
+		}
+
+		updated, err := pq.GetTabById(ctx, shopId, tabId)
+		if err != nil {
+			return err
+		}
+		rules = updated.LimitRules
+		return nil
+	})
+	return rules, err
+}
+
+func (h *Handler) GetTabOrders(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int, params *models.GetOrdersQueryParams) (orders []models.Order, err error) {
+	err = WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_READ, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		orders, err = pq.GetTabOrders(ctx, shopId, tabId, params)
 		return err
+	})
+	return orders, err
+}
+
+func (h *Handler) AddOrderToTab(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int, data *models.BillOrderCreate) (order *models.Order, err error) {
+	err = models.ValidateData(data, h.logger)
+	if err != nil {
+		return nil, err
 	}
 
-	return WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_ADD_ORDER, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
-		return pq.AddOrderToTab(ctx, shopId, tabId, data)
+	// Orders outside of the tab's schedule require an explicit override
+	action := authorization.TAB_ACTION_ADD_ORDER
+	if data.ScheduleOverride {
+		action = authorization.TAB_ACTION_OVERRIDE_SCHEDULE
+	}
+
+	err = WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, action, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		err := tab.ValidateOrderTime(shop.Now(), data.ScheduleOverride)
+		if err != nil {
+			return err
+		}
+		err = tab.ValidateLocation(data.LocationId)
+		if err != nil {
+			return err
+		}
+		err = tab.ValidateOrderer(data)
+		if err != nil {
+			return err
+		}
+
+		orderId, err := pq.AddOrderToTab(ctx, shopId, tabId, user.Id, shop.Now(), data)
+		if err != nil {
+			return err
+		}
+
+		order, err = pq.GetTabOrderById(ctx, shopId, tabId, orderId)
+		return err
 	})
+	return order, err
 }
 
-func (h *Handler) RemoveOrderFromTab(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int, data *models.BillOrderCreate) error {
-	err := models.ValidateData(data, h.logger)
+func (h *Handler) RemoveOrderFromTab(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int, data *models.BillOrderCreate) (order *models.Order, err error) {
+	err = models.ValidateData(data, h.logger)
 	if err != nil {
+		return nil, err
+	}
+
+	action := authorization.TAB_ACTION_REMOVE_ORDER
+	if data.ScheduleOverride {
+		action = authorization.TAB_ACTION_OVERRIDE_SCHEDULE
+	}
+
+	err = WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, action, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		// Managers may correct orders on tabs which are no longer accepting them
+		if !authorization.HasRole(user, shop, authorization.ROLE_SHOP_MANAGE_ORDERS|authorization.ROLE_SHOP_MANAGE_TABS) {
+			err := tab.ValidateOrderTime(shop.Now(), data.ScheduleOverride)
+			if err != nil {
+				return err
+			}
+		}
+		err := tab.ValidateLocation(data.LocationId)
+		if err != nil {
+			return err
+		}
+		// Removals are not required to identify a person, but any identity given must be valid for the tab
+		if data.OrderedByEmail != nil {
+			err = tab.ValidateOrderer(data)
+			if err != nil {
+				return err
+			}
+		}
+
+		orderId, err := pq.RemoveOrderFromTab(ctx, shopId, tabId, user.Id, shop.Now(), data)
+		if err != nil {
+			return err
+		}
+
+		order, err = pq.GetTabOrderById(ctx, shopId, tabId, orderId)
 		return err
+	})
+	return order, err
+}
+
+func (h *Handler) VoidTabOrder(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int, orderId int, data *models.OrderVoidCreate) (order *models.Order, err error) {
+	err = models.ValidateData(data, h.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// Orders on paid bills may only be voided with an explicit override
+	action := authorization.TAB_ACTION_VOID_ORDER
+	if data.PaidBillOverride {
+		action = authorization.TAB_ACTION_VOID_PAID_ORDER
 	}
 
-	return WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_REMOVE_ORDER, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
-		return pq.RemoveOrderFromTab(ctx, shopId, tabId, data)
+	err = WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, action, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		order, err = pq.GetTabOrderById(ctx, shopId, tabId, orderId)
+		if err != nil {
+			return err
+		}
+
+		for _, b := range tab.Bills {
+			if b.Id == order.BillId && b.IsPaid && !data.PaidBillOverride {
+				return services.NewValidationServiceError(errors.New("Bill has already been paid"), services.ValidationErrors{
+					"paid_bill_override": services.ValidationError{Value: data.PaidBillOverride, Error: "required"},
+				})
+			}
+		}
+
+		err = pq.VoidTabOrder(ctx, shopId, tabId, orderId, user.Id, data, shop.Today())
+		if err != nil {
+			return err
+		}
+
+		order, err = pq.GetTabOrderById(ctx, shopId, tabId, orderId)
+		if err != nil {
+			return err
+		}
+
+		err = h.dispatchBillSettled(ctx, pq, shop, tab, order.BillId)
+		if err != nil {
+			return err
+		}
+
+		// The voided bill reports whether its payments now exceed its total
+		voided, err := pq.GetTabById(ctx, shopId, tabId)
+		if err != nil {
+			return err
+		}
+		events.Dispatch(h.eventDispatcher, events.OrderVoidedEvent{Order: order, Bill: findBill(voided, order.BillId), Tab: voided, Shop: shop})
+		return nil
 	})
+	return order, err
 }
+
 func WithAuthorizeTabAction(ctx context.Context, conn db.PgxConn, session *sessions.AuthedSession, shopId int, tabId int, action authorization.Action, fn func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error) error {
 	return db.WithTx(ctx, conn, func(pq *db.PgxQueries) error {
 		user, err := pq.GetUser(ctx, session.UserId)
@@ -0,0 +1,81 @@
+package shop
+
+import (
+	"context"
+	"errors"
+
+	"github.com/willtrojniak/TabAppBackend/db"
+	"github.com/willtrojniak/TabAppBackend/models"
+	"github.com/willtrojniak/TabAppBackend/services"
+	"github.com/willtrojniak/TabAppBackend/services/authorization"
+	"github.com/willtrojniak/TabAppBackend/services/sessions"
+)
+
+// Moves lines of the order to another bill of the tab or to a bill of another tab in the shop,
+// keeping the time and bill period of the original order
+func (h *Handler) TransferTabOrder(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int, orderId int, data *models.OrderTransferCreate) (transfer *models.OrderTransfer, err error) {
+	err = models.ValidateData(data, h.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	err = WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_TRANSFER_ORDER, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		order, err := pq.GetTabOrderById(ctx, shopId, tabId, orderId)
+		if err != nil {
+			return err
+		}
+		lines, err := order.TransferLines(data)
+		if err != nil {
+			return err
+		}
+
+		target := tab
+		if data.TargetTabId != tab.Id {
+			target, err = pq.GetTabById(ctx, shopId, data.TargetTabId)
+			if err != nil {
+				return err
+			}
+			if ok, err := authorization.AuthorizeTabAction(user, &authorization.TabTarget{Shop: shop, Tab: target}, authorization.TAB_ACTION_TRANSFER_ORDER); err != nil {
+				return err
+			} else if !ok {
+				return services.NewUnauthorizedServiceError(nil)
+			}
+		}
+
+		// The lines must be valid for the target tab at the time they were originally ordered
+		at := order.CreatedAt.In(shop.Location())
+		if !order.ScheduleOverride {
+			if violation := target.CheckActiveAt(at); violation != models.SCHEDULE_VIOLATION_NONE {
+				return services.NewValidationServiceError(errors.New("Order is outside of the target tab's schedule"), services.ValidationErrors{
+					"target_tab_id": services.ValidationError{Value: data.TargetTabId, Error: string(violation)},
+				})
+			}
+		}
+
+		targetOrder := order.TransferOrder(data, lines)
+		if order.LocationId != nil {
+			err = target.ValidateLocation(targetOrder.LocationId)
+			if err != nil {
+				return err
+			}
+		}
+		err = target.ValidateOrderer(targetOrder)
+		if err != nil {
+			return err
+		}
+
+		transferId, err := pq.TransferTabOrder(ctx, tab, target, order, lines, targetOrder, user.Id, data, at, shop.Today())
+		if err != nil {
+			return err
+		}
+
+		transfer, err = pq.GetOrderTransferById(ctx, shopId, transferId)
+		if err != nil {
+			return err
+		}
+
+		// The source bill's payments may now cover its reduced total
+		return h.dispatchBillSettled(ctx, pq, shop, tab, order.BillId)
+	})
+	return transfer, err
+}
@@ -0,0 +1,58 @@
+package shop
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/willtrojniak/TabAppBackend/db"
+	"github.com/willtrojniak/TabAppBackend/models"
+	"github.com/willtrojniak/TabAppBackend/services"
+	"github.com/willtrojniak/TabAppBackend/services/authorization"
+	"github.com/willtrojniak/TabAppBackend/services/sessions"
+)
+
+// Issues a short-lived token identifying the session user as a member of the tab
+func (h *Handler) GetVerificationToken(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int) (token *models.VerificationToken, err error) {
+	err = WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_GET_VERIFICATION, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		email, _ := tab.VerificationMember(user.Email)
+		token, err = models.NewVerificationToken(shopId, tabId, email, h.verificationKey, time.Now())
+		return err
+	})
+	return token, err
+}
+
+func (h *Handler) VerifyToken(ctx context.Context, session *sessions.AuthedSession, shopId int, data *models.VerificationTokenVerify) (result *models.VerificationResult, err error) {
+	err = models.ValidateData(data, h.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := models.ParseVerificationToken(data.Token, h.verificationKey, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if claims.ShopId != shopId {
+		return nil, services.NewValidationServiceError(errors.New("Verification token is for a different shop"), services.ValidationErrors{
+			"token": services.ValidationError{Value: nil, Error: "invalid"},
+		})
+	}
+
+	err = WithAuthorizeTabAction(ctx, h.store, session, shopId, claims.TabId, authorization.TAB_ACTION_VERIFY_MEMBER, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		// Members removed from the tab after the token was issued are no longer verified
+		email, ok := tab.VerificationMember(claims.Email)
+		if !ok {
+			return services.NewValidationServiceError(errors.New("Member is no longer on the tab's verification list"), services.ValidationErrors{
+				"token": services.ValidationError{Value: nil, Error: "invalid"},
+			})
+		}
+
+		result = &models.VerificationResult{
+			Tab:      tab.TabOverview,
+			Email:    email,
+			IsActive: tab.IsActiveAt(shop.Now()),
+		}
+		return nil
+	})
+	return result, err
+}
@@ -0,0 +1,46 @@
+package shop
+
+import (
+	"context"
+
+	"github.com/willtrojniak/TabAppBackend/db"
+	"github.com/willtrojniak/TabAppBackend/models"
+	"github.com/willtrojniak/TabAppBackend/services"
+	"github.com/willtrojniak/TabAppBackend/services/authorization"
+	"github.com/willtrojniak/TabAppBackend/services/sessions"
+	"github.com/willtrojniak/TabAppBackend/util"
+)
+
+func (h *Handler) CreateTabVouchers(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int, data *models.VoucherBatchCreate) (vouchers []models.Voucher, err error) {
+	err = models.ValidateData(data, h.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, data.Count)
+	for i := range codes {
+		codes[i], err = util.RandCode(models.VoucherCodeLength)
+		if err != nil {
+			return nil, services.NewInternalServiceError(err)
+		}
+	}
+
+	err = WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_CREATE_VOUCHERS, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		err := shop.ApplyCurrency(data)
+		if err != nil {
+			return err
+		}
+
+		vouchers, err = pq.CreateTabVouchers(ctx, shopId, tabId, user.Id, codes, data)
+		return err
+	})
+	return vouchers, err
+}
+
+func (h *Handler) GetTabVouchers(ctx context.Context, session *sessions.AuthedSession, shopId int, tabId int) (vouchers []models.Voucher, err error) {
+	err = WithAuthorizeTabAction(ctx, h.store, session, shopId, tabId, authorization.TAB_ACTION_READ, func(pq *db.PgxQueries, user *models.User, shop *models.Shop, tab *models.Tab) error {
+		vouchers, err = pq.GetTabVouchers(ctx, shopId, tabId)
+		return err
+	})
+	return vouchers, err
+}
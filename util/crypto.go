@@ -3,7 +3,9 @@ package util
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
 	"io"
@@ -56,3 +58,27 @@ func Decrypt(b64ciphertext string, key []byte) ([]byte, error) {
 	}
 	return plaintext, nil
 }
+
+// Derives a key for the purpose from the secret with HMAC-SHA256, so that keys for different purposes are independent
+func DeriveKey(secret []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// Signs the message with HMAC-SHA256, returning the URL safe base64 signature
+func Sign(message []byte, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(message)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func VerifySignature(message []byte, signature string, key []byte) bool {
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(message)
+	return hmac.Equal(sig, mac.Sum(nil))
+}